@@ -6,6 +6,15 @@ if [[ "${TARGET}" == "" ]]; then
     TARGET=$(go env GOOS)
 fi
 
+# address of the key which signs the transparency log of the production PGP service, the default of -pgpLogAddress
+PGP_LOG_ADDRESS="$(printenv PGP_LOG_ADDRESS || true)"
+LDFLAGS=""
+if [[ "${PGP_LOG_ADDRESS}" == "" ]]; then
+    echo "WARNING: PGP_LOG_ADDRESS isn't set, the dapp won't verify the keys of the PGP service unless started with -pgpLogAddress"
+else
+    LDFLAGS="-ldflags X:github.com/ProxeusApp/storage-app/spp/config.DefaultPGPLogAddress=${PGP_LOG_ADDRESS}"
+fi
+
 echo "Building for target "${TARGET}"..."
 echo "Bundling electron..."
 
@@ -15,5 +24,5 @@ echo "Bundling electron..."
         # attach bindata with js code
         go get -u github.com/asticode/go-bindata/...
         go generate ./dapp
-        cd dapp && astilectron-bundler -c bundler_"${TARGET}".json
+        cd dapp && astilectron-bundler -c bundler_"${TARGET}".json ${LDFLAGS}
      "
@@ -333,7 +333,7 @@ func MainApi(e *echo.Echo) (*channelhub.ChannelHub, *core.App) {
 		reg.FileReader = f
 		reg.DurationDays = fileUploadRequest.Register.DurationDays
 
-		_, err = app.ArchiveFileAndRegister(reg, nil, 0, fileUploadRequest.ProviderInfo, recipients)
+		_, err = app.ArchiveFileAndRegister(reg, nil, 0, fileUploadRequest.ProviderInfo, fileUploadRequest.ReplicaProviders, recipients)
 		if err != nil {
 			if os.IsPermission(err) {
 				return c.JSON(http.StatusUnauthorized, err.Error())
@@ -368,6 +368,8 @@ func MainApi(e *echo.Echo) (*channelhub.ChannelHub, *core.App) {
 	jsonApi.POST("/file/new/estimateGas", endpoints.NewFileEstimateGas)
 	jsonApi.POST("/file/new", endpoints.NewFile)
 	jsonApi.POST("/file/quote", endpoints.FileQuote)
+	jsonApi.GET("/file/renew/quote/:fileHash", endpoints.FileRenewQuote)
+	jsonApi.POST("/file/renew/:fileHash", endpoints.FileRenew)
 
 	jsonApi.GET("/isUnlocked", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, app.HasActiveAndUnlockedAccount())
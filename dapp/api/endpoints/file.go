@@ -7,6 +7,7 @@ import (
 	"math/big"
 	"net/http"
 	"os"
+	"reflect"
 	"strconv"
 
 	"github.com/labstack/echo"
@@ -23,6 +24,7 @@ type (
 		DefinedSignerList     []account.AddressBookEntry
 		UndefinedSignersCount int64
 		ProviderInfo          models.StorageProviderInfo
+		ReplicaProviders      []models.StorageProviderInfo // Providers the file is replicated to by ProviderInfo
 		XesAmount             *big.Int
 	}
 )
@@ -253,7 +255,7 @@ func NewFileEstimateGas(c echo.Context) error {
 	}
 
 	gasEstimate, err := App.RegisterFileEstimateGas(fileUploadRequest.Register, fileUploadRequest.DefinedSignerList,
-		fileUploadRequest.UndefinedSignersCount, fileUploadRequest.ProviderInfo)
+		fileUploadRequest.UndefinedSignersCount, fileUploadRequest.ProviderInfo, fileUploadRequest.ReplicaProviders)
 	if err != nil {
 		log.Print("couldn't estimate gas for new file ", err)
 		return c.JSON(http.StatusBadRequest, err.Error())
@@ -268,12 +270,12 @@ func NewFile(c echo.Context) error {
 		log.Print("new file error ", err)
 		return c.JSON(http.StatusBadRequest, err.Error())
 	}
-	if fileUploadRequest.ProviderInfo == (models.StorageProviderInfo{}) {
+	if reflect.DeepEqual(fileUploadRequest.ProviderInfo, models.StorageProviderInfo{}) {
 		return c.JSON(http.StatusBadRequest, ErrNoSppSelected.Error())
 	}
 
 	fileHash, err := App.ArchiveFileAndRegister(fileUploadRequest.Register, fileUploadRequest.DefinedSignerList,
-		fileUploadRequest.UndefinedSignersCount, fileUploadRequest.ProviderInfo, nil)
+		fileUploadRequest.UndefinedSignersCount, fileUploadRequest.ProviderInfo, fileUploadRequest.ReplicaProviders, nil)
 	if err != nil {
 		if os.IsPermission(err) {
 			return c.JSON(http.StatusUnauthorized, err.Error())
@@ -311,6 +313,34 @@ func FileQuote(c echo.Context) error {
 	return c.JSON(http.StatusOK, quote)
 }
 
+// Returns the price of keeping a file the days given in the duration query param longer
+func FileRenewQuote(c echo.Context) error {
+	duration, err := strconv.Atoi(c.QueryParam("duration"))
+	if err != nil || duration < 1 {
+		return c.JSON(http.StatusBadRequest, ErrDurationOutOfRange.Error())
+	}
+	quote, err := App.RenewalQuote(c.Param("fileHash"), duration)
+	if err != nil {
+		log.Println("[endpoints][file][FileRenewQuote] ", err)
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, quote)
+}
+
+// Pays for and requests keeping a file the days given in the duration query param longer
+func FileRenew(c echo.Context) error {
+	duration, err := strconv.Atoi(c.QueryParam("duration"))
+	if err != nil || duration < 1 {
+		return c.JSON(http.StatusBadRequest, ErrDurationOutOfRange.Error())
+	}
+	txHash, err := App.RenewFile(c.Param("fileHash"), duration)
+	if err != nil {
+		log.Println("[endpoints][file][FileRenew] ", err)
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, txHash)
+}
+
 var ErrNoSppSelected = errors.New("no service provider selected")
 var ErrDurationOutOfRange = errors.New("duration out of range")
 var ErrDurationNegative = errors.New("duration negative")
@@ -357,7 +387,23 @@ func ParseFileUpload(c echo.Context) (FileUploadRequest, error) {
 		fileUploadRequest.ProviderInfo = providerInfo
 	}
 
-	log.Printf("[endpoints.file][ParseFileUpload] spp name: %s | address: %s | file defined signers count: %d", providerInfo.Name, providerInfo.Address, len(definedSignerList))
+	replicaAddressesForm := form.Value["replicaProviderAddresses"]
+	if len(replicaAddressesForm) > 0 {
+		var replicaAddresses []string
+		if err = json.Unmarshal([]byte(replicaAddressesForm[0]), &replicaAddresses); err != nil {
+			return fileUploadRequest, err
+		}
+		for _, replicaAddress := range replicaAddresses {
+			replicaInfo, err := App.GetStorageProvider(replicaAddress)
+			if err != nil {
+				return fileUploadRequest, err
+			}
+			fileUploadRequest.ReplicaProviders = append(fileUploadRequest.ReplicaProviders, replicaInfo)
+		}
+	}
+
+	log.Printf("[endpoints.file][ParseFileUpload] spp name: %s | address: %s | replicas: %d | file defined signers count: %d",
+		providerInfo.Name, providerInfo.Address, len(fileUploadRequest.ReplicaProviders), len(definedSignerList))
 
 	reg := file.Register{}
 	files := form.File["file"]
@@ -27,6 +27,8 @@ type (
 	Config struct {
 		StorageDir              string
 		PGPServiceURL           string
+		PGPLogAddress           string // Signer of the transparency log of the PGP service
+		PGPLogTrustFirst        bool   // Pins the first seen signer if PGPLogAddress is empty, for development only
 		FileSuffix              string
 		pgpPublicKeyAddListener func(ac *Account)
 	}
@@ -360,6 +362,23 @@ func (me *Account) SignWithETH(msg []byte) ([]byte, error) {
 	return []byte("0x" + hex.EncodeToString(buf.Bytes())), err
 }
 
+// Signs a 32 byte digest as is, like the EIP-712 hash of a grant, and returns the hex encoded signature with v of 27 or 28
+func (me *Account) SignHash(digest []byte) (string, error) {
+	if !me.unlocked {
+		return "", ErrAccountLocked
+	}
+	ecdsaPriv, err := crypto.HexToECDSA(string(me.kpETH.Priv))
+	if err != nil {
+		return "", err
+	}
+	signature, err := crypto.Sign(digest, ecdsaPriv)
+	if err != nil {
+		return "", err
+	}
+	signature[64] += 27
+	return "0x" + hex.EncodeToString(signature), nil
+}
+
 func (me *Account) VerifyWithETH(msg, sig []byte) (bool, error) {
 	var (
 		challenge []byte
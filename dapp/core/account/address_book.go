@@ -14,6 +14,7 @@ import (
 	"github.com/ProxeusApp/pgp"
 
 	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/crypto/openpgp"
 
 	"github.com/ProxeusApp/storage-app/dapp/core/account/pgpService"
 	"github.com/ProxeusApp/storage-app/dapp/core/embdb"
@@ -94,6 +95,10 @@ func (me *AddressBook) List(ethAddr string) ([]AddressBookEntry, error) {
 				ETHAddress:              abe.ETHAddress,
 				PGPPublicKey:            abe.PGPPublicKey,
 				ValidatedWithPGPService: abe.ValidatedWithPGPService,
+				PGPKeyChanged:           abe.PGPKeyChanged,
+				ChangedPGPPublicKey:     abe.ChangedPGPPublicKey,
+				PGPKeyRevoked:           abe.PGPKeyRevoked,
+				PGPKeyUnverified:        abe.PGPKeyUnverified,
 			})
 		}
 	}
@@ -104,48 +109,114 @@ func (me *AddressBook) List(ethAddr string) ([]AddressBookEntry, error) {
 
 func (me *AddressBook) syncValidatedWithPGPService() {
 	me.rwLoadLock.RLock()
+	abes := make([]*AddressBookEntry, 0, len(me.book))
 	for _, abe := range me.book {
-		me.syncValidatedWithPGPServiceEntry(abe)
+		abes = append(abes, abe)
 	}
+	me.syncWithPGPService(abes)
 	me.rwLoadLock.RUnlock()
 }
 
 func (me *AddressBook) syncValidatedWithPGPServiceEntry(abe *AddressBookEntry) {
-	if abe == nil {
+	me.syncWithPGPService([]*AddressBookEntry{abe})
+}
+
+// Looks up the keys of the entries which are due for a check with one batch request, rwLoadLock must be read locked
+func (me *AddressBook) syncWithPGPService(abes []*AddressBookEntry) {
+	now := time.Now()
+	var due []*AddressBookEntry
+	var ethAddrs []string
+	for _, abe := range abes {
+		if abe != nil && now.After(abe.lastPGPServiceCheck.Add(time.Minute*3)) {
+			due = append(due, abe)
+			ethAddrs = append(ethAddrs, abe.ETHAddress)
+		}
+	}
+	if len(due) == 0 {
 		return
 	}
-	now := time.Now()
-	if !abe.ValidatedWithPGPService && now.After(abe.lastPGPServiceCheck.Add(time.Minute*3)) {
-		pgpPublicKey, err := me.pgpServiceClient.Lookup(abe.ETHAddress)
-		if err == nil && len(pgpPublicKey) > 0 {
-			if abe.PGPPublicKey == pgpPublicKey {
-				log.Printf("PGP received the same public key from %s with address %s -> updating the validate flag", me.pgpServiceClient.GetURL(), abe.ETHAddress)
-				me.rwLoadLock.RUnlock()
-				me.rwLoadLock.Lock()
-				abe.ValidatedWithPGPService = true
-				//to ensure they are not synced at once to spread the pgp service load
-				abe.lastPGPServiceCheck = time.Now().Add(time.Minute * time.Duration(me.rndBetween(20, 200)))
-				me.rwLoadLock.Unlock()
-				me.rwLoadLock.RLock()
-			} else {
-				if pgp.ValidatePublicKey([]byte(pgpPublicKey)) {
-					log.Printf("PGP received a valid public key from %s with address %s -> adding it to our book", me.pgpServiceClient.GetURL(), abe.ETHAddress)
-					me.rwLoadLock.RUnlock()
-					me.rwLoadLock.Lock()
-					abe.PGPPublicKey = pgpPublicKey
-					abe.ValidatedWithPGPService = true
-					//to ensure they are not synced at once to spread the pgp service load
-					abe.lastPGPServiceCheck = time.Now().Add(time.Minute * time.Duration(me.rndBetween(60, 200)))
-					me.rwLoadLock.Unlock()
-					me.rwLoadLock.RLock()
-				} else {
-					log.Printf("PGP received an invalid public key from %s with address %s", me.pgpServiceClient.GetURL(), abe.ETHAddress)
-				}
+	keys, err := me.pgpServiceClient.LookupMany(ethAddrs)
+	for _, abe := range due {
+		pgpPublicKey, ok := keys[strings.ToLower(abe.ETHAddress)]
+		if !ok && err == nil {
+			me.applyPGPServiceKey(abe, "", os.ErrNotExist)
+			continue
+		}
+		me.applyPGPServiceKey(abe, pgpPublicKey, err)
+	}
+}
+
+/*
+	Checks the key of the entry with the one of the PGP service, the validated ones again once their next check is due.
+	A key is only taken from the PGP service if the entry has none yet. If the service serves another key, the known key
+	is kept and the change is flagged until the contact is updated with the new key, as it could have been replaced by
+	someone else.
+*/
+func (me *AddressBook) applyPGPServiceKey(abe *AddressBookEntry, pgpPublicKey string, err error) {
+	if len(pgpPublicKey) == 0 {
+		log.Printf("PGP service request error: %s %s [%s] size of the PGP public key %d", me.pgpServiceClient.GetURL(), abe.ETHAddress, err, len(pgpPublicKey))
+		return
+	}
+	if !pgp.ValidatePublicKey([]byte(pgpPublicKey)) {
+		log.Printf("PGP received an invalid public key from %s with address %s", me.pgpServiceClient.GetURL(), abe.ETHAddress)
+		return
+	}
+	revoked := isRevokedPGPKey(pgpPublicKey)
+	if revoked && !abe.PGPKeyRevoked {
+		log.Printf("WARNING: PGP received a revoked public key from %s with address %s", me.pgpServiceClient.GetURL(), abe.ETHAddress)
+	}
+	// an unverified key is used, but not flagged as validated
+	unverified := err == pgpService.ErrNoLogAddress
+	if unverified && !abe.PGPKeyUnverified {
+		log.Printf("WARNING: PGP received a public key from %s with address %s which isn't verified with the transparency log", me.pgpServiceClient.GetURL(), abe.ETHAddress)
+	}
+	me.rwLoadLock.RUnlock()
+	me.rwLoadLock.Lock()
+	switch {
+	case abe.PGPPublicKey == pgpPublicKey:
+		if !abe.ValidatedWithPGPService {
+			log.Printf("PGP received the same public key from %s with address %s -> updating the validate flag", me.pgpServiceClient.GetURL(), abe.ETHAddress)
+		}
+		abe.ValidatedWithPGPService = !unverified
+		abe.PGPKeyChanged = false
+		abe.ChangedPGPPublicKey = ""
+		//to ensure they are not synced at once to spread the pgp service load
+		abe.lastPGPServiceCheck = time.Now().Add(time.Minute * time.Duration(me.rndBetween(20, 200)))
+	case abe.PGPPublicKey == "":
+		log.Printf("PGP received a valid public key from %s with address %s -> adding it to our book", me.pgpServiceClient.GetURL(), abe.ETHAddress)
+		abe.PGPPublicKey = pgpPublicKey
+		abe.ValidatedWithPGPService = !unverified
+		//to ensure they are not synced at once to spread the pgp service load
+		abe.lastPGPServiceCheck = time.Now().Add(time.Minute * time.Duration(me.rndBetween(60, 200)))
+	default:
+		if abe.ChangedPGPPublicKey != pgpPublicKey {
+			log.Printf("WARNING: PGP received another public key from %s with address %s than the one in our book -> keeping ours until the contact is updated", me.pgpServiceClient.GetURL(), abe.ETHAddress)
+		}
+		abe.ValidatedWithPGPService = false
+		abe.PGPKeyChanged = true
+		abe.ChangedPGPPublicKey = pgpPublicKey
+		abe.lastPGPServiceCheck = time.Now().Add(time.Minute * time.Duration(me.rndBetween(20, 200)))
+	}
+	abe.PGPKeyRevoked = revoked
+	abe.PGPKeyUnverified = unverified
+	me.rwLoadLock.Unlock()
+	me.rwLoadLock.RLock()
+}
+
+// Whether the armored public key carries a valid revocation signature of its primary key
+func isRevokedPGPKey(pgpPublicKey string) bool {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(pgpPublicKey))
+	if err != nil {
+		return false
+	}
+	for _, e := range entities {
+		for _, sig := range e.Revocations {
+			if e.PrimaryKey.VerifyRevocationSignature(sig) == nil {
+				return true
 			}
-		} else {
-			log.Printf("PGP service request error: %s %s [%s] size of the PGP public key %d", me.pgpServiceClient.GetURL(), abe.ETHAddress, err, len(pgpPublicKey))
 		}
 	}
+	return false
 }
 
 func (me *AddressBook) rndBetween(min, max int) int {
@@ -190,6 +261,7 @@ func (me *AddressBook) QuickInsertByETHAddr(name, ethAddr, pgpPublicKey string)
 			if len(pgpPublicKey) > 0 && pgpPublicKey != abe.PGPPublicKey {
 				abe.PGPPublicKey = pgpPublicKey
 				abe.ValidatedWithPGPService = false
+				abe.resetPGPKeyChange()
 				me.insertOrUpdateAddrBookEntry(abe)
 			}
 		}
@@ -203,14 +275,17 @@ func (me *AddressBook) Create(name, ethAddr string) (*AddressBookEntry, error) {
 		return nil, err
 	}
 	pgpPublicKey := ""
+	unverified := false
 
 	if me.pgpServiceClient != nil {
 		pgpPublicKey, err = me.pgpServiceClient.Lookup(ethAddr)
-		if err != nil {
+		unverified = err == pgpService.ErrNoLogAddress
+		if err != nil && !unverified {
 			pgpPublicKey = ""
 		}
 	}
 	abe := NewAddressBookEntry(name, ethAddr, pgpPublicKey)
+	abe.PGPKeyUnverified = unverified
 	err = me.insertAddrBookEntry(abe)
 	return abe, err // Fails if already existing
 }
@@ -228,9 +303,14 @@ func (me *AddressBook) Update(name, ethAddr, pgpPublicKey string) (*AddressBookE
 	if len(pgpPublicKey) > 0 {
 		abe.PGPPublicKey = pgpPublicKey
 		abe.ValidatedWithPGPService = false
+		abe.resetPGPKeyChange()
 	}
 	abe.Hidden = false
 	me.rwLoadLock.Unlock()
+	if len(pgpPublicKey) > 0 && me.pgpServiceClient != nil {
+		// check the new key with the service, not with the cached one
+		me.pgpServiceClient.Forget(ethAddr)
+	}
 	return abe, me.updateAddrBookEntry(abe) // Updates if existing
 }
 
@@ -263,6 +343,27 @@ func (me *AddressBook) Get(ethAddr string) *AddressBookEntry {
 	return me.provideAddrBookEntry(strings.ToLower(ethAddr))
 }
 
+// Like Get for many addresses, the entries not validated yet are synchronized with the PGP service in one batch
+func (me *AddressBook) GetMany(ethAddrs []string) []*AddressBookEntry {
+	abes := make([]*AddressBookEntry, len(ethAddrs))
+	var unvalidated []*AddressBookEntry
+	for i, ethAddr := range ethAddrs {
+		if me.isInvalidETHAddr(ethAddr) {
+			continue
+		}
+		abes[i] = me.loadOrNewAddrBookEntry(strings.ToLower(ethAddr))
+		if !abes[i].ValidatedWithPGPService {
+			unvalidated = append(unvalidated, abes[i])
+		}
+	}
+	if me.pgpServiceClient != nil && len(unvalidated) > 0 {
+		me.rwLoadLock.RLock()
+		me.syncWithPGPService(unvalidated)
+		me.rwLoadLock.RUnlock()
+	}
+	return abes
+}
+
 func (me *AddressBook) validateEntry(name, ethAddr, pgpPublicKey *string) error {
 	if *name == "" {
 		return errors.New("name: invalid")
@@ -291,6 +392,14 @@ func (me *AddressBook) IsEmptyAddr(addr string) bool {
 	then tries to retrieve it from the DB and as last step creates a new one which is then synced with PGP service
 */
 func (me *AddressBook) provideAddrBookEntry(ethAddr string) *AddressBookEntry {
+	abe := me.loadOrNewAddrBookEntry(ethAddr)
+	if me.pgpServiceClient != nil {
+		me.syncEntry(abe)
+	}
+	return abe
+}
+
+func (me *AddressBook) loadOrNewAddrBookEntry(ethAddr string) *AddressBookEntry {
 	me.rwLoadLock.RLock()
 	abe := me.book[ethAddr]
 	me.rwLoadLock.RUnlock()
@@ -310,9 +419,6 @@ func (me *AddressBook) provideAddrBookEntry(ethAddr string) *AddressBookEntry {
 			me.rwLoadLock.Unlock()
 		}
 	}
-	if me.pgpServiceClient != nil {
-		me.syncEntry(abe)
-	}
 	return abe
 }
 
@@ -8,8 +8,14 @@ type (
 		ETHAddress              string `json:"address"`
 		PGPPublicKey            string `json:"pgpPublicKey"`
 		ValidatedWithPGPService bool   `json:"validatedWithPGPService"`
-		lastPGPServiceCheck     time.Time
-		Hidden                  bool `json:"hidden"` // we hide it to be able to use it for older files (rights, etc.)
+		// The PGP service serves another key than PGPPublicKey, which is kept until the contact is updated with the new one
+		PGPKeyChanged       bool   `json:"pgpKeyChanged"`
+		ChangedPGPPublicKey string `json:"changedPGPPublicKey,omitempty"`
+		PGPKeyRevoked       bool   `json:"pgpKeyRevoked"` // The PGP service serves PGPPublicKey or the changed key revoked
+		// The key of the PGP service isn't verified with its transparency log, as no log address is configured
+		PGPKeyUnverified    bool `json:"pgpKeyUnverified"`
+		lastPGPServiceCheck time.Time
+		Hidden              bool `json:"hidden"` // we hide it to be able to use it for older files (rights, etc.)
 	}
 )
 
@@ -23,3 +29,17 @@ func NewAddressBookEntry(name, ethAddress, pgpPublicKey string) *AddressBookEntr
 		Hidden:                  false,
 	}
 }
+
+// Whether files mustn't be encrypted for the contact, as the PGP service serves a revoked key or PGPPublicKey is revoked
+func (me *AddressBookEntry) Revoked() bool {
+	return me.PGPKeyRevoked || isRevokedPGPKey(me.PGPPublicKey)
+}
+
+// Clears the flags of a changed key, the entry is checked with the PGP service again at the next sync
+func (me *AddressBookEntry) resetPGPKeyChange() {
+	me.PGPKeyChanged = false
+	me.ChangedPGPPublicKey = ""
+	me.PGPKeyRevoked = false
+	me.PGPKeyUnverified = false
+	me.lastPGPServiceCheck = time.Time{}
+}
@@ -1,9 +1,19 @@
 package account
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/ProxeusApp/pgp"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/account/pgpService"
 	"github.com/ProxeusApp/storage-app/dapp/core/embdb"
+	"github.com/ProxeusApp/storage-app/lib/merkle"
+	"github.com/ProxeusApp/storage-app/lib/translog"
 )
 
 func TestCreateAndUpdate(t *testing.T) {
@@ -86,6 +96,95 @@ func TestListAndGet(t *testing.T) {
 	}
 }
 
+func TestSyncKeyChange(t *testing.T) {
+	ethAddr := "0xa80899bb12e4afe9787425a5e5fe166234b88185"
+	key1, err := pgp.Create(ethAddr, "", 1024, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, err := pgp.Create(ethAddr, "", 1024, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the PGP service logs every key it serves
+	logKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var served []byte
+	var logEntries, leaves [][]byte
+	serve := func(publicKey []byte) {
+		served = publicKey
+		entry, _ := json.Marshal(translog.NewEntry(ethAddr, "", string(publicKey), false))
+		logEntries = append(logEntries, entry)
+		leaves = append(leaves, translog.LeafHash(entry))
+	}
+	serve(key1["public"])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := struct {
+			TreeSize int `json:"treeSize"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&params)
+		head, _ := translog.NewTreeHead(merkle.LeafTree(leaves), logKey)
+		proof := translog.NewProof(merkle.LeafTree(leaves), logEntries[len(logEntries)-1], len(logEntries)-1, *head, params.TreeSize)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": map[string]interface{}{ethAddr: map[string]interface{}{"publicKey": string(served), "proof": proof}},
+		})
+	}))
+	defer server.Close()
+	pgpServiceClient, err := pgpService.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pgpServiceClient.SetLog(crypto.PubkeyToAddress(logKey.PublicKey).Hex(), "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	abe := NewAddressBookEntry("iana", ethAddr, "")
+	addressBook := &AddressBook{
+		book:             map[string]*AddressBookEntry{ethAddr: abe},
+		db:               embdb.OpenDummyDB(),
+		pgpServiceClient: pgpServiceClient,
+	}
+	sync := func() {
+		abe.lastPGPServiceCheck = time.Time{}
+		addressBook.syncValidatedWithPGPService()
+	}
+
+	// an entry without key takes the one of the PGP service
+	sync()
+	if abe.PGPPublicKey != string(key1["public"]) || !abe.ValidatedWithPGPService || abe.PGPKeyChanged {
+		t.Errorf("Expected the key of the PGP service to be validated but got validated %t changed %t", abe.ValidatedWithPGPService, abe.PGPKeyChanged)
+	}
+
+	// a changed key is flagged, the known one is kept
+	serve(key2["public"])
+	pgpServiceClient.Forget(ethAddr)
+	sync()
+	if abe.PGPPublicKey != string(key1["public"]) || abe.ValidatedWithPGPService || !abe.PGPKeyChanged || abe.ChangedPGPPublicKey != string(key2["public"]) {
+		t.Errorf("Expected the key change to be flagged but got validated %t changed %t", abe.ValidatedWithPGPService, abe.PGPKeyChanged)
+	}
+	entries, _ := addressBook.List(ethAddr)
+	if len(entries) != 1 || !entries[0].PGPKeyChanged {
+		t.Error("Expected the listed entry to show the key change")
+	}
+
+	// updating the contact with the new key accepts the change, the dummy DB doesn't persist it
+	addressBook.Update("iana", ethAddr, string(key2["public"]))
+	sync()
+	if abe.PGPPublicKey != string(key2["public"]) || !abe.ValidatedWithPGPService || abe.PGPKeyChanged || abe.ChangedPGPPublicKey != "" {
+		t.Errorf("Expected the new key to be validated but got validated %t changed %t", abe.ValidatedWithPGPService, abe.PGPKeyChanged)
+	}
+	// without log address the key is used, but flagged unverified
+	if err = pgpServiceClient.SetLog("", "", false); err != nil {
+		t.Fatal(err)
+	}
+	sync()
+	if abe.PGPPublicKey != string(key2["public"]) || abe.ValidatedWithPGPService || !abe.PGPKeyUnverified {
+		t.Errorf("Expected the key to be flagged unverified but got validated %t unverified %t", abe.ValidatedWithPGPService, abe.PGPKeyUnverified)
+	}
+}
+
 func TestIsInvalidETHAddr(t *testing.T) {
 	addressBook := &AddressBook{}
 
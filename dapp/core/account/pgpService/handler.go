@@ -21,12 +21,18 @@ type eth_pgp struct {
 	pgpPublicKey string
 }
 
-func NewPGPServiceHandler(dbPath, url string, signer func(ethAddr string, challenge []byte) ([]byte, error)) (*PGPServiceHandler, error) {
+func NewPGPServiceHandler(dbPath, url, logAddress string, logTrustFirst bool, signer func(ethAddr string, challenge []byte) ([]byte, error)) (*PGPServiceHandler, error) {
 	dbPath = filepath.Join(dbPath, "pgp")
 	pgpClient, err := NewClient(url)
 	if err != nil {
 		return nil, err
 	}
+	if err = os.MkdirAll(dbPath, 0750); err != nil {
+		return nil, err
+	}
+	if err = pgpClient.SetLog(logAddress, filepath.Join(dbPath, "log.json"), logTrustFirst); err != nil {
+		return nil, err
+	}
 	if signer == nil {
 		return nil, os.ErrInvalid
 	}
@@ -86,7 +92,7 @@ func (me *PGPServiceHandler) add(ethAddr, pgpPublicKey string) {
 	if me.stopping {
 		return
 	}
-	if err != nil || registeredPGP != pgpPublicKey {
+	if err != nil && err != ErrNoLogAddress || registeredPGP != pgpPublicKey {
 		challenge, err := me.pgpClient.Challenge()
 		if err != nil {
 			keep()
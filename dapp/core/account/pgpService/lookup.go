@@ -0,0 +1,231 @@
+package pgpService
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	cache "github.com/patrickmn/go-cache"
+
+	"github.com/ProxeusApp/storage-app/lib/translog"
+)
+
+/**
+Keys are looked up in batches of up to lookupBatchSize addresses, with the proofs of their transparency log entries
+in the same response. Verified keys are cached for keyCacheTTL, addresses without key for missingKeyCacheTTL. If the
+service can't be reached or fails, the keys cached within staleKeyTTL are used instead. Without a log address the keys
+aren't verified, they are returned and cached flagged as unverified.
+*/
+
+const (
+	lookupBatchSize    = 100
+	keyCacheTTL        = 5 * time.Minute
+	missingKeyCacheTTL = time.Minute
+	staleKeyTTL        = 24 * time.Hour
+)
+
+var ErrServiceUnavailable = errors.New("PGP service unavailable")
+
+type cachedKey struct {
+	publicKey  string // Empty if the service has no key for the address
+	fetched    time.Time
+	unverified bool // Not verified with the transparency log, as no log address is configured
+}
+
+func (me cachedKey) fresh(now time.Time) bool {
+	ttl := keyCacheTTL
+	if me.publicKey == "" {
+		ttl = missingKeyCacheTTL
+	}
+	return now.Before(me.fetched.Add(ttl))
+}
+
+/**
+Returns the keys of the ethereum addresses by lower case address, addresses the service has no key for are left out.
+err is set if some of the addresses couldn't be looked up or their keys couldn't be verified, the keys of the others
+are returned anyway. Revoked keys are returned with their revocation signature and err translog.ErrKeyRevoked, they
+aren't cached. Without a log address the keys are returned unverified with err ErrNoLogAddress.
+*/
+func (me *Client) LookupMany(ethAddresses []string) (keys map[string]string, err error) {
+	keys = map[string]string{}
+	var pending []string
+	seen := map[string]bool{}
+	now := time.Now()
+	for _, addr := range ethAddresses {
+		addr = strings.ToLower(addr)
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		if ck, ok := me.cached(addr); ok && ck.fresh(now) {
+			if ck.publicKey != "" {
+				keys[addr] = ck.publicKey
+			}
+			if ck.unverified {
+				err = firstErr(err, ErrNoLogAddress)
+			}
+			continue
+		}
+		pending = append(pending, addr)
+	}
+	for len(pending) > 0 {
+		n := len(pending)
+		if n > lookupBatchSize {
+			n = lookupBatchSize
+		}
+		err = firstErr(err, me.lookupBatch(pending[:n], keys))
+		pending = pending[n:]
+	}
+	return
+}
+
+// Drops the cached keys of the addresses, their next lookup asks the service
+func (me *Client) Forget(ethAddresses ...string) {
+	for _, addr := range ethAddresses {
+		me.keys.Delete(strings.ToLower(addr))
+	}
+}
+
+func (me *Client) cached(addr string) (cachedKey, bool) {
+	if v, ok := me.keys.Get(addr); ok {
+		return v.(cachedKey), true
+	}
+	return cachedKey{}, false
+}
+
+// Looks up the addresses with one request and adds their verified keys to keys
+func (me *Client) lookupBatch(addresses []string, keys map[string]string) error {
+	for attempt := 1; ; attempt++ {
+		me.logLock.Lock()
+		treeSize := me.treeSize()
+		me.logLock.Unlock()
+		found, err := me.fetchBatch(addresses, treeSize)
+		if err == ErrServiceUnavailable {
+			return me.fromCache(addresses, keys)
+		}
+		if err != nil {
+			return err
+		}
+		me.logLock.Lock()
+		if me.treeSize() != treeSize && attempt < maxLookupAttempts {
+			// another lookup has seen a newer tree meanwhile, the proofs are consistent with the one asked for only
+			me.logLock.Unlock()
+			continue
+		}
+		err = me.verifyBatch(addresses, found, keys)
+		me.logLock.Unlock()
+		return err
+	}
+}
+
+// Lookups of a batch repeated because the tree seen changed during the request
+const maxLookupAttempts = 3
+
+type loggedKey struct {
+	PublicKey string          `json:"publicKey"`
+	Proof     *translog.Proof `json:"proof"`
+}
+
+// Requests the keys of the addresses with proofs consistent with the tree of treeSize leaves.
+// Returns ErrServiceUnavailable if the service can't be reached or fails.
+func (me *Client) fetchBatch(addresses []string, treeSize int) (map[string]loggedKey, error) {
+	bts, err := json.Marshal(struct {
+		Addresses []string `json:"addresses"`
+		TreeSize  int      `json:"treeSize"`
+	}{Addresses: addresses, TreeSize: treeSize})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := me.httpClient.Post(me.url+"/pks/lookup/batch", "application/json", bytes.NewReader(bts))
+	if err != nil {
+		log.Printf("[pgpService][fetchBatch] %s", err)
+		return nil, ErrServiceUnavailable
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == translog.StatusBeyondLog:
+		// the log is smaller than the tree seen before
+		return nil, translog.ErrInconsistent
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		log.Printf("[pgpService][fetchBatch] %s answered %d", me.url, resp.StatusCode)
+		return nil, ErrServiceUnavailable
+	default:
+		return nil, os.ErrInvalid
+	}
+	result := struct {
+		Keys map[string]loggedKey `json:"keys"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Keys, nil
+}
+
+// Verifies the keys found for the addresses and adds the verified ones to keys, logLock must be held
+func (me *Client) verifyBatch(addresses []string, logged map[string]loggedKey, keys map[string]string) error {
+	var verifyErr error
+	now := time.Now()
+	unverified := false
+	for _, addr := range addresses {
+		found, ok := logged[addr]
+		if !ok {
+			me.keys.Set(addr, cachedKey{fetched: now}, cache.DefaultExpiration)
+			continue
+		}
+		err := me.verifyProof(addr, found.PublicKey, found.Proof)
+		if err == ErrNoLogAddress {
+			// returned flagged as unverified, so contacts still get a key
+			unverified = true
+			keys[addr] = found.PublicKey
+			me.keys.Set(addr, cachedKey{publicKey: found.PublicKey, fetched: now, unverified: true}, cache.DefaultExpiration)
+		} else if err == translog.ErrKeyRevoked {
+			// returned so the revocation is seen, but not cached
+			keys[addr] = found.PublicKey
+		} else if err != nil {
+			log.Printf("[pgpService][verifyBatch] key of %s from %s isn't verified by the transparency log: %s", addr, me.url, err)
+		}
+		if err != nil {
+			verifyErr = firstErr(verifyErr, err)
+			continue
+		}
+		keys[addr] = found.PublicKey
+		me.keys.Set(addr, cachedKey{publicKey: found.PublicKey, fetched: now}, cache.DefaultExpiration)
+	}
+	if unverified {
+		log.Printf("[pgpService][verifyBatch] WARNING: no transparency log address configured, the keys from %s aren't verified", me.url)
+	}
+	return verifyErr
+}
+
+// Adds the cached keys of the addresses, returns ErrServiceUnavailable if some of them aren't cached
+func (me *Client) fromCache(addresses []string, keys map[string]string) error {
+	var err error
+	for _, addr := range addresses {
+		ck, ok := me.cached(addr)
+		if !ok {
+			err = ErrServiceUnavailable
+			continue
+		}
+		if ck.publicKey != "" {
+			keys[addr] = ck.publicKey
+		}
+		if ck.unverified {
+			err = firstErr(err, ErrNoLogAddress)
+		}
+	}
+	return err
+}
+
+// Returns the first of the errors, an ErrNoLogAddress only if there is no other error
+func firstErr(err, next error) error {
+	if err == nil || err == ErrNoLogAddress && next != nil {
+		return next
+	}
+	return err
+}
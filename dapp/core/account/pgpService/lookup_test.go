@@ -0,0 +1,50 @@
+package pgpService
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestLookupMany(t *testing.T) {
+	service := newFakeService(t)
+	var addresses []string
+	for i := 0; i < lookupBatchSize+20; i++ {
+		addr := fmt.Sprintf("0x%040x", i)
+		addresses = append(addresses, addr)
+		if i%2 == 0 {
+			service.serve(addr, "key of "+addr)
+		}
+	}
+	client, _ := NewClient(service.URL)
+	client.SetLog(crypto.PubkeyToAddress(service.signer.PublicKey).Hex(), "", false)
+
+	// looked up in batches, addresses without key are left out
+	keys, err := client.LookupMany(addresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != len(addresses)/2 || keys[addresses[2]] != "key of "+addresses[2] || service.requests != 2 {
+		t.Errorf("Expected %d keys with 2 requests but got %d with %d", len(addresses)/2, len(keys), service.requests)
+	}
+
+	// keys and missing keys are cached
+	if _, err = client.Lookup(addresses[1]); err != os.ErrNotExist {
+		t.Errorf("Expected %s to be missing but got %v", addresses[1], err)
+	}
+	if key, err := client.Lookup(addresses[0]); err != nil || key != "key of "+addresses[0] || service.requests != 2 {
+		t.Errorf("Expected the cached key without request but got %q %v with %d requests", key, err, service.requests)
+	}
+
+	// the cache is used while the service is unreachable
+	service.Close()
+	client.keys.Set(addresses[0], cachedKey{publicKey: "key of " + addresses[0]}, 0)
+	if key, err := client.Lookup(addresses[0]); err != nil || key != "key of "+addresses[0] {
+		t.Errorf("Expected the stale key but got %q %v", key, err)
+	}
+	if _, err = client.Lookup("0x00000000000000000000000000000000000000ff"); err != ErrServiceUnavailable {
+		t.Errorf("Expected the service to be unavailable but got %v", err)
+	}
+}
@@ -8,7 +8,13 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	cache "github.com/patrickmn/go-cache"
+
+	"github.com/ProxeusApp/storage-app/lib/translog"
 )
 
 type (
@@ -17,13 +23,26 @@ type (
 		Challenge string `json:"challenge"`
 	}
 	Client struct {
-		url string
+		url        string
+		httpClient *http.Client
+		keys       *cache.Cache // Looked up keys, see lookup.go
+
+		// Transparency log of the service, see translog.go
+		logLock       sync.Mutex
+		logAddress    common.Address
+		logTrustFirst bool
+		treeHead      *translog.TreeHead
+		logIndexes    map[string]int
+		treeHeadFile  string
 	}
 )
 
 func NewClient(url string) (*Client, error) {
 	if strings.HasPrefix(url, "http") {
-		c := &Client{}
+		c := &Client{
+			httpClient: &http.Client{Timeout: 10 * time.Second},
+			keys:       cache.New(staleKeyTTL, 10*time.Minute),
+		}
 		for strings.HasSuffix(url, "/") {
 			url = url[:len(url)-1]
 		}
@@ -39,9 +58,7 @@ func (me *Client) GetURL() string {
 }
 
 func (me *Client) Challenge() (*ChallengeMsg, error) {
-	client := &http.Client{}
-	client.Timeout = time.Duration(time.Second * 10)
-	resp, err := client.Get(me.url + "/pks/challenge")
+	resp, err := me.httpClient.Get(me.url + "/pks/challenge")
 	if err != nil {
 		return nil, err
 	}
@@ -82,9 +99,7 @@ func (me *Client) Add(pgpPublicKey, token, signature string) (bool, error) {
 		req.Header.Set("Accept-Charset", "utf-8")
 		req.Header.Set("charset", "utf-8")
 
-		client := &http.Client{}
-		client.Timeout = time.Duration(time.Second * 10)
-		resp, err := client.Do(req)
+		resp, err := me.httpClient.Do(req)
 		if resp == nil && err == nil {
 			err = os.ErrInvalid
 			return false, err
@@ -101,30 +116,18 @@ func (me *Client) Add(pgpPublicKey, token, signature string) (bool, error) {
 	return false, err
 }
 
+// Returns the key of ethAddress, os.ErrNotExist if the service has none, a revoked key with translog.ErrKeyRevoked and
+// an unverified key with ErrNoLogAddress, see LookupMany
 func (me *Client) Lookup(ethAddress string) (pgpPublicKey string, err error) {
-	client := &http.Client{}
-	client.Timeout = time.Duration(time.Second * 10)
-	var resp *http.Response
-	resp, err = client.Get(fmt.Sprintf("%s/pks/lookup?search=%s", me.url, ethAddress))
-	if resp == nil && err == nil {
-		err = os.ErrInvalid
-		return
-	}
-	if err == nil && resp != nil {
-		if resp.StatusCode == 200 {
-			var bts []byte
-			bts, err = ioutil.ReadAll(resp.Body)
-			resp.Body.Close()
-			if err != nil {
-				return
-			}
-			pgpPublicKey = string(bts)
-			return
-		} else if resp.StatusCode == 404 {
-			err = os.ErrNotExist
-			return
+	keys, err := me.LookupMany([]string{ethAddress})
+	if pgpPublicKey, ok := keys[strings.ToLower(ethAddress)]; ok {
+		if err != translog.ErrKeyRevoked && err != ErrNoLogAddress {
+			err = nil
 		}
+		return pgpPublicKey, err
+	}
+	if err == nil {
+		err = os.ErrNotExist
 	}
-	err = os.ErrInvalid
-	return
+	return "", err
 }
@@ -0,0 +1,137 @@
+package pgpService
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/ProxeusApp/storage-app/lib/translog"
+)
+
+/**
+Keys looked up from the PGP service are only accepted if they are included in its transparency log, under a tree head
+signed by the pinned log address and consistent with the last tree head the client has seen, see lib/translog.
+Without a configured log address, and unless trustFirst pins the signer of the first tree head, which is only meant for
+development, keys are returned unverified together with ErrNoLogAddress, so contacts still get a key but the lack of
+verification is flagged. The log index of the latest entry seen for an address is
+remembered, so the service can't serve an older key again. A revoked key is rejected with translog.ErrKeyRevoked.
+The pinned address, the last seen tree head and the indexes are kept in a file, so a rolled back or forked log is
+detected across restarts.
+*/
+
+type logState struct {
+	LogAddress common.Address     `json:"logAddress"`
+	TreeHead   *translog.TreeHead `json:"treeHead"`
+	Indexes    map[string]int     `json:"indexes,omitempty"` // Lower case ethereum address -> index of its latest seen entry
+}
+
+var ErrNoLogAddress = errors.New("no transparency log address of the PGP service configured, keys aren't verified")
+
+// Pins the log to logAddress, if not empty, and loads the last seen tree head from treeHeadFile.
+// trustFirst pins the signer of the first seen tree head if no log address is pinned yet.
+func (me *Client) SetLog(logAddress, treeHeadFile string, trustFirst bool) error {
+	if logAddress != "" && !common.IsHexAddress(logAddress) {
+		return os.ErrInvalid
+	}
+	me.logLock.Lock()
+	defer me.logLock.Unlock()
+	me.treeHeadFile = treeHeadFile
+	bts, err := ioutil.ReadFile(treeHeadFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var state logState
+	if len(bts) > 0 {
+		if err = json.Unmarshal(bts, &state); err != nil {
+			return err
+		}
+	}
+	if logAddress != "" && common.HexToAddress(logAddress) != state.LogAddress {
+		if state.TreeHead != nil {
+			log.Printf("[pgpService][SetLog] log address changed from %s to %s, forgetting the last seen tree head", state.LogAddress.Hex(), logAddress)
+		}
+		state = logState{LogAddress: common.HexToAddress(logAddress)}
+	}
+	if state.Indexes == nil {
+		state.Indexes = map[string]int{}
+	}
+	me.logAddress, me.treeHead, me.logIndexes, me.logTrustFirst = state.LogAddress, state.TreeHead, state.Indexes, trustFirst
+	// the cached keys were verified with the previous log, if at all
+	me.keys.Flush()
+	return nil
+}
+
+// Returns the last seen tree head of the transparency log, nil if none has been seen yet
+func (me *Client) TreeHead() *translog.TreeHead {
+	me.logLock.Lock()
+	defer me.logLock.Unlock()
+	return me.treeHead
+}
+
+// Size of the last seen tree, logLock must be held
+func (me *Client) treeSize() int {
+	if me.treeHead == nil {
+		return 0
+	}
+	return me.treeHead.Size
+}
+
+// Verifies that publicKey is the key logged for ethAddress and remembers the tree head and the entry if they are newer,
+// logLock must be held. Returns translog.ErrKeyRevoked for a verified but revoked key.
+func (me *Client) verifyProof(ethAddress, publicKey string, proof *translog.Proof) error {
+	if proof == nil {
+		return translog.ErrNotIncluded
+	}
+	logAddress := me.logAddress
+	if logAddress == (common.Address{}) {
+		if !me.logTrustFirst {
+			return ErrNoLogAddress
+		}
+		var err error
+		if logAddress, err = proof.TreeHead.Signer(); err != nil {
+			return err
+		}
+	}
+	if me.logIndexes == nil {
+		me.logIndexes = map[string]int{}
+	}
+	ethAddress = strings.ToLower(ethAddress)
+	lastIndex, seen := me.logIndexes[ethAddress]
+	if seen && proof.Index < lastIndex {
+		return translog.ErrOutdated
+	}
+	verifyErr := proof.Verify(ethAddress, publicKey, logAddress, me.treeHead)
+	if verifyErr != nil && verifyErr != translog.ErrKeyRevoked {
+		return verifyErr
+	}
+	changed := !seen || proof.Index > lastIndex || logAddress != me.logAddress
+	me.logIndexes[ethAddress] = proof.Index
+	if me.treeHead == nil || proof.TreeHead.Size > me.treeHead.Size {
+		head := proof.TreeHead
+		me.treeHead = &head
+		changed = true
+	}
+	if changed {
+		me.logAddress = logAddress
+		me.saveLogState()
+	}
+	return verifyErr
+}
+
+func (me *Client) saveLogState() {
+	if me.treeHeadFile == "" {
+		return
+	}
+	bts, err := json.Marshal(logState{LogAddress: me.logAddress, TreeHead: me.treeHead, Indexes: me.logIndexes})
+	if err == nil {
+		err = ioutil.WriteFile(me.treeHeadFile, bts, 0600)
+	}
+	if err != nil {
+		log.Printf("[pgpService][saveLogState] %s", err)
+	}
+}
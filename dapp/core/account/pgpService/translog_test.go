@@ -0,0 +1,177 @@
+package pgpService
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/ProxeusApp/storage-app/lib/merkle"
+	"github.com/ProxeusApp/storage-app/lib/translog"
+)
+
+// PGP service which logs the keys it serves
+type fakeService struct {
+	*httptest.Server
+	signer   *ecdsa.PrivateKey
+	keys     map[string]string
+	entries  [][]byte
+	leaves   [][]byte
+	latest   map[string]int
+	logged   int // Size of the tree the service proves, to roll it back
+	requests int
+	status   int // Answered instead of the keys if set
+}
+
+func newFakeService(t *testing.T) *fakeService {
+	signer, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	me := &fakeService{signer: signer, keys: map[string]string{}, latest: map[string]int{}}
+	me.Server = httptest.NewServer(http.HandlerFunc(me.lookupBatch))
+	return me
+}
+
+func (me *fakeService) serve(ethAddr, publicKey string) {
+	me.log(ethAddr, publicKey, false)
+}
+
+func (me *fakeService) revoke(ethAddr, publicKey string) {
+	me.log(ethAddr, publicKey, true)
+}
+
+func (me *fakeService) log(ethAddr, publicKey string, revoked bool) {
+	me.keys[ethAddr] = publicKey
+	entry, _ := json.Marshal(translog.NewEntry(ethAddr, "", publicKey, revoked))
+	me.latest[ethAddr] = len(me.entries)
+	me.entries = append(me.entries, entry)
+	me.leaves = append(me.leaves, translog.LeafHash(entry))
+	me.logged = len(me.leaves)
+}
+
+func (me *fakeService) lookupBatch(w http.ResponseWriter, r *http.Request) {
+	me.requests++
+	if me.status != 0 {
+		w.WriteHeader(me.status)
+		return
+	}
+	params := struct {
+		Addresses []string `json:"addresses"`
+		TreeSize  int      `json:"treeSize"`
+	}{}
+	json.NewDecoder(r.Body).Decode(&params)
+	if params.TreeSize > me.logged {
+		w.WriteHeader(translog.StatusBeyondLog)
+		return
+	}
+	tree := merkle.LeafTree(me.leaves[:me.logged])
+	head, _ := translog.NewTreeHead(tree, me.signer)
+	keys := map[string]interface{}{}
+	for _, addr := range params.Addresses {
+		if publicKey, ok := me.keys[addr]; ok {
+			i := me.latest[addr]
+			keys[addr] = map[string]interface{}{
+				"publicKey": publicKey,
+				"proof":     translog.NewProof(tree, me.entries[i], i, *head, params.TreeSize),
+			}
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
+
+func TestLookupVerifiesLog(t *testing.T) {
+	const ethAddr = "0xa80899bb12e4afe9787425a5e5fe166234b88185"
+	service := newFakeService(t)
+	defer service.Close()
+
+	dir, err := ioutil.TempDir("", "pgplog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	treeHeadFile := filepath.Join(dir, "log.json")
+	client, _ := NewClient(service.URL)
+	if err = client.SetLog(crypto.PubkeyToAddress(service.signer.PublicKey).Hex(), treeHeadFile, false); err != nil {
+		t.Fatal(err)
+	}
+
+	service.serve(ethAddr, "key 1")
+	if key, err := client.Lookup(ethAddr); err != nil || key != "key 1" {
+		t.Errorf("Expected the logged key to be accepted but got %q %v", key, err)
+	}
+
+	// a swapped key which isn't logged is rejected
+	service.keys[ethAddr] = "swapped"
+	client.keys.Flush()
+	if _, err = client.Lookup(ethAddr); err != translog.ErrEntryMismatch {
+		t.Errorf("Expected the swapped key to be rejected but got %v", err)
+	}
+
+	// a rotated key is accepted once logged, the tree head is remembered across clients
+	service.serve(ethAddr, "key 2")
+	if _, err = client.Lookup(ethAddr); err != nil {
+		t.Error(err)
+	}
+	client, _ = NewClient(service.URL)
+	if err = client.SetLog("", treeHeadFile, false); err != nil {
+		t.Fatal(err)
+	}
+	if head := client.TreeHead(); head == nil || head.Size != 2 {
+		t.Errorf("Expected the tree head of size 2 to be remembered but got %v", head)
+	}
+
+	// a rolled back log or a log signed by another key is rejected
+	service.keys[ethAddr], service.latest[ethAddr], service.logged = "key 1", 0, 1
+	if _, err = client.Lookup(ethAddr); err != translog.ErrInconsistent {
+		t.Errorf("Expected the rolled back log to be rejected but got %v", err)
+	}
+	// other bad requests don't mean the log is inconsistent
+	service.status = http.StatusBadRequest
+	if _, err = client.Lookup(ethAddr); err == nil || err == translog.ErrInconsistent {
+		t.Errorf("Expected the bad request to fail without inconsistency but got %v", err)
+	}
+	service.status = 0
+	// an older entry of the address is rejected although it is logged
+	service.keys[ethAddr], service.latest[ethAddr], service.logged = "key 1", 0, 2
+	if _, err = client.Lookup(ethAddr); err != translog.ErrOutdated {
+		t.Errorf("Expected the older key to be rejected but got %v", err)
+	}
+
+	// a revoked key is rejected
+	service.revoke(ethAddr, "key 2 revoked")
+	if _, err = client.Lookup(ethAddr); err != translog.ErrKeyRevoked {
+		t.Errorf("Expected the revoked key to be rejected but got %v", err)
+	}
+
+	service.signer, _ = crypto.GenerateKey()
+	if _, err = client.Lookup(ethAddr); err != translog.ErrInvalidTreeHead {
+		t.Errorf("Expected the tree head of another key to be rejected but got %v", err)
+	}
+
+	// without log address the key is returned unverified, the first signer is only pinned if asked for
+	client, _ = NewClient(service.URL)
+	if err = client.SetLog("", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := client.Lookup(ethAddr); err != ErrNoLogAddress || key == "" {
+		t.Errorf("Expected the key to be returned unverified without log address but got %q %v", key, err)
+	}
+	if key, err := client.Lookup(ethAddr); err != ErrNoLogAddress || key == "" {
+		t.Errorf("Expected the cached key to stay unverified but got %q %v", key, err)
+	}
+	if client.TreeHead() != nil {
+		t.Error("Expected no tree head to be pinned without log address")
+	}
+	client.SetLog("", "", true)
+	service.serve(ethAddr, "key 3")
+	if key, err := client.Lookup(ethAddr); err != nil || key != "key 3" {
+		t.Errorf("Expected the first signer to be trusted but got %q %v", key, err)
+	}
+}
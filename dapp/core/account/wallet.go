@@ -50,7 +50,7 @@ func LoadWallet(cfg *Config) (*Wallet, error) {
 	var err error
 	wallet := &Wallet{accs: []*AccFile{}, cfg: cfg}
 	cfg.pgpPublicKeyAddListener = wallet.addedListener
-	wallet.pgpHandler, err = pgpService.NewPGPServiceHandler(cfg.StorageDir, cfg.PGPServiceURL, wallet.signerListener)
+	wallet.pgpHandler, err = pgpService.NewPGPServiceHandler(cfg.StorageDir, cfg.PGPServiceURL, cfg.PGPLogAddress, cfg.PGPLogTrustFirst, wallet.signerListener)
 	if err != nil {
 		return nil, err
 	}
@@ -358,6 +358,17 @@ func (me *Wallet) SignWithETHofActiveAccount(msg []byte) ([]byte, error) {
 	return activeAccount.SignWithETH(msg)
 }
 
+// Signs digest with the active account, see Account.SignHash
+func (me *Wallet) SignHashOfActiveAccount(digest []byte) (string, error) {
+	me.lock.RLock()
+	defer me.lock.RUnlock()
+	activeAccount := me.getActiveAndUnlockedAccount()
+	if activeAccount == nil {
+		return "", ErrAccountLocked
+	}
+	return activeAccount.SignHash(digest)
+}
+
 func (me *Wallet) getActiveAndUnlockedAccount() *Account {
 	me.lock.RLock()
 	defer me.lock.RUnlock()
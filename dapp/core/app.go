@@ -137,14 +137,20 @@ type QuoteProvider struct {
 	PriceSize     string                     `json:"priceSize"`
 	PriceDuration string                     `json:"priceDuration"`
 	PriceTotal    string                     `json:"priceTotal"`
+	Breakdown     models.PriceBreakdown      `json:"breakdown"`
 	Available     bool                       `json:"available"`
+	// Charged for every upload of the file again once it is stored, like when it is re-encrypted for a new share
+	PriceReplacement string `json:"priceReplacement"`
 }
 
 const (
 	AccountDBName = "account"
 )
 
-var ErrPGPPublicKeyMissing = errors.New("PGP public key missing")
+var (
+	ErrPGPPublicKeyMissing = errors.New("PGP public key missing")
+	ErrPGPPublicKeyRevoked = errors.New("PGP public key revoked")
+)
 
 func NewApp(cfg *config.Configuration, chanHub *channelhub.ChannelHub, sessionTimeoutDuration time.Duration) (*App, error) {
 	storageDir := cfg.StorageDir
@@ -154,7 +160,10 @@ func NewApp(cfg *config.Configuration, chanHub *channelhub.ChannelHub, sessionTi
 
 	storageDir = filepath.Join(storageDir, "proxeus")
 	log.Println("storageDir set to", storageDir)
-	acfg := &account.Config{StorageDir: storageDir, PGPServiceURL: cfg.PGPPublicServiceURL, FileSuffix: ".proxeusks"}
+	acfg := &account.Config{StorageDir: storageDir, PGPServiceURL: cfg.PGPPublicServiceURL, PGPLogAddress: cfg.PGPLogAddress, PGPLogTrustFirst: cfg.DevMode || cfg.IsTestMode(), FileSuffix: ".proxeusks"}
+	if acfg.PGPLogAddress == "" && !acfg.PGPLogTrustFirst {
+		log.Println("[App][NewApp] WARNING: no pgpLogAddress set, the keys of the PGP service are used without verifying them with its transparency log")
+	}
 	_, err := os.Stat(cfg.StorageDir)
 	if os.IsNotExist(err) {
 		err = os.MkdirAll(cfg.StorageDir, 0750)
@@ -459,6 +468,10 @@ func (me *App) fileInfoUpdate(fileHashOrder *ethereum.FileHashOrder) {
 			if fileMeta.Hidden {
 				nfi.Removed = true
 			}
+			// renewals extend the expiry registered in the smart contract
+			if fileMeta.Expiry > nfi.Expiry.Int64() {
+				nfi.Expiry = big.NewInt(fileMeta.Expiry)
+			}
 		}
 	}
 
@@ -1303,6 +1316,12 @@ func (me *App) handleExecutedEventSigningRequest(signingNotification *notificati
 }
 
 func (me *App) fileListener(stype, fhash, spUrl, txHash, status, name string, percentage float32) error {
+	if file.StatusRenewal == stype {
+		if file.StatusSuccess == status {
+			me.pushFileStr(fhash)
+		}
+		return me.push(EventMsg{Type: "fileRenewal", Data: map[string]interface{}{"status": status, "spUrl": spUrl, "txHash": txHash, "hash": fhash, "fileName": name}})
+	}
 	if file.StatusDownload == stype && file.StatusSuccess == status {
 		signReqNotif, err := me.notificationManager.FindByFileHashAndType(fhash, "signing_request")
 		if err == nil && signReqNotif != nil {
@@ -1394,12 +1413,37 @@ func (me *App) reEncryptFile(fhash string) error {
 	if err != nil {
 		return err
 	}
-	_, err = me.fileHandler.ReEncryptFile(spUrl, fhash, pgpPublicKeys)
+	_, err = me.fileHandler.ReEncryptFile(spUrl, fhash, pgpPublicKeys, func() (string, error) {
+		return me.payReplacementFee(spUrl)
+	})
 	_ = me.RemovePlain(fhash)
 
 	return err
 }
 
+// Pays the replacement fee of the storage provider at spUrl for uploading a stored file again and returns the hash of
+// the XES transfer, empty if the provider doesn't charge one
+func (me *App) payReplacementFee(spUrl string) (string, error) {
+	storageProvider, err := me.getStorageProviderInfoByUrl(spUrl)
+	if err != nil {
+		return "", err
+	}
+	breakdown, err := storageProvider.ReplacementPriceBreakdown()
+	if err != nil || breakdown.Total.Sign() == 0 {
+		return "", err
+	}
+	spAddress, err := me.storageProviderAddress(spUrl)
+	if err != nil {
+		return "", err
+	}
+	tx, err := me.ETHClient.XESTransfer(me.wallet.GetActiveAccountETHPrivateKey(), spAddress, breakdown.Total)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("[app][payReplacementFee] paid the replacement fee of %v to %s with %s", breakdown.Total, spUrl, tx.Hash().Hex())
+	return tx.Hash().Hex(), nil
+}
+
 func (me *App) push(msg EventMsg) error {
 	if me.ChanHub != nil && me.pushMsgs {
 		return me.ChanHub.Broadcast("global", msg)
@@ -1557,12 +1601,12 @@ func (me *App) collectAllPublicKeysFor(account *account.Account, fhash string) (
 		if me.addressBook.IsEmptyAddr(strAddr) || alreadyCollected[strAddr] {
 			continue
 		}
-		abe := me.addressBook.Get(strAddr)
-		if abe == nil || abe.PGPPublicKey == "" {
-			return nil, ErrPGPPublicKeyMissing
+		pubKey, err := encryptionKey(me.addressBook.Get(strAddr))
+		if err != nil {
+			return nil, err
 		}
 		alreadyCollected[strAddr] = true
-		pubKeys = append(pubKeys, []byte(abe.PGPPublicKey))
+		pubKeys = append(pubKeys, pubKey)
 	}
 
 	for _, addr := range fi.ReadAccess {
@@ -1570,12 +1614,12 @@ func (me *App) collectAllPublicKeysFor(account *account.Account, fhash string) (
 		if me.addressBook.IsEmptyAddr(strAddr) || alreadyCollected[strAddr] {
 			continue
 		}
-		abe := me.addressBook.Get(strAddr)
-		if abe == nil || abe.PGPPublicKey == "" {
-			return nil, ErrPGPPublicKeyMissing
+		pubKey, err := encryptionKey(me.addressBook.Get(strAddr))
+		if err != nil {
+			return nil, err
 		}
 		alreadyCollected[strAddr] = true
-		pubKeys = append(pubKeys, []byte(abe.PGPPublicKey))
+		pubKeys = append(pubKeys, pubKey)
 	}
 
 	return pubKeys, nil
@@ -1636,6 +1680,8 @@ func (me *App) GetStorageProviders() ([]models.StorageProviderInfo, error) {
 			if err != nil {
 				log.Printf("[app][GetStorageProviders] Can't get info from storage provider, address: %s url: %s, err: %s", ethStorageProvider.Address, ethStorageProvider.URL, err.Error())
 			} else {
+				// Providers without capacity left can't accept uploads
+				clientInfo.Full = !clientInfo.HasCapacityFor(0)
 				mux.Lock()
 				spis = append(spis, clientInfo)
 				mux.Unlock()
@@ -1721,20 +1767,36 @@ func (me *App) collectPGPKeys(definedSigners []account.AddressBookEntry) ([][]by
 	//owners public key
 	pubKeys := [][]byte{[]byte(me.wallet.GetActiveAccountPGPKey())}
 
-	//readers public key
-	for _, entry := range definedSigners {
-		abe := me.addressBook.Get(entry.ETHAddress)
+	//readers public key, looked up at once
+	ethAddrs := make([]string, len(definedSigners))
+	for i, entry := range definedSigners {
+		ethAddrs[i] = entry.ETHAddress
+	}
+	for _, abe := range me.addressBook.GetMany(ethAddrs) {
 		if abe != nil && abe.ETHAddress != "" && abe.ETHAddress == me.GetActiveAccountETHAddress() {
 			continue
 		}
-		if abe == nil || abe.PGPPublicKey == "" {
-			return nil, ErrPGPPublicKeyMissing
+		pubKey, err := encryptionKey(abe)
+		if err != nil {
+			return nil, err
 		}
-		pubKeys = append(pubKeys, []byte(abe.PGPPublicKey))
+		pubKeys = append(pubKeys, pubKey)
 	}
 	return pubKeys, nil
 }
 
+// Returns the key files are encrypted with for the contact, ErrPGPPublicKeyMissing if it has none and
+// ErrPGPPublicKeyRevoked if it has been revoked
+func encryptionKey(abe *account.AddressBookEntry) ([]byte, error) {
+	if abe == nil || abe.PGPPublicKey == "" {
+		return nil, ErrPGPPublicKeyMissing
+	}
+	if abe.Revoked() {
+		return nil, ErrPGPPublicKeyRevoked
+	}
+	return []byte(abe.PGPPublicKey), nil
+}
+
 // Archive files and return information about it, but remove the file! This should only be used for simulations like quote requests
 func (me *App) ArchiveFile(register file.Register, definedSigners []account.AddressBookEntry, undefinedSignersCount int64, spInfo models.StorageProviderInfo) (encryptedArchive file.EncryptedArchive, err error) {
 	pubKeys, err := me.checkFileSizeAndCollectPGPKeys(register, definedSigners, spInfo)
@@ -1749,7 +1811,7 @@ func (me *App) ArchiveFile(register file.Register, definedSigners []account.Addr
 var ErrorEstimateGasNotImplemented = errors.New("estimate gas not implemented yet")
 
 func (me *App) RegisterFileEstimateGas(reg file.Register, definedSigners []account.AddressBookEntry, undefinedSignersCount int64,
-	spInfo models.StorageProviderInfo) (GasEstimate, error) {
+	spInfo models.StorageProviderInfo, replicas []models.StorageProviderInfo) (GasEstimate, error) {
 
 	var gasEstimate GasEstimate
 
@@ -1764,9 +1826,8 @@ func (me *App) RegisterFileEstimateGas(reg file.Register, definedSigners []accou
 
 	fileHash := util.StrHexToBytes32(encryptedArchiveInfo.FileHash)
 	replacesFileHash := util.StrHexToBytes32("")
-	storageProviders := []common.Address{common.HexToAddress(spInfo.Address)}
 
-	xesAmount, err := spInfo.TotalPriceForFile(reg.DurationDays, big.NewInt(encryptedArchiveInfo.Size))
+	storageProviders, xesAmount, err := storageProvidersAndPrice(reg, encryptedArchiveInfo.Size, spInfo, replicas)
 	if err != nil {
 		return gasEstimate, err
 	}
@@ -1800,8 +1861,19 @@ func (me *App) RegisterFileEstimateGas(reg file.Register, definedSigners []accou
 	return gasEstimate, err
 }
 
-func (me *App) ArchiveFileAndRegister(reg file.Register, definedSigners []account.AddressBookEntry, undefinedSignersCount int64, spInfo models.StorageProviderInfo, readers []string) (string, error) {
+// Registers the file with spInfo and the replicas and uploads it to spInfo, which replicates it to the others.
+// Every provider is paid the price of the most expensive one.
+func (me *App) ArchiveFileAndRegister(reg file.Register, definedSigners []account.AddressBookEntry, undefinedSignersCount int64, spInfo models.StorageProviderInfo,
+	replicas []models.StorageProviderInfo, readers []string) (string, error) {
 	pubKeys, err := me.checkFileSizeAndCollectPGPKeys(reg, definedSigners, spInfo)
+	if err != nil {
+		return "", err
+	}
+	for _, replica := range replicas {
+		if err = me.fileSizeCheck(reg, replica); err != nil {
+			return "", err
+		}
+	}
 	spUrl, err := me.ETHClient.SpInfo(common.HexToAddress(spInfo.Address))
 	if err != nil {
 		return "", err
@@ -1811,7 +1883,7 @@ func (me *App) ArchiveFileAndRegister(reg file.Register, definedSigners []accoun
 		return "", err
 	}
 
-	xesAmount, err := spInfo.TotalPriceForFile(reg.DurationDays, big.NewInt(encryptedArchive.Size))
+	storageProviders, xesAmount, err := storageProvidersAndPrice(reg, encryptedArchive.Size, spInfo, replicas)
 	if err != nil {
 		return encryptedArchive.FileHash, err
 	}
@@ -1819,14 +1891,14 @@ func (me *App) ArchiveFileAndRegister(reg file.Register, definedSigners []accoun
 	txHash, err := "", nil
 
 	if reg.FileKind == 2 {
-		txHash, err = me.registerFileShared(encryptedArchive.FileHash, reg.FileName, undefinedSignersCount, me.toTimestamp(reg.DurationDays), spInfo.Address, xesAmount, readers)
+		txHash, err = me.registerFileShared(encryptedArchive.FileHash, reg.FileName, undefinedSignersCount, me.toTimestamp(reg.DurationDays), storageProviders, xesAmount, readers)
 	} else {
 		if definedSigners != nil && len(definedSigners) > 0 {
 			txHash, err = me.registerFileWithDefinedSigners(encryptedArchive.FileHash, reg.FileName, definedSigners,
-				me.toTimestamp(reg.DurationDays), spInfo.Address, xesAmount)
+				me.toTimestamp(reg.DurationDays), storageProviders, xesAmount)
 		} else {
 			txHash, err = me.registerFileWithUndefinedSigners(encryptedArchive.FileHash, reg.FileName,
-				undefinedSignersCount, me.toTimestamp(reg.DurationDays), spInfo.Address, xesAmount)
+				undefinedSignersCount, me.toTimestamp(reg.DurationDays), storageProviders, xesAmount)
 		}
 	}
 
@@ -1839,8 +1911,48 @@ func (me *App) ArchiveFileAndRegister(reg file.Register, definedSigners []accoun
 	return encryptedArchive.FileHash, err
 }
 
+var ErrProviderCapacity = errors.New("storage provider has no capacity left for the file")
+
+// Returns the addresses of spInfo and the replicas and the XES amount the smart contract pays to each of them,
+// the highest of their prices
+func storageProvidersAndPrice(reg file.Register, sizeBytes int64, spInfo models.StorageProviderInfo,
+	replicas []models.StorageProviderInfo) ([]common.Address, *big.Int, error) {
+	var (
+		addrs     []common.Address
+		xesAmount *big.Int
+	)
+	for _, p := range append([]models.StorageProviderInfo{spInfo}, replicas...) {
+		addr := common.HexToAddress(p.Address)
+		if containsAddress(addrs, addr) {
+			continue
+		}
+		if !p.HasCapacityFor(sizeBytes) {
+			log.Printf("[app][storageProvidersAndPrice] provider %s has no capacity left for %d bytes", p.Address, sizeBytes)
+			return nil, nil, ErrProviderCapacity
+		}
+		price, err := p.TotalPriceForFile(reg.DurationDays, big.NewInt(sizeBytes))
+		if err != nil {
+			return nil, nil, err
+		}
+		if xesAmount == nil || price.Cmp(xesAmount) > 0 {
+			xesAmount = price
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, xesAmount, nil
+}
+
+func containsAddress(addrs []common.Address, addr common.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
 func (me *App) registerFileWithDefinedSigners(fileHash string, filename string,
-	definedSigners []account.AddressBookEntry, expiry *big.Int, ethAddrSp string, xesAmount *big.Int) (string, error) {
+	definedSigners []account.AddressBookEntry, expiry *big.Int, storageProviders []common.Address, xesAmount *big.Int) (string, error) {
 
 	if me.hasNoActiveAccount() {
 		return "", os.ErrPermission
@@ -1852,14 +1964,14 @@ func (me *App) registerFileWithDefinedSigners(fileHash string, filename string,
 	}
 
 	tx, err := me.ETHClient.CreateFileDefinedSigners(me.wallet.GetActiveAccountETHPrivateKey(), fhash, filename, dsignrs,
-		expiry, util.StrHexToBytes32(""), []common.Address{common.HexToAddress(ethAddrSp)}, xesAmount)
+		expiry, util.StrHexToBytes32(""), storageProviders, xesAmount)
 	if err != nil {
 		return "", err
 	}
 	return tx.Hash().Hex(), err
 }
 
-func (me *App) registerFileShared(fileHash string, filename string, mandatorySigners int64, expiry *big.Int, ethAddrSp string,
+func (me *App) registerFileShared(fileHash string, filename string, mandatorySigners int64, expiry *big.Int, storageProviders []common.Address,
 	xesAmount *big.Int, readers []string) (string, error) {
 	if me.hasNoActiveAccount() {
 		return "", os.ErrPermission
@@ -1871,7 +1983,7 @@ func (me *App) registerFileShared(fileHash string, filename string, mandatorySig
 		readersAddrs = append(readersAddrs, common.HexToAddress(r))
 	}
 	tx, err := me.ETHClient.CreateFileShared(me.wallet.GetActiveAccountETHPrivateKey(), fhash, filename,
-		big.NewInt(mandatorySigners), expiry, replacesFileHash, []common.Address{common.HexToAddress(ethAddrSp)}, readersAddrs, xesAmount)
+		big.NewInt(mandatorySigners), expiry, replacesFileHash, storageProviders, readersAddrs, xesAmount)
 
 	if err != nil {
 		return "", err
@@ -1880,7 +1992,7 @@ func (me *App) registerFileShared(fileHash string, filename string, mandatorySig
 }
 
 func (me *App) registerFileWithUndefinedSigners(fileHash string, filename string, mandatorySigners int64, expiry *big.Int,
-	ethAddrSp string, xesAmount *big.Int) (string, error) {
+	storageProviders []common.Address, xesAmount *big.Int) (string, error) {
 	if me.hasNoActiveAccount() {
 		return "", os.ErrPermission
 	}
@@ -1892,7 +2004,7 @@ func (me *App) registerFileWithUndefinedSigners(fileHash string, filename string
 	}
 
 	tx, err := me.ETHClient.CreateFileUndefinedSigners(me.wallet.GetActiveAccountETHPrivateKey(), fhash, filename,
-		big.NewInt(mandatorySigners), expiry, replacesFileHash, []common.Address{common.HexToAddress(ethAddrSp)}, xesAmount)
+		big.NewInt(mandatorySigners), expiry, replacesFileHash, storageProviders, xesAmount)
 
 	if err != nil {
 		return "", err
@@ -2038,9 +2150,8 @@ func (me *App) shareFilePrepare(fileHash string, ethAddrs []string) ([32]byte, [
 	}
 	for _, ethAddr := range ethAddrs {
 		//check the ethAddr we want to share it with
-		abe := me.addressBook.Get(ethAddr)
-		if abe == nil || abe.PGPPublicKey == "" {
-			return fhash, nil, ErrPGPPublicKeyMissing
+		if _, err = encryptionKey(me.addressBook.Get(ethAddr)); err != nil {
+			return fhash, nil, err
 		}
 	}
 
@@ -2547,38 +2658,132 @@ func (me *App) Quotes(durationDays int, sizeBytes int64) (Quote, error) {
 
 		fileSizesBytes := big.NewInt(sizeBytes)
 
-		priceSize, err := storageProvider.PriceForSizeInXesWei(fileSizesBytes)
+		breakdown, err := storageProvider.PriceBreakdown(durationDays, fileSizesBytes)
 		if err != nil {
-			log.Println("quote skipping storage provider: error PriceForSizeInXesWei", err)
+			log.Println("quote skipping storage provider: error PriceBreakdown", err)
 			continue
 		}
-		priceDuration, err := storageProvider.PriceForDurationInXesWei(durationDays)
+		replacement, err := storageProvider.ReplacementPriceBreakdown()
 		if err != nil {
-			log.Println("quote skipping storage provider: error PriceForDurationInXesWei", err)
-			continue
-		}
-		priceTotal, err := storageProvider.TotalPriceForFile(durationDays, fileSizesBytes)
-		if err != nil {
-			log.Println("quote skipping storage provider: error TotalPriceForFile", err)
+			log.Println("quote skipping storage provider: error ReplacementPriceBreakdown", err)
 			continue
 		}
 
 		quoteProvider := QuoteProvider{
 			Provider:      storageProvider,
-			PriceSize:     priceSize.String(),
-			PriceDuration: priceDuration.String(),
-			PriceTotal:    priceTotal.String(),
-			Available:     durationDays <= storageProvider.MaxStorageDays && sizeBytes <= storageProvider.MaxFileSizeByte,
+			PriceSize:     breakdown.Size.String(),
+			PriceDuration: breakdown.Duration.String(),
+			PriceTotal:    breakdown.Total.String(),
+			Breakdown:     breakdown,
+			Available: durationDays <= storageProvider.MaxStorageDays && sizeBytes <= storageProvider.MaxFileSizeByte &&
+				storageProvider.HasCapacityFor(sizeBytes),
+			PriceReplacement: replacement.Total.String(),
 		}
 		quote.Providers = append(quote.Providers, quoteProvider)
 
 		log.Printf(
-			"dapp spp quote Provider: URL: %v | PriceDuration: %v | PriceSize: %v | PriceTotal: %v | sizeBytes: %v",
-			quoteProvider.Provider.URL, quoteProvider.PriceDuration, quoteProvider.PriceSize, quoteProvider.PriceTotal, sizeBytes)
+			"dapp spp quote Provider: URL: %v | PriceDuration: %v | PriceSize: %v | PriceTotal: %v | PriceReplacement: %v | sizeBytes: %v",
+			quoteProvider.Provider.URL, quoteProvider.PriceDuration, quoteProvider.PriceSize, quoteProvider.PriceTotal,
+			quoteProvider.PriceReplacement, sizeBytes)
 	}
 	return quote, nil
 }
 
+var (
+	ErrRenewalNotAvailable     = errors.New("renewal exceeds the max storage days of the provider")
+	ErrStorageProviderNotFound = errors.New("storage provider not found")
+)
+
+// Quotes keeping fileHash durationDays longer on its storage provider
+func (me *App) RenewalQuote(fileHash string, durationDays int) (QuoteProvider, error) {
+	var quoteProvider QuoteProvider
+	if me.hasNoActiveAccount() {
+		return quoteProvider, os.ErrPermission
+	}
+	fileMeta, err := me.fileHandler.FileMetaHandler.Get(fileHash)
+	if err != nil {
+		return quoteProvider, err
+	}
+	spUrl := fileMeta.SpUrl
+	if spUrl == "" {
+		if spUrl, err = me.ETHClient.SpInfoForFile(fileHash); err != nil {
+			return quoteProvider, err
+		}
+	}
+	storageProvider, err := me.getStorageProviderInfoByUrl(spUrl)
+	if err != nil {
+		return quoteProvider, err
+	}
+	storageProvider.URL = spUrl
+	if storageProvider.Address, err = me.storageProviderAddress(spUrl); err != nil {
+		return quoteProvider, err
+	}
+
+	breakdown, err := storageProvider.RenewalPriceBreakdown(durationDays)
+	if err != nil {
+		return quoteProvider, err
+	}
+	// The days are added to the current expiry, the SPP doesn't keep files longer than its max storage days from now
+	from := time.Now()
+	if expiry := time.Unix(fileMeta.Expiry, 0); expiry.After(from) {
+		from = expiry
+	}
+	until := from.Add(time.Hour * 24 * time.Duration(durationDays))
+	maxUntil := time.Now().Add(time.Hour * 24 * time.Duration(storageProvider.MaxStorageDays))
+
+	quoteProvider = QuoteProvider{
+		Provider:      storageProvider,
+		PriceSize:     breakdown.Size.String(),
+		PriceDuration: breakdown.Duration.String(),
+		PriceTotal:    breakdown.Total.String(),
+		Breakdown:     breakdown,
+		Available:     durationDays > 0 && !until.After(maxUntil),
+	}
+	log.Printf("dapp spp renewal quote Provider: URL: %v | PriceTotal: %v | fileHash: %v | durationDays: %v",
+		spUrl, quoteProvider.PriceTotal, fileHash, durationDays)
+	return quoteProvider, nil
+}
+
+// Pays the storage provider of fileHash for durationDays more and returns the hash of the XES transfer.
+// The SPP is asked to extend the expiry once the transfer is confirmed, see file.Handler.AddRenewal.
+func (me *App) RenewFile(fileHash string, durationDays int) (string, error) {
+	quote, err := me.RenewalQuote(fileHash, durationDays)
+	if err != nil {
+		return "", err
+	}
+	if !quote.Available {
+		return "", ErrRenewalNotAvailable
+	}
+	tx, err := me.ETHClient.XESTransfer(me.wallet.GetActiveAccountETHPrivateKey(), quote.Provider.Address, quote.Breakdown.Total)
+	if err != nil {
+		return "", err
+	}
+	txHash := tx.Hash().Hex()
+	// kept until the SPP accepts it, so the payment isn't lost if the dapp stops meanwhile
+	if err = me.fileHandler.AddRenewal(quote.Provider.URL, fileHash, txHash, durationDays); err != nil {
+		log.Printf("[app][RenewFile] couldn't keep the renewal of %s paid with %s: %s", fileHash, txHash, err.Error())
+		return txHash, err
+	}
+	return txHash, nil
+}
+
+// Returns the ethereum address of the storage provider reachable at spUrl
+func (me *App) storageProviderAddress(spUrl string) (string, error) {
+	if me.cfg.ForceSpp != "" {
+		return me.cfg.StorageProviderAddress, nil
+	}
+	storageProviders, err := me.ETHClient.StorageProviders()
+	if err != nil {
+		return "", err
+	}
+	for _, sp := range storageProviders {
+		if strings.TrimSuffix(sp.URL, "/") == strings.TrimSuffix(spUrl, "/") {
+			return sp.Address, nil
+		}
+	}
+	return "", ErrStorageProviderNotFound
+}
+
 //Logout is called when user clicks logout or if session expires
 func (me *App) Logout() error {
 
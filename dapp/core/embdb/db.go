@@ -199,6 +199,23 @@ func (me *DB) Del(key []byte) error {
 	return nil
 }
 
+// Returns an error if the database file is gone or can't be read
+func (me *DB) Check() error {
+	me.failSafeLock.Lock()
+	err := me.db.View(func(tx *bolt.Tx) error {
+		tx.Bucket([]byte("toAdd"))
+		return nil
+	})
+	me.failSafeLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if me.failSafeCheck() {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
 func (me *DB) Close() {
 	me.failSafeLock.Lock()
 	defer me.failSafeLock.Unlock()
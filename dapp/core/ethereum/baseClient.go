@@ -55,6 +55,8 @@ type (
 
 		pendingTxListener         func(txHash string)
 		eventsHandler             func(lg *types.Log, recent bool) error
+		removedLogHandler         func(lg *types.Log) // rolls back a handled log removed by a reorg
+		confirmations             *ethglue.Confirmations
 		updateEthInterfaceHandler func() error
 
 		workersRunning bool
@@ -90,6 +92,7 @@ func NewBaseClient(listenerLock *sync.RWMutex, ethWebSocketURL, ethClientURL str
 	me.ethWebSocketURL = ethWebSocketURL
 	me.ethClientURL = ethClientURL
 	me.filterAddresses = filterAddresses
+	me.confirmations = ethglue.NewConfirmations(config.Config.EventsConfirmationDepth())
 	return me
 }
 
@@ -240,16 +243,31 @@ func (me *baseClient) listenLoop() (shouldReconnect bool) {
 			if me.currentAddress == "" {
 				continue // not logged in
 			}
-			me.eventsHandler(&vLog, true)
-			if me.pendingTxListener != nil {
-				me.pendingTxListener(vLog.TxHash.Hex())
-			}
+			me.handleConfirmed(vLog)
 		case <-me.stopChan:
 			return false
 		}
 	}
 }
 
+// Logs are handled once they are confirmations.Depth() blocks deep, the latest block is estimated from the incoming logs
+func (me *baseClient) handleConfirmed(vLog types.Log) {
+	if !me.confirmations.Add(vLog) {
+		log.Printf("[baseClient][handleConfirmed] log %d of tx %s in block %d was removed by a reorg\n", vLog.Index, vLog.TxHash.Hex(), vLog.BlockNumber)
+		me.forgetExecuted(&vLog)
+		if me.removedLogHandler != nil {
+			me.removedLogHandler(&vLog)
+		}
+		return
+	}
+	for _, lg := range me.confirmations.Release(me.confirmations.Latest()) {
+		me.eventsHandler(&lg, true)
+		if me.pendingTxListener != nil {
+			me.pendingTxListener(lg.TxHash.Hex())
+		}
+	}
+}
+
 func (me *baseClient) poll() {
 	me.stopWg.Add(1)
 	defer func() {
@@ -332,7 +350,12 @@ func (me *baseClient) pollEvents() {
 		me.ethReconnect()
 		return
 	}
-	latestBlockNumber := header.Number
+	// only confirmed blocks are polled, more recent logs are tracked by listen() until they are confirmed
+	confirmedBlock, ok := me.confirmations.ConfirmedBlock(header.Number.Uint64())
+	if !ok {
+		return
+	}
+	latestBlockNumber := new(big.Int).SetUint64(confirmedBlock)
 
 	// Batch blocks
 	startBlocks, toBlocks := me.getBlockChunks(big.NewInt(int64(lastBlock)), latestBlockNumber, 2000)
@@ -376,6 +399,9 @@ func (me *baseClient) pollEvents() {
 		}
 	}
 
+	// the logs released by now were handled by the poll
+	me.confirmations.Release(confirmedBlock)
+
 	// No logs processed or latest block was processed
 	if lastProcessedBlock == 0 || lastProcessedBlock == latestBlockNumber.Uint64() {
 		if me.connStatus != ConnOnline {
@@ -450,6 +476,12 @@ func (me *baseClient) alreadyExecutedRecently(lg *types.Log) (string, bool) {
 	return eventKey, exists
 }
 
+// Lets a log be handled again if it is included in another block after a reorg
+func (me *baseClient) forgetExecuted(lg *types.Log) {
+	eventKey, _ := me.alreadyExecutedRecently(lg)
+	me.ensureUniquenessOfEventCache.Remove(eventKey)
+}
+
 func (me *baseClient) alreadyExecutedSuccessfully(eventKey string) {
 	me.ensureUniquenessOfEventCache.Put(eventKey, true)
 }
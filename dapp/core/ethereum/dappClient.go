@@ -110,6 +110,7 @@ func NewDappClient(ethClientURL, wsUrl, XESAddress, proxeusFSAddress string) (*D
 
 	me.listenerLock = new(sync.RWMutex)
 	me.baseClient = NewBaseClient(me.listenerLock, wsUrl, ethClientURL, []common.Address{me.pfsAddress, me.xesAddress})
+	me.baseClient.removedLogHandler = me.revertEvent
 
 	// to avoid panic when offline
 	me.baseClient.ethconn, err = ethclient.Dial("http://localhost/")
@@ -466,6 +467,24 @@ func (me *DappClient) handleSigningFileWithUndefinedSigners(notifySign *eth.Prox
 	me.fsClient.cleanSigningRequest(notifySign.Hash)
 }
 
+// A handled event was removed by a reorg, the affected files are read again from the smart contract
+func (me *DappClient) revertEvent(lg *types.Log) {
+	if lg.Address != me.pfsAddress || len(lg.Topics) < 2 {
+		return
+	}
+	var fhashes []common.Hash
+	switch lg.Topics[0] {
+	case me.proxeusFSABI.Events["Deleted"].ID(), me.proxeusFSABI.Events["NotifySign"].ID():
+		fhashes = lg.Topics[1:2]
+	case me.proxeusFSABI.Events["UpdatedEvent"].ID():
+		fhashes = lg.Topics[1:]
+	}
+	for _, fhash := range fhashes {
+		log.Printf("[dappClient][revertEvent] reading file %s again after tx %s was removed by a reorg\n", fhash.Hex(), lg.TxHash.Hex())
+		me.eventNotify(lg, fhash, true)
+	}
+}
+
 func (me *DappClient) eventNotify(eventLogEntry *types.Log, fhash common.Hash, recent bool) {
 	if me.baseClient.currentAddress == "" {
 		return
@@ -701,6 +701,33 @@ func (me *fsClient) spInfoForFile(fileHash string) (string, error) {
 	return "", err
 }
 
+// Returns all storage providers the file has been registered with
+func (me *fsClient) storageProvidersForFile(fileHash string) ([]StorageProvider, error) {
+	l, err := me.SpList()
+	if err != nil {
+		return nil, err
+	}
+	fhash := util.StrHexToBytes32(fileHash)
+	var res []StorageProvider
+	for _, a := range l {
+		ctx, cancel := me.baseClient.ctxWithTimeout()
+		yes, err := me.proxeusFSContractCaller.FileHasSP(&bind.CallOpts{Pending: false, Context: ctx}, fhash, a)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		if !yes {
+			continue
+		}
+		url, err := me.spInfo(a)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, StorageProvider{Address: a.Hex(), URL: url})
+	}
+	return res, nil
+}
+
 func (me *fsClient) storageProviders() ([]StorageProvider, error) {
 	l, err := me.SpList()
 	if err != nil {
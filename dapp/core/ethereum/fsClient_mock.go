@@ -34,10 +34,18 @@ func (me *ClientMock) SpInfoForFile(fileHash string) (string, error) {
 	log.Fatal("ClientMock::SpInfoForFile() not implemented")
 	return "", nil
 }
+func (me *ClientMock) StorageProvidersForFile(fileHash string) ([]fs.SpAddress, error) {
+	log.Fatal("ClientMock::StorageProvidersForFile() not implemented")
+	return nil, nil
+}
 func (me *ClientMock) GetFilePayment(fhash common.Hash) (*big.Int, error) {
 	log.Fatal("ClientMock::GetFilePayment() not implemented")
 	return nil, nil
 }
+func (me *ClientMock) XesTransfers(txHash common.Hash) ([]fs.XesTransfer, error) {
+	log.Fatal("ClientMock::XesTransfers() not implemented")
+	return nil, nil
+}
 
 func (me *ClientMock) HasWriteRights(fileHash [32]byte, addr common.Address, readFromCache bool) (bool, error) {
 	log.Fatal("ClientMock::HasWriteRights() not implemented")
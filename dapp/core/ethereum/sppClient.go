@@ -1,10 +1,20 @@
 package ethereum
 
 import (
+	"bytes"
+	"context"
+	"log"
 	"math/big"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/ethglue"
 	"github.com/ProxeusApp/storage-app/spp/fs"
 
 	"github.com/ethereum/go-ethereum/core/types"
@@ -17,11 +27,17 @@ import (
 
 type (
 	SppClient struct {
-		baseClient    *baseClient
-		paymentClient *paymentClient
-		fsClient      *fsClient
-		eventsHandler func(lg *types.Log, recent bool) error
-		pfsAddress    string
+		baseClient *baseClient
+		fsClient   *fsClient
+		pfsAddress string
+		xesAddress common.Address
+		xesABI     abi.ABI
+	}
+
+	// Closes the websocket connection of the subscription on Unsubscribe
+	wsSubscription struct {
+		ethereum.Subscription
+		conn *ethclient.Client
 	}
 )
 
@@ -29,7 +45,7 @@ const (
 	dataDir = "data"
 )
 
-func NewSppClient(ethClientURL, wsUrl, storageDir, pfsAddress string) (*SppClient, error) {
+func NewSppClient(ethClientURL, wsUrl, storageDir, pfsAddress, xesAddress string) (*SppClient, error) {
 	var err error
 
 	baseClient := NewBaseClient(&sync.RWMutex{}, wsUrl, ethClientURL, []common.Address{common.HexToAddress(pfsAddress)})
@@ -38,7 +54,8 @@ func NewSppClient(ethClientURL, wsUrl, storageDir, pfsAddress string) (*SppClien
 	me := &SppClient{}
 	me.baseClient = baseClient
 	me.pfsAddress = pfsAddress
-	if me.paymentClient, err = NewPaymentClient(baseClient, storageDir, pfsAddress); err != nil {
+	me.xesAddress = common.HexToAddress(xesAddress)
+	if me.xesABI, err = abi.JSON(strings.NewReader(eth.XESTokenContractABI)); err != nil {
 		return me, err
 	}
 	me.fsClient, err = NewFsClient(baseClient, common.HexToAddress(pfsAddress))
@@ -52,12 +69,78 @@ func NewSppClient(ethClientURL, wsUrl, storageDir, pfsAddress string) (*SppClien
 func (me *SppClient) SpInfoForFile(fileHash string) (string, error) {
 	return me.fsClient.spInfoForFile(fileHash)
 }
+func (me *SppClient) StorageProvidersForFile(fileHash string) ([]fs.SpAddress, error) {
+	sps, err := me.fsClient.storageProvidersForFile(fileHash)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]fs.SpAddress, 0, len(sps))
+	for _, sp := range sps {
+		res = append(res, fs.SpAddress{Address: sp.Address, Url: sp.URL})
+	}
+	return res, nil
+}
 func (me *SppClient) FileInfo(fileHash [32]byte, readFromCache bool) (fi fs.FileInfo, err error) {
 	return me.fsClient.FileInfo(fileHash, readFromCache)
 }
-func (me *SppClient) GetFilePayment(fhash common.Hash) (*big.Int, error) {
-	return me.paymentClient.GetFilePayment(fhash)
+
+// Returns the XES transfers made by the transaction txHash.
+// fs.ErrRenewalPaymentNotFound is returned as long as the transaction isn't mined and confirmed by the events
+// confirmation depth, so a transfer dropped by a reorg doesn't pay a renewal.
+func (me *SppClient) XesTransfers(txHash common.Hash) ([]fs.XesTransfer, error) {
+	ctx, cancel := me.baseClient.ctxWithTimeout()
+	defer cancel()
+	receipt, err := me.baseClient.ethconn.TransactionReceipt(ctx, txHash)
+	if err == ethereum.NotFound {
+		return nil, fs.ErrRenewalPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return nil, fs.ErrInvalidRenewalPayment
+	}
+	latest, err := me.LatestBlock()
+	if err != nil {
+		return nil, err
+	}
+	confirmed, ok := me.baseClient.confirmations.ConfirmedBlock(latest)
+	if !ok || receipt.BlockNumber.Uint64() > confirmed {
+		return nil, fs.ErrRenewalPaymentNotFound
+	}
+	header, err := me.baseClient.HeaderByNumber(receipt.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if header.Hash() != receipt.BlockHash {
+		// the receipt is of a block which was dropped by a reorg meanwhile
+		return nil, fs.ErrRenewalPaymentNotFound
+	}
+
+	transferID := me.xesABI.Events["Transfer"].ID()
+	xesLogUnpacker := bind.NewBoundContract(me.xesAddress, me.xesABI, nil, nil, nil)
+	var transfers []fs.XesTransfer
+	for _, lg := range receipt.Logs {
+		if lg.Address != me.xesAddress || len(lg.Topics) == 0 || !bytes.Equal(lg.Topics[0].Bytes(), transferID.Bytes()) {
+			continue
+		}
+		event := new(eth.XESTokenContractTransfer)
+		if err = xesLogUnpacker.UnpackLog(event, "Transfer", *lg); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, fs.XesTransfer{
+			From:   event.FromAddress,
+			To:     event.ToAddress,
+			Amount: event.Value,
+			Time:   time.Unix(int64(header.Time), 0),
+		})
+	}
+	if len(transfers) == 0 {
+		return nil, fs.ErrInvalidRenewalPayment
+	}
+	return transfers, nil
 }
+
 func (me *SppClient) HasWriteRights(fileHash [32]byte, addr common.Address, readFromCache bool) (bool, error) {
 	return me.fsClient.hasWriteRights(fileHash, addr, readFromCache)
 }
@@ -65,18 +148,10 @@ func (me *SppClient) HasReadRights(fileHash [32]byte, addr common.Address, readF
 	return me.fsClient.hasReadRights(fileHash, addr, readFromCache)
 }
 
-func (me *SppClient) LogAsPaymentReceived(lg *types.Log) *eth.ProxeusFSContractPaymentReceived {
-	return me.paymentClient.LogAsPaymentReceived(lg)
-}
-
 func (me *SppClient) HeaderByNumber(number *big.Int) (*types.Header, error) {
 	return me.baseClient.HeaderByNumber(number)
 }
 
-func (me *SppClient) HandlePaymentReceivedEvent(fileHash common.Hash, xesAmount *big.Int) error {
-	return me.paymentClient.HandlePaymentReceivedEvent(fileHash, xesAmount)
-}
-
 func (me *SppClient) initLocalStorage(storageDir string) error {
 	var err error
 
@@ -110,20 +185,56 @@ func (me *SppClient) updateEthInterfaces() error {
 	return nil
 }
 
-func (me *SppClient) InitListeners(storDir, ethAddress string, eventHandler func(lg *types.Log, recent bool) error) error {
+// Connects to the ethereum node. The SPP processes the contract events itself, see fs.ChainEvents,
+// so no listeners are started. A failed connection is retried by LatestBlock.
+func (me *SppClient) Connect(storDir string) error {
 	if err := me.initLocalStorage(storDir); err != nil {
 		return err
 	}
-	me.baseClient.initListeners(ethAddress, nil, nil, nil, eventHandler, me.updateEthInterfaces)
-	me.baseClient.startWorkers()
+	me.baseClient.updateEthInterfaceHandler = me.updateEthInterfaces
+	me.baseClient.ethReconnect()
+	return me.updateEthInterfaces()
+}
 
-	return nil
+// Returns the number of the latest block, the connection is renewed if it fails
+func (me *SppClient) LatestBlock() (uint64, error) {
+	header, err := me.baseClient.HeaderByNumber(nil)
+	if err != nil {
+		log.Printf("[SppClient][LatestBlock] Ethereum connection broken. Can't get header by number (%s). Reconnecting...\n", err)
+		me.baseClient.ethReconnect()
+		return 0, err
+	}
+	return header.Number.Uint64(), nil
 }
 
-func (me *SppClient) Close() error {
-	if me.paymentClient != nil {
-		me.paymentClient.close()
+func (me *SppClient) FilterLogs(query ethereum.FilterQuery) ([]types.Log, error) {
+	ctx, cancel := me.baseClient.ctxWithTimeout()
+	defer cancel()
+	return me.baseClient.ethconn.FilterLogs(ctx, query)
+}
+
+// Subscribes to the logs on a new websocket connection
+func (me *SppClient) SubscribeLogs(query ethereum.FilterQuery, logs chan<- types.Log) (ethereum.Subscription, error) {
+	conn, err := ethglue.Dial(me.baseClient.ethWebSocketURL)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sub, err := conn.SubscribeFilterLogs(ctx, query, logs)
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
+	return &wsSubscription{Subscription: sub, conn: conn}, nil
+}
+
+func (me *wsSubscription) Unsubscribe() {
+	me.Subscription.Unsubscribe()
+	me.conn.Close()
+}
+
+func (me *SppClient) Close() error {
 	if me.baseClient != nil {
 		me.baseClient.close()
 	}
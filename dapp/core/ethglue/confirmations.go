@@ -0,0 +1,89 @@
+package ethglue
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Confirmations holds logs back until they are depth blocks deep, so that logs dropped by a chain reorganisation
+// are never acted upon. A depth of 0 releases every log right away.
+type Confirmations struct {
+	depth   uint64
+	pending []types.Log
+	latest  uint64 // highest block a log was added from
+	mu      sync.Mutex
+}
+
+func NewConfirmations(depth uint64) *Confirmations {
+	return &Confirmations{depth: depth}
+}
+
+func (c *Confirmations) Depth() uint64 {
+	return c.depth
+}
+
+// Returns the latest block deep enough to act on its logs, ok is false if there is none yet
+func (c *Confirmations) ConfirmedBlock(latest uint64) (block uint64, ok bool) {
+	if latest < c.depth {
+		return 0, false
+	}
+	return latest - c.depth, true
+}
+
+// Tracks lg until it is confirmed. A log reported with Removed=true is dropped, pending is false if it isn't
+// tracked anymore because it was released already and its effects have to be rolled back.
+func (c *Confirmations) Add(lg types.Log) (pending bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, p := range c.pending {
+		if p.TxHash == lg.TxHash && p.Index == lg.Index && p.BlockHash == lg.BlockHash {
+			if lg.Removed {
+				c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			}
+			return true
+		}
+	}
+	if lg.Removed {
+		return false
+	}
+	if lg.BlockNumber > c.latest {
+		c.latest = lg.BlockNumber
+	}
+	c.pending = append(c.pending, lg)
+	return true
+}
+
+// Removes and returns the logs at least depth blocks below latest, ordered by block and index
+func (c *Confirmations) Release(latest uint64) []types.Log {
+	confirmed, ok := c.ConfirmedBlock(latest)
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var released, pending []types.Log
+	for _, lg := range c.pending {
+		if lg.BlockNumber <= confirmed {
+			released = append(released, lg)
+		} else {
+			pending = append(pending, lg)
+		}
+	}
+	c.pending = pending
+	sort.Slice(released, func(i, j int) bool {
+		if released[i].BlockNumber != released[j].BlockNumber {
+			return released[i].BlockNumber < released[j].BlockNumber
+		}
+		return released[i].Index < released[j].Index
+	})
+	return released
+}
+
+// Returns the highest block a log was added from, a lower bound of the latest block
+func (c *Confirmations) Latest() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.latest
+}
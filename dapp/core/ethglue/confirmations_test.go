@@ -0,0 +1,38 @@
+package ethglue
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmations(t *testing.T) {
+	c := NewConfirmations(3)
+	first := types.Log{BlockNumber: 10, TxHash: common.HexToHash("0x01"), Index: 1}
+	second := types.Log{BlockNumber: 11, TxHash: common.HexToHash("0x02"), Index: 2}
+	reorged := types.Log{BlockNumber: 11, TxHash: common.HexToHash("0x03"), Index: 3}
+
+	assert.True(t, c.Add(second))
+	assert.True(t, c.Add(first))
+	assert.True(t, c.Add(reorged))
+	assert.Equal(t, uint64(11), c.Latest())
+	assert.Empty(t, c.Release(12))
+
+	// a log removed before it is confirmed is never released
+	reorged.Removed = true
+	assert.True(t, c.Add(reorged))
+	assert.Equal(t, []types.Log{first, second}, c.Release(14))
+	assert.Empty(t, c.Release(20))
+
+	// a log removed after it was released has to be rolled back
+	first.Removed = true
+	assert.False(t, c.Add(first))
+
+	block, ok := c.ConfirmedBlock(2)
+	assert.False(t, ok)
+	block, ok = c.ConfirmedBlock(20)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(17), block)
+}
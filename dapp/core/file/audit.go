@@ -0,0 +1,214 @@
+package file
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/ProxeusApp/storage-app/lib/merkle"
+	"github.com/ProxeusApp/storage-app/spp/client"
+	"github.com/ProxeusApp/storage-app/spp/client/models"
+	"github.com/ProxeusApp/storage-app/spp/fs"
+)
+
+/**
+The storage auditor spot-checks that the storage providers still hold the archives uploaded from this dapp.
+The Merkle root of every archive is computed before it is uploaded and kept in the file meta once the SPP stored it.
+Every storageAuditInterval a few of these files are picked at random and their SPP is challenged to prove random
+offsets of the archive, a proof which doesn't lead to the kept root raises a storage_proof_failed notification.
+An SPP which can't be reached isn't reported, the file is checked again in a later round.
+*/
+
+const (
+	storageAuditInterval = 6 * time.Hour
+	storageAuditFiles    = 5 // Files checked per round
+	storageAuditOffsets  = 4 // Random offsets challenged per file
+
+	NotificationStorageProofFailed = "storage_proof_failed"
+)
+
+var ErrStorageProofInvalid = errors.New("storage provider couldn't prove it holds the archive")
+
+func (me *Handler) storageAuditor() {
+	me.waitWorkerGrp.Add(1)
+	go func() {
+		ticker := time.NewTicker(storageAuditInterval)
+		defer func() {
+			ticker.Stop()
+			me.waitWorkerGrp.Done()
+		}()
+		for {
+			select {
+			case <-ticker.C:
+				me.auditStorage()
+			case <-me.stopAll:
+				return
+			}
+		}
+	}()
+}
+
+// Challenges the SPPs of a few random files uploaded from this dapp
+func (me *Handler) auditStorage() {
+	if !me.wallet.HasActiveAndUnlockedAccount() {
+		return
+	}
+	fileMetas, err := me.FileMetaHandler.All()
+	if err != nil {
+		log.Println("[Handler][auditStorage] couldn't read the file metas ", err)
+		return
+	}
+	var audited []*FileMeta
+	for _, fileMeta := range fileMetas {
+		if fileMeta.Uploaded && !fileMeta.Expired && fileMeta.MerkleRoot != "" && fileMeta.SpUrl != "" {
+			audited = append(audited, fileMeta)
+		}
+	}
+	rand.Shuffle(len(audited), func(i, j int) { audited[i], audited[j] = audited[j], audited[i] })
+	if len(audited) > storageAuditFiles {
+		audited = audited[:storageAuditFiles]
+	}
+	for _, fileMeta := range audited {
+		if me.closing {
+			return
+		}
+		err = me.AuditStorage(fileMeta)
+		if err == ErrStorageProofInvalid || errors.Is(err, client.ErrFileNotFound) {
+			log.Printf("[Handler][auditStorage] SPP %s failed the proof of storage of %s: %v", fileMeta.SpUrl, fileMeta.FileHash, err)
+			me.notifyStorageProofFailed(fileMeta)
+		} else if err != nil {
+			log.Printf("[Handler][auditStorage] couldn't audit %s on SPP %s: %v", fileMeta.FileHash, fileMeta.SpUrl, err)
+		}
+	}
+}
+
+// Challenges the SPP of fileMeta to prove random offsets of the archive it stores
+func (me *Handler) AuditStorage(fileMeta *FileMeta) error {
+	spUrl := fileMeta.SpUrl
+	if len(me.cfg.ForceSpp) > 10 {
+		spUrl = me.cfg.ForceSpp
+	}
+	r, err := client.Challenge(spUrl)
+	if err != nil || r == nil {
+		if err == nil {
+			err = os.ErrInvalid
+		}
+		return err
+	}
+	bts, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp := fs.SignMsg{}
+	if err = json.Unmarshal(bts, &resp); err != nil {
+		return err
+	}
+	sig, err := me.wallet.SignWithETHofActiveAccount([]byte(resp.Challenge))
+	if err != nil {
+		return err
+	}
+
+	// the offsets must not be predictable, or the SPP could keep just the challenged chunks
+	offsets := make([]int64, storageAuditOffsets)
+	for i := range offsets {
+		if fileMeta.ArchiveSize > 0 {
+			offset, err := crand.Int(crand.Reader, big.NewInt(fileMeta.ArchiveSize))
+			if err != nil {
+				return err
+			}
+			offsets[i] = offset.Int64()
+		}
+	}
+	proof, err := client.StorageProof(context.TODO(), spUrl, fileMeta.FileHash, resp.Token, string(sig), offsets)
+	if err != nil {
+		return err
+	}
+	return verifyStorageProof(proof, fileMeta.MerkleRoot, fileMeta.ArchiveSize, offsets)
+}
+
+// Checks that proof answers every offset with a chunk leading to root
+func verifyStorageProof(proof *models.StorageProof, root string, size int64, offsets []int64) error {
+	rootBytes, err := hex.DecodeString(root)
+	if err != nil {
+		return err
+	}
+	if proof.Size != size || len(proof.Chunks) != len(offsets) {
+		return ErrStorageProofInvalid
+	}
+	count := merkle.Chunks(size)
+	for i, chunk := range proof.Chunks {
+		if chunk.Offset != offsets[i] || chunk.Index != int(offsets[i]/merkle.ChunkSize) {
+			return ErrStorageProofInvalid
+		}
+		siblings := make([][]byte, len(chunk.Proof))
+		for j, s := range chunk.Proof {
+			if siblings[j], err = hex.DecodeString(s); err != nil {
+				return ErrStorageProofInvalid
+			}
+		}
+		if !merkle.Verify(rootBytes, merkle.LeafHash(chunk.Data), chunk.Index, count, siblings) {
+			return ErrStorageProofInvalid
+		}
+	}
+	return nil
+}
+
+func (me *Handler) notifyStorageProofFailed(fileMeta *FileMeta) {
+	if me.notificationManager == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"fileHash": fileMeta.FileHash,
+		"fileName": fileMeta.FileName,
+		"spUrl":    fileMeta.SpUrl,
+	}
+	n, err := me.notificationManager.AddOrUpdate(NotificationStorageProofFailed, map[string]string{"fileHash": fileMeta.FileHash}, data)
+	if err != nil {
+		log.Println("[Handler][notifyStorageProofFailed] ", err)
+		return
+	}
+	if !n.Dismissed && me.chanHub != nil {
+		if err = me.chanHub.Broadcast("global", n); err != nil {
+			log.Println("[Handler][notifyStorageProofFailed] ", err)
+		}
+	}
+}
+
+// Keeps the Merkle root of an archive the SPP stored, so the SPP can be audited
+func (me *Handler) archiveStored(pending Pending) {
+	if pending.MerkleRoot == "" {
+		return
+	}
+	fileMeta, err := me.FileMetaHandler.Get(pending.FileHash)
+	if err != nil {
+		log.Printf("[Handler][archiveStored] no file meta for %s: %v", pending.FileHash, err)
+		return
+	}
+	fileMeta.MerkleRoot = pending.MerkleRoot
+	fileMeta.ArchiveSize = pending.ArchiveSize
+	if err = me.FileMetaHandler.Put(fileMeta); err != nil {
+		log.Printf("[Handler][archiveStored] couldn't save the Merkle root of %s: %v", pending.FileHash, err)
+	}
+}
+
+func archiveMerkleRoot(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	leaves, err := merkle.Leaves(f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(merkle.Root(leaves)), nil
+}
@@ -27,13 +27,13 @@ import (
 	channelhub "github.com/ProxeusApp/storage-app/web"
 
 	"context"
-	"net/http"
 
 	cache "github.com/ProxeusApp/memcache"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/pborman/uuid"
 
 	"github.com/ProxeusApp/storage-app/dapp/core/account"
+	"github.com/ProxeusApp/storage-app/lib/grant"
 	"github.com/ProxeusApp/storage-app/spp/client"
 	"github.com/ProxeusApp/storage-app/spp/config"
 	"github.com/ProxeusApp/storage-app/spp/fs"
@@ -62,6 +62,9 @@ type (
 		archiveFileMutex           sync.Mutex
 		fileDownloadScheduledCache *cache.Cache
 		closing                    bool
+
+		renewalsLock sync.Mutex // Guards the pending renewals of the file metas
+		renewalKick  chan bool
 	}
 
 	uploadDownloadStatus struct {
@@ -93,6 +96,9 @@ type (
 		FileHash        string
 		Percentage      float32
 		DurationDays    int
+		MerkleRoot      string // Of the archive, kept in the file meta once the SPP stored it
+		ArchiveSize     int64
+		FeeTx           string // XES transfer paying the replacement fee of a re-encrypted file
 	}
 
 	ReqFile struct {
@@ -129,8 +135,12 @@ const (
 
 	filesName = "files"
 
+	partialDownloadSuffix = ".partial"
+	etagSuffix            = ".etag"
+
 	StatusDownload = "download"
 	StatusUpload   = "upload"
+	StatusRenewal  = "renewal"
 	StatusSuccess  = "success"
 	StatusPending  = "pending"
 	StatusFail     = "fail"
@@ -154,10 +164,14 @@ func NewHandler(cfg *config.Configuration, wallet *account.Wallet, storageDir, u
 		return nil, err
 	}
 	fh.fileDownloadScheduledCache = cache.New(30 * time.Second)
+	fh.renewalKick = make(chan bool, 1)
 	fh.uploadDownloadSync = make(map[string]*uploadDownloadStatus)
 	fh.wallet = wallet
 	fh.uploader, err = NewUploader(cfg, accountGetter, &fh.waitWorkerGrp, &fh.closing, &fh.stopAll, &fh.uploadDownloadSync, &fh.uploadDownloadSyncMutex,
 		wallet, userAccountDir)
+	if fh.uploader != nil {
+		fh.uploader.stored = fh.archiveStored
+	}
 
 	return fh, err
 }
@@ -170,6 +184,8 @@ func (me *Handler) setupWorkers() {
 		me.stopAll = make(chan bool)
 		me.uploader.setupWorkers()
 		me.uploader.uploadHandler()
+		me.storageAuditor()
+		me.renewer()
 	}
 	me.workersLock.Unlock()
 }
@@ -404,7 +420,7 @@ func (me *Handler) PrepareRegisterAndScheduleUpload(reg Register, publicKeys [][
 		return archiveFile, err
 	}
 
-	_, pending, err := me.uploader.scheduleUpload(archiveFile, reg, publicKeys, spUrl, false)
+	_, pending, err := me.uploader.scheduleUpload(archiveFile, reg, publicKeys, spUrl, false, "")
 	if err != nil {
 		return archiveFile, err
 	}
@@ -619,7 +635,9 @@ func (me *Handler) thumbnailFromDisk(fileHash string) (string, error) {
 	return "", os.ErrNotExist
 }
 
-func (me *Handler) ReEncryptFile(spUrl, fileHash string, pgpPubKeys [][]byte) (string, error) {
+// Encrypts fileHash for pgpPubKeys and uploads it again. payFee pays the replacement fee of the SPP once the archive
+// is ready and returns the XES transfer, see App.payReplacementFee.
+func (me *Handler) ReEncryptFile(spUrl, fileHash string, pgpPubKeys [][]byte, payFee func() (string, error)) (string, error) {
 	filePath, err := me.RequestFileFromSpp(spUrl, fileHash)
 	if err != nil {
 		return "", err
@@ -676,8 +694,12 @@ func (me *Handler) ReEncryptFile(spUrl, fileHash string, pgpPubKeys [][]byte) (s
 	if err != nil {
 		return "", err
 	}
+	feeTx, err := payFee()
+	if err != nil {
+		return "", err
+	}
 
-	filePath, _, err = me.uploader.scheduleUpload(archiveFile, reg, pgpPubKeys, spUrl, true)
+	filePath, _, err = me.uploader.scheduleUpload(archiveFile, reg, pgpPubKeys, spUrl, true, feeTx)
 	if err != nil {
 		log.Println("[fileHandler][ReEncryptFile] error while scheduling upload", err)
 	}
@@ -883,10 +905,9 @@ func (me *Handler) downloadArchiveFromSpp(spUrl, fileHash, archiveFilePath strin
 	}
 
 	var (
-		bts         []byte
-		sig         []byte
 		archiveFile *os.File
-		r           *http.Response
+		partialPath = archiveFilePath + partialDownloadSuffix
+		etagPath    = partialPath + etagSuffix
 	)
 
 	//try a couple of times in case server is not reachable and each time increment the waiting time before retry
@@ -904,41 +925,28 @@ func (me *Handler) downloadArchiveFromSpp(spUrl, fileHash, archiveFilePath strin
 		if me.closing {
 			return os.ErrClosed
 		}
-		r, err = client.Challenge(spUrl)
-		if err != nil || r == nil {
-			log.Printf("try %d: error when connecting to SPP(%s) to request the challenge err %v \n",
-				count, spUrl, err)
-			continue
-		}
-		bts, err = ioutil.ReadAll(r.Body)
-		r.Body.Close()
-		if err != nil {
-			log.Printf("try %d: error when connecting to SPP(%s) response not readable %v \n",
-				count, spUrl, err)
-			continue
-		}
-		resp := fs.SignMsg{}
-		err = json.Unmarshal(bts, &resp)
-		if err != nil {
-			continue
-		}
-		sig, err = me.wallet.SignWithETHofActiveAccount([]byte(resp.Challenge))
-		if err == account.ErrAccountLocked {
+		encodedGrant, err := signGrant(me.cfg, spUrl, fileHash, grant.OperationRead, me.wallet.SignHashOfActiveAccount)
+		if err == account.ErrAccountLocked || err == ErrGrantDomainMismatch {
 			return err
 		}
 		if me.closing {
 			return os.ErrClosed
 		}
 		if err != nil {
-			log.Printf("try %d: error when signing the challenge of the SPP(%s) with address %s err %v \n",
+			log.Printf("try %d: error when signing the download grant for the SPP(%s) with address %s err %v \n",
 				count, spUrl, me.wallet.GetActiveAccountETHAddress(), err)
 			continue
 		}
-		archiveFile, err = os.OpenFile(archiveFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		//continue a download interrupted by a timeout or a restart of the app
+		archiveFile, err = os.OpenFile(partialPath, os.O_WRONLY|os.O_CREATE, 0600)
 		if err != nil {
-			archiveFile.Close()
 			continue
 		}
+		var offset int64
+		etag, _ := ioutil.ReadFile(etagPath)
+		if stat, err := archiveFile.Stat(); err == nil && len(etag) > 0 {
+			offset = stat.Size()
+		}
 		downStatus.closeSync.Lock()
 		ctx, cancel := me.uploader.ctxWithCancel()
 		downStatus.cancel = func() {
@@ -955,22 +963,36 @@ func (me *Handler) downloadArchiveFromSpp(spUrl, fileHash, archiveFilePath strin
 		}
 		downStatus.closeSync.Unlock()
 
-		_, err = client.OutputWithContext(spUrl, fileHash, resp.Token, string(sig), false, archiveFile, ctx, transferProgressCallback)
+		_, err = client.OutputRangeWithGrant(spUrl, fileHash, encodedGrant, archiveFile, offset, string(etag), ctx,
+			transferProgressCallback, func(etag string) error {
+				return ioutil.WriteFile(etagPath, []byte(etag), 0600)
+			})
 		if me.closing {
+			archiveFile.Close()
 			return os.ErrClosed
 		}
 		if err == fs.ErrNotSatisfiable {
+			archiveFile.Close()
 			return err
 		}
 		if err != nil {
 			log.Printf("try %d: error when downloading the file(%s) from the SPP(%s) with address %s err %v \n", count, fileHash, spUrl, me.wallet.GetActiveAccountETHAddress(), err)
-			os.Remove(archiveFilePath)
+			archiveFile.Close()
+			if errors.Is(err, client.ErrFileNotFound) || errors.Is(err, client.ErrFileRemoved) ||
+				errors.Is(err, client.ErrForbidden) || errors.Is(err, client.ErrNotSatisfiable) {
+				//the partial download can't be continued
+				me.removePartialDownload(archiveFilePath)
+			}
 			continue
 		}
 		err = archiveFile.Close()
 		if err != nil {
 			continue
 		}
+		if err = os.Rename(partialPath, archiveFilePath); err != nil {
+			continue
+		}
+		os.Remove(etagPath)
 
 		downStatus.closeSync.Lock()
 		downStatus.cancel = nil
@@ -981,6 +1003,11 @@ func (me *Handler) downloadArchiveFromSpp(spUrl, fileHash, archiveFilePath strin
 	return ErrDownloadTimeout
 }
 
+func (me *Handler) removePartialDownload(archiveFilePath string) {
+	os.Remove(archiveFilePath + partialDownloadSuffix)
+	os.Remove(archiveFilePath + partialDownloadSuffix + etagSuffix)
+}
+
 func (me *Handler) getPlainFileFromArchive(fileHash, plainDir, archiveDir string, fromSpp bool) (File, error) {
 	if !me.wallet.HasActiveAndUnlockedAccount() {
 		return File{}, os.ErrPermission
@@ -26,6 +26,10 @@ type (
 		GraceSeconds int
 		Expired      bool
 		HasThumbnail bool
+		MerkleRoot   string `json:",omitempty"` // Root of the Merkle tree over the archive stored on the SPP, see audit.go
+		ArchiveSize  int64  `json:",omitempty"`
+		// Renewals paid but not accepted by the SPP yet, see renewal.go
+		PendingRenewals []PendingRenewal `json:",omitempty"`
 	}
 )
 
@@ -83,6 +87,26 @@ func (me *handler) Get(fileHash string) (*FileMeta, error) {
 	return nil, ErrFileMetaNotFound
 }
 
+func (me *handler) All() ([]*FileMeta, error) {
+	_, vals, err := me.fileMetaDB.AllWithValues()
+	if err != nil {
+		return nil, err
+	}
+	var fileMetas []*FileMeta
+	for _, val := range vals {
+		if len(val) == 0 {
+			continue
+		}
+		fileMeta := FileMeta{}
+		if err = json.Unmarshal(val, &fileMeta); err != nil {
+			log.Println("[fileMetaHandler][All] deserialize FileMetaHandler error: ", err, string(val))
+			return nil, err
+		}
+		fileMetas = append(fileMetas, &fileMeta)
+	}
+	return fileMetas, nil
+}
+
 func (me *handler) Del(fileHash string) error {
 	return me.fileMetaDB.Del([]byte(strings.ToLower(fileHash)))
 }
@@ -0,0 +1,43 @@
+package file
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/ProxeusApp/storage-app/lib/grant"
+	"github.com/ProxeusApp/storage-app/spp/client"
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+/**
+Uploads to and downloads from the SPP are authorized with grants covering the single file and operation, see lib/grant.
+A new grant is signed for every attempt, the SPP uses it up with the request it is sent with.
+*/
+
+// The grant only has to reach the SPP in time, the transfer itself may take longer
+const grantValidity = 10 * time.Minute
+
+var ErrGrantDomainMismatch = errors.New("the SPP accepts grants of another chain or contract")
+
+// Returns an encoded grant of operation on fileHash for the SPP at spUrl, signed with sign
+func signGrant(cfg *config.Configuration, spUrl, fileHash, operation string, sign grant.DigestSigner) (string, error) {
+	info, err := client.GrantInfo(spUrl)
+	if err != nil {
+		return "", err
+	}
+	// the SPP names its own address but it has to be bound to our chain and contract
+	domain := grant.NewDomain(config.GetChainId().Int64(), common.HexToAddress(cfg.ContractAddress).Hex())
+	if info.Domain != domain {
+		return "", ErrGrantDomainMismatch
+	}
+	g, err := grant.New(fileHash, operation, info.Provider, grantValidity)
+	if err != nil {
+		return "", err
+	}
+	if err = g.Sign(domain, sign); err != nil {
+		return "", err
+	}
+	return g.Encode(), nil
+}
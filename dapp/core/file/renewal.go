@@ -0,0 +1,203 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/account"
+	"github.com/ProxeusApp/storage-app/spp/client"
+	"github.com/ProxeusApp/storage-app/spp/fs"
+)
+
+/**
+A renewal is paid before the SPP is asked to accept it, so the paid renewal is kept in the file meta until the SPP
+accepts or rejects it. The renewer asks the SPP right away and, for renewals which couldn't be completed yet, again
+every renewalRetryInterval and after a restart, once the account is unlocked. A renewal is only dropped if the SPP
+rejects it for good.
+*/
+
+// A renewal paid with the XES transfer TxHash which the SPP hasn't accepted yet
+type PendingRenewal struct {
+	TxHash string
+	SpUrl  string
+	Days   int
+}
+
+var ErrRenewalTimeout = errors.New("renewal payment wasn't accepted by the SPP in time")
+
+const (
+	// How often the SPP is asked to accept a renewal while its payment isn't mined and confirmed yet
+	renewalTries = 10
+	// Pending renewals are retried this often
+	renewalRetryInterval = 5 * time.Minute
+)
+
+// Keeps the renewal of fileHash paid with txHash and asks the SPP to accept it in the background
+func (me *Handler) AddRenewal(spUrl, fileHash, txHash string, durationDays int) error {
+	me.renewalsLock.Lock()
+	fileMeta, err := me.FileMetaHandler.Get(fileHash)
+	if err == nil {
+		fileMeta.PendingRenewals = append(fileMeta.PendingRenewals, PendingRenewal{TxHash: txHash, SpUrl: spUrl, Days: durationDays})
+		err = me.FileMetaHandler.Put(fileMeta)
+	}
+	me.renewalsLock.Unlock()
+	if err != nil {
+		return err
+	}
+	select {
+	case me.renewalKick <- true:
+	default:
+	}
+	return nil
+}
+
+func (me *Handler) renewer() {
+	me.waitWorkerGrp.Add(1)
+	go func() {
+		ticker := time.NewTicker(renewalRetryInterval)
+		defer func() {
+			ticker.Stop()
+			me.waitWorkerGrp.Done()
+		}()
+		for {
+			me.resumeRenewals()
+			select {
+			case <-ticker.C:
+			case <-me.renewalKick:
+			case <-me.stopAll:
+				return
+			}
+		}
+	}()
+}
+
+// Asks the SPPs to accept the pending renewals
+func (me *Handler) resumeRenewals() {
+	if !me.wallet.HasActiveAndUnlockedAccount() {
+		return
+	}
+	fileMetas, err := me.FileMetaHandler.All()
+	if err != nil {
+		log.Println("[Handler][resumeRenewals] couldn't read the file metas ", err)
+		return
+	}
+	for _, fileMeta := range fileMetas {
+		for _, pending := range fileMeta.PendingRenewals {
+			if me.closing {
+				return
+			}
+			expiry, err := me.Renew(pending.SpUrl, fileMeta.FileHash, pending.TxHash, pending.Days)
+			if err != nil && !renewalRejected(err) {
+				log.Printf("[Handler][resumeRenewals] renewal of %s paid with %s is retried later: %v", fileMeta.FileHash, pending.TxHash, err)
+				continue
+			}
+			if err = me.finishRenewal(fileMeta.FileHash, pending, expiry, err); err != nil {
+				log.Printf("[Handler][resumeRenewals] couldn't save the renewal of %s: %v", fileMeta.FileHash, err)
+			}
+		}
+	}
+}
+
+// Drops the pending renewal and, unless the SPP rejected it with rejectErr, saves the new expiry
+func (me *Handler) finishRenewal(fileHash string, pending PendingRenewal, expiry int64, rejectErr error) error {
+	me.renewalsLock.Lock()
+	fileMeta, err := me.FileMetaHandler.Get(fileHash)
+	if err == nil {
+		renewals := fileMeta.PendingRenewals[:0]
+		for _, r := range fileMeta.PendingRenewals {
+			if !strings.EqualFold(r.TxHash, pending.TxHash) {
+				renewals = append(renewals, r)
+			}
+		}
+		fileMeta.PendingRenewals = renewals
+		if rejectErr == nil {
+			fileMeta.Expiry = expiry
+			fileMeta.Expired = false
+		}
+		err = me.FileMetaHandler.Put(fileMeta)
+	}
+	me.renewalsLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	status := StatusSuccess
+	if rejectErr != nil {
+		status = StatusFail
+		log.Printf("[Handler][finishRenewal] SPP %s rejected the renewal of %s paid with %s: %v", pending.SpUrl, fileHash, pending.TxHash, rejectErr)
+	} else {
+		log.Printf("[Handler][finishRenewal] %s renewed until %s", fileHash, time.Unix(expiry, 0))
+	}
+	_ = me.uploader.notify(StatusRenewal, fileHash, pending.SpUrl, pending.TxHash, status, fileMeta.FileName, 100)
+	return nil
+}
+
+// Returns true if the SPP answered err for good, retrying the renewal won't help
+func renewalRejected(err error) bool {
+	var sppErr *client.Error
+	if errors.As(err, &sppErr) {
+		return !sppErr.Retryable()
+	}
+	return errors.Is(err, client.ErrRenewalAlreadyUsed) || errors.Is(err, client.ErrFileNotFound) || errors.Is(err, client.ErrForbidden)
+}
+
+// Renew asks the SPP to extend the storage of fileHash by durationDays, paid with the XES transfer txHash.
+// It waits for the transfer to be mined and confirmed and returns the expiry returned by the SPP.
+func (me *Handler) Renew(spUrl, fileHash, txHash string, durationDays int) (int64, error) {
+	if len(me.cfg.ForceSpp) > 10 {
+		spUrl = me.cfg.ForceSpp
+	}
+	if spUrl == "" {
+		return 0, ErrEmptySpURL
+	}
+
+	for count := 1; count <= renewalTries; count++ {
+		if me.closing {
+			return 0, os.ErrClosed
+		}
+		//the transfer needs at least a block to be mined, wait longer with every try
+		sleep := count * 5
+		log.Printf("[Handler][Renew] sleep %d seconds before renewing %s", sleep, fileHash)
+		time.Sleep(time.Second * time.Duration(sleep))
+
+		r, err := client.Challenge(spUrl)
+		if err != nil || r == nil {
+			log.Printf("[Handler][Renew] try %d: error when connecting to SPP(%s) to request the challenge err %v", count, spUrl, err)
+			continue
+		}
+		bts, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			continue
+		}
+		resp := fs.SignMsg{}
+		if err = json.Unmarshal(bts, &resp); err != nil {
+			continue
+		}
+		sig, err := me.wallet.SignWithETHofActiveAccount([]byte(resp.Challenge))
+		if err == account.ErrAccountLocked {
+			return 0, err
+		}
+		if err != nil {
+			continue
+		}
+
+		expiry, err := client.Renew(context.TODO(), spUrl, fileHash, resp.Token, string(sig), txHash, durationDays)
+		if errors.Is(err, client.ErrRenewalPaymentNotFound) {
+			log.Printf("[Handler][Renew] try %d: payment %s for %s not confirmed yet", count, txHash, fileHash)
+			continue
+		}
+		if err != nil {
+			log.Printf("[Handler][Renew] renewal of %s with payment %s failed: %v", fileHash, txHash, err)
+			return 0, err
+		}
+		return expiry, nil
+	}
+	return 0, ErrRenewalTimeout
+}
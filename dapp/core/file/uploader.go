@@ -3,7 +3,7 @@ package file
 import (
 	"context"
 	"encoding/json"
-	"io/ioutil"
+	"errors"
 	"log"
 	"math"
 	"os"
@@ -15,9 +15,9 @@ import (
 
 	"github.com/ProxeusApp/storage-app/dapp/core/account"
 	"github.com/ProxeusApp/storage-app/dapp/core/embdb"
+	"github.com/ProxeusApp/storage-app/lib/grant"
 	"github.com/ProxeusApp/storage-app/spp/client"
 	"github.com/ProxeusApp/storage-app/spp/config"
-	"github.com/ProxeusApp/storage-app/spp/fs"
 )
 
 const (
@@ -40,6 +40,7 @@ type (
 		uploadDownloadSyncMutex  *sync.Mutex
 		listener                 func(stype, fhash, spUrl, txHash, status, name string, percentage float32) error
 		listenerLock             sync.RWMutex
+		stored                   func(pending Pending) // Called once the SPP stored the archive of pending
 	}
 )
 
@@ -225,8 +226,13 @@ func (me *Uploader) uploadHandler() {
 }
 
 // Returns filehash after having scheduled an upload of the encrypted file
-func (me *Uploader) scheduleUpload(archiveFile EncryptedArchive, reg Register, publicKeys [][]byte, spUrl string, readyForUpload bool) (string, *Pending, error) {
+func (me *Uploader) scheduleUpload(archiveFile EncryptedArchive, reg Register, publicKeys [][]byte, spUrl string, readyForUpload bool,
+	feeTx string) (string, *Pending, error) {
 	currentAccountETHAddr := strings.ToLower(me.wallet.GetActiveAccountETHAddress())
+	merkleRoot, err := archiveMerkleRoot(archiveFile.AbsolutePath)
+	if err != nil {
+		return "", nil, err
+	}
 	pending := &Pending{
 		CurrentAddress:  currentAccountETHAddr,
 		ArchiveFilePath: archiveFile.AbsolutePath,
@@ -236,6 +242,9 @@ func (me *Uploader) scheduleUpload(archiveFile EncryptedArchive, reg Register, p
 		SpUrl:           spUrl,
 		FileHash:        archiveFile.FileHash,
 		DurationDays:    reg.DurationDays,
+		MerkleRoot:      merkleRoot,
+		ArchiveSize:     archiveFile.Size,
+		FeeTx:           feeTx,
 	}
 	bts, err := json.Marshal(pending)
 	if err != nil {
@@ -282,6 +291,8 @@ func (me *Uploader) sppUpload(acc *account.Account, pending Pending) error {
 	//sync ----------------------------------------------
 
 	//try a couple of times in case server is not reachable
+	//every try continues the upload session on the SPP at the last acknowledged offset,
+	//so already transferred chunks aren't sent again
 	paymentNotFoundCount := 0
 	for count := 1; count < 3; count++ {
 		if *me.closing {
@@ -297,35 +308,16 @@ func (me *Uploader) sppUpload(acc *account.Account, pending Pending) error {
 		log.Printf("[Uploader][sppUpload] sleep %d seconds before upload", sleepDuration)
 		time.Sleep(time.Second * time.Duration(sleepDuration))
 
-		response, err := client.Challenge(spUrl)
-		if err != nil || response == nil {
-			log.Printf("[Uploader][sppUpload] Try %d: error connecting to SPP(%s) to request the challenge. Error: %s\n",
-				count, spUrl, err.Error())
-			continue
-		}
-
-		bts, err := ioutil.ReadAll(response.Body)
-		response.Body.Close()
-		if err != nil {
-			log.Printf("[Uploader][sppUpload] Try %d: error when connecting to SPP(%s) Response from spp not readable. Error: %s\n",
-				count, spUrl, err.Error())
-			continue
-		}
-		resp := fs.SignMsg{}
-		err = json.Unmarshal(bts, &resp)
-		if err != nil {
-			return err
-		}
-		sig, err := acc.SignWithETH([]byte(resp.Challenge))
-		if err == account.ErrAccountLocked {
+		encodedGrant, err := signGrant(me.cfg, spUrl, pending.FileHash, grant.OperationWrite, acc.SignHash)
+		if err == account.ErrAccountLocked || err == ErrGrantDomainMismatch {
 			return err
 		}
 		if *me.closing {
 			return os.ErrClosed
 		}
 		if err != nil {
-			log.Printf("[Uploader][sppUpload] Try %d: error when signing the challenge of the SPP(%s) with address %s\n",
-				count, spUrl, acc.GetETHAddress())
+			log.Printf("[Uploader][sppUpload] Try %d: error when signing the upload grant for the SPP(%s) with address %s. Error: %s\n",
+				count, spUrl, acc.GetETHAddress(), err.Error())
 			continue
 		}
 		var archiveFile *os.File
@@ -357,10 +349,12 @@ func (me *Uploader) sppUpload(acc *account.Account, pending Pending) error {
 			pending.Percentage = percentage
 			_ = me.notify(StatusUpload, pending.FileHash, pending.SpUrl, pending.TxHash, StatusPending, pending.FileName, percentage)
 		}
-		_, err = client.InputWithContext(spUrl, pending.FileHash, resp.Token, string(sig), archiveFile, ctx, stat.Size(), transferProgressCallback, pending.DurationDays)
+		_, err = client.InputWithGrant(ctx, spUrl, pending.FileHash, encodedGrant, archiveFile, stat.Size(), transferProgressCallback, pending.DurationDays,
+			pending.FeeTx)
 		_ = archiveFile.Close()
 		if err != nil {
-			if err == client.ErrFilePaymentNotFound {
+			if errors.Is(err, client.ErrFilePaymentNotFound) {
+				//the archive is kept on the SPP, the next try only finalizes the upload
 				paymentNotFoundCount++
 				log.Printf("[uploader][sppUpload] ErrFilePaymentNotFound file: %s, paymentNotFoundCount: %d", pending.FileHash, paymentNotFoundCount)
 				if paymentNotFoundCount >= 4 {
@@ -369,12 +363,22 @@ func (me *Uploader) sppUpload(acc *account.Account, pending Pending) error {
 				count-- //lower count if payment not found because we will try more than 3 times
 				continue
 			}
+			var sppErr *client.Error
+			if errors.As(err, &sppErr) && !sppErr.Retryable() {
+				//the same request would fail again
+				if sppErr.NeedsPayment() {
+					log.Printf("[uploader][sppUpload] SPP(%s) doesn't accept the payment of file %s, a new payment is needed: %s", spUrl, pending.FileHash, err.Error())
+				} else {
+					log.Printf("[uploader][sppUpload] SPP(%s) rejected the upload of file %s: %s", spUrl, pending.FileHash, err.Error())
+				}
+				return err
+			}
 			log.Printf("[uploader][sppUpload] Try %d: error when uploading the file(%s) to the SPP(%s) with address %s. Error: %s\n",
 				count, pending.FileHash, spUrl, acc.GetETHAddress(), err.Error())
 			continue
 		}
 		pending.UploadedToSPP = true
-		bts, err = json.Marshal(pending)
+		bts, err := json.Marshal(pending)
 		if err != nil {
 			return err
 		}
@@ -382,6 +386,9 @@ func (me *Uploader) sppUpload(acc *account.Account, pending Pending) error {
 		if err != nil {
 			continue
 		}
+		if me.stored != nil {
+			me.stored(pending)
+		}
 		downStatus.closeSync.Lock()
 		downStatus.cancel = nil
 		downStatus.closeSync.Unlock()
@@ -0,0 +1,162 @@
+package challenge
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+/**
+Keeps challenges and used keys in a bolt database, so issued challenges and used grants survive a restart.
+Expired entries are swept periodically. The database is locked to one process, it isn't shared between instances.
+*/
+type (
+	boltStore struct {
+		db       *bolt.DB
+		stopChan chan bool
+	}
+
+	boltEntry struct {
+		Challenge string
+		Expiry    time.Time
+	}
+)
+
+const sweepInterval = 10 * time.Minute
+
+var (
+	challengeBucket = []byte("challenges")
+	usedBucket      = []byte("used")
+)
+
+func NewBoltStore(path string) (ChallengeStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{challengeBucket, usedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	me := &boltStore{db: db, stopChan: make(chan bool)}
+	go me.sweep()
+	return me, nil
+}
+
+func (me *boltStore) Put(msg *SignMsg, ttl time.Duration) error {
+	bts, err := json.Marshal(boltEntry{Challenge: msg.Challenge, Expiry: time.Now().Add(ttl)})
+	if err != nil {
+		return err
+	}
+	return me.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(challengeBucket).Put([]byte(msg.Token), bts)
+	})
+}
+
+func (me *boltStore) Take(token string) (*SignMsg, error) {
+	var entry boltEntry
+	err := me.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(challengeBucket)
+		bts := b.Get([]byte(token))
+		if bts == nil {
+			return ErrChallengeNotFound
+		}
+		if err := json.Unmarshal(bts, &entry); err != nil {
+			return err
+		}
+		return b.Delete([]byte(token))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(entry.Expiry) {
+		return nil, ErrChallengeNotFound
+	}
+	return &SignMsg{Token: token, Challenge: entry.Challenge}, nil
+}
+
+func (me *boltStore) UseOnce(key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	bts, err := json.Marshal(boltEntry{Expiry: now.Add(ttl)})
+	if err != nil {
+		return false, err
+	}
+	used := false
+	err = me.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(usedBucket)
+		if prev := b.Get([]byte(key)); prev != nil {
+			var entry boltEntry
+			if err := json.Unmarshal(prev, &entry); err == nil && now.Before(entry.Expiry) {
+				used = true
+				return nil
+			}
+		}
+		return b.Put([]byte(key), bts)
+	})
+	if err != nil {
+		return false, err
+	}
+	return !used, nil
+}
+
+func (me *boltStore) sweep() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := me.removeExpired(); err != nil {
+				log.Println("[challenge][boltStore] couldn't remove expired entries: ", err)
+			}
+		case <-me.stopChan:
+			return
+		}
+	}
+}
+
+func (me *boltStore) removeExpired() error {
+	now := time.Now()
+	return me.db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{challengeBucket, usedBucket} {
+			if err := removeExpiredFrom(tx.Bucket(bucket), now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func removeExpiredFrom(b *bolt.Bucket, now time.Time) error {
+	var expired [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		var entry boltEntry
+		if err := json.Unmarshal(v, &entry); err != nil || now.After(entry.Expiry) {
+			expired = append(expired, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range expired {
+		if err = b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (me *boltStore) Close() error {
+	close(me.stopChan)
+	return me.db.Close()
+}
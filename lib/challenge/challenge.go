@@ -0,0 +1,140 @@
+package challenge
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/ProxeusApp/storage-app/lib/wallet"
+)
+
+/**
+Sign-in challenges prove control over an ethereum address. A client requests a challenge, signs it with its key
+and sends back the token together with the signature. Every challenge can be used exactly once and only until
+its TTL has passed.
+
+Usage:
+
+	auth := challenge.NewAuthenticator(challenge.NewMemoryStore(), challenge.DefaultTTL)
+	msg, _ := auth.CreateSignInChallenge()
+	addr, err := auth.Validate(msg.Token, signatureHex)
+*/
+type (
+	// ChallengeStore keeps issued challenges until they are taken or expired
+	ChallengeStore interface {
+		Put(msg *SignMsg, ttl time.Duration) error
+		// Take returns the challenge of the token and removes it in the same step
+		Take(token string) (*SignMsg, error)
+		// UseOnce records key as used until ttl has passed, it returns false if key has been used already
+		UseOnce(key string, ttl time.Duration) (bool, error)
+		Close() error
+	}
+
+	SignMsg struct {
+		Token     string `json:"token"`
+		Challenge string `json:"challenge"`
+	}
+
+	// Limits how often an address signs in, see lib/ratelimit
+	AddressLimiter interface {
+		AllowAddress(addr string) error
+	}
+
+	Authenticator struct {
+		store   ChallengeStore
+		ttl     time.Duration
+		limiter AddressLimiter
+	}
+)
+
+const (
+	DefaultTTL = 5 * time.Minute
+
+	signInMessage = "Sign this message to login: "
+)
+
+var (
+	ErrChallengeNotFound = errors.New("challenge not found or expired")
+	ErrUnknownStore      = errors.New("unknown challenge store")
+	ErrInvalidSignature  = wallet.ErrInvalidSignature
+)
+
+func NewAuthenticator(store ChallengeStore, ttl time.Duration) *Authenticator {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Authenticator{store: store, ttl: ttl}
+}
+
+func (me *Authenticator) CreateSignInChallenge() (*SignMsg, error) {
+	u, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	msg := &SignMsg{Token: u.String(), Challenge: wallet.CreateSignInChallenge(signInMessage)}
+	if err = me.store.Put(msg, me.ttl); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Validate returns the address which signed the challenge of token.
+// The challenge is consumed even if the signature is invalid, so a token can't be replayed.
+func (me *Authenticator) Validate(token, signatureHex string) (addr string, err error) {
+	addr, _, err = me.ValidateMsg(token, signatureHex)
+	return addr, err
+}
+
+// Like Validate, also returns the signed challenge, for records of what a sign in authorized
+func (me *Authenticator) ValidateMsg(token, signatureHex string) (addr string, msg *SignMsg, err error) {
+	msg, err = me.store.Take(token)
+	if err != nil {
+		return "", nil, err
+	}
+	addr, err = wallet.VerifySignInChallenge(msg.Challenge, signatureHex)
+	if err != nil || me.limiter == nil {
+		return addr, msg, err
+	}
+	if err = me.limiter.AllowAddress(addr); err != nil {
+		return "", nil, err
+	}
+	return addr, msg, nil
+}
+
+// Rejects validated sign ins of addresses over their limit with the error of limiter
+func (me *Authenticator) SetAddressLimiter(limiter AddressLimiter) {
+	me.limiter = limiter
+}
+
+// Records key as used until ttl has passed in the challenge store, returns false if it has been used already.
+// Lets signed grants be used once only, see lib/grant.
+func (me *Authenticator) UseOnce(key string, ttl time.Duration) (bool, error) {
+	return me.store.UseOnce(key, ttl)
+}
+
+func (me *Authenticator) Close() error {
+	return me.store.Close()
+}
+
+const (
+	StoreMemory = "memory"
+	StoreBolt   = "bolt"
+
+	boltStoreFilename = "challenges.db"
+)
+
+// Returns the challenge store of kind, bolt is the default and kept in dir.
+// Neither store is shared: bolt locks its file to one process, so every instance of a server needs its own dir and
+// a challenge or grant is only known to the instance which issued or accepted it. Run a single instance, or route the
+// requests of a client to the same instance.
+func NewStore(kind, dir string) (ChallengeStore, error) {
+	switch kind {
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case "", StoreBolt:
+		return NewBoltStore(filepath.Join(dir, boltStoreFilename))
+	}
+	return nil, ErrUnknownStore
+}
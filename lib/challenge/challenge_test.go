@@ -0,0 +1,163 @@
+package challenge
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "challenge-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "challenges.db")
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+
+	// issued challenges survive a restart
+	store, err = NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, store.Put(&SignMsg{Token: "restart", Challenge: "0x01"}, time.Minute))
+	_, err = store.UseOnce("restart", time.Minute)
+	assert.NoError(t, err)
+	store.Close()
+	store, err = NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	msg, err := store.Take("restart")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "0x01", msg.Challenge)
+	}
+	// used keys stay used
+	first, err := store.UseOnce("restart", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, first)
+}
+
+func testStore(t *testing.T, store ChallengeStore) {
+	defer store.Close()
+	auth := NewAuthenticator(store, time.Minute)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := auth.CreateSignInChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, err := auth.Validate(msg.Token, sign(t, msg.Challenge, key))
+	if assert.NoError(t, err) {
+		assert.Equal(t, crypto.PubkeyToAddress(key.PublicKey).String(), addr)
+	}
+
+	// a challenge can only be used once
+	_, err = auth.Validate(msg.Token, sign(t, msg.Challenge, key))
+	assert.Equal(t, ErrChallengeNotFound, err)
+
+	// expired challenges are rejected
+	assert.NoError(t, store.Put(&SignMsg{Token: "expired", Challenge: msg.Challenge}, time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	_, err = auth.Validate("expired", sign(t, msg.Challenge, key))
+	assert.Equal(t, ErrChallengeNotFound, err)
+
+	// a key is used once until its TTL has passed
+	first, err := auth.UseOnce("nonce", 10*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, first)
+	first, err = auth.UseOnce("nonce", 10*time.Millisecond)
+	assert.NoError(t, err)
+	assert.False(t, first)
+	time.Sleep(20 * time.Millisecond)
+	first, err = auth.UseOnce("nonce", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, first)
+}
+
+type limiterFunc func(addr string) error
+
+func (me limiterFunc) AllowAddress(addr string) error {
+	return me(addr)
+}
+
+func TestAddressLimiter(t *testing.T) {
+	auth := NewAuthenticator(NewMemoryStore(), time.Minute)
+	defer auth.Close()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errLimited := errors.New("limited")
+	var limited []string
+	auth.SetAddressLimiter(limiterFunc(func(addr string) error {
+		limited = append(limited, addr)
+		return errLimited
+	}))
+
+	msg, err := auth.CreateSignInChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = auth.Validate(msg.Token, sign(t, msg.Challenge, key))
+	assert.Equal(t, errLimited, err)
+	assert.Equal(t, []string{crypto.PubkeyToAddress(key.PublicKey).String()}, limited)
+
+	// invalid signatures don't reach the limiter
+	msg, err = auth.CreateSignInChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = auth.Validate(msg.Token, "0x00")
+	assert.Error(t, err)
+	assert.Len(t, limited, 1)
+
+	// the signed challenge is returned for the records of the caller
+	auth.SetAddressLimiter(nil)
+	msg, err = auth.CreateSignInChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, signed, err := auth.ValidateMsg(msg.Token, sign(t, msg.Challenge, key))
+	assert.NoError(t, err)
+	assert.Equal(t, crypto.PubkeyToAddress(key.PublicKey).String(), addr)
+	assert.Equal(t, msg, signed)
+}
+
+// Signs the challenge like eth_sign does
+func sign(t *testing.T, challengeHex string, key *ecdsa.PrivateKey) string {
+	challenge, err := hex.DecodeString(challengeHex[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := crypto.Keccak256(append([]byte("\x19Ethereum Signed Message:\n"+strconv.Itoa(len(challenge))), challenge...))
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	return "0x" + hex.EncodeToString(sig)
+}
@@ -0,0 +1,47 @@
+package challenge
+
+import (
+	"sync"
+	"time"
+
+	cache "github.com/patrickmn/go-cache"
+)
+
+// Keeps challenges in process memory, they are lost on restart
+type memoryStore struct {
+	lock sync.Mutex
+	c    *cache.Cache
+	used *cache.Cache
+}
+
+func NewMemoryStore() ChallengeStore {
+	return &memoryStore{c: cache.New(DefaultTTL, 10*time.Minute), used: cache.New(DefaultTTL, 10*time.Minute)}
+}
+
+func (me *memoryStore) Put(msg *SignMsg, ttl time.Duration) error {
+	me.c.Set(msg.Token, *msg, ttl)
+	return nil
+}
+
+func (me *memoryStore) Take(token string) (*SignMsg, error) {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	x, found := me.c.Get(token)
+	if !found {
+		return nil, ErrChallengeNotFound
+	}
+	me.c.Delete(token)
+	msg := x.(SignMsg)
+	return &msg, nil
+}
+
+func (me *memoryStore) UseOnce(key string, ttl time.Duration) (bool, error) {
+	// Add fails if the key is there and not expired yet
+	return me.used.Add(key, true, ttl) == nil, nil
+}
+
+func (me *memoryStore) Close() error {
+	me.c.Flush()
+	me.used.Flush()
+	return nil
+}
@@ -0,0 +1,289 @@
+package grant
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	cache "github.com/patrickmn/go-cache"
+)
+
+/**
+Grants authorize a single operation on a single file of a storage provider, without handing out a sign in.
+A grant is EIP-712 typed data signed like eth_signTypedData_v4:
+
+	EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)
+	Grant(bytes32 fileHash,string operation,address provider,uint256 expiry,bytes32 nonce)
+
+The domain binds the grant to the chain and the ProxeusFS contract, the provider field to one storage provider.
+A grant is valid until its expiry, unix seconds, and only once: the provider remembers the nonce until then,
+in its NonceStore so that used grants stay used across restarts.
+It is sent base64url encoded JSON in the Storage-Grant header.
+
+Usage:
+
+	g, _ := grant.New(fileHash, grant.OperationRead, providerAddress, 10*time.Minute)
+	_ = g.Sign(domain, grant.KeySigner(key))
+	req.Header.Set(grant.Header, g.Encode())
+*/
+type (
+	Domain struct {
+		Name              string `json:"name"`
+		Version           string `json:"version"`
+		ChainID           int64  `json:"chainId"`
+		VerifyingContract string `json:"verifyingContract"`
+	}
+
+	Grant struct {
+		FileHash  string `json:"fileHash"`
+		Operation string `json:"operation"`
+		Provider  string `json:"provider"`
+		Expiry    int64  `json:"expiry"`
+		Nonce     string `json:"nonce"`
+		Signature string `json:"signature,omitempty"` // Hex encoded, v is 27 or 28
+	}
+
+	// Signs the EIP-712 digest of a grant, returns the hex encoded signature
+	DigestSigner func(digest []byte) (string, error)
+
+	// Records used nonces, see challenge.Authenticator.UseOnce
+	NonceStore interface {
+		// UseOnce records nonce as used until ttl has passed, it returns false if nonce has been used already
+		UseOnce(nonce string, ttl time.Duration) (bool, error)
+	}
+
+	// Checks the grants presented to a storage provider and remembers their nonces
+	Verifier struct {
+		domain      Domain
+		provider    common.Address
+		maxValidity time.Duration
+
+		nonces NonceStore
+		now    func() time.Time
+	}
+
+	// Keeps used nonces in process memory, they are lost on restart
+	memoryNonces struct {
+		used *cache.Cache
+	}
+)
+
+const (
+	OperationRead  = "read"
+	OperationWrite = "write"
+
+	DomainName    = "Proxeus Storage"
+	DomainVersion = "1"
+
+	// HTTP header carrying the encoded grant
+	Header = "Storage-Grant"
+
+	// Keeps the nonces apart from other keys of a shared NonceStore
+	nonceKeyPrefix = "grant:"
+)
+
+var (
+	domainTypeHash = crypto.Keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+	grantTypeHash  = crypto.Keccak256([]byte("Grant(bytes32 fileHash,string operation,address provider,uint256 expiry,bytes32 nonce)"))
+
+	ErrInvalidGrant     = errors.New("invalid grant")
+	ErrGrantScope       = errors.New("grant doesn't cover the operation")
+	ErrGrantExpired     = errors.New("grant expired")
+	ErrGrantTooLong     = errors.New("grant is valid for longer than the provider accepts")
+	ErrGrantAlreadyUsed = errors.New("grant has been used already")
+)
+
+func NewDomain(chainID int64, contract string) Domain {
+	return Domain{Name: DomainName, Version: DomainVersion, ChainID: chainID, VerifyingContract: contract}
+}
+
+// Returns an unsigned grant of operation on fileHash at provider, valid for validity from now on
+func New(fileHash, operation, provider string, validity time.Duration) (*Grant, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &Grant{
+		FileHash:  fileHash,
+		Operation: operation,
+		Provider:  provider,
+		Expiry:    time.Now().Add(validity).Unix(),
+		Nonce:     hexutil.Encode(nonce),
+	}, nil
+}
+
+// Returns the EIP-712 digest of g, the hash which is signed
+func (me Domain) Digest(g *Grant) ([]byte, error) {
+	if !common.IsHexAddress(me.VerifyingContract) || !common.IsHexAddress(g.Provider) {
+		return nil, ErrInvalidGrant
+	}
+	fileHash, err := bytes32(g.FileHash)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := bytes32(g.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if g.Expiry < 0 {
+		return nil, ErrInvalidGrant
+	}
+	domainSeparator := crypto.Keccak256(
+		domainTypeHash,
+		crypto.Keccak256([]byte(me.Name)),
+		crypto.Keccak256([]byte(me.Version)),
+		math.PaddedBigBytes(big.NewInt(me.ChainID), 32),
+		common.LeftPadBytes(common.HexToAddress(me.VerifyingContract).Bytes(), 32),
+	)
+	structHash := crypto.Keccak256(
+		grantTypeHash,
+		fileHash,
+		crypto.Keccak256([]byte(g.Operation)),
+		common.LeftPadBytes(common.HexToAddress(g.Provider).Bytes(), 32),
+		math.PaddedBigBytes(big.NewInt(g.Expiry), 32),
+		nonce,
+	)
+	return crypto.Keccak256([]byte("\x19\x01"), domainSeparator, structHash), nil
+}
+
+// Returns the address which signed g
+func (me Domain) Signer(g *Grant) (string, error) {
+	digest, err := me.Digest(g)
+	if err != nil {
+		return "", err
+	}
+	sig, err := hexutil.Decode(g.Signature)
+	if err != nil || len(sig) != 65 {
+		return "", ErrInvalidGrant
+	}
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pub, err := crypto.SigToPub(digest, sig)
+	if err != nil {
+		return "", ErrInvalidGrant
+	}
+	return crypto.PubkeyToAddress(*pub).Hex(), nil
+}
+
+// Signs the grant for domain
+func (me *Grant) Sign(domain Domain, sign DigestSigner) error {
+	digest, err := domain.Digest(me)
+	if err != nil {
+		return err
+	}
+	me.Signature, err = sign(digest)
+	return err
+}
+
+// Signs digests with key
+func KeySigner(key *ecdsa.PrivateKey) DigestSigner {
+	return func(digest []byte) (string, error) {
+		sig, err := crypto.Sign(digest, key)
+		if err != nil {
+			return "", err
+		}
+		sig[64] += 27
+		return hexutil.Encode(sig), nil
+	}
+}
+
+// Returns the grant as base64url encoded JSON
+func (me *Grant) Encode() string {
+	bts, _ := json.Marshal(me)
+	return base64.RawURLEncoding.EncodeToString(bts)
+}
+
+func Decode(encoded string) (*Grant, error) {
+	bts, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return nil, ErrInvalidGrant
+	}
+	g := &Grant{}
+	if err = json.Unmarshal(bts, g); err != nil {
+		return nil, ErrInvalidGrant
+	}
+	return g, nil
+}
+
+func bytes32(hexStr string) ([]byte, error) {
+	bts, err := hex.DecodeString(strings.TrimPrefix(hexStr, "0x"))
+	if err != nil || len(bts) != 32 {
+		return nil, ErrInvalidGrant
+	}
+	return bts, nil
+}
+
+// Accepts grants of domain for provider which expire within maxValidity
+func NewVerifier(domain Domain, provider common.Address, maxValidity time.Duration) *Verifier {
+	return &Verifier{
+		domain:      domain,
+		provider:    provider,
+		maxValidity: maxValidity,
+		nonces:      &memoryNonces{used: cache.New(maxValidity, 10*time.Minute)},
+		now:         time.Now,
+	}
+}
+
+// Records used nonces in store instead of process memory
+func (me *Verifier) SetNonceStore(store NonceStore) {
+	me.nonces = store
+}
+
+// Returns the domain grants have to be signed for
+func (me *Verifier) Domain() Domain {
+	return me.domain
+}
+
+func (me *Verifier) Provider() common.Address {
+	return me.provider
+}
+
+// Returns the address which granted operation on fileHash with the encoded grant.
+// The nonce of the grant is used up, even if the operation fails afterwards.
+func (me *Verifier) Verify(encoded, fileHash, operation string) (addr string, err error) {
+	g, err := Decode(encoded)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(g.FileHash, fileHash) || g.Operation != operation ||
+		!common.IsHexAddress(g.Provider) || common.HexToAddress(g.Provider) != me.provider {
+		return "", ErrGrantScope
+	}
+	now := me.now()
+	expiry := time.Unix(g.Expiry, 0)
+	if !expiry.After(now) {
+		return "", ErrGrantExpired
+	}
+	if expiry.Sub(now) > me.maxValidity {
+		return "", ErrGrantTooLong
+	}
+	addr, err = me.domain.Signer(g)
+	if err != nil {
+		return "", err
+	}
+
+	first, err := me.nonces.UseOnce(nonceKeyPrefix+strings.ToLower(g.Nonce), expiry.Sub(now))
+	if err != nil {
+		return "", err
+	}
+	if !first {
+		return "", ErrGrantAlreadyUsed
+	}
+	return addr, nil
+}
+
+func (me *memoryNonces) UseOnce(nonce string, ttl time.Duration) (bool, error) {
+	// Add fails if the nonce is there and not expired yet
+	return me.used.Add(nonce, true, ttl) == nil, nil
+}
@@ -0,0 +1,160 @@
+package grant
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core"
+	cache "github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testContract = "0x1111111111111111111111111111111111111111"
+	testProvider = "0x2222222222222222222222222222222222222222"
+	testFileHash = "0x9c22ff5f21f0b81b113e63f7db6da94fedef11b2119b4088b89664fb9a3cb658"
+)
+
+func TestDigest(t *testing.T) {
+	domain := NewDomain(3, testContract)
+	g, err := New(testFileHash, OperationRead, testProvider, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := domain.Digest(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the digest equals the one of eth_signTypedData
+	typedData := core.TypedData{
+		Types: core.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+		},
+		PrimaryType: "Grant",
+		Domain: core.TypedDataDomain{
+			Name:              DomainName,
+			Version:           DomainVersion,
+			ChainId:           math.NewHexOrDecimal256(3),
+			VerifyingContract: testContract,
+		},
+		Message: core.TypedDataMessage{
+			"fileHash":  hexutil.MustDecode(testFileHash),
+			"operation": OperationRead,
+			"provider":  testProvider,
+			"expiry":    fmt.Sprint(g.Expiry),
+			"nonce":     hexutil.MustDecode(g.Nonce),
+		},
+	}
+	domainSeparator, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// HashStruct of this go-ethereum version rejects bytes32 fields, the grant is encoded field by field instead
+	typedData.Types["Grant"] = []core.Type{
+		{Name: "fileHash", Type: "bytes32"},
+		{Name: "operation", Type: "string"},
+		{Name: "provider", Type: "address"},
+		{Name: "expiry", Type: "uint256"},
+		{Name: "nonce", Type: "bytes32"},
+	}
+	encoded := typedData.TypeHash("Grant")
+	for _, field := range typedData.Types["Grant"] {
+		value := typedData.Message[field.Name]
+		if bts, ok := value.([]byte); ok {
+			value = hexutil.Bytes(bts)
+		}
+		enc, err := typedData.EncodePrimitiveValue(field.Type, value, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded = append(encoded, enc...)
+	}
+	structHash := crypto.Keccak256(encoded)
+	assert.Equal(t, crypto.Keccak256([]byte("\x19\x01"), domainSeparator, structHash), digest)
+
+	g.Nonce = "0x01"
+	_, err = domain.Digest(g)
+	assert.Equal(t, ErrInvalidGrant, err)
+}
+
+func TestVerifier(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	domain := NewDomain(3, testContract)
+	now := time.Now()
+	v := NewVerifier(domain, common.HexToAddress(testProvider), time.Hour)
+	v.now = func() time.Time { return now }
+
+	signed := func(fileHash, operation, provider string, validity time.Duration) string {
+		g, err := New(fileHash, operation, provider, validity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = g.Sign(domain, KeySigner(key)); err != nil {
+			t.Fatal(err)
+		}
+		return g.Encode()
+	}
+
+	encoded := signed(testFileHash, OperationWrite, testProvider, 10*time.Minute)
+	signer, err := v.Verify(encoded, testFileHash, OperationWrite)
+	assert.NoError(t, err)
+	assert.Equal(t, addr, signer)
+	_, err = v.Verify(encoded, testFileHash, OperationWrite)
+	assert.Equal(t, ErrGrantAlreadyUsed, err)
+
+	_, err = v.Verify(signed(testFileHash, OperationWrite, testProvider, time.Minute), testFileHash, OperationRead)
+	assert.Equal(t, ErrGrantScope, err)
+	_, err = v.Verify(signed(testFileHash, OperationRead, testContract, time.Minute), testFileHash, OperationRead)
+	assert.Equal(t, ErrGrantScope, err)
+	_, err = v.Verify(signed(testFileHash, OperationRead, testProvider, time.Minute), "0x01", OperationRead)
+	assert.Equal(t, ErrGrantScope, err)
+	_, err = v.Verify(signed(testFileHash, OperationRead, testProvider, -time.Minute), testFileHash, OperationRead)
+	assert.Equal(t, ErrGrantExpired, err)
+	_, err = v.Verify(signed(testFileHash, OperationRead, testProvider, 2*time.Hour), testFileHash, OperationRead)
+	assert.Equal(t, ErrGrantTooLong, err)
+	_, err = v.Verify("grant", testFileHash, OperationRead)
+	assert.Equal(t, ErrInvalidGrant, err)
+
+	// a grant of another chain recovers another address
+	other := NewDomain(1, testContract)
+	g, _ := New(testFileHash, OperationRead, testProvider, time.Minute)
+	_ = g.Sign(other, KeySigner(key))
+	signer, err = v.Verify(g.Encode(), testFileHash, OperationRead)
+	assert.NoError(t, err)
+	assert.NotEqual(t, addr, signer)
+
+	// the expiry is signed
+	g, _ = New(testFileHash, OperationRead, testProvider, time.Minute)
+	_ = g.Sign(domain, KeySigner(key))
+	g.Expiry = new(big.Int).Add(big.NewInt(g.Expiry), big.NewInt(60)).Int64()
+	signer, err = v.Verify(g.Encode(), testFileHash, OperationRead)
+	assert.NoError(t, err)
+	assert.NotEqual(t, addr, signer)
+
+	// a verifier sharing the nonce store, like one started again with a persistent store, doesn't accept used grants
+	store := &memoryNonces{used: cache.New(time.Hour, time.Hour)}
+	v.SetNonceStore(store)
+	encoded = signed(testFileHash, OperationRead, testProvider, time.Minute)
+	_, err = v.Verify(encoded, testFileHash, OperationRead)
+	assert.NoError(t, err)
+	restarted := NewVerifier(domain, common.HexToAddress(testProvider), time.Hour)
+	restarted.SetNonceStore(store)
+	_, err = restarted.Verify(encoded, testFileHash, OperationRead)
+	assert.Equal(t, ErrGrantAlreadyUsed, err)
+}
@@ -0,0 +1,14 @@
+// +build !windows
+
+package health
+
+import "syscall"
+
+// Returns the bytes available to unprivileged users on the file system of path
+func FreeDiskBytes(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
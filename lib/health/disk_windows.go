@@ -0,0 +1,8 @@
+package health
+
+import "errors"
+
+// Free disk space isn't checked on windows
+func FreeDiskBytes(path string) (uint64, error) {
+	return 0, errors.New("free disk space is unknown on windows")
+}
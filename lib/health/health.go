@@ -0,0 +1,138 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+/**
+Liveness and readiness checks of the SPP and the pgp-server.
+
+The liveness endpoint only shows that the process serves requests. The readiness endpoint runs every check and
+answers 503 Service Unavailable as soon as a critical one is down, e.g. a database which can't be read. Checks which
+aren't critical are reported without affecting the readiness. A check which doesn't return within the timeout is down.
+
+Usage:
+
+	checker := health.NewChecker(5 * time.Second)
+	checker.Add("database", true, func() (string, error) { return "", db.Ping() })
+	e.GET("/health/live", checker.Live)
+	e.GET("/health/ready", checker.Ready)
+*/
+type (
+	// Returns a short description of the checked state, an error if it is down
+	CheckFunc func() (info string, err error)
+
+	Checker struct {
+		timeout time.Duration
+		lock    sync.Mutex
+		checks  []check
+	}
+
+	check struct {
+		name     string
+		critical bool
+		run      CheckFunc
+	}
+
+	Status struct {
+		ServiceName string
+		Status      string
+		Info        string
+		Critical    bool // A critical check which is down makes the service unready
+	}
+
+	Report struct {
+		Status string
+		Checks []Status
+	}
+)
+
+const (
+	Up   = "UP"
+	Down = "DOWN"
+)
+
+var ErrTimeout = errors.New("check timed out")
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Adds a check, a critical check which is down makes the service unready
+func (me *Checker) Add(name string, critical bool, run CheckFunc) {
+	me.lock.Lock()
+	me.checks = append(me.checks, check{name: name, critical: critical, run: run})
+	me.lock.Unlock()
+}
+
+// Runs all checks at the same time, the status of the report is down if a critical check is
+func (me *Checker) Run() Report {
+	me.lock.Lock()
+	checks := me.checks
+	me.lock.Unlock()
+
+	report := Report{Status: Up, Checks: make([]Status, len(checks))}
+	var wg sync.WaitGroup
+	wg.Add(len(checks))
+	for i := range checks {
+		go func(i int) {
+			defer wg.Done()
+			report.Checks[i] = me.run(checks[i])
+		}(i)
+	}
+	wg.Wait()
+	for _, s := range report.Checks {
+		if s.Critical && s.Status == Down {
+			report.Status = Down
+		}
+	}
+	return report
+}
+
+func (me *Checker) run(c check) Status {
+	type result struct {
+		info string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		info, err := c.run()
+		done <- result{info, err}
+	}()
+	status := Status{ServiceName: c.name, Status: Up, Critical: c.critical}
+	timer := time.NewTimer(me.timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		status.Info = r.info
+		if r.err != nil {
+			status.Status = Down
+			if status.Info == "" {
+				status.Info = r.err.Error()
+			}
+		}
+	case <-timer.C:
+		status.Status = Down
+		status.Info = ErrTimeout.Error()
+	}
+	return status
+}
+
+// Answers 200 as long as the process serves requests
+func (me *Checker) Live(c echo.Context) error {
+	return c.JSON(http.StatusOK, Report{Status: Up})
+}
+
+// Answers 200 with the report if the service is ready, 503 if a critical check is down
+func (me *Checker) Ready(c echo.Context) error {
+	report := me.Run()
+	if report.Status == Down {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
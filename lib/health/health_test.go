@@ -0,0 +1,52 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker(t *testing.T) {
+	checker := NewChecker(50 * time.Millisecond)
+	checker.Add("db", true, func() (string, error) { return "ok", nil })
+	checker.Add("subscription", false, func() (string, error) { return "", errors.New("not subscribed") })
+
+	ready := func() (int, Report) {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/health/ready", nil), rec)
+		assert.NoError(t, checker.Ready(c))
+		var report Report
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		return rec.Code, report
+	}
+
+	// checks which aren't critical don't affect the readiness
+	code, report := ready()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, Up, report.Status)
+	assert.Equal(t, []Status{
+		{ServiceName: "db", Status: Up, Info: "ok", Critical: true},
+		{ServiceName: "subscription", Status: Down, Info: "not subscribed"},
+	}, report.Checks)
+
+	block := make(chan bool)
+	defer close(block)
+	checker.Add("node", true, func() (string, error) {
+		<-block
+		return "", nil
+	})
+	code, report = ready()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, Down, report.Status)
+	assert.Equal(t, Status{ServiceName: "node", Status: Down, Info: ErrTimeout.Error(), Critical: true}, report.Checks[2])
+
+	rec := httptest.NewRecorder()
+	assert.NoError(t, checker.Live(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/health/live", nil), rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
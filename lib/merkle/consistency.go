@@ -0,0 +1,86 @@
+package merkle
+
+import "bytes"
+
+/**
+Consistency proofs show that a tree is an append-only extension of an older tree, as used by transparency logs.
+The trees are built like in RFC 6962, carrying an odd node up gives the same roots, and the proofs follow its
+SUBPROOF algorithm, verified as described in RFC 9162.
+
+Usage:
+
+	proof := merkle.ConsistencyProof(leaves, oldCount)
+	ok := merkle.VerifyConsistency(oldRoot, newRoot, oldCount, len(leaves), proof)
+*/
+
+// Returns the proof that the tree of the first oldCount leaves is a prefix of the tree of all leaves
+func ConsistencyProof(leaves [][]byte, oldCount int) [][]byte {
+	if oldCount <= 0 || oldCount > len(leaves) {
+		return nil
+	}
+	return subProof(oldCount, leaves, true)
+}
+
+func subProof(m int, leaves [][]byte, complete bool) [][]byte {
+	n := len(leaves)
+	if m == n {
+		if complete {
+			return [][]byte{}
+		}
+		return [][]byte{Root(leaves)}
+	}
+	k := splitPoint(n)
+	if m <= k {
+		return append(subProof(m, leaves[:k], complete), Root(leaves[k:]))
+	}
+	return append(subProof(m-k, leaves[k:], false), Root(leaves[:k]))
+}
+
+// Reports whether proof shows that the tree with oldRoot and oldCount leaves is a prefix of the one with newRoot
+func VerifyConsistency(oldRoot, newRoot []byte, oldCount, newCount int, proof [][]byte) bool {
+	if oldCount <= 0 || oldCount > newCount {
+		return false
+	}
+	if oldCount == newCount {
+		return len(proof) == 0 && bytes.Equal(oldRoot, newRoot)
+	}
+	if oldCount&(oldCount-1) == 0 {
+		proof = append([][]byte{oldRoot}, proof...)
+	}
+	if len(proof) == 0 {
+		return false
+	}
+	fn, sn := oldCount-1, newCount-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = nodeHash(c, fr)
+			sr = nodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = nodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(fr, oldRoot) && bytes.Equal(sr, newRoot)
+}
+
+// Largest power of two smaller than n
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
@@ -0,0 +1,134 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+)
+
+/**
+Merkle trees over archives split into chunks of ChunkSize bytes, used to prove that a storage provider still holds an
+archive without downloading it. The leaves are the hashes of the chunks, an odd node at the end of a level is carried
+up to the next level unchanged. Leaves and inner nodes are hashed with different prefixes, so a node can't be passed
+off as a chunk.
+
+Usage:
+
+	leaves, _ := merkle.Leaves(archive)
+	root := merkle.Root(leaves)
+	proof := merkle.Proof(leaves, i)
+	ok := merkle.Verify(root, merkle.LeafHash(chunk), i, len(leaves), proof)
+*/
+
+const ChunkSize = 4096
+
+const (
+	leafPrefix byte = 0
+	nodePrefix byte = 1
+)
+
+// Returns the number of chunks of an archive of size bytes, an empty archive has one empty chunk
+func Chunks(size int64) int {
+	if size <= 0 {
+		return 1
+	}
+	return int((size + ChunkSize - 1) / ChunkSize)
+}
+
+func LeafHash(chunk []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(chunk)
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Reads r to the end and returns the hashes of its chunks
+func Leaves(r io.Reader) ([][]byte, error) {
+	var leaves [][]byte
+	chunk := make([]byte, ChunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 || len(leaves) == 0 && err == io.EOF {
+			leaves = append(leaves, LeafHash(chunk[:n]))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return leaves, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func Root(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		return nil
+	}
+	level := leaves
+	for len(level) > 1 {
+		level = parents(level)
+	}
+	return level[0]
+}
+
+// Returns the sibling hashes from the leaf at index up to the root
+func Proof(leaves [][]byte, index int) [][]byte {
+	if index < 0 || index >= len(leaves) {
+		return nil
+	}
+	proof := [][]byte{}
+	level := leaves
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof = append(proof, level[sibling])
+		}
+		level = parents(level)
+		index /= 2
+	}
+	return proof
+}
+
+// Reports whether proof leads from leaf at index of a tree with count leaves to root
+func Verify(root, leaf []byte, index, count int, proof [][]byte) bool {
+	if index < 0 || index >= count {
+		return false
+	}
+	hash := leaf
+	for ; count > 1; count = (count + 1) / 2 {
+		sibling := index ^ 1
+		if sibling < count {
+			if len(proof) == 0 {
+				return false
+			}
+			if index%2 == 0 {
+				hash = nodeHash(hash, proof[0])
+			} else {
+				hash = nodeHash(proof[0], hash)
+			}
+			proof = proof[1:]
+		}
+		index /= 2
+	}
+	return len(proof) == 0 && bytes.Equal(hash, root)
+}
+
+func parents(level [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 < len(level) {
+			next = append(next, nodeHash(level[i], level[i+1]))
+		} else {
+			next = append(next, level[i])
+		}
+	}
+	return next
+}
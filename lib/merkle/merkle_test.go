@@ -0,0 +1,82 @@
+package merkle
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerkle(t *testing.T) {
+	for _, size := range []int{0, 1, ChunkSize, ChunkSize + 1, 5*ChunkSize + 17} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i*7 + i/ChunkSize)
+		}
+		leaves, err := Leaves(bytes.NewReader(data))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Len(t, leaves, Chunks(int64(size)))
+		root := Root(leaves)
+
+		for i := range leaves {
+			end := (i + 1) * ChunkSize
+			if end > size {
+				end = size
+			}
+			chunk := data[i*ChunkSize : end]
+			proof := Proof(leaves, i)
+			assert.True(t, Verify(root, LeafHash(chunk), i, len(leaves), proof), "size %d chunk %d", size, i)
+
+			// a modified chunk or a proof for another index doesn't verify
+			assert.False(t, Verify(root, LeafHash(append([]byte{1}, chunk...)), i, len(leaves), proof))
+			if len(leaves) > 1 {
+				assert.False(t, Verify(root, LeafHash(chunk), (i+1)%len(leaves), len(leaves), proof))
+			}
+		}
+	}
+}
+
+func TestConsistency(t *testing.T) {
+	var leaves [][]byte
+	for i := 0; i < 20; i++ {
+		leaves = append(leaves, LeafHash([]byte{byte(i)}))
+	}
+	for n := 1; n <= len(leaves); n++ {
+		for m := 1; m <= n; m++ {
+			oldRoot, newRoot := Root(leaves[:m]), Root(leaves[:n])
+			proof := ConsistencyProof(leaves[:n], m)
+			assert.True(t, VerifyConsistency(oldRoot, newRoot, m, n, proof), "%d of %d leaves", m, n)
+
+			// a changed old tree doesn't verify
+			changed := append(append([][]byte{}, leaves[:m-1]...), LeafHash([]byte{99}))
+			assert.False(t, VerifyConsistency(Root(changed), newRoot, m, n, proof), "changed %d of %d leaves", m, n)
+		}
+	}
+}
+
+func TestTree(t *testing.T) {
+	nodes := map[[2]int][]byte{}
+	get := func(level, index int) []byte { return nodes[[2]int{level, index}] }
+	var leaves [][]byte
+	for n := 1; n <= 20; n++ {
+		leaf := LeafHash([]byte{byte(n)})
+		for _, node := range AppendLeaf(get, len(leaves), leaf) {
+			nodes[[2]int{node.Level, node.Index}] = node.Hash
+		}
+		leaves = append(leaves, leaf)
+
+		// the stored nodes give the same root and proofs as the leaves, for every size the tree had
+		for size := 1; size <= n; size++ {
+			tree := Tree{Size: size, Node: get}
+			assert.Equal(t, Root(leaves[:size]), tree.Root(), "%d of %d leaves", size, n)
+			for i := 0; i < size; i++ {
+				assert.Equal(t, Proof(leaves[:size], i), tree.Proof(i), "leaf %d of %d", i, size)
+			}
+			for m := 1; m <= size; m++ {
+				assert.Equal(t, ConsistencyProof(leaves[:size], m), tree.ConsistencyProof(m), "%d of %d leaves", m, size)
+			}
+		}
+	}
+}
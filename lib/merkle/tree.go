@@ -0,0 +1,121 @@
+package merkle
+
+/**
+Trees which only grow by appending leaves, like transparency logs, keep the hashes of their complete subtrees instead
+of hashing all leaves again for every root or proof. The node at level l and index i is the root of the 2^l leaves
+from i*2^l on, level 0 holds the leaves. Appending a leaf completes at most one node per level, and the root and the
+proofs of the tree of the first Size leaves are built from O(log Size) stored nodes. They are the same as Root, Proof
+and ConsistencyProof of the leaves.
+
+Usage:
+
+	for _, n := range merkle.AppendLeaf(get, index, leaf) {
+		store(n.Level, n.Index, n.Hash)
+	}
+	tree := merkle.Tree{Size: size, Node: get}
+	root := tree.Root()
+*/
+type (
+	// Returns the stored hash of a complete subtree, nil if it isn't stored
+	NodeFunc func(level, index int) []byte
+
+	Tree struct {
+		Size int
+		Node NodeFunc
+	}
+
+	TreeNode struct {
+		Level int
+		Index int
+		Hash  []byte
+	}
+)
+
+// Returns the nodes completed by appending leaf at index, the leaf first. The nodes of the previous leaves must be stored.
+func AppendLeaf(node NodeFunc, index int, leaf []byte) []TreeNode {
+	completed := []TreeNode{{Index: index, Hash: leaf}}
+	hash := leaf
+	for level := 0; index%2 == 1; level++ {
+		hash = nodeHash(node(level, index-1), hash)
+		index /= 2
+		completed = append(completed, TreeNode{Level: level + 1, Index: index, Hash: hash})
+	}
+	return completed
+}
+
+// Returns the tree of leaves, its nodes are hashed on demand
+func LeafTree(leaves [][]byte) Tree {
+	return Tree{Size: len(leaves), Node: func(level, index int) []byte {
+		return Root(leaves[index<<level : (index+1)<<level])
+	}}
+}
+
+func (me Tree) Root() []byte {
+	if me.Size <= 0 {
+		return nil
+	}
+	return me.rangeRoot(0, me.Size)
+}
+
+// Returns the sibling hashes from the leaf at index up to the root
+func (me Tree) Proof(index int) [][]byte {
+	if index < 0 || index >= me.Size {
+		return nil
+	}
+	proof := [][]byte{}
+	for level := 0; (me.Size-1)>>level > 0; level++ {
+		if sibling := me.node(level, index^1); sibling != nil {
+			proof = append(proof, sibling)
+		}
+		index /= 2
+	}
+	return proof
+}
+
+// Returns the proof that the tree of the first oldCount leaves is a prefix of the tree
+func (me Tree) ConsistencyProof(oldCount int) [][]byte {
+	if oldCount <= 0 || oldCount > me.Size {
+		return nil
+	}
+	return me.subProof(oldCount, 0, me.Size, true)
+}
+
+func (me Tree) subProof(m, start, end int, complete bool) [][]byte {
+	n := end - start
+	if m == n {
+		if complete {
+			return [][]byte{}
+		}
+		return [][]byte{me.rangeRoot(start, end)}
+	}
+	k := splitPoint(n)
+	if m <= k {
+		return append(me.subProof(m, start, start+k, complete), me.rangeRoot(start+k, end))
+	}
+	return append(me.subProof(m-k, start+k, end, false), me.rangeRoot(start, start+k))
+}
+
+// Root of the leaves from start up to end, start is a multiple of the smallest power of two not below end-start
+func (me Tree) rangeRoot(start, end int) []byte {
+	level := 0
+	for 1<<level < end-start {
+		level++
+	}
+	return Tree{Size: end, Node: me.Node}.node(level, start>>level)
+}
+
+// Returns the node at level and index of the tree, built from its children at the right edge, nil beyond the tree
+func (me Tree) node(level, index int) []byte {
+	start := index << level
+	if start >= me.Size {
+		return nil
+	}
+	if start+1<<level <= me.Size {
+		return me.Node(level, index)
+	}
+	left, right := me.node(level-1, 2*index), me.node(level-1, 2*index+1)
+	if right == nil {
+		return left
+	}
+	return nodeHash(left, right)
+}
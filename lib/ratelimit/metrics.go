@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Exposes the limits of the guard, the requests it rejected and its bans
+type collector struct {
+	guard *Guard
+
+	rate       *prometheus.Desc
+	burst      *prometheus.Desc
+	maxUploads *prometheus.Desc
+	banAfter   *prometheus.Desc
+	banSeconds *prometheus.Desc
+	limited    *prometheus.Desc
+	bansActive *prometheus.Desc
+	bans       *prometheus.Desc
+	uploads    *prometheus.Desc
+}
+
+// Returns the collector of the guard with metrics prefixed by namespace
+func (me *Guard) Collector(namespace string) prometheus.Collector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil)
+	}
+	return &collector{
+		guard:      me,
+		rate:       desc("rate_limit_per_second", "Requests per second allowed, by scope (ip or address), 0 for no limit.", "scope"),
+		burst:      desc("rate_limit_burst", "Requests allowed in a burst, by scope (ip or address).", "scope"),
+		maxUploads: desc("rate_limit_max_uploads", "Open upload sessions allowed per address, 0 for no limit."),
+		banAfter:   desc("ban_after_failures", "Authentication failures which ban an IP, 0 to never ban."),
+		banSeconds: desc("ban_duration_seconds", "Duration of a ban."),
+		limited:    desc("rate_limited_requests_total", "Requests rejected, by scope (ip, address, banned or uploads).", "scope"),
+		bansActive: desc("bans_active", "IPs currently banned."),
+		bans:       desc("bans_total", "IPs banned after repeated authentication failures."),
+		uploads:    desc("uploads_in_progress", "Upload sessions open."),
+	}
+}
+
+func (me *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{me.rate, me.burst, me.maxUploads, me.banAfter, me.banSeconds, me.limited, me.bansActive, me.bans, me.uploads} {
+		ch <- d
+	}
+}
+
+func (me *collector) Collect(ch chan<- prometheus.Metric) {
+	g := me.guard
+	cfg := g.cfg
+	ch <- prometheus.MustNewConstMetric(me.rate, prometheus.GaugeValue, cfg.IPRate, ScopeIP)
+	ch <- prometheus.MustNewConstMetric(me.rate, prometheus.GaugeValue, cfg.AddressRate, ScopeAddress)
+	ch <- prometheus.MustNewConstMetric(me.burst, prometheus.GaugeValue, g.ips.burst, ScopeIP)
+	ch <- prometheus.MustNewConstMetric(me.burst, prometheus.GaugeValue, g.addresses.burst, ScopeAddress)
+	ch <- prometheus.MustNewConstMetric(me.maxUploads, prometheus.GaugeValue, float64(cfg.MaxUploads))
+	ch <- prometheus.MustNewConstMetric(me.banAfter, prometheus.GaugeValue, float64(cfg.BanAfter))
+	ch <- prometheus.MustNewConstMetric(me.banSeconds, prometheus.GaugeValue, cfg.BanDuration.Seconds())
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for _, scope := range []string{ScopeIP, ScopeAddress, ScopeBanned, ScopeUploads} {
+		ch <- prometheus.MustNewConstMetric(me.limited, prometheus.CounterValue, float64(g.stats.limited[scope]), scope)
+	}
+	now := g.now()
+	active := 0
+	for _, f := range g.failures {
+		if f.bannedUntil.After(now) {
+			active++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(me.bansActive, prometheus.GaugeValue, float64(active))
+	ch <- prometheus.MustNewConstMetric(me.bans, prometheus.CounterValue, float64(g.stats.bans))
+	ch <- prometheus.MustNewConstMetric(me.uploads, prometheus.GaugeValue, float64(g.stats.inFlight))
+}
@@ -0,0 +1,377 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+/**
+Rate limits and temporary bans protecting the public endpoints of the SPP and the pgp-server.
+
+Requests are limited with token buckets keyed by the remote IP and, once a sign-in challenge has been validated,
+by the recovered ETH address. Repeated authentication failures of an IP ban it for a while and the upload sessions an
+address keeps open at the same time are capped. A zero limit disables it.
+
+The remote IP is the address of the connection. X-Forwarded-For and X-Real-IP are only honoured for connections of
+TrustedProxies, as any client can set them: the client IP is the last forwarded address which isn't a trusted proxy.
+
+Usage:
+
+	guard := ratelimit.NewGuard(cfg)
+	e.GET("/challenge", endpoint.GetChallenge, guard.Middleware())
+	auth.SetAddressLimiter(guard)
+	prometheus.MustRegister(guard.Collector("spp"))
+*/
+type (
+	Config struct {
+		IPRate       float64 // Requests per second of a remote IP
+		IPBurst      int
+		AddressRate  float64 // Signed-in requests per second of an ETH address
+		AddressBurst int
+		MaxUploads   int           // Upload sessions an address keeps open at the same time
+		BanAfter     int           // Authentication failures within BanWindow which ban the IP
+		BanWindow    time.Duration // Failures further apart are forgotten
+		BanDuration  time.Duration
+		// Reverse proxies whose forwarding headers name the client, see ParseTrustedProxies
+		TrustedProxies []*net.IPNet
+	}
+
+	Guard struct {
+		cfg       Config
+		ips       *Limiter
+		addresses *Limiter
+
+		lock       sync.Mutex
+		failures   map[string]*failures
+		uploads    map[string]string // Upload session ID -> address
+		openByAddr map[string]int
+		stats      stats
+		lastSweep  time.Time
+		now        func() time.Time
+		respond    Responder
+	}
+
+	// Answers a request rejected by the middleware, wait is the time until the client may try again
+	Responder func(c echo.Context, wait time.Duration) error
+
+	failures struct {
+		count       int
+		since       time.Time
+		bannedUntil time.Time
+	}
+
+	// Exposed by the collector, see metrics.go
+	stats struct {
+		limited  map[string]uint64 // Rejected requests by scope
+		bans     uint64            // Bans since the start
+		inFlight int               // Upload sessions open
+	}
+
+	// Token buckets refilled at rate per second up to burst, one per key
+	Limiter struct {
+		rate  float64
+		burst float64
+
+		lock      sync.Mutex
+		buckets   map[string]*bucket
+		lastSweep time.Time
+		now       func() time.Time
+	}
+
+	bucket struct {
+		tokens float64
+		last   time.Time
+	}
+)
+
+const (
+	ScopeIP      = "ip"
+	ScopeAddress = "address"
+	ScopeBanned  = "banned"
+	ScopeUploads = "uploads"
+
+	// Idle buckets and expired bans are dropped at most this often, so the limits don't keep every client ever seen
+	sweepInterval = time.Minute
+)
+
+var (
+	ErrRateLimited    = errors.New("rate limit exceeded")
+	ErrTooManyUploads = errors.New("too many open uploads")
+	ErrInvalidProxy   = errors.New("invalid trusted proxy, expected an IP or CIDR")
+)
+
+// Parses a comma separated list of IPs and CIDRs, e.g. "127.0.0.1,10.0.0.0/8"
+func ParseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, ErrInvalidProxy
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, ErrInvalidProxy
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+func NewGuard(cfg Config) *Guard {
+	return &Guard{
+		cfg:        cfg,
+		ips:        NewLimiter(cfg.IPRate, cfg.IPBurst),
+		addresses:  NewLimiter(cfg.AddressRate, cfg.AddressBurst),
+		failures:   map[string]*failures{},
+		uploads:    map[string]string{},
+		openByAddr: map[string]int{},
+		stats:      stats{limited: map[string]uint64{}},
+		now:        time.Now,
+		respond:    tooManyRequests,
+	}
+}
+
+// Replaces the empty 429 Too Many Requests response of the middleware
+func (me *Guard) SetResponder(respond Responder) {
+	me.respond = respond
+}
+
+// Rejects requests of banned IPs and requests over the limit of their IP with 429 Too Many Requests
+func (me *Guard) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ip := me.ClientIP(c)
+			if wait := me.BannedFor(ip); wait > 0 {
+				me.count(ScopeBanned)
+				return me.respond(c, wait)
+			}
+			if !me.ips.Allow(ip) {
+				me.count(ScopeIP)
+				return me.respond(c, me.ips.RetryAfter())
+			}
+			return next(c)
+		}
+	}
+}
+
+// Returns the IP of the client, forwarding headers are only honoured for connections of trusted proxies
+func (me *Guard) ClientIP(c echo.Context) string {
+	req := c.Request()
+	remote, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		remote = req.RemoteAddr
+	}
+	if !me.trusted(remote) {
+		return remote
+	}
+	if forwarded := req.Header.Get(echo.HeaderXForwardedFor); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		// every trusted proxy appends the address it got the request from, the ones before can be forged
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				return remote
+			}
+			if !me.trusted(hop) || i == 0 {
+				return hop
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(req.Header.Get(echo.HeaderXRealIP)); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return remote
+}
+
+func (me *Guard) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range me.cfg.TrustedProxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func tooManyRequests(c echo.Context, wait time.Duration) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return c.NoContent(http.StatusTooManyRequests)
+}
+
+// Returns ErrRateLimited if addr signed in too often, called once its challenge is validated
+func (me *Guard) AllowAddress(addr string) error {
+	if !me.addresses.Allow(addr) {
+		me.count(ScopeAddress)
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// Counts a failed sign in or permission check of ip, the IP is banned once it failed BanAfter times
+func (me *Guard) AuthFailed(ip string) {
+	if me.cfg.BanAfter <= 0 {
+		return
+	}
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	now := me.now()
+	f := me.failures[ip]
+	if f == nil {
+		f = &failures{since: now}
+		me.failures[ip] = f
+	}
+	if now.Sub(f.since) > me.cfg.BanWindow {
+		f.count = 0
+		f.since = now
+	}
+	f.count++
+	if f.count >= me.cfg.BanAfter {
+		f.count = 0
+		f.since = now
+		f.bannedUntil = now.Add(me.cfg.BanDuration)
+		me.stats.bans++
+	}
+	me.sweepBans(now)
+}
+
+// Returns how long ip stays banned, 0 if it isn't
+func (me *Guard) BannedFor(ip string) time.Duration {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	f := me.failures[ip]
+	if f == nil {
+		return 0
+	}
+	if wait := f.bannedUntil.Sub(me.now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Opens the upload session id of addr, ErrTooManyUploads if addr keeps MaxUploads other sessions open.
+// The session counts until it is closed with CloseUpload, opening it again doesn't count it twice.
+func (me *Guard) OpenUpload(addr, id string) error {
+	addr = strings.ToLower(addr)
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	if _, open := me.uploads[id]; open {
+		return nil
+	}
+	if max := me.cfg.MaxUploads; max > 0 && me.openByAddr[addr] >= max {
+		me.stats.limited[ScopeUploads]++
+		return ErrTooManyUploads
+	}
+	me.uploads[id] = addr
+	me.openByAddr[addr]++
+	me.stats.inFlight++
+	return nil
+}
+
+// Closes the upload session id once it is finalized, aborted or expired
+func (me *Guard) CloseUpload(id string) {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	addr, open := me.uploads[id]
+	if !open {
+		return
+	}
+	delete(me.uploads, id)
+	if me.openByAddr[addr]--; me.openByAddr[addr] <= 0 {
+		delete(me.openByAddr, addr)
+	}
+	me.stats.inFlight--
+}
+
+func (me *Guard) count(scope string) {
+	me.lock.Lock()
+	me.stats.limited[scope]++
+	me.lock.Unlock()
+}
+
+// Drops failures which neither ban nor count anymore
+func (me *Guard) sweepBans(now time.Time) {
+	if now.Sub(me.lastSweep) < sweepInterval {
+		return
+	}
+	me.lastSweep = now
+	for ip, f := range me.failures {
+		if !f.bannedUntil.After(now) && now.Sub(f.since) > me.cfg.BanWindow {
+			delete(me.failures, ip)
+		}
+	}
+}
+
+// A rate of 0 doesn't limit, a burst below 1 allows single requests
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{rate: rate, burst: float64(burst), buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// Takes a token from the bucket of key, returns false if it is empty
+func (me *Limiter) Allow(key string) bool {
+	if me.rate <= 0 {
+		return true
+	}
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	now := me.now()
+	me.sweep(now)
+	b := me.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: me.burst, last: now}
+		me.buckets[key] = b
+	}
+	b.tokens = math.Min(me.burst, b.tokens+now.Sub(b.last).Seconds()*me.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Time until an empty bucket holds a token again
+func (me *Limiter) RetryAfter() time.Duration {
+	if me.rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / me.rate)
+}
+
+// Drops the buckets which are full again, they are the same as new ones
+func (me *Limiter) sweep(now time.Time) {
+	if now.Sub(me.lastSweep) < sweepInterval {
+		return
+	}
+	me.lastSweep = now
+	for key, b := range me.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*me.rate >= me.burst {
+			delete(me.buckets, key)
+		}
+	}
+}
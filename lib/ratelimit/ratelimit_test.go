@@ -0,0 +1,174 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (me *clock) now() time.Time {
+	return me.t
+}
+
+func TestLimiter(t *testing.T) {
+	c := &clock{t: time.Now()}
+	l := NewLimiter(2, 3)
+	l.now = c.now
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.Allow("a"))
+	}
+	assert.False(t, l.Allow("a"))
+	assert.True(t, l.Allow("b"), "keys have their own bucket")
+	assert.Equal(t, 500*time.Millisecond, l.RetryAfter())
+
+	c.t = c.t.Add(500 * time.Millisecond)
+	assert.True(t, l.Allow("a"))
+	assert.False(t, l.Allow("a"))
+
+	// full buckets are dropped
+	c.t = c.t.Add(time.Hour)
+	l.Allow("c")
+	assert.Len(t, l.buckets, 1)
+
+	assert.True(t, NewLimiter(0, 0).Allow("a"))
+}
+
+func TestGuard(t *testing.T) {
+	c := &clock{t: time.Now()}
+	// httptest requests come from 192.0.2.1
+	proxies, err := ParseTrustedProxies("192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewGuard(Config{IPRate: 1, IPBurst: 2, AddressRate: 1, AddressBurst: 1, MaxUploads: 1,
+		BanAfter: 3, BanWindow: time.Minute, BanDuration: 10 * time.Minute, TrustedProxies: proxies})
+	g.now = c.now
+	g.ips.now = c.now
+	g.addresses.now = c.now
+
+	assert.NoError(t, g.AllowAddress("0x01"))
+	assert.Equal(t, ErrRateLimited, g.AllowAddress("0x01"))
+
+	assert.NoError(t, g.OpenUpload("0x01", "upload1"))
+	assert.NoError(t, g.OpenUpload("0x01", "upload1"), "an open session isn't counted twice")
+	assert.Equal(t, ErrTooManyUploads, g.OpenUpload("0x01", "upload2"))
+	assert.NoError(t, g.OpenUpload("0x02", "upload3"))
+	g.CloseUpload("upload1")
+	g.CloseUpload("upload1")
+	g.CloseUpload("upload3")
+	assert.NoError(t, g.OpenUpload("0x01", "upload2"))
+
+	// failures further apart than the window don't ban
+	g.AuthFailed("10.0.0.1")
+	g.AuthFailed("10.0.0.1")
+	c.t = c.t.Add(2 * time.Minute)
+	g.AuthFailed("10.0.0.1")
+	assert.Equal(t, time.Duration(0), g.BannedFor("10.0.0.1"))
+	g.AuthFailed("10.0.0.1")
+	g.AuthFailed("10.0.0.1")
+	assert.Equal(t, 10*time.Minute, g.BannedFor("10.0.0.1"))
+
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, g.Middleware())
+	get := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderXRealIP, ip)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	rec := get("10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "600", rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, get("10.0.0.2").Code)
+	assert.Equal(t, http.StatusOK, get("10.0.0.2").Code)
+	assert.Equal(t, http.StatusTooManyRequests, get("10.0.0.2").Code)
+
+	c.t = c.t.Add(10 * time.Minute)
+	assert.Equal(t, http.StatusOK, get("10.0.0.1").Code)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(g.Collector("test"))
+	metrics, err := reg.Gather()
+	if assert.NoError(t, err) {
+		values := map[string]float64{}
+		for _, m := range metrics {
+			for _, metric := range m.Metric {
+				name := m.GetName()
+				for _, l := range metric.Label {
+					name += "_" + l.GetValue()
+				}
+				if metric.Gauge != nil {
+					values[name] = metric.Gauge.GetValue()
+				} else {
+					values[name] = metric.Counter.GetValue()
+				}
+			}
+		}
+		assert.Equal(t, 1.0, values["test_rate_limited_requests_total_banned"])
+		assert.Equal(t, 1.0, values["test_rate_limited_requests_total_ip"])
+		assert.Equal(t, 1.0, values["test_rate_limited_requests_total_address"])
+		assert.Equal(t, 1.0, values["test_rate_limited_requests_total_uploads"])
+		assert.Equal(t, 1.0, values["test_bans_total"])
+		assert.Equal(t, 0.0, values["test_bans_active"])
+		assert.Equal(t, 1.0, values["test_uploads_in_progress"])
+		assert.Equal(t, 2.0, values["test_rate_limit_burst_ip"])
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.1, 172.16.0.0/12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseTrustedProxies("10.0.0.1,proxy")
+	assert.Equal(t, ErrInvalidProxy, err)
+	g := NewGuard(Config{IPRate: 1, IPBurst: 1, TrustedProxies: proxies})
+
+	e := echo.New()
+	ip := func(remote, forwardedFor, realIP string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		if forwardedFor != "" {
+			req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		}
+		if realIP != "" {
+			req.Header.Set(echo.HeaderXRealIP, realIP)
+		}
+		return g.ClientIP(e.NewContext(req, httptest.NewRecorder()))
+	}
+	// the headers of clients which aren't trusted proxies are ignored
+	assert.Equal(t, "203.0.113.7", ip("203.0.113.7:4000", "198.51.100.1", "198.51.100.2"))
+	// trusted proxies name the client, forged addresses before them are skipped
+	assert.Equal(t, "203.0.113.7", ip("10.0.0.1:4000", "198.51.100.1, 203.0.113.7", ""))
+	assert.Equal(t, "203.0.113.7", ip("10.0.0.1:4000", "198.51.100.1, 203.0.113.7, 172.16.0.5", ""))
+	assert.Equal(t, "172.16.0.5", ip("10.0.0.1:4000", "172.16.0.5", ""))
+	assert.Equal(t, "198.51.100.2", ip("10.0.0.1:4000", "", "198.51.100.2"))
+	assert.Equal(t, "10.0.0.1", ip("10.0.0.1:4000", "unknown", ""))
+	assert.Equal(t, "10.0.0.1", ip("10.0.0.1:4000", "", ""))
+
+	// rotating the forwarding headers doesn't get around the limit of the IP
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, g.Middleware())
+	for i, forged := range []string{"198.51.100.1", "198.51.100.2"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.7:4000"
+		req.Header.Set(echo.HeaderXForwardedFor, forged)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if i == 0 {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package translog
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/ProxeusApp/storage-app/lib/merkle"
+)
+
+/**
+Append-only transparency log of the bindings of ethereum addresses to PGP keys, so clients don't have to blindly
+trust the key a pgp-server returns. Every key the server starts to serve for an address is appended as an entry,
+the leaves of the Merkle tree are the hashes of the entries as JSON. The server signs the tree head after each
+append with its log key, an ethereum key, so a client can pin the log by its address.
+
+A client verifies that a key it looked up is included in the log under a signed tree head, and that the tree head
+is consistent with the last one it has seen: the log only grew, no binding was changed or removed. A server which
+swaps a key has to log the swap where the owner of the address and monitors can see it. A revoked key verifies with
+ErrKeyRevoked, so it isn't used anymore. The proof doesn't show that the entry is the latest one of the address, the
+client rejects an entry older than the latest one of the address it has seen with ErrOutdated.
+
+Usage:
+
+	proof, _ := server.LogProof(address, last.Size)
+	err := proof.Verify(address, publicKey, logAddress, last)
+*/
+type (
+	Entry struct {
+		Address     string `json:"address"`
+		Fingerprint string `json:"fingerprint"`
+		KeyHash     string `json:"keyHash"` // Hex sha256 of the armored key as the lookups return it
+		Revoked     bool   `json:"revoked,omitempty"`
+		Timestamp   int64  `json:"timestamp"`
+	}
+
+	TreeHead struct {
+		Size      int    `json:"size"`
+		Root      string `json:"root"` // Hex
+		Timestamp int64  `json:"timestamp"`
+		Signature string `json:"signature"` // Hex encoded, v is 27 or 28
+	}
+
+	// Inclusion of the entry of an address in the tree of TreeHead and, if asked for, its consistency with an older tree
+	Proof struct {
+		Entry       json.RawMessage `json:"entry"`
+		Index       int             `json:"index"`
+		TreeHead    TreeHead        `json:"treeHead"`
+		Inclusion   []string        `json:"inclusion"`
+		Consistency []string        `json:"consistency,omitempty"`
+	}
+
+	// Proof that the tree of First leaves is a prefix of the one of Second leaves
+	Consistency struct {
+		First  int      `json:"first"`
+		Second int      `json:"second"`
+		Proof  []string `json:"proof"`
+	}
+)
+
+var (
+	ErrInvalidTreeHead = errors.New("tree head isn't signed by the log")
+	ErrEntryMismatch   = errors.New("log entry doesn't match the key")
+	ErrNotIncluded     = errors.New("key isn't included in the log")
+	ErrInconsistent    = errors.New("log isn't consistent with the last seen tree head")
+	ErrKeyRevoked      = errors.New("logged key has been revoked")
+	ErrOutdated        = errors.New("log entry is older than the one seen before")
+)
+
+// Status a log server answers a proof request with if the tree size asked for is beyond its log, which the client
+// has seen before: the log shrank or was replaced
+const StatusBeyondLog = http.StatusConflict
+
+func NewEntry(address, fingerprint, publicKey string, revoked bool) *Entry {
+	return &Entry{
+		Address:     strings.ToLower(address),
+		Fingerprint: fingerprint,
+		KeyHash:     KeyHash(publicKey),
+		Revoked:     revoked,
+		Timestamp:   time.Now().Unix(),
+	}
+}
+
+func KeyHash(publicKey string) string {
+	h := sha256.Sum256([]byte(publicKey))
+	return hex.EncodeToString(h[:])
+}
+
+// Returns the leaf hash of an entry as stored in the log
+func LeafHash(entry []byte) []byte {
+	return merkle.LeafHash(entry)
+}
+
+// Returns the tree head of tree signed with key. The root of an empty tree is the hash of nothing.
+func NewTreeHead(tree merkle.Tree, key *ecdsa.PrivateKey) (*TreeHead, error) {
+	root := tree.Root()
+	if tree.Size == 0 {
+		empty := sha256.Sum256(nil)
+		root = empty[:]
+	}
+	th := &TreeHead{Size: tree.Size, Root: hex.EncodeToString(root), Timestamp: time.Now().Unix()}
+	sig, err := crypto.Sign(th.Digest(), key)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	th.Signature = hexutil.Encode(sig)
+	return th, nil
+}
+
+// The hash the log key signs
+func (me *TreeHead) Digest() []byte {
+	return crypto.Keccak256([]byte(fmt.Sprintf("Proxeus PGP key log\nsize: %d\ntimestamp: %d\nroot: %s", me.Size, me.Timestamp, me.Root)))
+}
+
+// Returns the address of the log key which signed the tree head
+func (me *TreeHead) Signer() (common.Address, error) {
+	sig, err := hexutil.Decode(me.Signature)
+	if err != nil || len(sig) != 65 {
+		return common.Address{}, ErrInvalidTreeHead
+	}
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pub, err := crypto.SigToPub(me.Digest(), sig)
+	if err != nil {
+		return common.Address{}, ErrInvalidTreeHead
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// Returns the proof of the entry at index of tree under head, with the consistency from oldSize if it is in between
+func NewProof(tree merkle.Tree, entry []byte, index int, head TreeHead, oldSize int) *Proof {
+	p := &Proof{Entry: entry, Index: index, TreeHead: head, Inclusion: encode(tree.Proof(index))}
+	if oldSize > 0 && oldSize < tree.Size {
+		p.Consistency = encode(tree.ConsistencyProof(oldSize))
+	}
+	return p
+}
+
+func NewConsistency(tree merkle.Tree, first int) *Consistency {
+	return &Consistency{First: first, Second: tree.Size, Proof: encode(tree.ConsistencyProof(first))}
+}
+
+/**
+Verifies that publicKey is the key logged for address under a tree head signed by logAddress, and that the tree
+head is consistent with last, the last seen one. last may be nil for the first lookup. Returns ErrKeyRevoked if
+everything verifies but the entry revokes the key.
+*/
+func (me *Proof) Verify(address, publicKey string, logAddress common.Address, last *TreeHead) error {
+	signer, err := me.TreeHead.Signer()
+	if err != nil {
+		return err
+	}
+	if signer != logAddress {
+		return ErrInvalidTreeHead
+	}
+	var entry Entry
+	if err = json.Unmarshal(me.Entry, &entry); err != nil {
+		return ErrEntryMismatch
+	}
+	if !strings.EqualFold(entry.Address, address) || entry.KeyHash != KeyHash(publicKey) {
+		return ErrEntryMismatch
+	}
+	root, err := hex.DecodeString(me.TreeHead.Root)
+	if err != nil {
+		return ErrNotIncluded
+	}
+	inclusion, err := decode(me.Inclusion)
+	if err != nil || !merkle.Verify(root, LeafHash(me.Entry), me.Index, me.TreeHead.Size, inclusion) {
+		return ErrNotIncluded
+	}
+	if last != nil {
+		if err = me.TreeHead.VerifyConsistency(last, me.Consistency); err != nil {
+			return err
+		}
+	}
+	if entry.Revoked {
+		return ErrKeyRevoked
+	}
+	return nil
+}
+
+// Verifies that me extends older, with the consistency proof from the size of older
+func (me *TreeHead) VerifyConsistency(older *TreeHead, proof []string) error {
+	if older.Size == 0 {
+		return nil
+	}
+	if older.Size > me.Size {
+		return ErrInconsistent
+	}
+	oldRoot, err := hex.DecodeString(older.Root)
+	if err != nil {
+		return ErrInconsistent
+	}
+	newRoot, err := hex.DecodeString(me.Root)
+	if err != nil {
+		return ErrInconsistent
+	}
+	if older.Size == me.Size {
+		if !bytes.Equal(oldRoot, newRoot) {
+			return ErrInconsistent
+		}
+		return nil
+	}
+	hashes, err := decode(proof)
+	if err != nil || !merkle.VerifyConsistency(oldRoot, newRoot, older.Size, me.Size, hashes) {
+		return ErrInconsistent
+	}
+	return nil
+}
+
+func encode(hashes [][]byte) []string {
+	encoded := make([]string, len(hashes))
+	for i, h := range hashes {
+		encoded[i] = hex.EncodeToString(h)
+	}
+	return encoded
+}
+
+func decode(encoded []string) ([][]byte, error) {
+	hashes := make([][]byte, len(encoded))
+	for i, e := range encoded {
+		h, err := hex.DecodeString(e)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = h
+	}
+	return hashes, nil
+}
@@ -0,0 +1,70 @@
+package translog
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/lib/merkle"
+)
+
+func TestProof(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	logAddress := crypto.PubkeyToAddress(key.PublicKey)
+
+	var (
+		entries [][]byte
+		leaves  [][]byte
+	)
+	appendKey := func(address, publicKey string, revoked bool) {
+		entry, _ := json.Marshal(NewEntry(address, "", publicKey, revoked))
+		entries = append(entries, entry)
+		leaves = append(leaves, LeafHash(entry))
+	}
+	for i := 0; i < 5; i++ {
+		appendKey(fmt.Sprintf("0x%040d", i), fmt.Sprintf("key %d", i), false)
+	}
+	first, err := NewTreeHead(merkle.LeafTree(leaves), key)
+	assert.NoError(t, err)
+	address := fmt.Sprintf("0x%040d", 3)
+	proof := NewProof(merkle.LeafTree(leaves), entries[3], 3, *first, 0)
+	assert.NoError(t, proof.Verify(address, "key 3", logAddress, nil))
+
+	// another key, another address or another log don't verify
+	assert.Equal(t, ErrEntryMismatch, proof.Verify(address, "key 4", logAddress, nil))
+	assert.Equal(t, ErrEntryMismatch, proof.Verify(fmt.Sprintf("0x%040d", 4), "key 3", logAddress, nil))
+	other, _ := crypto.GenerateKey()
+	assert.Equal(t, ErrInvalidTreeHead, proof.Verify(address, "key 3", crypto.PubkeyToAddress(other.PublicKey), nil))
+
+	// the log grows consistently with a rotated key
+	for i := 5; i < 12; i++ {
+		appendKey(fmt.Sprintf("0x%040d", i), fmt.Sprintf("key %d", i), false)
+	}
+	appendKey(address, "key 3 rotated", false)
+	second, err := NewTreeHead(merkle.LeafTree(leaves), key)
+	assert.NoError(t, err)
+	proof = NewProof(merkle.LeafTree(leaves), entries[12], 12, *second, first.Size)
+	assert.NoError(t, proof.Verify(address, "key 3 rotated", logAddress, first))
+	assert.NoError(t, proof.Verify(address, "key 3 rotated", logAddress, second))
+
+	// a revoked key verifies as revoked only
+	appendKey(address, "key 3 rotated", true)
+	third, err := NewTreeHead(merkle.LeafTree(leaves), key)
+	assert.NoError(t, err)
+	revoked := NewProof(merkle.LeafTree(leaves), entries[13], 13, *third, second.Size)
+	assert.Equal(t, ErrKeyRevoked, revoked.Verify(address, "key 3 rotated", logAddress, second))
+	assert.Equal(t, ErrInvalidTreeHead, revoked.Verify(address, "key 3 rotated", crypto.PubkeyToAddress(other.PublicKey), second))
+	leaves, entries = leaves[:13], entries[:13]
+
+	// a rolled back or forked log is detected
+	assert.Equal(t, ErrInconsistent, NewProof(merkle.LeafTree(leaves[:5]), entries[3], 3, *first, 0).Verify(address, "key 3", logAddress, second))
+	leaves[1] = LeafHash([]byte("swapped"))
+	forked, err := NewTreeHead(merkle.LeafTree(leaves), key)
+	assert.NoError(t, err)
+	proof = NewProof(merkle.LeafTree(leaves), entries[12], 12, *forked, first.Size)
+	assert.Equal(t, ErrInconsistent, proof.Verify(address, "key 3 rotated", logAddress, first))
+}
@@ -2,6 +2,7 @@ package wallet
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
@@ -111,6 +112,26 @@ func VerifySignInChallenge(challengeHex, signatureHex string) (addressHex string
 	return
 }
 
+// SignInChallenge signs the challenge with key the way eth_sign does, so it can be verified with VerifySignInChallenge.
+// It's used by services signing in to each other with their own key.
+func SignInChallenge(challengeHex string, key *ecdsa.PrivateKey) (signatureHex string, err error) {
+	if len(challengeHex) < 2 {
+		return "", fmt.Errorf("Wrong challenge size: Expected more than 2 characters, but %d found", len(challengeHex))
+	}
+	challenge, err := hex.DecodeString(challengeHex[2:])
+	if err != nil {
+		return
+	}
+	challenge = append([]byte("\x19Ethereum Signed Message:\n"+strconv.Itoa(len(challenge))), challenge...)
+	signature, err := crypto.Sign(crypto.Keccak256(challenge), key)
+	if err != nil {
+		return
+	}
+	// add 27 to V like eth_sign, see VerifySignInChallenge
+	signature[64] += 27
+	return "0x" + hex.EncodeToString(signature), nil
+}
+
 // RegisterDocument executes a transaction on the blockchain to call the "notarize" method on a DocumentRegistry
 // smart contract at the address provided. An approval of XES Token is done at the provided token address to the
 // address of the provided document registry.
@@ -1 +1,26 @@
 package wallet
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignInChallenge(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := CreateSignInChallenge("Sign this message to login: ")
+
+	signature, err := SignInChallenge(challenge, key)
+	if assert.NoError(t, err) {
+		addr, err := VerifySignInChallenge(challenge, signature)
+		assert.NoError(t, err)
+		assert.Equal(t, crypto.PubkeyToAddress(key.PublicKey).String(), addr)
+	}
+
+	_, err = SignInChallenge("", key)
+	assert.Error(t, err)
+}
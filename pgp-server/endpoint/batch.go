@@ -0,0 +1,47 @@
+package endpoint
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+
+	"github.com/ProxeusApp/storage-app/pgp-server/storage"
+)
+
+// Max addresses looked up by one batch request
+const maxBatchLookup = 100
+
+/**
+Looks up the keys of many ethereum addresses at once, with the proofs of their transparency log entries:
+
+	POST /pks/lookup/batch {"addresses": ["0x<address>", ...], "treeSize": <last seen tree size>}
+	-> {"keys": {"0x<address>": {"publicKey": "...", "proof": {...}}, ...}}
+
+Addresses without key are left out of keys.
+*/
+func LookupBatch(c echo.Context) error {
+	params := struct {
+		Addresses []string `json:"addresses"`
+		TreeSize  int      `json:"treeSize"`
+	}{}
+	if err := c.Bind(&params); err != nil {
+		return err
+	}
+	if len(params.Addresses) == 0 {
+		return c.String(http.StatusBadRequest, "Empty addresses")
+	}
+	if len(params.Addresses) > maxBatchLookup {
+		return c.String(http.StatusRequestEntityTooLarge, "Too many addresses")
+	}
+	for i, addr := range params.Addresses {
+		params.Addresses[i] = strings.ToLower(strings.TrimSpace(addr))
+	}
+	keys, err := storage.GetLoggedKeys(params.Addresses, params.TreeSize)
+	if err != nil {
+		return logFailed(c, err)
+	}
+	return c.JSON(http.StatusOK, struct {
+		Keys map[string]*storage.LoggedKey `json:"keys"`
+	}{Keys: keys})
+}
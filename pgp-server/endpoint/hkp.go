@@ -0,0 +1,287 @@
+package endpoint
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+
+	"github.com/ProxeusApp/storage-app/pgp-server/storage"
+)
+
+/**
+HKP lookups as specified by draft-shaw-openpgp-hkp, so OpenPGP tools like gpg can use the server as a keyserver:
+
+	/pks/lookup?op=get&search=0x<address, fingerprint or key ID>    the armored keys
+	/pks/lookup?op=index&search=<text>&options=mr                  the machine readable index of the keys
+	/pks/lookup?search=0x<address>                                 the key of an ethereum address, as before HKP
+	/pks/lookup?op=x-history&search=0x<address>                    the versions of the keys of an address as JSON
+
+A search of 0x and 40 hex digits is looked up as ethereum address first and as fingerprint if there is no key stored
+under it. 0x and 16 or 8 hex digits is a key ID, anything else is searched in the user IDs, exactly with exact=on.
+Keys are only added with a signed challenge, see AddPublicKey.
+*/
+
+const (
+	hkpOpGet    = "get"
+	hkpOpIndex  = "index"
+	hkpOpVIndex = "vindex"
+	// Extension, HKP reserves the x- prefix for them
+	hkpOpHistory = "x-history"
+
+	mimePGPKeys = "application/pgp-keys"
+)
+
+type hkpKey struct {
+	address   string
+	publicKey string
+}
+
+// Answers the lookups of HKP and of the dapp, which searches an ethereum address without op
+func GetPublicKey(c echo.Context) error {
+	search := strings.TrimSpace(c.QueryParam("search"))
+	op := c.QueryParam("op")
+	if search == "" {
+		if op == "" {
+			return c.String(http.StatusBadRequest, "Empty ethereum address")
+		}
+		return c.String(http.StatusBadRequest, "Empty search")
+	}
+
+	switch op {
+	case "":
+		return getByAddress(c, search)
+	case hkpOpHistory:
+		return getHistory(c, search)
+	case hkpOpGet, hkpOpIndex, hkpOpVIndex:
+	default:
+		return c.String(http.StatusNotImplemented, "Operation not implemented")
+	}
+
+	keys, err := findKeys(search, c.QueryParam("exact") == "on")
+	if err == storage.ErrNotFound {
+		return c.String(http.StatusNotFound, "No keys found")
+	}
+	if err != nil {
+		c.Logger().Warn(err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if op == hkpOpGet {
+		return getKeys(c, keys)
+	}
+	entities := readEntities(c, keys)
+	if hasOption(c, "mr") {
+		return c.Blob(http.StatusOK, echo.MIMETextPlainCharsetUTF8, machineReadableIndex(entities))
+	}
+	return c.HTML(http.StatusOK, htmlIndex(search, entities, op == hkpOpVIndex))
+}
+
+// Every key stored for an ethereum address, oldest first, with the signed challenges which authorized the changes
+func getHistory(c echo.Context, ethAddress string) error {
+	records, err := storage.KeyHistory(strings.ToLower(ethAddress))
+	if err == storage.ErrNotFound {
+		return c.String(http.StatusNotFound, "No keys found")
+	}
+	if err != nil {
+		c.Logger().Warn(err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, records)
+}
+
+// The key stored for an ethereum address, unchanged
+func getByAddress(c echo.Context, ethAddress string) error {
+	publicKey, err := storage.GetPublicKey(strings.ToLower(ethAddress))
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return c.String(http.StatusNotFound, err.Error())
+		}
+		c.Logger().Warn(err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.String(http.StatusOK, publicKey)
+}
+
+func findKeys(search string, exact bool) ([]hkpKey, error) {
+	var (
+		addresses []string
+		err       error
+	)
+	lower := strings.ToLower(search)
+	switch {
+	case strings.HasPrefix(lower, "0x") && len(lower) == 42:
+		if publicKey, err := storage.GetPublicKey(lower); err == nil {
+			return []hkpKey{{address: lower, publicKey: publicKey}}, nil
+		} else if err != storage.ErrNotFound {
+			return nil, err
+		}
+		addresses, err = storage.FindByKeyID(lower)
+	case strings.HasPrefix(lower, "0x"):
+		addresses, err = storage.FindByKeyID(lower)
+	default:
+		addresses, err = storage.FindByText(search, exact)
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]hkpKey, 0, len(addresses))
+	for _, addr := range addresses {
+		publicKey, err := storage.GetPublicKey(addr)
+		if err == storage.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, hkpKey{address: addr, publicKey: publicKey})
+	}
+	if len(keys) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return keys, nil
+}
+
+// Answers the keys in one armored block, or a single stored key as it is
+func getKeys(c echo.Context, keys []hkpKey) error {
+	if len(keys) == 1 {
+		return c.Blob(http.StatusOK, mimePGPKeys, []byte(keys[0].publicKey))
+	}
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return err
+	}
+	for _, e := range readEntities(c, keys) {
+		if err = serializeEntity(w, e); err != nil {
+			return err
+		}
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, mimePGPKeys, buf.Bytes())
+}
+
+// Keys which can't be parsed are left out
+func readEntities(c echo.Context, keys []hkpKey) openpgp.EntityList {
+	var entities openpgp.EntityList
+	for _, k := range keys {
+		el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(k.publicKey))
+		if err != nil {
+			c.Logger().Warnf("key of %s can't be read: %v", k.address, err)
+			continue
+		}
+		entities = append(entities, el...)
+	}
+	return entities
+}
+
+func hasOption(c echo.Context, option string) bool {
+	for _, o := range strings.Split(c.QueryParam("options"), ",") {
+		if strings.TrimSpace(o) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Index in the machine readable format of HKP:
+//
+//	info:1:<count>
+//	pub:<fingerprint>:<algorithm>:<bits>:<created>:<expires>:<flags>
+//	uid:<escaped user ID>:<created>:<expires>:<flags>
+func machineReadableIndex(entities openpgp.EntityList) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "info:1:%d\n", len(entities))
+	now := time.Now()
+	for _, e := range entities {
+		pk := e.PrimaryKey
+		bits, _ := pk.BitLength()
+		expires, flags := keyExpiry(e), keyFlags(e, now)
+		fmt.Fprintf(buf, "pub:%X:%d:%d:%d:%s:%s\n", pk.Fingerprint, pk.PubKeyAlgo, bits, pk.CreationTime.Unix(), unixOrEmpty(expires), flags)
+		for _, id := range e.Identities {
+			var created string
+			if id.SelfSignature != nil {
+				created = fmt.Sprint(id.SelfSignature.CreationTime.Unix())
+			}
+			fmt.Fprintf(buf, "uid:%s:%s::\n", escapeUID(id.Name), created)
+		}
+	}
+	return buf.Bytes()
+}
+
+func htmlIndex(search string, entities openpgp.EntityList, verbose bool) string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "<html><head><title>Search results for '%s'</title></head><body><h1>Search results for '%s'</h1><pre>\n",
+		html.EscapeString(search), html.EscapeString(search))
+	now := time.Now()
+	for _, e := range entities {
+		pk := e.PrimaryKey
+		bits, _ := pk.BitLength()
+		fmt.Fprintf(buf, "pub  %d/<a href=\"/pks/lookup?op=get&amp;search=0x%X\">%X</a> %s", bits, pk.Fingerprint, pk.Fingerprint, pk.CreationTime.UTC().Format("2006-01-02"))
+		if flags := keyFlags(e, now); flags != "" {
+			fmt.Fprintf(buf, " [%s]", flags)
+		}
+		buf.WriteString("\n")
+		for _, id := range e.Identities {
+			fmt.Fprintf(buf, "uid  %s\n", html.EscapeString(id.Name))
+		}
+		if verbose {
+			for _, sub := range e.Subkeys {
+				subBits, _ := sub.PublicKey.BitLength()
+				fmt.Fprintf(buf, "sub  %d/%X %s\n", subBits, sub.PublicKey.Fingerprint, sub.PublicKey.CreationTime.UTC().Format("2006-01-02"))
+			}
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("</pre></body></html>")
+	return buf.String()
+}
+
+// The key lifetime counts from the creation of the key, zero time if it doesn't expire
+func keyExpiry(e *openpgp.Entity) time.Time {
+	for _, id := range e.Identities {
+		if sig := id.SelfSignature; sig != nil && sig.KeyLifetimeSecs != nil && *sig.KeyLifetimeSecs > 0 {
+			return e.PrimaryKey.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second)
+		}
+	}
+	return time.Time{}
+}
+
+// r for revoked, e for expired keys
+func keyFlags(e *openpgp.Entity, now time.Time) string {
+	var flags string
+	if len(e.Revocations) > 0 {
+		flags += "r"
+	}
+	if expires := keyExpiry(e); !expires.IsZero() && expires.Before(now) {
+		flags += "e"
+	}
+	return flags
+}
+
+func unixOrEmpty(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return fmt.Sprint(t.Unix())
+}
+
+// Escapes the characters which aren't printable ASCII and the separator, as the machine readable format requires
+func escapeUID(uid string) string {
+	var b strings.Builder
+	for _, c := range []byte(uid) {
+		if c < 0x20 || c > 0x7e || c == ':' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package endpoint
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestHKPLookups(t *testing.T) {
+	openTestDB(t)
+	defer closeTestDB()
+	ethKey, address := newEthKey(t)
+	e := newEntity(t, address)
+	assert.Equal(t, http.StatusOK, addKey(t, ethKey, armoredKey(t, e)).Code)
+	fingerprint := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+
+	lookup := func(query string) (int, string) {
+		rec := serve(t, http.MethodGet, "/pks/lookup?"+query, "", GetPublicKey)
+		return rec.Code, rec.Body.String()
+	}
+	// the key is found by address, fingerprint, key ID and user ID
+	for _, search := range []string{address, "0x" + fingerprint, "0x" + fingerprint[24:], "0x" + fingerprint[32:], "test@example.org"} {
+		code, body := lookup("op=get&search=" + search)
+		if assert.Equal(t, http.StatusOK, code, search) {
+			entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(body))
+			if assert.NoError(t, err, search) {
+				assert.Equal(t, e.PrimaryKey.Fingerprint, entities[0].PrimaryKey.Fingerprint, search)
+			}
+		}
+	}
+	code, body := lookup("search=" + address)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, armoredKey(t, e), body)
+
+	code, body = lookup("op=index&options=mr&search=" + address)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, strings.HasPrefix(body, "info:1:1\npub:"+fingerprint+":"), body)
+	assert.Contains(t, body, "uid:"+address+" <test@example.org>:")
+
+	code, _ = lookup("op=get&search=nobody@example.org&exact=on")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = lookup("op=stats&search=" + address)
+	assert.Equal(t, http.StatusNotImplemented, code)
+
+	// a revoked key is flagged in the index
+	revoked := *e
+	revoked.Revocations = []*packet.Signature{revocation(t, e, e)}
+	assert.Equal(t, http.StatusOK, addKey(t, ethKey, armoredKey(t, &revoked)).Code)
+	_, body = lookup("op=index&options=mr&search=" + address)
+	assert.Contains(t, body, ":r\n")
+}
@@ -9,11 +9,15 @@ import (
 
 	"github.com/labstack/echo"
 
+	"github.com/ProxeusApp/storage-app/lib/challenge"
+	"github.com/ProxeusApp/storage-app/lib/ratelimit"
 	"github.com/ProxeusApp/storage-app/pgp-server/storage"
-	"github.com/ProxeusApp/storage-app/spp/fs"
 )
 
-var ProxeusFS *fs.ProxeusFS
+var Challenges *challenge.Authenticator
+
+// Limits the requests of IPs and the key uploads of addresses, see lib/ratelimit
+var Guard *ratelimit.Guard
 
 func AddPublicKey(c echo.Context) error {
 	params := struct {
@@ -22,6 +26,11 @@ func AddPublicKey(c echo.Context) error {
 		Signature string `json:"signature"`
 	}{}
 
+	// HKP clients submit a keytext form, keys are only accepted with a signed challenge
+	if c.FormValue("keytext") != "" {
+		return c.String(http.StatusForbidden, "Keys can only be added with a signed challenge, see /pks/challenge")
+	}
+
 	if err := c.Bind(&params); err != nil {
 		return err
 	}
@@ -33,17 +42,30 @@ func AddPublicKey(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "Empty public key")
 	}
 
-	addr, err := ProxeusFS.Validate(params.Token, params.Signature)
+	addr, msg, err := Challenges.ValidateMsg(params.Token, params.Signature)
+	if err == ratelimit.ErrRateLimited {
+		return c.NoContent(http.StatusTooManyRequests)
+	}
 	if err != nil {
+		if err == challenge.ErrInvalidSignature {
+			authFailed(c)
+		}
 		return c.NoContent(http.StatusBadRequest)
 	}
 
-	ethereumAddress, err := GetIdentity(params.Pubkey)
-
 	addr = strings.ToLower(addr)
+	auth := storage.Authorization{Token: params.Token, Challenge: msg.Challenge, Signature: params.Signature}
+
+	// a revocation certificate has no identity, it revokes a key stored for the signer
+	if revocation, ok := readRevocationCertificate(params.Pubkey); ok {
+		return revokeWithCertificate(c, addr, revocation, auth)
+	}
+
+	ethereumAddress, err := GetIdentity(params.Pubkey)
 	ethereumAddress = strings.ToLower(ethereumAddress)
 
 	if err != nil || addr != ethereumAddress {
+		authFailed(c)
 		return c.NoContent(http.StatusUnauthorized)
 	}
 
@@ -64,44 +86,47 @@ func AddPublicKey(c echo.Context) error {
 		}
 	}
 
-	err = storage.SetPublicKey(ethereumAddress, params.Pubkey)
-	if err != nil {
-		c.Logger().Error(err)
-		return c.String(http.StatusInternalServerError, err.Error())
+	// a key uploaded with its revocation signature revokes the stored version of it
+	if revoked, ok := readRevokedKey(params.Pubkey); ok {
+		return revokeWithKey(c, ethereumAddress, revoked, auth)
+	}
+	if _, err = storage.StoreKey(ethereumAddress, params.Pubkey, auth); err != nil {
+		return keyChangeFailed(c, err)
 	}
-
 	return c.String(http.StatusOK, ethereumAddress)
 }
 
-func GetPublicKey(c echo.Context) error {
-	ethAddress := c.QueryParam("search")
-
-	if ethAddress == "" {
-		return c.String(http.StatusBadRequest, "Empty ethereum address")
-	}
-
-	ethAddress = strings.ToLower(ethAddress)
-	publicKey, err := storage.GetPublicKey(ethAddress)
-
-	if err != nil {
-		if err == storage.ErrNotFound {
-			return c.String(http.StatusNotFound, err.Error())
-		}
-		c.Logger().Warn(err)
-		return c.String(http.StatusInternalServerError, err.Error())
+// Answers a rejected key upload or revocation
+func keyChangeFailed(c echo.Context, err error) error {
+	switch err {
+	case storage.ErrKeyExists:
+		return c.String(http.StatusAlreadyReported, err.Error())
+	case storage.ErrKeyRevoked, storage.ErrFingerprintInUse:
+		return c.String(http.StatusConflict, err.Error())
+	case storage.ErrNotFound:
+		return c.String(http.StatusNotFound, "Key not found")
+	case storage.ErrInvalidKey:
+		return c.String(http.StatusBadRequest, err.Error())
 	}
-
-	return c.String(http.StatusOK, publicKey)
+	c.Logger().Error(err)
+	return c.String(http.StatusInternalServerError, err.Error())
 }
 
 func GetChallenge(c echo.Context) error {
-	r, err := ProxeusFS.CreateSignInChallenge()
+	r, err := Challenges.CreateSignInChallenge()
 	if err != nil {
 		return c.String(http.StatusBadRequest, err.Error())
 	}
 	return c.JSON(http.StatusOK, r)
 }
 
+// Counts a failed sign in of the client, repeated failures ban its IP for a while
+func authFailed(c echo.Context) {
+	if Guard != nil {
+		Guard.AuthFailed(Guard.ClientIP(c))
+	}
+}
+
 func GetIdentity(publicKey string) (ethAddress string, err error) {
 	identity, err := pgp.ReadIdentity([][]byte{[]byte(publicKey)})
 	if err != nil {
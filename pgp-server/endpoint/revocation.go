@@ -0,0 +1,150 @@
+package endpoint
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/ProxeusApp/storage-app/pgp-server/storage"
+)
+
+/**
+Keys are revoked by uploading them with their revocation signature, as exported after revoking them, or by uploading
+a revocation certificate alone, as created by gpg --gen-revoke. Both are signed challenges of the address the key is
+stored for, like any upload. The revocation signatures are verified with the stored version of the key, and an
+uploaded key must match the stored version apart from them, so a revocation can't change the key. The stored version
+with the revocation signatures is served from then on. A revoked key stays in the history and can't become the
+current key again.
+*/
+
+// Returns the revocation signature of an armored revocation certificate, ok is false for anything else
+func readRevocationCertificate(armored string) (sig *packet.Signature, ok bool) {
+	block, err := armor.Decode(strings.NewReader(armored))
+	if err != nil {
+		return nil, false
+	}
+	packets := packet.NewReader(block.Body)
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			return sig, sig != nil
+		}
+		if err != nil {
+			return nil, false
+		}
+		s, isSig := p.(*packet.Signature)
+		if !isSig || s.SigType != packet.SigTypeKeyRevocation || s.IssuerKeyId == nil || sig != nil {
+			return nil, false
+		}
+		sig = s
+	}
+}
+
+// Returns the armored key if it carries revocation signatures, ok is false for anything else
+func readRevokedKey(armored string) (e *openpgp.Entity, ok bool) {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armored))
+	if err != nil || len(entities) == 0 || len(entities[0].Revocations) == 0 {
+		return nil, false
+	}
+	return entities[0], true
+}
+
+// Revokes the stored key of addr which issued the revocation certificate
+func revokeWithCertificate(c echo.Context, addr string, sig *packet.Signature, auth storage.Authorization) error {
+	return revoke(c, addr, *sig.IssuerKeyId, []*packet.Signature{sig}, nil, auth)
+}
+
+// Revokes the stored version of the key uploaded with its revocation signatures
+func revokeWithKey(c echo.Context, addr string, revoked *openpgp.Entity, auth storage.Authorization) error {
+	return revoke(c, addr, revoked.PrimaryKey.KeyId, revoked.Revocations, revoked, auth)
+}
+
+// Revokes the stored key of addr with the key ID if the revocation signatures verify and uploaded, if not nil, matches it
+func revoke(c echo.Context, addr string, keyID uint64, sigs []*packet.Signature, uploaded *openpgp.Entity, auth storage.Authorization) error {
+	rec, e, err := storedKey(addr, keyID)
+	if err != nil {
+		return keyChangeFailed(c, err)
+	}
+	for _, sig := range sigs {
+		if err = e.PrimaryKey.VerifyRevocationSignature(sig); err != nil {
+			authFailed(c)
+			return c.String(http.StatusBadRequest, "Invalid revocation signature")
+		}
+	}
+	if uploaded != nil && !sameKey(e, uploaded) {
+		return c.String(http.StatusBadRequest, "Key doesn't match the stored version")
+	}
+	e.Revocations = append(e.Revocations, sigs...)
+	revokedKey, err := armorEntity(e)
+	if err != nil {
+		return keyChangeFailed(c, err)
+	}
+	if _, err = storage.RevokeKey(addr, rec.Fingerprint, revokedKey, auth); err != nil {
+		return keyChangeFailed(c, err)
+	}
+	return c.String(http.StatusOK, addr)
+}
+
+// Returns the stored version of the key of addr with the key ID, storage.ErrNotFound if there is none
+func storedKey(addr string, keyID uint64) (*storage.KeyRecord, *openpgp.Entity, error) {
+	records, err := storage.KeyHistory(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, rec := range records {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(rec.PublicKey))
+		if err == nil && len(entities) > 0 && entities[0].PrimaryKey.KeyId == keyID {
+			return rec, entities[0], nil
+		}
+	}
+	return nil, nil, storage.ErrNotFound
+}
+
+// Whether the keys are the same apart from their revocation signatures
+func sameKey(a, b *openpgp.Entity) bool {
+	bufA, bufB := &bytes.Buffer{}, &bytes.Buffer{}
+	return a.Serialize(bufA) == nil && b.Serialize(bufB) == nil && bytes.Equal(bufA.Bytes(), bufB.Bytes())
+}
+
+func armorEntity(e *openpgp.Entity) (string, error) {
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return "", err
+	}
+	if err = serializeEntity(w, e); err != nil {
+		return "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Like Entity.Serialize, with the revocation signatures which follow the primary key
+func serializeEntity(w io.Writer, e *openpgp.Entity) error {
+	primary := &bytes.Buffer{}
+	if err := e.PrimaryKey.Serialize(primary); err != nil {
+		return err
+	}
+	all := &bytes.Buffer{}
+	if err := e.Serialize(all); err != nil {
+		return err
+	}
+	if _, err := w.Write(primary.Bytes()); err != nil {
+		return err
+	}
+	for _, sig := range e.Revocations {
+		if err := sig.Serialize(w); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(all.Bytes()[primary.Len():])
+	return err
+}
@@ -0,0 +1,224 @@
+package endpoint
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/ProxeusApp/storage-app/lib/challenge"
+	"github.com/ProxeusApp/storage-app/pgp-server/storage"
+)
+
+func TestRotationAndRevocation(t *testing.T) {
+	openTestDB(t)
+	defer closeTestDB()
+	ethKey, address := newEthKey(t)
+	first, second := newEntity(t, address), newEntity(t, address)
+
+	assert.Equal(t, http.StatusOK, addKey(t, ethKey, armoredKey(t, first)).Code)
+	assert.Equal(t, http.StatusAlreadyReported, addKey(t, ethKey, armoredKey(t, first)).Code)
+	assert.Equal(t, http.StatusOK, addKey(t, ethKey, armoredKey(t, second)).Code)
+
+	// the key of another address isn't accepted
+	otherKey, _ := newEthKey(t)
+	assert.Equal(t, http.StatusUnauthorized, addKey(t, otherKey, armoredKey(t, newEntity(t, address))).Code)
+
+	history := keyHistory(t, address)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, 1, history[0].Version)
+		assert.NotNil(t, history[0].Replaced)
+		assert.Equal(t, 2, history[1].Version)
+		assert.Nil(t, history[1].Replaced)
+		assert.NotNil(t, history[1].Authorization)
+	}
+
+	// a revocation certificate signed by another key is rejected
+	rec := addKey(t, ethKey, revocationCertificate(t, revocation(t, first, second)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "Invalid revocation signature", rec.Body.String())
+	// a revoked key which doesn't match the stored version is rejected
+	stripped := *second
+	stripped.Subkeys = nil
+	stripped.Revocations = []*packet.Signature{revocation(t, second, second)}
+	rec = addKey(t, ethKey, armoredKey(t, &stripped))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "Key doesn't match the stored version", rec.Body.String())
+	history = keyHistory(t, address)
+	assert.Nil(t, history[1].Revoked)
+
+	// the current key is revoked with the key and its revocation signature, the stored version is served revoked
+	revoked := *second
+	revoked.Revocations = []*packet.Signature{revocation(t, second, second)}
+	assert.Equal(t, http.StatusOK, addKey(t, ethKey, armoredKey(t, &revoked)).Code)
+	publicKey, err := storage.GetPublicKey(address)
+	if assert.NoError(t, err) {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(publicKey))
+		if assert.NoError(t, err) {
+			assert.Len(t, entities[0].Revocations, 1)
+			assert.Len(t, entities[0].Subkeys, len(second.Subkeys))
+		}
+	}
+	// an old key is revoked with a revocation certificate
+	assert.Equal(t, http.StatusOK, addKey(t, ethKey, revocationCertificate(t, revocation(t, first, first))).Code)
+	history = keyHistory(t, address)
+	assert.NotNil(t, history[0].Revoked)
+	assert.NotNil(t, history[1].Revoked)
+
+	// a revoked key can't become the current key again
+	assert.Equal(t, http.StatusConflict, addKey(t, ethKey, armoredKey(t, first)).Code)
+}
+
+func openTestDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgp-endpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.DatabaseDir = filepath.Join(dir, "keys.db")
+	if storage.LogKey, err = ethcrypto.GenerateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.OpenDB(); err != nil {
+		t.Fatal(err)
+	}
+	Challenges = challenge.NewAuthenticator(challenge.NewMemoryStore(), time.Minute)
+}
+
+func closeTestDB() {
+	storage.CloseDB()
+	os.RemoveAll(filepath.Dir(storage.DatabaseDir))
+}
+
+func newEthKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ethcrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, strings.ToLower(ethcrypto.PubkeyToAddress(key.PublicKey).Hex())
+}
+
+// Returns a key with the user ID the dapp creates for the address
+func newEntity(t *testing.T, address string) *openpgp.Entity {
+	e, err := openpgp.NewEntity(address, "", "test@example.org", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func armoredKey(t *testing.T, e *openpgp.Entity) string {
+	armored, err := armorEntity(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return armored
+}
+
+// Returns the revocation signature of the primary key of e, signed by signer
+func revocation(t *testing.T, e, signer *openpgp.Entity) *packet.Signature {
+	sig := &packet.Signature{
+		SigType:      packet.SigTypeKeyRevocation,
+		PubKeyAlgo:   signer.PrimaryKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &e.PrimaryKey.KeyId,
+	}
+	// the hash of a key revocation covers the primary key packet without its header
+	pk := &bytes.Buffer{}
+	if err := e.PrimaryKey.Serialize(pk); err != nil {
+		t.Fatal(err)
+	}
+	body := pk.Bytes()
+	switch {
+	case body[1] < 192:
+		body = body[2:]
+	case body[1] < 224:
+		body = body[3:]
+	default:
+		body = body[6:]
+	}
+	h := sig.Hash.New()
+	e.PrimaryKey.SerializeSignaturePrefix(h)
+	h.Write(body)
+	if err := sig.Sign(h, signer.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func revocationCertificate(t *testing.T, sig *packet.Signature) string {
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sig.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return buf.String()
+}
+
+// Uploads publicKey with a challenge signed by ethKey
+func addKey(t *testing.T, ethKey *ecdsa.PrivateKey, publicKey string) *httptest.ResponseRecorder {
+	msg, err := Challenges.CreateSignInChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(map[string]string{"pubkey": publicKey, "token": msg.Token, "signature": signChallenge(t, msg.Challenge, ethKey)})
+	return serve(t, http.MethodPost, "/pks/add", string(body), AddPublicKey)
+}
+
+func signChallenge(t *testing.T, challengeHex string, key *ecdsa.PrivateKey) string {
+	challenge, err := hex.DecodeString(challengeHex[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := ethcrypto.Keccak256(append([]byte("\x19Ethereum Signed Message:\n"+strconv.Itoa(len(challenge))), challenge...))
+	sig, err := ethcrypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	return "0x" + hex.EncodeToString(sig)
+}
+
+func keyHistory(t *testing.T, address string) []storage.KeyRecord {
+	rec := serve(t, http.MethodGet, "/pks/lookup?op=x-history&search="+address, "", GetPublicKey)
+	var history []storage.KeyRecord
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return history
+}
+
+func serve(t *testing.T, method, target, body string, handler echo.HandlerFunc) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	rec := httptest.NewRecorder()
+	if err := handler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
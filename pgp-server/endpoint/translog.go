@@ -0,0 +1,99 @@
+package endpoint
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+
+	"github.com/ProxeusApp/storage-app/lib/translog"
+	"github.com/ProxeusApp/storage-app/pgp-server/storage"
+)
+
+/**
+The transparency log of the served keys, see lib/translog:
+
+	/pks/log/head                                        the latest signed tree head
+	/pks/log/proof?search=0x<address>&treeSize=<size>    inclusion of the current key of an address, consistent with treeSize
+	/pks/log/consistency?first=<size>&second=<size>      consistency between two tree sizes
+	/pks/log/entries?start=<index>&end=<index>           the entries, for monitors
+*/
+
+func GetLogHead(c echo.Context) error {
+	head, err := storage.LogHead()
+	if err != nil {
+		return logFailed(c, err)
+	}
+	return c.JSON(http.StatusOK, head)
+}
+
+func GetLogProof(c echo.Context) error {
+	search := strings.ToLower(strings.TrimSpace(c.QueryParam("search")))
+	if search == "" {
+		return c.String(http.StatusBadRequest, "Empty ethereum address")
+	}
+	treeSize, err := optionalInt(c, "treeSize")
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid treeSize")
+	}
+	proof, err := storage.LogProof(search, treeSize)
+	if err != nil {
+		return logFailed(c, err)
+	}
+	return c.JSON(http.StatusOK, proof)
+}
+
+func GetLogConsistency(c echo.Context) error {
+	first, err := strconv.Atoi(c.QueryParam("first"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid first")
+	}
+	second, err := strconv.Atoi(c.QueryParam("second"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid second")
+	}
+	consistency, err := storage.LogConsistency(first, second)
+	if err != nil {
+		return logFailed(c, err)
+	}
+	return c.JSON(http.StatusOK, consistency)
+}
+
+func GetLogEntries(c echo.Context) error {
+	start, err := strconv.Atoi(c.QueryParam("start"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid start")
+	}
+	end, err := strconv.Atoi(c.QueryParam("end"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid end")
+	}
+	entries, err := storage.LogEntries(start, end)
+	if err != nil {
+		return logFailed(c, err)
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+func optionalInt(c echo.Context, name string) (int, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func logFailed(c echo.Context, err error) error {
+	switch err {
+	case storage.ErrNotFound:
+		return c.String(http.StatusNotFound, err.Error())
+	case storage.ErrInvalidLogSize:
+		return c.String(http.StatusBadRequest, err.Error())
+	case storage.ErrBeyondLog:
+		// the client has seen a larger tree of this log
+		return c.String(translog.StatusBeyondLog, err.Error())
+	}
+	c.Logger().Warn(err)
+	return c.String(http.StatusInternalServerError, err.Error())
+}
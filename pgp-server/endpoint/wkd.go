@@ -0,0 +1,85 @@
+package endpoint
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+
+	"github.com/ProxeusApp/storage-app/pgp-server/storage"
+	"github.com/ProxeusApp/storage-app/pgp-server/wkd"
+)
+
+/**
+Web Key Directory of the configured domains, see pgp-server/wkd:
+
+	/.well-known/openpgpkey/<domain>/hu/<hash>    advanced method, served as openpgpkey.<domain>
+	/.well-known/openpgpkey/hu/<hash>             direct method, the domain is the requested host
+	/.well-known/openpgpkey/<domain>/policy       and /.well-known/openpgpkey/policy, empty
+
+Other domains are answered with 404. Mail addresses of user IDs other than the ethereum address are only published if
+listed in WKDMailboxes.
+*/
+
+// Domains whose web key directory is served
+var WKDDomains []string
+
+// Verified mail addresses whose user IDs are published besides the ethereum addresses
+var WKDMailboxes wkd.Mailboxes
+
+func GetWKDKey(c echo.Context) error {
+	domain, ok := wkdDomain(c)
+	if !ok {
+		return c.NoContent(http.StatusNotFound)
+	}
+	addresses, err := storage.FindByWKDHash(domain, strings.ToLower(c.Param("hash")), WKDMailboxes)
+	if err == storage.ErrNotFound {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		c.Logger().Warn(err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	var keys []byte
+	for _, addr := range addresses {
+		publicKey, err := storage.GetPublicKey(addr)
+		if err != nil {
+			continue
+		}
+		binaryKey, err := wkd.Binary(publicKey)
+		if err != nil {
+			c.Logger().Warnf("key of %s can't be read: %v", addr, err)
+			continue
+		}
+		keys = append(keys, binaryKey...)
+	}
+	if len(keys) == 0 {
+		return c.NoContent(http.StatusNotFound)
+	}
+	return c.Blob(http.StatusOK, echo.MIMEOctetStream, keys)
+}
+
+func GetWKDPolicy(c echo.Context) error {
+	if _, ok := wkdDomain(c); !ok {
+		return c.NoContent(http.StatusNotFound)
+	}
+	return c.Blob(http.StatusOK, echo.MIMETextPlain, nil)
+}
+
+// Returns the configured domain of the advanced method path or, for the direct method, of the requested host
+func wkdDomain(c echo.Context) (string, bool) {
+	domain := c.Param("domain")
+	if domain == "" {
+		domain = c.Request().Host
+		if host, _, err := net.SplitHostPort(domain); err == nil {
+			domain = host
+		}
+	}
+	for _, d := range WKDDomains {
+		if strings.EqualFold(d, domain) {
+			return d, true
+		}
+	}
+	return "", false
+}
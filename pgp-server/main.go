@@ -1,26 +1,53 @@
 package main
 
 import (
+	"crypto/ecdsa"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/ProxeusApp/storage-app/lib/challenge"
 	"github.com/ProxeusApp/storage-app/lib/default_server"
+	"github.com/ProxeusApp/storage-app/lib/health"
+	"github.com/ProxeusApp/storage-app/lib/ratelimit"
 	"github.com/ProxeusApp/storage-app/pgp-server/endpoint"
 	"github.com/ProxeusApp/storage-app/pgp-server/storage"
-	"github.com/ProxeusApp/storage-app/spp/config"
-	"github.com/ProxeusApp/storage-app/spp/fs"
+	"github.com/ProxeusApp/storage-app/pgp-server/wkd"
 )
 
 var storageDir string
 var serverAddress string
+var challengeStore string
+var challengeTTL int
+var rateLimits ratelimit.Config
+var banWindow, banDuration int
+var trustedProxies string
+var minFreeDisk int64
+var logKeyFile string
+var wkdDomains string
+var wkdExport string
+var wkdMailboxes string
 
 func main() {
 	e := newEcho()
 	defer storage.CloseDB()
+	defer endpoint.Challenges.Close()
+	if wkdExport != "" {
+		if err := exportWKD(wkdExport); err != nil {
+			e.Logger.Fatal(err)
+		}
+		return
+	}
 	// Start server
 	e.Logger.Debug(e.Start(serverAddress))
 }
@@ -28,6 +55,21 @@ func main() {
 func newEcho() *echo.Echo {
 	flag.StringVar(&storageDir, "storageDir", "/tmp", "databaseDir directory")
 	flag.StringVar(&serverAddress, "serverAddress", ":8080", "host:port")
+	flag.StringVar(&challengeStore, "challengeStore", challenge.StoreBolt, "Where sign in challenges are kept (bolt or memory, bolt survives restarts, neither is shared between instances)")
+	flag.IntVar(&challengeTTL, "challengeTTL", 300, "Seconds a sign in challenge stays valid")
+	flag.Float64Var(&rateLimits.IPRate, "rateLimitIP", 10, "Requests per second allowed per remote IP, 0 for no limit")
+	flag.IntVar(&rateLimits.IPBurst, "rateLimitIPBurst", 40, "Requests a remote IP may send in a burst")
+	flag.Float64Var(&rateLimits.AddressRate, "rateLimitAddress", 1, "Key uploads per second allowed per ethereum address, 0 for no limit")
+	flag.IntVar(&rateLimits.AddressBurst, "rateLimitAddressBurst", 5, "Key uploads an ethereum address may do in a burst")
+	flag.IntVar(&rateLimits.BanAfter, "banAfterFailures", 10, "Failed sign ins within banWindow which ban the remote IP, 0 to never ban")
+	flag.IntVar(&banWindow, "banWindow", 600, "Seconds within which failures count towards a ban")
+	flag.IntVar(&banDuration, "banDuration", 900, "Seconds a remote IP stays banned")
+	flag.StringVar(&trustedProxies, "trustedProxies", "", "Comma separated IPs and CIDRs of reverse proxies whose X-Forwarded-For and X-Real-IP headers name the client")
+	flag.Int64Var(&minFreeDisk, "healthMinFreeDiskBytes", 100*1024*1024, "Free disk space of the storage dir below which the server isn't ready, 0 for no limit")
+	flag.StringVar(&logKeyFile, "logKeyFile", "", "Hex encoded ethereum key which signs the transparency log, created if missing (default <storageDir>/log.key)")
+	flag.StringVar(&wkdDomains, "wkdDomains", "", "Comma separated mail domains whose Web Key Directory is served")
+	flag.StringVar(&wkdExport, "wkdExport", "", "Directory to write a static Web Key Directory of wkdDomains to instead of starting the server")
+	flag.StringVar(&wkdMailboxes, "wkdMailboxes", "", "File of verified \"<mail address> <ethereum address>\" lines, whose user IDs are published in the Web Key Directory besides the ethereum addresses")
 	flag.Parse()
 
 	e := default_server.Setup("/var/log/pgp.log")
@@ -45,14 +87,34 @@ func newEcho() *echo.Echo {
 			e.Logger.Panic(err)
 		}
 	}
-	storage.DatabaseDir = filepath.Join(storage.DatabaseDir, "database.db")
-	e.Logger.Print("DB path:", storage.DatabaseDir)
-	err = storage.OpenDB()
+	store, err := challenge.NewStore(challengeStore, storage.DatabaseDir)
+	if err != nil {
+		e.Logger.Panic(err)
+	}
+	endpoint.Challenges = challenge.NewAuthenticator(store, time.Duration(challengeTTL)*time.Second)
+
+	rateLimits.BanWindow = time.Duration(banWindow) * time.Second
+	rateLimits.BanDuration = time.Duration(banDuration) * time.Second
+	rateLimits.TrustedProxies, err = ratelimit.ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		e.Logger.Panic(err)
+	}
+	endpoint.Guard = ratelimit.NewGuard(rateLimits)
+	endpoint.Challenges.SetAddressLimiter(endpoint.Guard)
+	prometheus.MustRegister(endpoint.Guard.Collector("pgp"))
+
+	if logKeyFile == "" {
+		logKeyFile = filepath.Join(storage.DatabaseDir, "log.key")
+	}
+	storage.LogKey, err = loadLogKey(logKeyFile)
 	if err != nil {
 		e.Logger.Panic(err)
 	}
+	e.Logger.Print("Transparency log address: ", crypto.PubkeyToAddress(storage.LogKey.PublicKey).Hex())
 
-	endpoint.ProxeusFS, err = fs.NewProxeusFS(&config.Configuration{}, nil, nil, nil) // ETH connection not used
+	storage.DatabaseDir = filepath.Join(storage.DatabaseDir, "database.db")
+	e.Logger.Print("DB path:", storage.DatabaseDir)
+	err = storage.OpenDB()
 	if err != nil {
 		e.Logger.Panic(err)
 	}
@@ -62,9 +124,90 @@ func newEcho() *echo.Echo {
 	}))
 
 	// Routes
-	e.GET("/pks/challenge", endpoint.GetChallenge)
-	e.POST("/pks/add", endpoint.AddPublicKey)
-	e.GET("/pks/lookup", endpoint.GetPublicKey)
+	limited := endpoint.Guard.Middleware()
+	e.GET("/pks/challenge", endpoint.GetChallenge, limited)
+	e.POST("/pks/add", endpoint.AddPublicKey, limited)
+	e.GET("/pks/lookup", endpoint.GetPublicKey, limited)
+	e.POST("/pks/lookup/batch", endpoint.LookupBatch, limited)
+	e.GET("/pks/log/head", endpoint.GetLogHead, limited)
+	e.GET("/pks/log/proof", endpoint.GetLogProof, limited)
+	e.GET("/pks/log/consistency", endpoint.GetLogConsistency, limited)
+	e.GET("/pks/log/entries", endpoint.GetLogEntries, limited)
+	for _, domain := range strings.Split(wkdDomains, ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			endpoint.WKDDomains = append(endpoint.WKDDomains, domain)
+		}
+	}
+	if wkdMailboxes != "" {
+		if endpoint.WKDMailboxes, err = wkd.LoadMailboxes(wkdMailboxes); err != nil {
+			e.Logger.Panic(err)
+		}
+	}
+	e.GET("/.well-known/openpgpkey/hu/:hash", endpoint.GetWKDKey, limited)
+	e.GET("/.well-known/openpgpkey/policy", endpoint.GetWKDPolicy, limited)
+	e.GET("/.well-known/openpgpkey/:domain/hu/:hash", endpoint.GetWKDKey, limited)
+	e.GET("/.well-known/openpgpkey/:domain/policy", endpoint.GetWKDPolicy, limited)
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
+	checks := newHealthChecks(filepath.Dir(storage.DatabaseDir))
+	e.GET("/health", func(c echo.Context) error { return c.JSON(http.StatusOK, checks.Run().Checks) })
+	e.GET("/health/live", checks.Live)
+	e.GET("/health/ready", checks.Ready)
 
 	return e
 }
+
+// Loads the key which signs the transparency log, a new one is created if the file doesn't exist.
+// Clients pin the log by its address, so the key must be kept.
+func loadLogKey(file string) (*ecdsa.PrivateKey, error) {
+	key, err := crypto.LoadECDSA(file)
+	if err == nil || !os.IsNotExist(err) {
+		return key, err
+	}
+	if key, err = crypto.GenerateKey(); err != nil {
+		return nil, err
+	}
+	return key, crypto.SaveECDSA(file, key)
+}
+
+// Writes the Web Key Directory of the stored keys to dir
+func exportWKD(dir string) error {
+	if len(endpoint.WKDDomains) == 0 {
+		return fmt.Errorf("wkdExport needs wkdDomains")
+	}
+	directory := wkd.NewDirectory(endpoint.WKDDomains, endpoint.WKDMailboxes)
+	err := storage.ForEachKey(func(address, publicKey string) error {
+		if err := directory.Add(address, publicKey); err != nil {
+			fmt.Fprintf(os.Stderr, "skipping the key of %s: %v\n", address, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = directory.Write(dir); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d keys for %s to %s\n", directory.Len(), strings.Join(endpoint.WKDDomains, ", "), dir)
+	return nil
+}
+
+// The server isn't ready if the keys can't be read or stored
+func newHealthChecks(dir string) *health.Checker {
+	checks := health.NewChecker(5 * time.Second)
+	checks.Add("database", true, func() (string, error) {
+		return "", storage.Check()
+	})
+	checks.Add("disk", true, func() (string, error) {
+		free, err := health.FreeDiskBytes(dir)
+		if err != nil {
+			return "", err
+		}
+		info := fmt.Sprintf("Free: %d bytes", free)
+		if minFreeDisk > 0 && free < uint64(minFreeDisk) {
+			return info, fmt.Errorf("less than %d bytes free", minFreeDisk)
+		}
+		return info, nil
+	})
+	return checks
+}
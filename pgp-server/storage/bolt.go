@@ -2,6 +2,8 @@ package storage
 
 import (
 	"errors"
+	"os"
+	"time"
 
 	"github.com/boltdb/bolt"
 )
@@ -17,7 +19,8 @@ var bucketName = []byte("items")
 
 func OpenDB() error {
 	var err error
-	db, err = bolt.Open(DatabaseDir, 0644, nil)
+	// the timeout fails an export instead of waiting for a running server to release the file
+	db, err = bolt.Open(DatabaseDir, 0644, &bolt.Options{Timeout: 10 * time.Second})
 	if err != nil {
 		return err
 	}
@@ -26,7 +29,13 @@ func OpenDB() error {
 		if err != nil {
 			return err
 		}
-		return nil
+		if err = ensureIndex(tx); err != nil {
+			return err
+		}
+		if err = ensureHistory(tx); err != nil {
+			return err
+		}
+		return ensureLog(tx)
 	})
 	return err
 }
@@ -35,6 +44,19 @@ func CloseDB() {
 	db.Close()
 }
 
+// Returns an error if the database file is gone or can't be read
+func Check() error {
+	if _, err := os.Stat(DatabaseDir); err != nil {
+		return err
+	}
+	return db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketName) == nil {
+			return bolt.ErrBucketNotFound
+		}
+		return nil
+	})
+}
+
 func GetPublicKey(ethereumAddress string) (publicKey string, err error) {
 	err = db.View(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket(bucketName)
@@ -48,9 +70,11 @@ func GetPublicKey(ethereumAddress string) (publicKey string, err error) {
 	return publicKey, err
 }
 
-func SetPublicKey(ethereumAddress string, publicKey string) error {
-	return db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(bucketName)
-		return bucket.Put([]byte(ethereumAddress), []byte(publicKey))
+// Calls fn with every stored key
+func ForEachKey(fn func(address, publicKey string) error) error {
+	return db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).ForEach(func(address, publicKey []byte) error {
+			return fn(string(address), string(publicKey))
+		})
 	})
 }
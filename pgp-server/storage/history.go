@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/ProxeusApp/storage-app/lib/translog"
+)
+
+/**
+Every key stored for an address is kept as a version in the history bucket, keyed by the address and the big endian
+version number. The current key is the latest version and is also kept in the items bucket, which the lookups read.
+A version records when it was added and replaced, the signed challenge which authorized it and, once revoked, the
+revocation with its own authorization.
+
+Keys stored before the history existed become version 1 without authorization when the database is opened.
+*/
+type (
+	// Signed sign-in challenge which authorized a change
+	Authorization struct {
+		Token     string `json:"token"`
+		Challenge string `json:"challenge"`
+		Signature string `json:"signature"`
+	}
+
+	Revocation struct {
+		At            time.Time      `json:"at"`
+		Authorization *Authorization `json:"authorization,omitempty"`
+	}
+
+	KeyRecord struct {
+		Version       int            `json:"version"`
+		Fingerprint   string         `json:"fingerprint"` // Lower case hex fingerprint of the primary key
+		PublicKey     string         `json:"publicKey"`
+		Added         time.Time      `json:"added"` // Zero for keys stored before the history existed
+		Replaced      *time.Time     `json:"replaced,omitempty"`
+		Revoked       *Revocation    `json:"revoked,omitempty"`
+		Authorization *Authorization `json:"authorization,omitempty"`
+	}
+)
+
+var historyBucket = []byte("history")
+
+var (
+	ErrInvalidKey = errors.New("public key can't be read")
+	ErrKeyRevoked = errors.New("key has been revoked")
+	ErrKeyExists  = errors.New("key is stored already")
+)
+
+// Creates the history bucket, the stored keys become their first version if it didn't exist yet
+func ensureHistory(tx *bolt.Tx) error {
+	if tx.Bucket(historyBucket) != nil {
+		return nil
+	}
+	history, err := tx.CreateBucket(historyBucket)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketName).ForEach(func(address, publicKey []byte) error {
+		rec := KeyRecord{Version: 1, PublicKey: string(publicKey)}
+		rec.Fingerprint, _ = fingerprint(rec.PublicKey)
+		return putRecord(history, string(address), &rec)
+	})
+}
+
+// Stores publicKey as the new current key of address, authorized by auth.
+// Returns ErrKeyExists if it is the current key already, ErrKeyRevoked if it has been revoked before and
+// ErrFingerprintInUse if the key or a subkey is stored for another address.
+func StoreKey(address, publicKey string, auth Authorization) (*KeyRecord, error) {
+	fpr, err := fingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	rec := &KeyRecord{Fingerprint: fpr, PublicKey: publicKey, Added: time.Now().UTC(), Authorization: &auth}
+	err = db.Update(func(tx *bolt.Tx) error {
+		history := tx.Bucket(historyBucket)
+		records, err := records(history, address)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			if r.Fingerprint == fpr && r.Revoked != nil {
+				return ErrKeyRevoked
+			}
+		}
+		if n := len(records); n > 0 {
+			current := records[n-1]
+			if current.Fingerprint == fpr && current.PublicKey == publicKey {
+				return ErrKeyExists
+			}
+			current.Replaced = &rec.Added
+			if err = putRecord(history, address, current); err != nil {
+				return err
+			}
+			rec.Version = current.Version + 1
+		} else {
+			rec.Version = 1
+		}
+		if err = putRecord(history, address, rec); err != nil {
+			return err
+		}
+		return setCurrent(tx, address, rec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Marks the version of address with the fingerprint revoked, revokedKey is the key with the revocation signature.
+// If it is the current key, revokedKey is served from now on so lookups show the revocation.
+func RevokeKey(address, fpr, revokedKey string, auth Authorization) (*KeyRecord, error) {
+	var rec *KeyRecord
+	err := db.Update(func(tx *bolt.Tx) error {
+		history := tx.Bucket(historyBucket)
+		records, err := records(history, address)
+		if err != nil {
+			return err
+		}
+		for i, r := range records {
+			if r.Fingerprint != fpr {
+				continue
+			}
+			if r.Revoked != nil {
+				return ErrKeyRevoked
+			}
+			r.Revoked = &Revocation{At: time.Now().UTC(), Authorization: &auth}
+			r.PublicKey = revokedKey
+			rec = r
+			if err = putRecord(history, address, r); err != nil {
+				return err
+			}
+			if i == len(records)-1 {
+				return setCurrent(tx, address, r)
+			}
+			return nil
+		}
+		return ErrNotFound
+	})
+	return rec, err
+}
+
+// Returns the versions of the keys of address, oldest first
+func KeyHistory(address string) (recs []*KeyRecord, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		recs, err = records(tx.Bucket(historyBucket), address)
+		return err
+	})
+	if err == nil && len(recs) == 0 {
+		err = ErrNotFound
+	}
+	return
+}
+
+// Serves the key of rec for address from now on and logs it
+func setCurrent(tx *bolt.Tx, address string, rec *KeyRecord) error {
+	if err := tx.Bucket(bucketName).Put([]byte(address), []byte(rec.PublicKey)); err != nil {
+		return err
+	}
+	if err := unindex(tx, address); err != nil {
+		return err
+	}
+	if err := index(tx, address, rec.PublicKey); err != nil {
+		return err
+	}
+	return appendLog(tx, translog.NewEntry(address, rec.Fingerprint, rec.PublicKey, rec.Revoked != nil))
+}
+
+func records(history *bolt.Bucket, address string) ([]*KeyRecord, error) {
+	var recs []*KeyRecord
+	prefix := []byte(address + "/")
+	c := history.Cursor()
+	for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+		rec := &KeyRecord{}
+		if err := json.Unmarshal(v, rec); err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+func putRecord(history *bolt.Bucket, address string, rec *KeyRecord) error {
+	bts, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	key := make([]byte, len(address)+1+4)
+	copy(key, address+"/")
+	binary.BigEndian.PutUint32(key[len(address)+1:], uint32(rec.Version))
+	return history.Put(key, bts)
+}
+
+// Returns the fingerprint of the primary key of the armored publicKey
+func fingerprint(publicKey string) (string, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(publicKey))
+	if err != nil || len(entities) == 0 {
+		return "", ErrInvalidKey
+	}
+	return hex.EncodeToString(entities[0].PrimaryKey.Fingerprint[:]), nil
+}
@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/ProxeusApp/storage-app/pgp-server/wkd"
+)
+
+/**
+The key index finds the stored keys by the fingerprints and key IDs of their primary keys and subkeys and by their
+user IDs, for the HKP and WKD lookups. It is updated in the same transaction as the keys and rebuilt from them when a
+database without index is opened.
+A fingerprint only belongs to one address: a key having the primary key or a subkey of the key of another address
+is rejected, so the lookups by fingerprint and key ID can't be redirected to another address.
+
+	fingerprints: lower case hex fingerprint -> ethereum address the key is stored under
+	uids:         ethereum address -> lower case user IDs of the key, one per line
+	wkd:          <domain>/<WKD hash of the local part> -> ethereum addresses with a user ID of the mail address, one per line
+*/
+
+var (
+	fingerprintsBucket = []byte("fingerprints")
+	uidsBucket         = []byte("uids")
+	wkdBucket          = []byte("wkd")
+)
+
+var indexBuckets = [][]byte{fingerprintsBucket, uidsBucket, wkdBucket}
+
+// Max keys returned by a search
+const maxSearchResults = 100
+
+var ErrFingerprintInUse = errors.New("the key or one of its subkeys is stored for another address")
+
+// Creates the index buckets, indexes the stored keys again if one of them didn't exist yet
+func ensureIndex(tx *bolt.Tx) error {
+	missing := false
+	for _, b := range indexBuckets {
+		missing = missing || tx.Bucket(b) == nil
+	}
+	if !missing {
+		return nil
+	}
+	for _, b := range indexBuckets {
+		if tx.Bucket(b) != nil {
+			if err := tx.DeleteBucket(b); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.CreateBucket(b); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(bucketName).ForEach(func(address, publicKey []byte) error {
+		err := index(tx, string(address), string(publicKey))
+		if err == ErrFingerprintInUse {
+			// stored before fingerprints were unique, the key indexed first keeps them
+			log.Printf("[storage][ensureIndex] key of %s isn't indexed: %v", address, err)
+			return nil
+		}
+		return err
+	})
+}
+
+// Indexes publicKey stored under address. Keys which can't be parsed are only found by their address.
+// Returns ErrFingerprintInUse if a fingerprint of the key is indexed for another address.
+func index(tx *bolt.Tx, address, publicKey string) error {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(publicKey))
+	if err != nil {
+		return nil
+	}
+	var (
+		keys [][]byte
+		uids []string
+	)
+	for _, e := range entities {
+		keys = append(keys, []byte(hex.EncodeToString(e.PrimaryKey.Fingerprint[:])))
+		for _, sub := range e.Subkeys {
+			keys = append(keys, []byte(hex.EncodeToString(sub.PublicKey.Fingerprint[:])))
+		}
+		for uid := range e.Identities {
+			uids = append(uids, strings.ToLower(uid))
+		}
+	}
+	fingerprints := tx.Bucket(fingerprintsBucket)
+	for _, fpr := range keys {
+		if addr := fingerprints.Get(fpr); addr != nil && string(addr) != address {
+			return ErrFingerprintInUse
+		}
+	}
+	for _, fpr := range keys {
+		if err = fingerprints.Put(fpr, []byte(address)); err != nil {
+			return err
+		}
+	}
+	for _, k := range wkdKeys(uids) {
+		addresses := lines(tx.Bucket(wkdBucket).Get(k))
+		if contains(addresses, address) {
+			continue
+		}
+		if err = tx.Bucket(wkdBucket).Put(k, []byte(strings.Join(append(addresses, address), "\n"))); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(uidsBucket).Put([]byte(address), []byte(strings.Join(uids, "\n")))
+}
+
+// Returns the keys of the wkd bucket of the mail addresses of uids
+func wkdKeys(uids []string) [][]byte {
+	var keys [][]byte
+	for _, uid := range uids {
+		if local, domain := wkd.UserIDMail(uid); local != "" {
+			keys = append(keys, []byte(domain+"/"+wkd.Hash(local)))
+		}
+	}
+	return keys
+}
+
+// Returns the lines of an index value, none if it is empty
+func lines(value []byte) []string {
+	if len(value) == 0 {
+		return nil
+	}
+	return strings.Split(string(value), "\n")
+}
+
+// Removes the index entries of the key stored under address
+func unindex(tx *bolt.Tx, address string) error {
+	fingerprints := tx.Bucket(fingerprintsBucket)
+	var stale [][]byte
+	err := fingerprints.ForEach(func(fingerprint, addr []byte) error {
+		if string(addr) == address {
+			stale = append(stale, append([]byte{}, fingerprint...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, fingerprint := range stale {
+		if err = fingerprints.Delete(fingerprint); err != nil {
+			return err
+		}
+	}
+	wkdIndex := tx.Bucket(wkdBucket)
+	for _, k := range wkdKeys(lines(tx.Bucket(uidsBucket).Get([]byte(address)))) {
+		var addresses []string
+		for _, addr := range lines(wkdIndex.Get(k)) {
+			if addr != address {
+				addresses = append(addresses, addr)
+			}
+		}
+		if len(addresses) == 0 {
+			err = wkdIndex.Delete(k)
+		} else {
+			err = wkdIndex.Put(k, []byte(strings.Join(addresses, "\n")))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(uidsBucket).Delete([]byte(address))
+}
+
+// Returns the addresses of the keys with a fingerprint (40 hex digits) or key ID (16 or 8 hex digits, the end of the fingerprint)
+func FindByKeyID(keyID string) (addresses []string, err error) {
+	keyID = strings.TrimPrefix(strings.ToLower(keyID), "0x")
+	if _, err = hex.DecodeString(keyID); err != nil || (len(keyID) != 40 && len(keyID) != 16 && len(keyID) != 8) {
+		return nil, ErrNotFound
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		fingerprints := tx.Bucket(fingerprintsBucket)
+		if len(keyID) == 40 {
+			if addr := fingerprints.Get([]byte(keyID)); addr != nil {
+				addresses = append(addresses, string(addr))
+			}
+			return nil
+		}
+		return fingerprints.ForEach(func(fingerprint, addr []byte) error {
+			if strings.HasSuffix(string(fingerprint), keyID) && !contains(addresses, string(addr)) && len(addresses) < maxSearchResults {
+				addresses = append(addresses, string(addr))
+			}
+			return nil
+		})
+	})
+	if err == nil && len(addresses) == 0 {
+		err = ErrNotFound
+	}
+	return
+}
+
+// Returns the addresses of the keys with a user ID containing text, or equal to it if exact is set. Case is ignored.
+func FindByText(text string, exact bool) (addresses []string, err error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return nil, ErrNotFound
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(uidsBucket).ForEach(func(addr, uids []byte) error {
+			if len(addresses) >= maxSearchResults {
+				return nil
+			}
+			for _, uid := range strings.Split(string(uids), "\n") {
+				if uid == text || (!exact && strings.Contains(uid, text)) {
+					addresses = append(addresses, string(addr))
+					break
+				}
+			}
+			return nil
+		})
+	})
+	if err == nil && len(addresses) == 0 {
+		err = ErrNotFound
+	}
+	return
+}
+
+// Returns the addresses of the keys published in the web key directory of domain under hash, see pgp-server/wkd
+func FindByWKDHash(domain, hash string, mailboxes wkd.Mailboxes) (addresses []string, err error) {
+	domain = strings.ToLower(domain)
+	err = db.View(func(tx *bolt.Tx) error {
+		uids := tx.Bucket(uidsBucket)
+		// the index holds the mail addresses of all user IDs, the ones which aren't published are skipped
+		for _, addr := range lines(tx.Bucket(wkdBucket).Get([]byte(domain + "/" + hash))) {
+			for _, local := range wkd.LocalParts(addr, lines(uids.Get([]byte(addr))), domain, mailboxes) {
+				if wkd.Hash(local) == hash {
+					addresses = append(addresses, addr)
+					break
+				}
+			}
+		}
+		return nil
+	})
+	if err == nil && len(addresses) == 0 {
+		err = ErrNotFound
+	}
+	return
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/ProxeusApp/storage-app/pgp-server/wkd"
+)
+
+func TestFingerprintsBelongToOneAddress(t *testing.T) {
+	openTestDB(t)
+	defer closeTestDB()
+
+	alice, bob := "0x00000000000000000000000000000000000000a1", "0x00000000000000000000000000000000000000b0"
+	e := newEntity(t)
+	publicKey := armoredKey(t, e)
+	primary := hex.EncodeToString(e.PrimaryKey.Fingerprint[:])
+	subkey := hex.EncodeToString(e.Subkeys[0].PublicKey.Fingerprint[:])
+	_, err := StoreKey(alice, publicKey, Authorization{})
+	assert.NoError(t, err)
+
+	// the key of alice can't be stored for bob, the lookups keep finding alice
+	_, err = StoreKey(bob, publicKey, Authorization{})
+	assert.Equal(t, ErrFingerprintInUse, err)
+	_, err = GetPublicKey(bob)
+	assert.Equal(t, ErrNotFound, err)
+	for _, keyID := range []string{primary, subkey, subkey[24:]} {
+		addresses, err := FindByKeyID(keyID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{alice}, addresses)
+		}
+	}
+
+	// alice can store it again after rotating
+	_, err = StoreKey(alice, armoredKey(t, newEntity(t)), Authorization{})
+	assert.NoError(t, err)
+	_, err = StoreKey(alice, publicKey, Authorization{})
+	assert.NoError(t, err)
+
+	// keys stored before fingerprints were unique are indexed for the address indexed first
+	assert.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketName).Put([]byte(bob), []byte(publicKey)); err != nil {
+			return err
+		}
+		return tx.DeleteBucket(fingerprintsBucket)
+	}))
+	CloseDB()
+	assert.NoError(t, OpenDB())
+	addresses, err := FindByKeyID(primary)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{alice}, addresses)
+	}
+}
+
+func TestFindByWKDHash(t *testing.T) {
+	openTestDB(t)
+	defer closeTestDB()
+
+	alice, bob := "0x00000000000000000000000000000000000000a1", "0x00000000000000000000000000000000000000b0"
+	keyWithMail := func(mail string) string {
+		e, err := openpgp.NewEntity("test", "", mail, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return armoredKey(t, e)
+	}
+	_, err := StoreKey(alice, keyWithMail(alice+"@example.org"), Authorization{})
+	assert.NoError(t, err)
+	_, err = StoreKey(bob, keyWithMail(alice+"@example.org"), Authorization{})
+	assert.NoError(t, err)
+	_, err = StoreKey(bob, keyWithMail("ceo@example.org"), Authorization{})
+	assert.NoError(t, err)
+
+	// a user ID of the address of another key isn't published, nor is a mail address which isn't listed in the mailboxes
+	find := func(local string, mailboxes wkd.Mailboxes) []string {
+		addresses, err := FindByWKDHash("Example.org", wkd.Hash(local), mailboxes)
+		if err != nil {
+			assert.Equal(t, ErrNotFound, err)
+		}
+		return addresses
+	}
+	assert.Equal(t, []string{alice}, find(alice, nil))
+	assert.Nil(t, find(bob, nil))
+	assert.Nil(t, find("ceo", nil))
+	assert.Equal(t, []string{bob}, find("ceo", wkd.Mailboxes{"ceo@example.org": bob}))
+
+	// the index follows the stored keys and is rebuilt if it doesn't exist
+	_, err = StoreKey(alice, keyWithMail("joe@example.org"), Authorization{})
+	assert.NoError(t, err)
+	assert.Nil(t, find(alice, nil))
+	assert.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(wkdBucket)
+	}))
+	CloseDB()
+	assert.NoError(t, OpenDB())
+	assert.Equal(t, []string{bob}, find("ceo", wkd.Mailboxes{"ceo@example.org": bob}))
+}
@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/ProxeusApp/storage-app/lib/merkle"
+	"github.com/ProxeusApp/storage-app/lib/translog"
+)
+
+/**
+Transparency log of the keys served for the addresses, see lib/translog. An entry is appended in the transaction
+which changes the current key of an address, and the tree head is signed with LogKey right after.
+
+	log:       big endian index -> entry JSON, the leaves are its hashes
+	logNodes:  level byte and big endian index -> hash of the complete subtree, see lib/merkle Tree
+	logLatest: ethereum address -> big endian index of the latest entry of the address
+	logHead:   "head" -> the latest signed tree head
+
+The current keys are logged when a database without log is opened, the nodes of a log without them are hashed once.
+*/
+
+// Signs the tree heads, must be set before OpenDB
+var LogKey *ecdsa.PrivateKey
+
+var (
+	logBucket       = []byte("log")
+	logNodesBucket  = []byte("logNodes")
+	logLatestBucket = []byte("logLatest")
+	logHeadBucket   = []byte("logHead")
+	logHeadKey      = []byte("head")
+)
+
+var (
+	ErrNoLogKey       = errors.New("no log key to sign the tree heads")
+	ErrInvalidLogSize = errors.New("invalid tree size")
+	ErrBeyondLog      = errors.New("tree size is beyond the log")
+)
+
+// Max entries returned at once
+const maxLogEntries = 1000
+
+// Creates the log buckets, logs the current keys if they didn't exist yet
+func ensureLog(tx *bolt.Tx) error {
+	if LogKey == nil {
+		return ErrNoLogKey
+	}
+	if tx.Bucket(logBucket) != nil {
+		if tx.Bucket(logNodesBucket) == nil {
+			return hashLogNodes(tx)
+		}
+		return nil
+	}
+	for _, b := range [][]byte{logBucket, logNodesBucket, logLatestBucket, logHeadBucket} {
+		if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+			return err
+		}
+	}
+	var entries []*translog.Entry
+	err := tx.Bucket(bucketName).ForEach(func(address, publicKey []byte) error {
+		fpr, _ := fingerprint(string(publicKey))
+		entries = append(entries, translog.NewEntry(string(address), fpr, string(publicKey), false))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return appendLog(tx, entries...)
+}
+
+// Appends the entries and signs the new tree head
+func appendLog(tx *bolt.Tx, entries ...*translog.Entry) error {
+	log := tx.Bucket(logBucket)
+	latest := tx.Bucket(logLatestBucket)
+	size := logSize(log)
+	for _, e := range entries {
+		bts, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		index := uint64(size)
+		if err = log.Put(logIndex(index), bts); err != nil {
+			return err
+		}
+		if err = putLogNodes(tx, size, bts); err != nil {
+			return err
+		}
+		if err = latest.Put([]byte(e.Address), logIndex(index)); err != nil {
+			return err
+		}
+		size++
+	}
+	head, err := translog.NewTreeHead(merkle.Tree{Size: size, Node: logNodes(tx)}, LogKey)
+	if err != nil {
+		return err
+	}
+	bts, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(logHeadBucket).Put(logHeadKey, bts)
+}
+
+// Returns the latest signed tree head
+func LogHead() (head *translog.TreeHead, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		head, err = logHead(tx)
+		return err
+	})
+	return
+}
+
+// Returns the proof of the latest entry of address, with the consistency from the tree of oldSize leaves if not 0
+func LogProof(address string, oldSize int) (proof *translog.Proof, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		head, tree, err := logTree(tx, oldSize)
+		if err != nil {
+			return err
+		}
+		proof, err = logProof(tx, tree, head, address, oldSize)
+		return err
+	})
+	return
+}
+
+// Current key of an address with the proof of its log entry
+type LoggedKey struct {
+	PublicKey string          `json:"publicKey"`
+	Proof     *translog.Proof `json:"proof"`
+}
+
+// Returns the current keys of the addresses with their log proofs, read in one transaction. Addresses without key are left out.
+func GetLoggedKeys(addresses []string, oldSize int) (keys map[string]*LoggedKey, err error) {
+	keys = map[string]*LoggedKey{}
+	err = db.View(func(tx *bolt.Tx) error {
+		head, tree, err := logTree(tx, oldSize)
+		if err != nil {
+			return err
+		}
+		items := tx.Bucket(bucketName)
+		for _, address := range addresses {
+			publicKey := items.Get([]byte(address))
+			if publicKey == nil {
+				continue
+			}
+			proof, err := logProof(tx, tree, head, address, oldSize)
+			if err != nil {
+				return err
+			}
+			keys[address] = &LoggedKey{PublicKey: string(publicKey), Proof: proof}
+		}
+		return nil
+	})
+	return
+}
+
+// Returns the latest tree head and its tree, ErrBeyondLog if oldSize is beyond it
+func logTree(tx *bolt.Tx, oldSize int) (*translog.TreeHead, merkle.Tree, error) {
+	head, err := logHead(tx)
+	if err != nil {
+		return nil, merkle.Tree{}, err
+	}
+	if oldSize < 0 {
+		return nil, merkle.Tree{}, ErrInvalidLogSize
+	}
+	if oldSize > head.Size {
+		return nil, merkle.Tree{}, ErrBeyondLog
+	}
+	return head, merkle.Tree{Size: head.Size, Node: logNodes(tx)}, nil
+}
+
+func logProof(tx *bolt.Tx, tree merkle.Tree, head *translog.TreeHead, address string, oldSize int) (*translog.Proof, error) {
+	index := tx.Bucket(logLatestBucket).Get([]byte(address))
+	if index == nil {
+		return nil, ErrNotFound
+	}
+	entry := append([]byte{}, tx.Bucket(logBucket).Get(index)...)
+	return translog.NewProof(tree, entry, int(binary.BigEndian.Uint64(index)), *head, oldSize), nil
+}
+
+// Returns the proof that the tree of first leaves is a prefix of the one of second leaves
+func LogConsistency(first, second int) (c *translog.Consistency, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		if first <= 0 || first > second {
+			return ErrInvalidLogSize
+		}
+		if second > logSize(tx.Bucket(logBucket)) {
+			return ErrBeyondLog
+		}
+		c = translog.NewConsistency(merkle.Tree{Size: second, Node: logNodes(tx)}, first)
+		return nil
+	})
+	return
+}
+
+// Returns the entries from start up to end, exclusive, at most maxLogEntries, so monitors can follow the log
+func LogEntries(start, end int) (entries []json.RawMessage, err error) {
+	if start < 0 || end <= start {
+		return nil, ErrInvalidLogSize
+	}
+	if end-start > maxLogEntries {
+		end = start + maxLogEntries
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(logBucket).Cursor()
+		for k, v := c.Seek(logIndex(uint64(start))); k != nil && binary.BigEndian.Uint64(k) < uint64(end); k, v = c.Next() {
+			entries = append(entries, append(json.RawMessage{}, v...))
+		}
+		if len(entries) == 0 {
+			return ErrInvalidLogSize
+		}
+		return nil
+	})
+	return
+}
+
+func logHead(tx *bolt.Tx) (*translog.TreeHead, error) {
+	head := &translog.TreeHead{}
+	if err := json.Unmarshal(tx.Bucket(logHeadBucket).Get(logHeadKey), head); err != nil {
+		return nil, err
+	}
+	return head, nil
+}
+
+// Number of entries in the log
+func logSize(log *bolt.Bucket) int {
+	k, _ := log.Cursor().Last()
+	if k == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(k)) + 1
+}
+
+// Stores the leaf of entry, appended at index, and the nodes it completes
+func putLogNodes(tx *bolt.Tx, index int, entry []byte) error {
+	nodes := tx.Bucket(logNodesBucket)
+	for _, n := range merkle.AppendLeaf(logNodes(tx), index, translog.LeafHash(entry)) {
+		if err := nodes.Put(logNode(n.Level, n.Index), n.Hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Hashes the nodes of a log which was written without them
+func hashLogNodes(tx *bolt.Tx) error {
+	if _, err := tx.CreateBucket(logNodesBucket); err != nil {
+		return err
+	}
+	index := 0
+	return tx.Bucket(logBucket).ForEach(func(_, entry []byte) error {
+		err := putLogNodes(tx, index, entry)
+		index++
+		return err
+	})
+}
+
+func logNodes(tx *bolt.Tx) merkle.NodeFunc {
+	nodes := tx.Bucket(logNodesBucket)
+	return func(level, index int) []byte {
+		return nodes.Get(logNode(level, index))
+	}
+}
+
+func logNode(level, index int) []byte {
+	return append([]byte{byte(level)}, logIndex(uint64(index))...)
+}
+
+func logIndex(i uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, i)
+	return k
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestLog(t *testing.T) {
+	openTestDB(t)
+	defer closeTestDB()
+	logAddress := crypto.PubkeyToAddress(LogKey.PublicKey)
+
+	var addresses []string
+	for i := 0; i < 9; i++ {
+		address := fmt.Sprintf("0x%040x", i)
+		addresses = append(addresses, address)
+		_, err := StoreKey(address, armoredKey(t, newEntity(t)), Authorization{})
+		assert.NoError(t, err)
+	}
+	first, err := LogHead()
+	assert.NoError(t, err)
+	assert.Equal(t, len(addresses), first.Size)
+
+	// the key stored last for an address is proven consistently with the older tree
+	publicKey := armoredKey(t, newEntity(t))
+	_, err = StoreKey(addresses[3], publicKey, Authorization{})
+	assert.NoError(t, err)
+	proof, err := LogProof(addresses[3], first.Size)
+	if assert.NoError(t, err) {
+		assert.Equal(t, len(addresses), proof.Index)
+		assert.NoError(t, proof.Verify(addresses[3], publicKey, logAddress, first))
+	}
+	consistency, err := LogConsistency(first.Size, first.Size+1)
+	if assert.NoError(t, err) {
+		assert.NoError(t, proof.TreeHead.VerifyConsistency(first, consistency.Proof))
+	}
+	_, err = LogProof(addresses[3], first.Size+2)
+	assert.Equal(t, ErrBeyondLog, err)
+	_, err = LogProof(addresses[3], -1)
+	assert.Equal(t, ErrInvalidLogSize, err)
+
+	// the nodes of a log written without them are hashed when the database is opened
+	assert.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(logNodesBucket)
+	}))
+	CloseDB()
+	assert.NoError(t, OpenDB())
+	again, err := LogProof(addresses[3], first.Size)
+	if assert.NoError(t, err) {
+		assert.Equal(t, proof.Inclusion, again.Inclusion)
+		assert.Equal(t, proof.Consistency, again.Consistency)
+	}
+}
+
+func openTestDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgp-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	DatabaseDir = filepath.Join(dir, "keys.db")
+	if LogKey, err = crypto.GenerateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err = OpenDB(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func closeTestDB() {
+	CloseDB()
+	os.RemoveAll(filepath.Dir(DatabaseDir))
+}
+
+func newEntity(t *testing.T) *openpgp.Entity {
+	e, err := openpgp.NewEntity("test", "", "test@example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func armoredKey(t *testing.T, e *openpgp.Entity) string {
+	var b bytes.Buffer
+	w, err := armor.Encode(&b, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return b.String()
+}
@@ -0,0 +1,222 @@
+package wkd
+
+import (
+	"crypto/sha1"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+/**
+Web Key Directory (draft-koch-openpgp-webkey-service), so the stored keys are found by mail address by OpenPGP tools
+like gpg --locate-keys. A key is published for the configured domains under the local parts of its user IDs
+
+	<ethereum address>@<domain>                 for a user ID with the ethereum address the key is stored under
+	<local part>@<domain>                       for a user ID with a mail address of the domain listed in the mailboxes
+
+at the hash of the lower case local part, z-base-32 encoded SHA-1. Keys are served binary, as WKD requires. A key is
+only published under the mail addresses of its user IDs, OpenPGP tools reject a key without a user ID of the address.
+
+Uploads only prove the ethereum address, not the mailboxes of the user IDs, so the mail address of a user ID is only
+published if the operator listed it in the mailboxes for that ethereum address. Otherwise anybody could publish a key
+for ceo@example.org.
+
+Usage:
+
+	mailboxes, _ := wkd.LoadMailboxes("/etc/pgp-server/mailboxes")
+	dir := wkd.NewDirectory([]string{"example.org"}, mailboxes)
+	_ = dir.Add(address, publicKey)
+	_ = dir.Write("/var/www/openpgpkey")
+*/
+
+// Directory of the keys of some domains, written as static tree with the advanced layout:
+//
+//	<dir>/.well-known/openpgpkey/<domain>/hu/<hash>
+//	<dir>/.well-known/openpgpkey/<domain>/policy
+type Directory struct {
+	domains   []string
+	mailboxes Mailboxes
+	keys      map[string][]byte // domain/hash -> binary keys
+}
+
+// Verified mail addresses, lower case mail address -> lower case ethereum address whose key is published for it
+type Mailboxes map[string]string
+
+var ErrInvalidMailboxes = errors.New("mailboxes line isn't \"<mail address> <ethereum address>\"")
+
+const zbase32Alphabet = "ybndrfg8ejkmcpqxot1uwisza345h769"
+
+func NewDirectory(domains []string, mailboxes Mailboxes) *Directory {
+	return &Directory{domains: domains, mailboxes: mailboxes, keys: map[string][]byte{}}
+}
+
+/**
+Loads the mailboxes from a file with one verified mail address and the ethereum address whose key is published for it
+per line, empty lines and lines starting with # are skipped:
+
+	ceo@example.org 0xa80899bb12e4afe9787425a5e5fe166234b88185
+*/
+func LoadMailboxes(file string) (Mailboxes, error) {
+	bts, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	mailboxes := Mailboxes{}
+	for _, line := range strings.Split(string(bts), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, ErrInvalidMailboxes
+		}
+		if local, _ := splitMail(fields[0]); local == "" || !strings.HasPrefix(fields[1], "0x") {
+			return nil, ErrInvalidMailboxes
+		}
+		mailboxes[strings.ToLower(fields[0])] = strings.ToLower(fields[1])
+	}
+	return mailboxes, nil
+}
+
+// Returns whether the key stored for address is published for mail
+func (me Mailboxes) Allows(mail, address string) bool {
+	addr, ok := me[strings.ToLower(mail)]
+	return ok && addr == strings.ToLower(address)
+}
+
+// Adds the armored publicKey stored for address under its local parts of the domains
+func (me *Directory) Add(address, publicKey string) error {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(publicKey))
+	if err != nil {
+		return err
+	}
+	var uids []string
+	for _, e := range entities {
+		for uid := range e.Identities {
+			uids = append(uids, uid)
+		}
+	}
+	binaryKey, err := Binary(publicKey)
+	if err != nil {
+		return err
+	}
+	for _, domain := range me.domains {
+		for _, local := range LocalParts(address, uids, domain, me.mailboxes) {
+			k := domain + "/" + Hash(local)
+			me.keys[k] = append(me.keys[k], binaryKey...)
+		}
+	}
+	return nil
+}
+
+// Number of published local parts
+func (me *Directory) Len() int {
+	return len(me.keys)
+}
+
+// Writes the tree to dir, with an empty policy for every domain
+func (me *Directory) Write(dir string) error {
+	root := filepath.Join(dir, ".well-known", "openpgpkey")
+	for _, domain := range me.domains {
+		hu := filepath.Join(root, domain, "hu")
+		if err := os.MkdirAll(hu, 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(root, domain, "policy"), nil, 0644); err != nil {
+			return err
+		}
+	}
+	for k, binaryKey := range me.keys {
+		if err := ioutil.WriteFile(filepath.Join(root, filepath.FromSlash(strings.Replace(k, "/", "/hu/", 1))), binaryKey, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the lower case local parts under which a key stored for address with uids is published for domain,
+// of the mail addresses of the uids at domain which are the address or which the mailboxes allow
+func LocalParts(address string, uids []string, domain string, mailboxes Mailboxes) []string {
+	var locals []string
+	for _, uid := range uids {
+		mail := mailOf(uid)
+		local, d := splitMail(mail)
+		if local == "" || !strings.EqualFold(d, domain) || contains(locals, local) {
+			continue
+		}
+		if local == strings.ToLower(address) || mailboxes.Allows(mail, address) {
+			locals = append(locals, local)
+		}
+	}
+	return locals
+}
+
+// Returns the lower case local part and domain of the mail address of a user ID, empty if it has none
+func UserIDMail(uid string) (local, domain string) {
+	return splitMail(mailOf(uid))
+}
+
+// Returns the WKD hash of a local part, the z-base-32 encoded SHA-1 of it in lower case
+func Hash(local string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(local)))
+	var b strings.Builder
+	var buf, bits uint
+	for _, c := range sum {
+		buf = buf<<8 | uint(c)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			b.WriteByte(zbase32Alphabet[buf>>bits&31])
+		}
+	}
+	if bits > 0 {
+		b.WriteByte(zbase32Alphabet[buf<<(5-bits)&31])
+	}
+	return b.String()
+}
+
+// Returns the binary packets of an armored key
+func Binary(armored string) ([]byte, error) {
+	block, err := armor.Decode(strings.NewReader(armored))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(block.Body)
+}
+
+// Returns the mail address of a user ID like "Name <local@domain>" or "local@domain"
+func mailOf(uid string) string {
+	if i := strings.LastIndex(uid, "<"); i >= 0 {
+		if j := strings.Index(uid[i:], ">"); j > 0 {
+			return strings.TrimSpace(uid[i+1 : i+j])
+		}
+	}
+	uid = strings.TrimSpace(uid)
+	if strings.ContainsAny(uid, " \t") {
+		return ""
+	}
+	return uid
+}
+
+func splitMail(mail string) (local, domain string) {
+	i := strings.LastIndex(mail, "@")
+	if i <= 0 || i == len(mail)-1 {
+		return "", ""
+	}
+	return strings.ToLower(mail[:i]), strings.ToLower(mail[i+1:])
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package wkd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+const (
+	address = "0xa80899bb12e4afe9787425a5e5fe166234b88185"
+	other   = "0x71c7656ec7ab88b098defb751b7401b5f6d8976f"
+)
+
+func TestHash(t *testing.T) {
+	// test vector of draft-koch-openpgp-webkey-service
+	assert.Equal(t, "iy9q119eutrkn8s1mk4r39qejnbu3n5q", Hash("Joe.Doe"))
+}
+
+func TestLocalParts(t *testing.T) {
+	uids := []string{"Joe Doe <Joe.Doe@Example.org>", "ceo@example.org", "Joe <joe@other.org>", "Joe <" + address + "@example.org>"}
+
+	// mail addresses of user IDs aren't published unless they are the address or the mailboxes allow them
+	assert.Equal(t, []string{address}, LocalParts(address, uids, "example.org", nil))
+	mailboxes := Mailboxes{"joe.doe@example.org": address, "ceo@example.org": other}
+	assert.Equal(t, []string{"joe.doe", address}, LocalParts(address, uids, "example.org", mailboxes))
+	assert.Equal(t, []string(nil), LocalParts(address, uids, "other.org", mailboxes))
+	// the address is only published for keys with a user ID of it
+	assert.Equal(t, []string{"ceo"}, LocalParts(other, uids, "example.org", mailboxes))
+}
+
+func TestDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wkd")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "mailboxes")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("# verified\n\nJoe.Doe@example.org "+address+"\n"), 0644))
+	mailboxes, err := LoadMailboxes(file)
+	assert.NoError(t, err)
+
+	directory := NewDirectory([]string{"example.org"}, mailboxes)
+	assert.NoError(t, directory.Add(address, armoredKey(t, "Joe.Doe@example.org")))
+	assert.NoError(t, directory.Add(other, armoredKey(t, "ceo@example.org")))
+	assert.NoError(t, directory.Add(other, armoredKey(t, other+"@example.org")))
+	assert.Equal(t, 2, directory.Len())
+	assert.NoError(t, directory.Write(dir))
+
+	hu := filepath.Join(dir, ".well-known", "openpgpkey", "example.org", "hu")
+	for _, local := range []string{other, "joe.doe"} {
+		bts, err := ioutil.ReadFile(filepath.Join(hu, Hash(local)))
+		if assert.NoError(t, err, local) {
+			_, err = openpgp.ReadKeyRing(bytes.NewReader(bts))
+			assert.NoError(t, err, local)
+		}
+	}
+	for _, local := range []string{address, "ceo"} {
+		_, err = os.Stat(filepath.Join(hu, Hash(local)))
+		assert.True(t, os.IsNotExist(err), local)
+	}
+	_, err = os.Stat(filepath.Join(dir, ".well-known", "openpgpkey", "example.org", "policy"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("ceo@example.org\n"), 0644))
+	_, err = LoadMailboxes(file)
+	assert.Equal(t, ErrInvalidMailboxes, err)
+}
+
+func armoredKey(t *testing.T, mail string) string {
+	e, err := openpgp.NewEntity("", "", mail, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	w, err := armor.Encode(&b, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return b.String()
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
@@ -14,6 +15,7 @@ import (
 
 	cache "github.com/ProxeusApp/memcache"
 
+	"github.com/ProxeusApp/storage-app/lib/grant"
 	"github.com/ProxeusApp/storage-app/spp/client/models"
 )
 
@@ -24,6 +26,21 @@ var (
 	ErrFileNotReady        = errors.New("file not ready yet. Try again") // The file isn't ready to be served yet
 	ErrNotSatisfiable      = errors.New("request not satisfiable")
 	ErrFilePaymentNotFound = errors.New("file payment not found")
+
+	ErrUploadSessionNotFound = errors.New("upload session not found")
+	ErrUploadOffsetMismatch  = errors.New("upload offset does not match")
+	ErrUploadIncomplete      = errors.New("upload incomplete")
+	ErrUploadTooLarge        = errors.New("upload exceeds max file size of the provider")
+	ErrUploadInProgress      = errors.New("file is being uploaded by another address")
+	ErrInsufficientCapacity  = errors.New("provider has no capacity left for the upload")
+	ErrRateLimited           = errors.New("too many requests to the provider, try again later")
+	ErrGrantRejected         = errors.New("grant rejected by the provider") // Forged, expired, used already or not covering the request
+	ErrArchiveRejected       = errors.New("archive rejected by the provider")
+	ErrPaymentMismatch       = errors.New("payment doesn't match the price of the provider")
+	ErrInvalidSignature      = errors.New("signature rejected by the provider")
+
+	ErrRenewalPaymentNotFound = errors.New("renewal payment not found")
+	ErrRenewalAlreadyUsed     = errors.New("renewal payment has been used already")
 )
 
 var (
@@ -43,12 +60,74 @@ func Challenge(urlPath string) (resp *http.Response, err error) {
 	return
 }
 
-func Input(urlPath, fileHash, token, signature string, reader io.Reader, durationDays int) (resp *http.Response, err error) {
+func Input(urlPath, fileHash, token, signature string, reader io.ReadSeeker, durationDays int) (resp *http.Response, err error) {
 	return InputWithContext(urlPath, fileHash, token, signature, reader, nil, 0, nil, durationDays)
 }
 
-func InputWithContext(urlPath, fileHash, token, signature string, reader io.Reader, ctx context.Context,
+// InputWithContext uploads the reader through a resumable upload session.
+// If the SPP already holds a part of the file from a previous attempt, the upload continues at the committed offset.
+// Chunks failing due to connection issues are retried from the last acknowledged offset.
+func InputWithContext(urlPath, fileHash, token, signature string, reader io.ReadSeeker, ctx context.Context,
 	filesize int64, transferProgressCallback func(float32), durationDays int) (resp *http.Response, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	log.Printf("About to upload file to spp: fileHash %v | fileSize: %v | duration in days: %v | upload url path: %s",
+		fileHash, filesize, durationDays, urlPath)
+
+	sess, err := CreateUpload(ctx, urlPath, fileHash, token, signature, durationDays, filesize, "")
+	if err != nil {
+		return nil, err
+	}
+	return upload(ctx, urlPath, fileHash, sess, reader, filesize, transferProgressCallback)
+}
+
+// Like InputWithContext, authorized by the encoded write grant instead of a sign in.
+// The grant is used up by creating the upload session, an upload starting over needs a new one.
+// feeTx is the XES transfer paying the replacement fee if the SPP stores the file already, empty otherwise.
+func InputWithGrant(ctx context.Context, urlPath, fileHash, encodedGrant string, reader io.ReadSeeker, filesize int64,
+	transferProgressCallback func(float32), durationDays int, feeTx string) (resp *http.Response, err error) {
+	sess, err := CreateUploadWithGrant(ctx, urlPath, fileHash, encodedGrant, durationDays, filesize, feeTx)
+	if err != nil {
+		return nil, err
+	}
+	return upload(ctx, urlPath, fileHash, sess, reader, filesize, transferProgressCallback)
+}
+
+// Pushes the archive of a file to a peer provider, signed in with the key of the pushing provider.
+// The peer resumes a previous attempt and only accepts the archive if it matches digest, the hex encoded SHA-256.
+// Nothing is uploaded if the peer already stores the archive.
+func Replicate(ctx context.Context, urlPath, fileHash, token, signature, digest string, reader io.ReadSeeker,
+	filesize int64, durationDays int) error {
+	urlStr := fmt.Sprintf("%s/replicate/%s/%s/%s", urlPath, fileHash, token, signature)
+	req, err := http.NewRequest(http.MethodPost, urlStr, nil)
+	if err != nil {
+		return err
+	}
+	q := req.URL.Query()
+	q.Add("duration", strconv.Itoa(durationDays))
+	q.Add("size", strconv.FormatInt(filesize, 10))
+	q.Add("digest", digest)
+	req.URL.RawQuery = q.Encode()
+	sess, err := doUploadSessionRequest(ctx, req)
+	if err != nil {
+		return err
+	}
+	if sess.ID == "" {
+		log.Printf("[SPP Client] %s already stores file %s", urlPath, fileHash)
+		return nil
+	}
+	_, err = upload(ctx, urlPath, fileHash, sess, reader, filesize, nil)
+	return err
+}
+
+// Uploads reader from the committed offset of the session on and finalizes it
+func upload(ctx context.Context, urlPath, fileHash string, sess *models.UploadSession, reader io.ReadSeeker, filesize int64,
+	transferProgressCallback func(float32)) (resp *http.Response, err error) {
+	if sess.Offset > 0 {
+		log.Printf("Resuming upload %s of file %s at offset %d", sess.ID, fileHash, sess.Offset)
+	}
+
 	// Wrap the reader into a ProgressReader in order to be able to read percentage of upload
 	progressReader := &ProgressReader{
 		Reader:     reader,
@@ -56,36 +135,327 @@ func InputWithContext(urlPath, fileHash, token, signature string, reader io.Read
 		Delay:      200 * time.Millisecond,
 		UpdateFunc: transferProgressCallback,
 	}
-	var req *http.Request
-	url := fmt.Sprintf("%s/%s/%s/%s", urlPath, fileHash, token, signature)
-	req, err = http.NewRequest("POST", url, progressReader)
+	offset := sess.Offset
+	retries := 0
+	for filesize == 0 || offset < filesize {
+		if _, err = reader.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		progressReader.totalRead = offset
+
+		var committed int64
+		committed, err = uploadChunk(ctx, urlPath, sess, offset, io.LimitReader(progressReader, UploadChunkSize))
+		if err == nil {
+			if committed == offset {
+				break // nothing left to read
+			}
+			offset = committed
+			retries = 0
+			continue
+		}
+		if sppErr, ok := err.(*Error); ok && !sppErr.Retryable() {
+			return nil, err
+		}
+		if ctx.Err() != nil || err == ErrUploadSessionNotFound || err == ErrUploadTooLarge || err == ErrArchiveRejected || retries >= maxChunkRetries {
+			return nil, err
+		}
+		retries++
+		log.Printf("Upload of chunk at offset %d failed (%s), retrying from last acknowledged offset", offset, err)
+		time.Sleep(time.Duration(retries) * time.Second)
+		if offset, err = UploadOffset(ctx, urlPath, sess.ID, sess.Token); err != nil {
+			return nil, err
+		}
+	}
+
+	return FinalizeUpload(ctx, urlPath, sess.ID, sess.Token)
+}
+
+const (
+	// Size of the chunks an archive is uploaded in
+	UploadChunkSize = 4 * 1024 * 1024
+	maxChunkRetries = 3
+)
+
+// Creates an upload session or resumes the existing one on the SPP.
+// Replacing a stored file is paid with the XES transfer feeTx, see models.StorageProviderInfo.ReplacementPriceBreakdown.
+func CreateUpload(ctx context.Context, urlPath, fileHash, token, signature string, durationDays int, filesize int64, feeTx string) (*models.UploadSession, error) {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/upload/%s/%s/%s", urlPath, fileHash, token, signature), nil)
+	if err != nil {
+		return nil, err
+	}
+	return createUpload(ctx, req, durationDays, filesize, feeTx)
+}
+
+// Like CreateUpload, authorized by the encoded write grant instead of a sign in, see lib/grant
+func CreateUploadWithGrant(ctx context.Context, urlPath, fileHash, encodedGrant string, durationDays int, filesize int64, feeTx string) (*models.UploadSession, error) {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/grant/%s/upload", urlPath, fileHash), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(grant.Header, encodedGrant)
+	return createUpload(ctx, req, durationDays, filesize, feeTx)
+}
+
+func createUpload(ctx context.Context, req *http.Request, durationDays int, filesize int64, feeTx string) (*models.UploadSession, error) {
 	q := req.URL.Query()
 	q.Add("duration", strconv.Itoa(durationDays))
+	if filesize > 0 {
+		q.Add("size", strconv.FormatInt(filesize, 10))
+	}
+	if feeTx != "" {
+		q.Add("feeTx", feeTx)
+	}
 	req.URL.RawQuery = q.Encode()
+	return doUploadSessionRequest(ctx, req)
+}
+
+// Returns the committed offset of the upload session, uploadToken is the token returned when it was created
+func UploadOffset(ctx context.Context, urlPath, uploadID, uploadToken string) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/upload/%s", urlPath, uploadID), nil)
 	if err != nil {
-		return
+		return 0, err
 	}
-	if ctx != nil {
-		req = req.WithContext(ctx)
+	req.Header.Set(models.UploadTokenHeader, uploadToken)
+	sess, err := doUploadSessionRequest(ctx, req)
+	if err != nil {
+		return 0, err
 	}
-	client := &http.Client{}
-
-	log.Printf("About to upload file to spp: fileHash %v | fileSize: %v | duration in days: %v | upload url path: %s",
-		fileHash, filesize, durationDays, urlPath)
+	return sess.Offset, nil
+}
 
-	resp, err = client.Do(req)
-	if resp == nil && err == nil {
-		err = os.ErrInvalid
+// Validates and stores the uploaded file on the SPP
+func FinalizeUpload(ctx context.Context, urlPath, uploadID, uploadToken string) (resp *http.Response, err error) {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/upload/%s/finalize", urlPath, uploadID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(models.UploadTokenHeader, uploadToken)
+	resp, err = (&http.Client{}).Do(req.WithContext(ctx))
+	if err != nil {
 		return
 	}
-	if err == nil && resp != nil && resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusPaymentRequired {
-			err = ErrFilePaymentNotFound
-		} else {
-			err = os.ErrInvalid
+	defer resp.Body.Close()
+	err = readError(resp, uploadStatusError)
+	return
+}
+
+func uploadChunk(ctx context.Context, urlPath string, sess *models.UploadSession, offset int64, chunk io.Reader) (int64, error) {
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/upload/%s", urlPath, sess.ID), chunk)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set(models.UploadOffsetHeader, strconv.FormatInt(offset, 10))
+	req.Header.Set(models.UploadTokenHeader, sess.Token)
+	committed, err := doUploadSessionRequest(ctx, req)
+	if err == ErrUploadOffsetMismatch {
+		// The SPP committed a different offset than we expected, continue from there
+		return committed.Offset, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return committed.Offset, nil
+}
+
+func doUploadSessionRequest(ctx context.Context, req *http.Request) (*models.UploadSession, error) {
+	resp, err := (&http.Client{}).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return nil, err
+	}
+	sess := &models.UploadSession{}
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusConflict {
+		if err = json.Unmarshal(body, sess); err != nil && resp.StatusCode == http.StatusOK {
+			return nil, err
 		}
 	}
-	return
+	if resp.StatusCode == http.StatusConflict && sess.ID != "" {
+		return sess, ErrUploadOffsetMismatch
+	}
+	return sess, responseError(resp.StatusCode, body, uploadStatusError)
+}
+
+// Largest response body read, session and error responses are a lot smaller
+const maxResponseBody = 1 << 20
+
+// A failed request answered with an error body by the SPP, see models.Error.
+// Errors with a matching sentinel, like ErrFilePaymentNotFound, unwrap to it.
+type Error struct {
+	StatusCode int
+	Response   models.Error
+}
+
+func (me *Error) Error() string {
+	msg := "spp: " + me.Response.Code
+	if me.Response.Message != "" {
+		msg += ": " + me.Response.Message
+	}
+	return msg
+}
+
+func (me *Error) Unwrap() error {
+	return codeErrors[me.Response.Code]
+}
+
+// Returns true if repeating the request may succeed, after RetryAfter
+func (me *Error) Retryable() bool {
+	return me.Response.Retry == models.RetryLater
+}
+
+// Returns true if the request only succeeds once the file is paid with the price of the SPP
+func (me *Error) NeedsPayment() bool {
+	return me.Response.Retry == models.RetryPayment
+}
+
+// Time the SPP asks to wait before the request is repeated, 0 if it doesn't say
+func (me *Error) RetryAfter() time.Duration {
+	return time.Duration(me.Response.RetryAfter) * time.Second
+}
+
+var codeErrors = map[string]error{
+	models.CodeInvalidSignature:       ErrInvalidSignature,
+	models.CodeInvalidGrant:           ErrGrantRejected,
+	models.CodeGrantExpired:           ErrGrantRejected,
+	models.CodeGrantUsed:              ErrGrantRejected,
+	models.CodeNoPermission:           ErrForbidden,
+	models.CodeRateLimited:            ErrRateLimited,
+	models.CodeTooManyUploads:         ErrRateLimited,
+	models.CodeFileNotFound:           ErrFileNotFound,
+	models.CodeFileNotReady:           ErrFileNotReady,
+	models.CodeFileRemoved:            ErrFileRemoved,
+	models.CodeNotSatisfiable:         ErrNotSatisfiable,
+	models.CodePaymentNotFound:        ErrFilePaymentNotFound,
+	models.CodePaymentMismatch:        ErrPaymentMismatch,
+	models.CodeRenewalPaymentNotFound: ErrRenewalPaymentNotFound,
+	models.CodeRenewalAlreadyUsed:     ErrRenewalAlreadyUsed,
+	models.CodeUploadTooLarge:         ErrUploadTooLarge,
+	models.CodeUploadNotFound:         ErrUploadSessionNotFound,
+	models.CodeUploadIncomplete:       ErrUploadIncomplete,
+	models.CodeUploadInProgress:       ErrUploadInProgress,
+	models.CodeInsufficientCapacity:   ErrInsufficientCapacity,
+	models.CodeArchiveRejected:        ErrArchiveRejected,
+}
+
+// Returns the error of the failed response resp, see responseError
+func readError(resp *http.Response, fallback func(statusCode int) error) error {
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	return responseError(resp.StatusCode, body, fallback)
+}
+
+// Returns an *Error if body is the error body of the SPP, SPPs answering with the status code only get the error of fallback
+func responseError(statusCode int, body []byte, fallback func(statusCode int) error) error {
+	e := &Error{StatusCode: statusCode}
+	if json.Unmarshal(body, &e.Response) == nil && e.Response.Version > 0 && e.Response.Code != "" {
+		return e
+	}
+	return fallback(statusCode)
+}
+
+func uploadStatusError(statusCode int) error {
+	switch statusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusPaymentRequired:
+		return ErrFilePaymentNotFound
+	case http.StatusNotFound:
+		return ErrUploadSessionNotFound
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusRequestEntityTooLarge:
+		return ErrUploadTooLarge
+	case http.StatusConflict:
+		return ErrUploadIncomplete
+	case http.StatusInsufficientStorage:
+		return ErrInsufficientCapacity
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusUnauthorized:
+		return ErrGrantRejected
+	case http.StatusUnprocessableEntity:
+		return ErrArchiveRejected
+	}
+	return os.ErrInvalid
+}
+
+// Extends the storage duration of the file by durationDays, paid with the XES transfer txHash.
+// Returns the new expiry as unix time.
+func Renew(ctx context.Context, urlPath, fileHash, token, signature, txHash string, durationDays int) (int64, error) {
+	urlStr := fmt.Sprintf("%s/renew/%s/%s/%s", urlPath, fileHash, token, signature)
+	req, err := http.NewRequest(http.MethodPost, urlStr, nil)
+	if err != nil {
+		return 0, err
+	}
+	q := req.URL.Query()
+	q.Add("duration", strconv.Itoa(durationDays))
+	q.Add("tx", txHash)
+	req.URL.RawQuery = q.Encode()
+	resp, err := (&http.Client{}).Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, readError(resp, renewalStatusError)
+	}
+	renewal := models.Renewal{}
+	err = json.NewDecoder(resp.Body).Decode(&renewal)
+	return renewal.Expiry, err
+}
+
+func renewalStatusError(statusCode int) error {
+	switch statusCode {
+	case http.StatusPaymentRequired:
+		return ErrRenewalPaymentNotFound
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrFileNotFound
+	case http.StatusConflict:
+		return ErrRenewalAlreadyUsed
+	}
+	return os.ErrInvalid
+}
+
+// Challenges the SPP to prove it holds the archive of fileHash with the chunks at the byte offsets
+func StorageProof(ctx context.Context, urlPath, fileHash, token, signature string, offsets []int64) (*models.StorageProof, error) {
+	urlStr := fmt.Sprintf("%s/proof/%s/%s/%s", urlPath, fileHash, token, signature)
+	req, err := http.NewRequest(http.MethodGet, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	q := req.URL.Query()
+	for _, offset := range offsets {
+		q.Add(models.ProofOffsetParam, strconv.FormatInt(offset, 10))
+	}
+	req.URL.RawQuery = q.Encode()
+	resp, err := (&http.Client{}).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp, proofStatusError)
+	}
+	proof := &models.StorageProof{}
+	err = json.NewDecoder(resp.Body).Decode(proof)
+	return proof, err
+}
+
+func proofStatusError(statusCode int) error {
+	switch statusCode {
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrFileNotFound
+	}
+	return os.ErrInvalid
 }
 
 type PercentageCallback func(float32)
@@ -95,13 +465,87 @@ func Output(urlPath, fileHash, token, signature string, force bool, writer io.Wr
 }
 
 func OutputWithContext(urlPath, fileHash, token, signature string, force bool, writer io.Writer, ctx context.Context, transferProgressCallback func(float32)) (resp *http.Response, err error) {
+	req, err := outputRequest(urlPath, fileHash, token, signature, force)
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err = output(req, fileHash, writer, 0, "", ctx, transferProgressCallback, nil)
+	return
+}
+
+// Target of a resumable download, usually an *os.File
+type ResumableWriter interface {
+	io.Writer
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// OutputRangeWithContext continues a download into writer, which already holds offset bytes of the archive identified by etag.
+// If the SPP serves a different archive, for example after the file has been re-encrypted, writer is truncated and the
+// whole archive is downloaded.
+// etagCallback is called with the ETag of the served archive before any data is written, so callers can persist it along
+// with the partial download.
+func OutputRangeWithContext(urlPath, fileHash, token, signature string, writer ResumableWriter, offset int64, etag string,
+	ctx context.Context, transferProgressCallback func(float32), etagCallback func(etag string) error) (resp *http.Response, err error) {
+	req, err := outputRequest(urlPath, fileHash, token, signature, false)
+	if err != nil {
+		return nil, err
+	}
+	return outputRange(req, fileHash, writer, offset, etag, ctx, transferProgressCallback, etagCallback)
+}
+
+// Like OutputRangeWithContext, authorized by the encoded read grant instead of a sign in, see lib/grant
+func OutputRangeWithGrant(urlPath, fileHash, encodedGrant string, writer ResumableWriter, offset int64, etag string,
+	ctx context.Context, transferProgressCallback func(float32), etagCallback func(etag string) error) (resp *http.Response, err error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/grant/%s", urlPath, fileHash), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(grant.Header, encodedGrant)
+	return outputRange(req, fileHash, writer, offset, etag, ctx, transferProgressCallback, etagCallback)
+}
+
+func outputRange(req *http.Request, fileHash string, writer ResumableWriter, offset int64, etag string,
+	ctx context.Context, transferProgressCallback func(float32), etagCallback func(etag string) error) (resp *http.Response, err error) {
+	if etag == "" {
+		offset = 0
+	}
+	var resumed bool
+	resp, resumed, err = output(req, fileHash, writer, offset, etag, ctx, transferProgressCallback,
+		func(resumed bool, etag string) error {
+			if etagCallback != nil {
+				if err := etagCallback(etag); err != nil {
+					return err
+				}
+			}
+			if !resumed {
+				offset = 0
+				if err := writer.Truncate(0); err != nil {
+					return err
+				}
+			}
+			_, err := writer.Seek(offset, io.SeekStart)
+			return err
+		})
+	if err == nil && resumed {
+		log.Printf("[SPP Client] resumed download of %s at offset %d", fileHash, offset)
+	}
+	return
+}
+
+func outputRequest(urlPath, fileHash, token, signature string, force bool) (*http.Request, error) {
 	urlStr := fmt.Sprintf("%s/%s/%s/%s", urlPath, fileHash, token, signature)
 	if force {
 		urlStr += "?force"
 	}
-	req, err := http.NewRequest("GET", urlStr, nil)
-	if err != nil {
-		return nil, err
+	return http.NewRequest("GET", urlStr, nil)
+}
+
+func output(req *http.Request, fileHash string, writer io.Writer, offset int64, etag string,
+	ctx context.Context, transferProgressCallback func(float32), beforeWrite func(resumed bool, etag string) error) (resp *http.Response, resumed bool, err error) {
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", etag)
 	}
 	if ctx != nil {
 		req = req.WithContext(ctx)
@@ -111,36 +555,35 @@ func OutputWithContext(urlPath, fileHash, token, signature string, force bool, w
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		// readError would take the 202 of a file which isn't ready yet for success
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+		err = responseError(resp.StatusCode, body, func(int) error {
+			return outputStatusError(resp, fileHash)
+		})
+		return
+	}
 	headers := resp.Header
 	contentLength, err := strconv.Atoi(headers.Get("Content-Length"))
 	if err != nil {
-		return resp, errors.New("can't get 'Content-Length' from headers " + err.Error())
+		return resp, false, errors.New("can't get 'Content-Length' from headers " + err.Error())
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		switch resp.StatusCode {
-		case http.StatusAccepted:
-			err = ErrFileNotReady
-		case http.StatusNotFound:
-			err = ErrFileNotFound
-		case http.StatusForbidden:
-			err = ErrForbidden // No permissions or file removed
-		case http.StatusRequestedRangeNotSatisfiable:
-			err = ErrNotSatisfiable
-		case http.StatusGone:
-			err = ErrFileRemoved
+	resumed = resp.StatusCode == http.StatusPartialContent
+	if !resumed {
+		offset = 0
+	}
+	if beforeWrite != nil {
+		if err = beforeWrite(resumed, headers.Get("ETag")); err != nil {
 			return
-		default:
-			log.Println("[SPP Client] Unhandled error " + resp.Status + ". Can't download file " + fileHash)
-			err = errors.New(resp.Status)
 		}
-		return
 	}
 	progressReader := &ProgressReader{
 		Reader:     resp.Body,
-		Size:       int64(contentLength),
+		Size:       offset + int64(contentLength),
 		UpdateFunc: transferProgressCallback,
 		Delay:      200 * time.Millisecond,
+		totalRead:  offset,
 	}
 
 	if writer != nil {
@@ -149,6 +592,41 @@ func OutputWithContext(urlPath, fileHash, token, signature string, force bool, w
 	return
 }
 
+// Returns the error of a failed download from an SPP answering with the status code only
+func outputStatusError(resp *http.Response, fileHash string) error {
+	switch resp.StatusCode {
+	case http.StatusAccepted:
+		return ErrFileNotReady
+	case http.StatusNotFound:
+		return ErrFileNotFound
+	case http.StatusForbidden:
+		return ErrForbidden // No permissions or file removed
+	case http.StatusUnauthorized:
+		return ErrGrantRejected
+	case http.StatusRequestedRangeNotSatisfiable:
+		return ErrNotSatisfiable
+	case http.StatusGone:
+		return ErrFileRemoved
+	}
+	log.Println("[SPP Client] Unhandled error " + resp.Status + ". Can't download file " + fileHash)
+	return errors.New(resp.Status)
+}
+
+// Returns the domain and provider address grants for the SPP at urlPath have to be signed for
+func GrantInfo(urlPath string) (models.GrantInfo, error) {
+	info := models.GrantInfo{}
+	resp, err := http.Get(urlPath + "/grant")
+	if err != nil {
+		return info, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return info, errors.New("call to /grant failed")
+	}
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	return info, err
+}
+
 // Makes a request to /info and returns the info
 func ProviderInfo(urlPath string) (models.StorageProviderInfo, error) {
 	spi := models.StorageProviderInfo{}
@@ -0,0 +1,191 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/spp/client/models"
+)
+
+// Minimal in-memory SPP upload protocol. The first chunk is cut off halfway to simulate a dropped connection.
+type fakeUploadSpp struct {
+	sync.Mutex
+	data      bytes.Buffer
+	puts      int
+	finalized bool
+}
+
+func (me *fakeUploadSpp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	me.Lock()
+	defer me.Unlock()
+	respond := func(status int) {
+		w.Header().Set(models.UploadOffsetHeader, strconv.Itoa(me.data.Len()))
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(models.UploadSession{ID: "abc", Token: "secret", Offset: int64(me.data.Len())})
+	}
+	if r.Method != http.MethodPost || strings.HasSuffix(r.URL.Path, "/finalize") {
+		if r.Header.Get(models.UploadTokenHeader) != "secret" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/finalize"):
+		me.finalized = true
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPost || r.Method == http.MethodGet:
+		respond(http.StatusOK)
+	case r.Method == http.MethodPut:
+		offset, _ := strconv.Atoi(r.Header.Get(models.UploadOffsetHeader))
+		if offset != me.data.Len() {
+			respond(http.StatusConflict)
+			return
+		}
+		me.puts++
+		if me.puts == 1 {
+			io.CopyN(&me.data, r.Body, UploadChunkSize/2)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		io.Copy(&me.data, r.Body)
+		respond(http.StatusOK)
+	}
+}
+
+func TestInputWithContext_ResumesFromCommittedOffset(t *testing.T) {
+	spp := &fakeUploadSpp{}
+	server := httptest.NewServer(spp)
+	defer server.Close()
+
+	archive := make([]byte, UploadChunkSize*2+100)
+	for i := range archive {
+		archive[i] = byte(i)
+	}
+	_, err := InputWithContext(server.URL, "0x01", "token", "sig", bytes.NewReader(archive), nil, int64(len(archive)), nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, spp.finalized)
+	assert.Equal(t, len(archive), spp.data.Len())
+	assert.True(t, bytes.Equal(archive, spp.data.Bytes()), "uploaded data differs")
+}
+
+func TestInputWithContext_PaymentNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/finalize") {
+			w.WriteHeader(http.StatusPaymentRequired)
+			return
+		}
+		ioutil.ReadAll(r.Body)
+		json.NewEncoder(w).Encode(models.UploadSession{ID: "abc", Offset: 3})
+	}))
+	defer server.Close()
+
+	_, err := InputWithContext(server.URL, "0x01", "token", "sig", bytes.NewReader([]byte{1, 2, 3}), nil, 3, nil, 10)
+	assert.Equal(t, ErrFilePaymentNotFound, err)
+}
+
+func TestInputWithContext_ErrorBody(t *testing.T) {
+	var puts int
+	rejectChunks := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/finalize"):
+			w.WriteHeader(http.StatusPaymentRequired)
+			json.NewEncoder(w).Encode(models.Error{Version: models.ErrorVersion, Code: models.CodePaymentMismatch,
+				Message: "payment mismatch", Retry: models.RetryPayment})
+		case r.Method == http.MethodPut && rejectChunks:
+			puts++
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(models.Error{Version: models.ErrorVersion, Code: models.CodeArchiveRejected,
+				Retry: models.RetryNever, ArchiveRejection: &models.ArchiveRejection{Reason: "not_encrypted", Entry: "meta"}})
+		default:
+			json.NewEncoder(w).Encode(models.UploadSession{ID: "abc", Offset: 3})
+		}
+	}))
+	defer server.Close()
+
+	_, err := InputWithContext(server.URL, "0x01", "token", "sig", bytes.NewReader([]byte{1, 2, 3}), nil, 3, nil, 10)
+	assert.True(t, errors.Is(err, ErrPaymentMismatch))
+	if sppErr, ok := err.(*Error); assert.True(t, ok) {
+		assert.Equal(t, http.StatusPaymentRequired, sppErr.StatusCode)
+		assert.True(t, sppErr.NeedsPayment())
+		assert.False(t, sppErr.Retryable())
+	}
+
+	// a rejected archive isn't uploaded again
+	rejectChunks = true
+	_, err = InputWithContext(server.URL, "0x01", "token", "sig", bytes.NewReader([]byte{1, 2, 3, 4}), nil, 4, nil, 10)
+	assert.True(t, errors.Is(err, ErrArchiveRejected))
+	if sppErr, ok := err.(*Error); assert.True(t, ok) {
+		assert.Equal(t, "meta", sppErr.Response.Entry)
+	}
+	assert.Equal(t, 1, puts)
+}
+
+func TestOutputRangeWithContext(t *testing.T) {
+	archive := []byte("0123456789abcdefghij")
+	etag := `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "archive", time.Time{}, bytes.NewReader(archive))
+	}))
+	defer server.Close()
+
+	partial, err := ioutil.TempFile("", "partial-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(partial.Name())
+	defer partial.Close()
+
+	// resume with the matching ETag only fetches the rest
+	partial.Write(archive[:8])
+	var servedETag string
+	resp, err := OutputRangeWithContext(server.URL, "0x01", "token", "sig", partial, 8, `"v1"`, nil, nil, func(e string) error {
+		servedETag = e
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, `"v1"`, servedETag)
+	assertFileContent(t, partial.Name(), archive)
+
+	// a replaced archive invalidates the partial download
+	archive = []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	etag = `"v2"`
+	partial.Truncate(0)
+	partial.Seek(0, io.SeekStart)
+	partial.Write([]byte("0123456789"))
+	resp, err = OutputRangeWithContext(server.URL, "0x01", "token", "sig", partial, 10, `"v1"`, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assertFileContent(t, partial.Name(), archive)
+}
+
+func assertFileContent(t *testing.T, path string, expected []byte) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(expected), string(content))
+}
@@ -0,0 +1,57 @@
+package models
+
+// Version of the error body, increased on incompatible changes
+const ErrorVersion = 1
+
+// Retry hints, what the client should do about an error
+const (
+	RetryNever   = "never"   // The request fails the same way again
+	RetryLater   = "later"   // The request may succeed later, after RetryAfter seconds if set
+	RetryPayment = "payment" // The request succeeds once the file is paid with the price of the SPP
+)
+
+// Stable error codes of the SPP
+const (
+	CodeInvalidRequest         = "invalid_request"
+	CodeInvalidSignature       = "invalid_signature"
+	CodeInvalidGrant           = "invalid_grant"
+	CodeGrantExpired           = "grant_expired"
+	CodeGrantUsed              = "grant_used"
+	CodeNoPermission           = "no_permission"
+	CodeNotOperator            = "not_operator"
+	CodeRateLimited            = "rate_limited"
+	CodeTooManyUploads         = "too_many_uploads"
+	CodeFileNotFound           = "file_not_found"
+	CodeFileNotReady           = "file_not_ready"
+	CodeFileRemoved            = "file_removed"
+	CodeNotSatisfiable         = "not_satisfiable"
+	CodePaymentNotFound        = "payment_not_found"
+	CodePaymentMismatch        = "payment_mismatch"
+	CodeRenewalPaymentNotFound = "renewal_payment_not_found"
+	CodeInvalidRenewalPayment  = "invalid_renewal_payment"
+	CodeRenewalAlreadyUsed     = "renewal_already_used"
+	CodeInvalidDuration        = "invalid_duration"
+	CodeSizeMismatch           = "size_mismatch"
+	CodeUploadTooLarge         = "upload_too_large"
+	CodeUploadNotFound         = "upload_not_found"
+	CodeUploadIncomplete       = "upload_incomplete"
+	CodeUploadInProgress       = "upload_in_progress"
+	CodeInsufficientCapacity   = "insufficient_capacity"
+	CodeReadOnly               = "read_only"
+	CodeArchiveRejected        = "archive_rejected"
+	CodeInvalidReplica         = "invalid_replica"
+	CodeInvalidProofChallenge  = "invalid_proof_challenge"
+	CodeUnavailable            = "unavailable"
+	CodeInternal               = "internal_error"
+)
+
+// Body of the error responses of the SPP
+type Error struct {
+	Version    int    `json:"version"`
+	Code       string `json:"error"`
+	Message    string `json:"message"`
+	Retry      string `json:"retry"`
+	RetryAfter int    `json:"retryAfter,omitempty"` // Seconds
+
+	*ArchiveRejection // Set for archive_rejected
+}
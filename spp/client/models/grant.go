@@ -0,0 +1,9 @@
+package models
+
+import "github.com/ProxeusApp/storage-app/lib/grant"
+
+// Returned by the SPP, grants for it have to be signed for Domain and name Provider
+type GrantInfo struct {
+	Domain   grant.Domain `json:"domain"`
+	Provider string       `json:"provider"`
+}
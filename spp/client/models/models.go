@@ -11,25 +11,38 @@ type StorageProviderInfo struct {
 	Address string `json:"address,omitempty"`
 	URL     string `json:"url,omitempty"`
 	Online  bool   `json:"isOnline,omitempty"`
-
-	Name                  string `json:"name,omitempty"`
-	Description           string `json:"description,omitempty"`
-	LogoURL               string `json:"logoUrl,omitempty"`
-	JurisdictionCountry   string `json:"jurisdictionCountry,omitempty"`
-	DataCenter            string `json:"dataCenter,omitempty"`
-	MaxFileSizeByte       int64  `json:"maxFileSizeByte,omitempty"`
-	MaxStorageDays        int    `json:"maxStorageDays,omitempty"`
-	GraceSeconds          int    `json:"graceSeconds,omitempty"` // How long is the file kept after expiration
-	TermsAndConditionsURL string `json:"termsAndConditionsUrl,omitempty"`
-	PrivacyPolicyURL      string `json:"privacyPolicyUrl,omitempty"`
-	PriceByte             string `json:"priceByte,omitempty"` // XES per byte
-	PriceDay              string `json:"priceDay,omitempty"`  // XES per day
+	Full    bool   `json:"isFull,omitempty"`
+
+	Name                  string             `json:"name,omitempty"`
+	Description           string             `json:"description,omitempty"`
+	LogoURL               string             `json:"logoUrl,omitempty"`
+	JurisdictionCountry   string             `json:"jurisdictionCountry,omitempty"`
+	DataCenter            string             `json:"dataCenter,omitempty"`
+	MaxFileSizeByte       int64              `json:"maxFileSizeByte,omitempty"`
+	MaxStorageDays        int                `json:"maxStorageDays,omitempty"`
+	GraceSeconds          int                `json:"graceSeconds,omitempty"` // How long is the file kept after expiration
+	TermsAndConditionsURL string             `json:"termsAndConditionsUrl,omitempty"`
+	PrivacyPolicyURL      string             `json:"privacyPolicyUrl,omitempty"`
+	PriceByte             string             `json:"priceByte,omitempty"`         // XES per byte
+	PriceDay              string             `json:"priceDay,omitempty"`          // XES per day
+	SizeTiers             []SizeTier         `json:"sizeTiers,omitempty"`         // Cheaper prices per byte above a size
+	DurationDiscounts     []DurationDiscount `json:"durationDiscounts,omitempty"` // Discounts on the duration price for long retention
+	MinimumCharge         string             `json:"minimumCharge,omitempty"`     // XES charged at least per file
+	ReplacementFee        string             `json:"replacementFee,omitempty"`    // XES for replacing the archive of a stored file, e.g. when re-encrypting
+	CapacityByte          int64              `json:"capacityByte,omitempty"`      // Total capacity, 0 if unlimited
+	LowWaterMarkByte      int64              `json:"lowWaterMarkByte,omitempty"`  // Capacity kept free, uploads are refused below it
+	FreeCapacityByte      *int64             `json:"freeCapacityByte,omitempty"`  // Capacity still accepting uploads, nil if unlimited
 }
 
 func (me *StorageProviderInfo) MaxFileSizeMB() float32 {
 	return float32(me.MaxFileSizeByte) / 1024 / 1024
 }
 
+// Returns whether the provider has capacity left for sizeByte more
+func (me *StorageProviderInfo) HasCapacityFor(sizeByte int64) bool {
+	return me.FreeCapacityByte == nil || (*me.FreeCapacityByte > 0 && *me.FreeCapacityByte >= sizeByte)
+}
+
 func (me *StorageProviderInfo) priceXesWei(priceString string) (*big.Int, error) {
 	xes, err := me.parseStringToXES(priceString) // Ignore parsing
 	if err != nil {
@@ -51,36 +64,41 @@ func (me *StorageProviderInfo) PriceDayXESWei() (*big.Int, error) {
 	return me.priceXesWei(me.PriceDay)
 }
 
+// Returns the price of storing a new file, see PriceBreakdown for how it is composed
 func (me *StorageProviderInfo) TotalPriceForFile(duration int, fileSizeByte *big.Int) (*big.Int, error) {
-	totalPriceSize, err := me.PriceForSizeInXesWei(fileSizeByte)
+	breakdown, err := me.PriceBreakdown(duration, fileSizeByte)
 	if err != nil {
-		return totalPriceSize, err
-	}
-	totalPriceDuration, err := me.PriceForDurationInXesWei(duration)
-	if err != nil {
-		return totalPriceDuration, err
+		return nil, err
 	}
-
-	return new(big.Int).Add(totalPriceSize, totalPriceDuration), nil
+	return breakdown.Total, nil
 }
 
+// Returns the duration price after the duration discount
 func (me *StorageProviderInfo) PriceForDurationInXesWei(duration int) (*big.Int, error) {
 	pricePerDay, err := me.PriceDayXESWei()
 	if err != nil {
 		return pricePerDay, err
 	}
 
-	return new(big.Int).Mul(big.NewInt(int64(duration)), pricePerDay), nil
+	priceDuration := new(big.Int).Mul(big.NewInt(int64(duration)), pricePerDay)
+	discount, err := me.durationDiscountInXesWei(duration, priceDuration)
+	if err != nil {
+		return nil, err
+	}
+	return priceDuration.Sub(priceDuration, discount), nil
 }
 
+// Returns the size price, bytes above the size tiers are charged with the tier's price
 func (me *StorageProviderInfo) PriceForSizeInXesWei(fileSizeByte *big.Int) (*big.Int, error) {
 	priceByteXesWei, err := me.PriceByteXESWei()
 	if err != nil {
 		log.Println("storage price error on getting fileSizeByte: ", err)
 		return priceByteXesWei, err
 	}
-	totalPriceByte := new(big.Int).Mul(fileSizeByte, priceByteXesWei)
-	return totalPriceByte, nil
+	if len(me.SizeTiers) == 0 {
+		return new(big.Int).Mul(fileSizeByte, priceByteXesWei), nil
+	}
+	return me.tieredSizePriceInXesWei(fileSizeByte, priceByteXesWei)
 }
 
 var ErrParseXesString = errors.New("error parsing xes string")
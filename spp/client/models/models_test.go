@@ -42,3 +42,72 @@ func TestStorageProviderInfo_PriceByteXESWei(t *testing.T) {
 		t.Errorf("Wei conversion wrong. Expected %d, got %d", expected, priceWei)
 	}
 }
+
+func TestStorageProviderInfo_PriceBreakdown(t *testing.T) {
+	xesWei := func(xes int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(xes), big.NewInt(1000000000000000000))
+	}
+
+	// flat settings keep size * priceByte + days * priceDay
+	flat := StorageProviderInfo{PriceByte: "1", PriceDay: "2"}
+	total, err := flat.TotalPriceForFile(10, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.Cmp(xesWei(120)) != 0 {
+		t.Errorf("flat price wrong. Expected %d, got %d", xesWei(120), total)
+	}
+
+	spi := StorageProviderInfo{
+		PriceByte:         "1",
+		PriceDay:          "2",
+		SizeTiers:         []SizeTier{{FromByte: 100, PriceByte: "0.5"}},
+		DurationDiscounts: []DurationDiscount{{FromDays: 10, Discount: "0.1"}, {FromDays: 100, Discount: "0.5"}},
+		MinimumCharge:     "50",
+		ReplacementFee:    "3",
+	}
+	if err = spi.ValidatePricing(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 100 bytes * 1 + 100 bytes * 0.5, 10 days * 2 - 10%
+	b, err := spi.PriceBreakdown(10, big.NewInt(200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string][2]*big.Int{
+		"size":             {b.Size, xesWei(150)},
+		"duration":         {b.Duration, xesWei(18)},
+		"durationDiscount": {b.DurationDiscount, xesWei(2)},
+		"minimumCharge":    {b.MinimumCharge, xesWei(0)},
+		"replacementFee":   {b.ReplacementFee, xesWei(0)},
+		"total":            {b.Total, xesWei(168)},
+	} {
+		if c[0].Cmp(c[1]) != 0 {
+			t.Errorf("%s wrong. Expected %d, got %d", name, c[1], c[0])
+		}
+	}
+
+	// replacing a stored archive is charged the fee only
+	b, err = spi.ReplacementPriceBreakdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Total.Cmp(xesWei(3)) != 0 || b.ReplacementFee.Cmp(xesWei(3)) != 0 {
+		t.Errorf("replacement price wrong. Expected %d, got %d", xesWei(3), b.Total)
+	}
+
+	// small files are charged the minimum
+	total, err = spi.TotalPriceForFile(1, big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.Cmp(xesWei(50)) != 0 {
+		t.Errorf("minimum charge wrong. Expected %d, got %d", xesWei(50), total)
+	}
+
+	spi.SizeTiers = []SizeTier{{FromByte: 100, PriceByte: "0.5"}, {FromByte: 100, PriceByte: "0.2"}}
+	if spi.ValidatePricing() != ErrInvalidSizeTiers {
+		t.Error("unordered size tiers should be invalid")
+	}
+}
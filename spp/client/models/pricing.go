@@ -0,0 +1,221 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+/**
+The price of a file is composed of:
+- the size price: every byte is charged with PriceByte, bytes above a size tier with the price of that tier
+- the duration price: days * PriceDay, reduced by the discount of the longest duration discount reached
+- a top-up to the minimum charge if the sum of both is below it
+
+Renewals of stored files are charged the duration price only. Uploading a stored file again, like when it is
+re-encrypted for a new share, is charged the replacement fee only.
+Settings only having PriceByte and PriceDay are charged size * PriceByte + days * PriceDay as before.
+*/
+type (
+	SizeTier struct {
+		FromByte  int64  `json:"fromByte"`  // Bytes above FromByte are charged with PriceByte
+		PriceByte string `json:"priceByte"` // XES per byte
+	}
+
+	DurationDiscount struct {
+		FromDays int    `json:"fromDays"` // Applies to files stored at least FromDays
+		Discount string `json:"discount"` // Fraction of the duration price, e.g. "0.1" for 10%
+	}
+
+	// All amounts in XESWei
+	PriceBreakdown struct {
+		Size             *big.Int // After the size tiers
+		Duration         *big.Int // After the duration discount
+		DurationDiscount *big.Int // Already subtracted from Duration
+		MinimumCharge    *big.Int // Added to reach the minimum charge
+		ReplacementFee   *big.Int
+		Total            *big.Int
+	}
+)
+
+var (
+	ErrInvalidSizeTiers         = errors.New("size tiers need ascending fromByte above 0")
+	ErrInvalidDurationDiscounts = errors.New("duration discounts need ascending fromDays above 0 and a discount between 0 and 1")
+)
+
+// Returns the price of a file and how it is composed
+func (me *StorageProviderInfo) PriceBreakdown(duration int, fileSizeByte *big.Int) (PriceBreakdown, error) {
+	b := PriceBreakdown{
+		DurationDiscount: new(big.Int),
+		MinimumCharge:    new(big.Int),
+		ReplacementFee:   new(big.Int),
+	}
+	var err error
+	if b.Size, err = me.PriceForSizeInXesWei(fileSizeByte); err != nil {
+		return b, err
+	}
+	pricePerDay, err := me.PriceDayXESWei()
+	if err != nil {
+		return b, err
+	}
+	b.Duration = new(big.Int).Mul(big.NewInt(int64(duration)), pricePerDay)
+	if b.DurationDiscount, err = me.durationDiscountInXesWei(duration, b.Duration); err != nil {
+		return b, err
+	}
+	b.Duration.Sub(b.Duration, b.DurationDiscount)
+
+	b.Total = new(big.Int).Add(b.Size, b.Duration)
+	minimum, err := me.optionalXesWei(me.MinimumCharge)
+	if err != nil {
+		return b, err
+	}
+	if b.Total.Cmp(minimum) < 0 {
+		b.MinimumCharge.Sub(minimum, b.Total)
+		b.Total.Set(minimum)
+	}
+	return b, nil
+}
+
+// Returns the price of keeping a stored file duration days longer. Only the duration is charged,
+// the size price was paid with the upload and the minimum charge doesn't apply.
+func (me *StorageProviderInfo) RenewalPriceBreakdown(duration int) (PriceBreakdown, error) {
+	b := PriceBreakdown{
+		Size:           new(big.Int),
+		MinimumCharge:  new(big.Int),
+		ReplacementFee: new(big.Int),
+	}
+	pricePerDay, err := me.PriceDayXESWei()
+	if err != nil {
+		return b, err
+	}
+	b.Duration = new(big.Int).Mul(big.NewInt(int64(duration)), pricePerDay)
+	if b.DurationDiscount, err = me.durationDiscountInXesWei(duration, b.Duration); err != nil {
+		return b, err
+	}
+	b.Duration.Sub(b.Duration, b.DurationDiscount)
+	b.Total = new(big.Int).Set(b.Duration)
+	return b, nil
+}
+
+// Returns the price of replacing the archive of a stored file, e.g. when it is re-encrypted.
+// Only the replacement fee is charged, size and duration were paid with the upload.
+func (me *StorageProviderInfo) ReplacementPriceBreakdown() (PriceBreakdown, error) {
+	b := PriceBreakdown{
+		Size:             new(big.Int),
+		Duration:         new(big.Int),
+		DurationDiscount: new(big.Int),
+		MinimumCharge:    new(big.Int),
+	}
+	var err error
+	if b.ReplacementFee, err = me.optionalXesWei(me.ReplacementFee); err != nil {
+		return b, err
+	}
+	b.Total = new(big.Int).Set(b.ReplacementFee)
+	return b, nil
+}
+
+// Checks that all prices convert to XESWei and that tiers and discounts are ordered
+func (me *StorageProviderInfo) ValidatePricing() error {
+	if _, err := me.PriceByteXESWei(); err != nil {
+		return fmt.Errorf("priceByte %q: %s", me.PriceByte, err)
+	}
+	if _, err := me.PriceDayXESWei(); err != nil {
+		return fmt.Errorf("priceDay %q: %s", me.PriceDay, err)
+	}
+	var lastByte int64
+	for _, tier := range me.SizeTiers {
+		if tier.FromByte <= lastByte {
+			return ErrInvalidSizeTiers
+		}
+		lastByte = tier.FromByte
+		if _, err := me.priceXesWei(tier.PriceByte); err != nil {
+			return fmt.Errorf("size tier priceByte %q: %s", tier.PriceByte, err)
+		}
+	}
+	lastDays := 0
+	for _, d := range me.DurationDiscounts {
+		discount, ok := new(big.Rat).SetString(d.Discount)
+		if d.FromDays <= lastDays || !ok || discount.Sign() < 0 || discount.Cmp(big.NewRat(1, 1)) > 0 {
+			return ErrInvalidDurationDiscounts
+		}
+		lastDays = d.FromDays
+	}
+	if _, err := me.optionalXesWei(me.MinimumCharge); err != nil {
+		return fmt.Errorf("minimumCharge %q: %s", me.MinimumCharge, err)
+	}
+	if _, err := me.optionalXesWei(me.ReplacementFee); err != nil {
+		return fmt.Errorf("replacementFee %q: %s", me.ReplacementFee, err)
+	}
+	return nil
+}
+
+func (me *StorageProviderInfo) tieredSizePriceInXesWei(fileSizeByte, basePrice *big.Int) (*big.Int, error) {
+	tiers := make([]SizeTier, len(me.SizeTiers))
+	copy(tiers, me.SizeTiers)
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].FromByte < tiers[j].FromByte })
+
+	total := new(big.Int)
+	from := new(big.Int)
+	price := basePrice
+	for _, tier := range tiers {
+		tierFrom := big.NewInt(tier.FromByte)
+		if fileSizeByte.Cmp(tierFrom) <= 0 {
+			break
+		}
+		// Bytes from the previous boundary up to this tier are charged with the previous price
+		total.Add(total, new(big.Int).Mul(new(big.Int).Sub(tierFrom, from), price))
+		tierPrice, err := me.priceXesWei(tier.PriceByte)
+		if err != nil {
+			return nil, err
+		}
+		from, price = tierFrom, tierPrice
+	}
+	return total.Add(total, new(big.Int).Mul(new(big.Int).Sub(fileSizeByte, from), price)), nil
+}
+
+// Returns the discount of the longest duration discount reached, rounded down to whole XESWei
+func (me *StorageProviderInfo) durationDiscountInXesWei(duration int, priceDuration *big.Int) (*big.Int, error) {
+	var best *DurationDiscount
+	for i, d := range me.DurationDiscounts {
+		if duration >= d.FromDays && (best == nil || d.FromDays > best.FromDays) {
+			best = &me.DurationDiscounts[i]
+		}
+	}
+	if best == nil {
+		return new(big.Int), nil
+	}
+	discount, ok := new(big.Rat).SetString(best.Discount)
+	if !ok {
+		return nil, ErrInvalidDurationDiscounts
+	}
+	amount := discount.Mul(discount, new(big.Rat).SetInt(priceDuration))
+	return new(big.Int).Quo(amount.Num(), amount.Denom()), nil
+}
+
+// Empty prices are 0
+func (me *StorageProviderInfo) optionalXesWei(price string) (*big.Int, error) {
+	if price == "" {
+		return new(big.Int), nil
+	}
+	return me.priceXesWei(price)
+}
+
+// Amounts are serialized as strings, they exceed the precision of JSON numbers in javascript
+func (me PriceBreakdown) MarshalJSON() ([]byte, error) {
+	str := func(i *big.Int) string {
+		if i == nil {
+			return "0"
+		}
+		return i.String()
+	}
+	return json.Marshal(map[string]string{
+		"size":             str(me.Size),
+		"duration":         str(me.Duration),
+		"durationDiscount": str(me.DurationDiscount),
+		"minimumCharge":    str(me.MinimumCharge),
+		"replacementFee":   str(me.ReplacementFee),
+		"total":            str(me.Total),
+	})
+}
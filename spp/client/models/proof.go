@@ -0,0 +1,23 @@
+package models
+
+// Query param carrying the byte offsets challenged in a proof-of-storage request, may be repeated
+const ProofOffsetParam = "offset"
+
+type (
+	// Answer of the SPP to a proof-of-storage challenge, see lib/merkle
+	StorageProof struct {
+		FileHash string       `json:"fileHash"`
+		Root     string       `json:"root"` // Hex encoded Merkle root of the stored archive
+		Size     int64        `json:"size"`
+		Chunks   []ChunkProof `json:"chunks"`
+	}
+
+	// The chunk holding a challenged offset with the path from its hash up to the root
+	ChunkProof struct {
+		Offset int64    `json:"offset"` // Challenged offset
+		Index  int      `json:"index"`
+		Data   []byte   `json:"data"`
+		Hash   string   `json:"hash"`
+		Proof  []string `json:"proof"` // Hex encoded sibling hashes from the leaf up to the root
+	}
+)
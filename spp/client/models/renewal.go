@@ -0,0 +1,7 @@
+package models
+
+// Returned by the SPP when the storage duration of a file has been extended
+type Renewal struct {
+	FileHash string `json:"fileHash"`
+	Expiry   int64  `json:"expiry"` // Unix time the file is kept until now
+}
@@ -0,0 +1,21 @@
+package models
+
+// Header carrying the committed offset of a resumable upload, in requests and responses
+const UploadOffsetHeader = "Upload-Offset"
+
+// Header carrying the token of an upload session in the offset, chunk, finalize and abort requests
+const UploadTokenHeader = "Upload-Token"
+
+// Returned by the SPP when an upload session is created or its offset queried
+type UploadSession struct {
+	ID     string `json:"uploadId"`
+	Token  string `json:"uploadToken,omitempty"` // Only returned when the session is created or resumed
+	Offset int64  `json:"offset"`
+}
+
+// Details of an archive_rejected error, Reason is one of the Violation* codes of spp/fs
+type ArchiveRejection struct {
+	Reason string `json:"reason"`
+	Entry  string `json:"entry,omitempty"` // Archive entry violating the policy, if any
+	Detail string `json:"detail,omitempty"`
+}
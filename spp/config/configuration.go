@@ -6,9 +6,12 @@ import (
 	"log"
 	"math/big"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+
+	"github.com/ProxeusApp/storage-app/lib/ratelimit"
 )
 
 // plug pgp-server conf here too, decide how much should be shared across targets, better pkg location
@@ -21,6 +24,7 @@ import (
 */
 type Configuration struct {
 	PGPPublicServiceURL string `mapstructure:"pgpPublicServiceURL"`
+	PGPLogAddress       string `mapstructure:"pgpLogAddress"`
 	EthClientURL        string `mapstructure:"ETHCLIENTURL"`
 	EthWebSocketURL     string `mapstructure:"ETHWEBSOCKETURL"`
 	MainHostedURL       string `mapstructure:"mainHostedURL"`
@@ -28,7 +32,28 @@ type Configuration struct {
 	ServiceAddress string `mapstructure:"a"`
 
 	StorageDir             string `mapstructure:"dir"`
+	BlobStore              string `mapstructure:"blobStore"`
+	S3Endpoint             string `mapstructure:"s3Endpoint"`
+	S3Region               string `mapstructure:"s3Region"`
+	S3Bucket               string `mapstructure:"s3Bucket"`
+	S3Prefix               string `mapstructure:"s3Prefix"`
+	S3AccessKey            string `mapstructure:"S3ACCESSKEY"`
+	S3SecretKey            string `mapstructure:"S3SECRETKEY"`
+	ChallengeStore         string `mapstructure:"challengeStore"`
+	ChallengeTTL           int    `mapstructure:"challengeTTL"`
+	SweepSchedule          string `mapstructure:"sweepSchedule"`
+	SweepBatchSize         int    `mapstructure:"sweepBatchSize"`
+	SweepDryRun            bool   `mapstructure:"sweepDryRun"`
+	EventsStartBlock       uint64 `mapstructure:"eventsStartBlock"`
+	EventsPollInterval     int    `mapstructure:"eventsPollInterval"`
+	EventsConfirmations    int    `mapstructure:"eventsConfirmations"`
+	ArchiveMaxEntries      int    `mapstructure:"archiveMaxEntries"`
+	ArchiveMaxExpanded     int64  `mapstructure:"archiveMaxExpandedBytes"`
+	ArchiveMaxRatio        int    `mapstructure:"archiveMaxRatio"`
+	ArchiveMaxPathDepth    int    `mapstructure:"archiveMaxPathDepth"`
+	ArchiveAllowPlain      bool   `mapstructure:"archiveAllowUnencrypted"`
 	StorageProviderAddress string `mapstructure:"address"`
+	ProviderKey            string `mapstructure:"PROVIDERKEY" json:"-"` // Private key of StorageProviderAddress, replicas are only pushed with it
 	ContractAddress        string `mapstructure:"contract"`
 	XESContractAddress     string `mapstructure:"xesContract"`
 	DevMode                bool   `mapstructure:"devMode"`
@@ -36,6 +61,21 @@ type Configuration struct {
 	AutoTLS                bool   `mapstructure:"autotls"`
 	TestMode               string `mapstructure:"TESTMODE"`
 
+	RateLimitIP           float64 `mapstructure:"rateLimitIP"`
+	RateLimitIPBurst      int     `mapstructure:"rateLimitIPBurst"`
+	RateLimitAddress      float64 `mapstructure:"rateLimitAddress"`
+	RateLimitAddressBurst int     `mapstructure:"rateLimitAddressBurst"`
+	MaxUploadsPerAddress  int     `mapstructure:"maxUploadsPerAddress"`
+	BanAfterFailures      int     `mapstructure:"banAfterFailures"`
+	BanWindow             int     `mapstructure:"banWindow"`
+	BanDuration           int     `mapstructure:"banDuration"`
+	TrustedProxies        string  `mapstructure:"trustedProxies"`
+	GrantMaxValidity      int     `mapstructure:"grantMaxValidity"`
+
+	HealthMaxBlockLag int   `mapstructure:"healthMaxBlockLag"`
+	HealthMinFreeDisk int64 `mapstructure:"healthMinFreeDiskBytes"`
+	HealthMaxSweepAge int   `mapstructure:"healthMaxSweepAge"`
+
 	PprofDebug bool `mapstructure:"pprof"`
 
 	BlockchainNet string `mapstructure:"blockchainNet"`
@@ -43,8 +83,13 @@ type Configuration struct {
 
 var Config Configuration
 
+// Signer of the transparency log of the production PGP service, the default of pgpLogAddress. build/dapp.sh sets it to
+// PGP_LOG_ADDRESS with -ldflags "-X github.com/ProxeusApp/storage-app/spp/config.DefaultPGPLogAddress=0x..."
+var DefaultPGPLogAddress string
+
 func init() {
 	flag.String("pgpPublicServiceURL", "http://localhost:8084", "PGP public service URL")
+	flag.String("pgpLogAddress", DefaultPGPLogAddress, "Address of the key which signs the transparency log of the PGP public service, the first seen one is trusted in dev and test mode only")
 	flag.String("ethClientURL", "https://ropsten.infura.io/v3/YOURAPIKEY", "Ethereum client URL")
 	flag.String("ethWebSocketURL", "wss://ropsten.infura.io/ws/v3/YOURAPIKEY", "Ethereum websocket URL")
 	flag.String("mainHostedURL", "https://dev.proxeus.com", "Main hosted URL")
@@ -52,6 +97,37 @@ func init() {
 	flag.String("a", ":8082", "pddress and port")
 
 	flag.String("dir", "./", "directory") //0x5b3d62ca34bbef5428f660dffe893f084a985754
+	flag.String("blobStore", "local", "Where archives are stored (local or s3)")
+	flag.String("s3Endpoint", "", "S3 compatible endpoint URL, e.g. http://localhost:9000")
+	flag.String("s3Region", "us-east-1", "S3 region")
+	flag.String("s3Bucket", "", "S3 bucket")
+	flag.String("s3Prefix", "", "S3 key prefix")
+	flag.String("challengeStore", "bolt", "Where sign in challenges and used grants are kept (bolt or memory, bolt survives restarts, neither is shared between instances)")
+	flag.Int("challengeTTL", 300, "Seconds a sign in challenge stays valid")
+	flag.String("sweepSchedule", "02:00", "When expired files are removed, daily at a local time (HH:MM) or at an interval (e.g. 6h)")
+	flag.Int("sweepBatchSize", 500, "Max files removed per sweep, 0 for no limit")
+	flag.Bool("sweepDryRun", false, "Only report the expired files a sweep would remove")
+	flag.Uint64("eventsStartBlock", 6000000, "Block the contract events are processed from on the first start")
+	flag.Int("eventsConfirmations", 12, "Blocks a contract event has to be deep before it is acted upon, 0 acts on events right away")
+	flag.Int("eventsPollInterval", 30, "Seconds between polls for contract events, new events on the websocket are fetched right away")
+	flag.Int("archiveMaxEntries", 16, "Max entries of an uploaded archive, 0 for no limit")
+	flag.Int64("archiveMaxExpandedBytes", 4*1024*1024*1024, "Max bytes an uploaded archive expands to, 0 for no limit")
+	flag.Int("archiveMaxRatio", 20, "Max ratio between the expanded and the compressed size of an uploaded archive, 0 for no limit")
+	flag.Int("archiveMaxPathDepth", 1, "Max path depth of the entries of an uploaded archive, 1 allows no directories, 0 for no limit")
+	flag.Bool("archiveAllowUnencrypted", false, "Accept archives with files which aren't PGP encrypted")
+	flag.Float64("rateLimitIP", 10, "Requests per second allowed per remote IP, 0 for no limit")
+	flag.Int("rateLimitIPBurst", 40, "Requests a remote IP may send in a burst")
+	flag.Float64("rateLimitAddress", 2, "Sign ins per second allowed per ethereum address, 0 for no limit")
+	flag.Int("rateLimitAddressBurst", 20, "Sign ins an ethereum address may do in a burst")
+	flag.Int("maxUploadsPerAddress", 4, "Upload sessions an ethereum address may keep open at the same time, 0 for no limit")
+	flag.Int("banAfterFailures", 10, "Failed sign ins or grants within banWindow which ban the remote IP, 0 to never ban")
+	flag.Int("banWindow", 600, "Seconds within which failures count towards a ban")
+	flag.Int("banDuration", 900, "Seconds a remote IP stays banned")
+	flag.String("trustedProxies", "", "Comma separated IPs and CIDRs of reverse proxies whose X-Forwarded-For and X-Real-IP headers name the client")
+	flag.Int("grantMaxValidity", 86400, "Max seconds a signed upload or download grant may be valid for")
+	flag.Int("healthMaxBlockLag", 100, "Confirmed blocks the contract events may lag behind before the SPP isn't ready, 0 for no limit")
+	flag.Int64("healthMinFreeDiskBytes", 1024*1024*1024, "Free disk space of the storage dir below which the SPP isn't ready, 0 for no limit")
+	flag.Int("healthMaxSweepAge", 172800, "Seconds since the last successful expiry sweep after which the sweep check is down, 0 for no limit")
 	flag.String("address", "0x5C9eDfaaC887552D6b521E38dAA3BFf1f645fD36", "The storage providers ethereum address")
 	flag.String("xesContract", "0x84E0b37e8f5B4B86d5d299b0B0e33686405A3919", "XES contract address")
 	flag.String("contract", "0xcbd8084f8c759be749340bd20aaed48ec64860e6", "ProxeusFSContract address")
@@ -63,6 +139,33 @@ func init() {
 	flag.String("blockchainNet", "ropsten", "Blockchain Network (ropsten or mainnet)")
 }
 
+// Returns EventsConfirmations, negative values count as 0
+func (me Configuration) EventsConfirmationDepth() uint64 {
+	if me.EventsConfirmations < 0 {
+		return 0
+	}
+	return uint64(me.EventsConfirmations)
+}
+
+// Returns the rate limits and bans of the public endpoints, ratelimit.ErrInvalidProxy if TrustedProxies is invalid
+func (me Configuration) RateLimits() (ratelimit.Config, error) {
+	proxies, err := ratelimit.ParseTrustedProxies(me.TrustedProxies)
+	if err != nil {
+		return ratelimit.Config{}, err
+	}
+	return ratelimit.Config{
+		IPRate:         me.RateLimitIP,
+		IPBurst:        me.RateLimitIPBurst,
+		AddressRate:    me.RateLimitAddress,
+		AddressBurst:   me.RateLimitAddressBurst,
+		MaxUploads:     me.MaxUploadsPerAddress,
+		BanAfter:       me.BanAfterFailures,
+		BanWindow:      time.Duration(me.BanWindow) * time.Second,
+		BanDuration:    time.Duration(me.BanDuration) * time.Second,
+		TrustedProxies: proxies,
+	}, nil
+}
+
 func (me Configuration) IsTestMode() bool {
 	return strings.ToLower(me.TestMode) == "true"
 }
@@ -89,6 +192,26 @@ func Setup() {
 		return
 	}
 
+	// S3 credentials are only read from the environment or config.json
+	err = viper.BindEnv("S3ACCESSKEY")
+	if err != nil {
+		log.Println("error bind viper key to a 'S3ACCESSKEY' ENV variable")
+		return
+	}
+
+	err = viper.BindEnv("S3SECRETKEY")
+	if err != nil {
+		log.Println("error bind viper key to a 'S3SECRETKEY' ENV variable")
+		return
+	}
+
+	// The provider key is only read from the environment or config.json
+	err = viper.BindEnv("PROVIDERKEY")
+	if err != nil {
+		log.Println("error bind viper key to a 'PROVIDERKEY' ENV variable")
+		return
+	}
+
 	viper.BindPFlags(pflag.CommandLine)
 	viper.SetConfigName("config")
 	viper.SetConfigType("json")
@@ -0,0 +1,132 @@
+package endpoint
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/ProxeusApp/storage-app/spp/fs"
+)
+
+/**
+Admin API for the operator of the SPP. Every request has to be signed by the storage provider's address,
+like any other request with a fresh challenge from GET /challenge.
+*/
+
+type maintenanceMode struct {
+	ReadOnly bool `json:"readOnly"`
+}
+
+// Context key of the operator address set by RequireOperator
+const operatorKey = "operator"
+
+// Rejects requests whose challenge isn't signed by the storage provider
+func RequireOperator(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		addr, err := ProxeusFS.ValidateOperator(c.Param("token"), c.Param("signature"))
+		if err != nil {
+			c.Logger().Error(err)
+			return errorResponse(c, err)
+		}
+		c.Logger().Infof("spp: admin %s %s by %s", c.Request().Method, c.Path(), addr)
+		c.Set(operatorKey, addr)
+		return next(c)
+	}
+}
+
+func AdminFiles(c echo.Context) error {
+	files, err := ProxeusFS.Files()
+	if err != nil {
+		c.Logger().Error(err)
+		return errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, files)
+}
+
+func AdminUsage(c echo.Context) error {
+	usage, err := ProxeusFS.UsageByOwner()
+	if err != nil {
+		c.Logger().Error(err)
+		return errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, usage)
+}
+
+// Removes the expired files, with ?dryRun=true only the files which would be removed are returned.
+// ?batchSize= limits the files removed, all expired files are removed by default.
+func AdminRemoveExpired(c echo.Context) error {
+	dryRun, _ := strconv.ParseBool(c.QueryParam("dryRun"))
+	var batchSize int
+	if s := c.QueryParam("batchSize"); s != "" {
+		var err error
+		if batchSize, err = strconv.Atoi(s); err != nil || batchSize < 0 {
+			return invalidRequest(c, "batchSize has to be a positive number")
+		}
+	}
+	report, err := ProxeusFS.RemoveExpiredFiles(dryRun, batchSize)
+	if err != nil {
+		c.Logger().Error(err)
+		return errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// Returns the schedule of the sweeper and the report of its last sweep
+func AdminSweeper(c echo.Context) error {
+	return c.JSON(http.StatusOK, Sweeper.Status())
+}
+
+// Returns the audit log of removed files, filtered by the fileHash, reason, since and until (unix time) and limit query params
+func AdminDeletions(c echo.Context) error {
+	filter := fs.AuditFilter{FileHash: c.QueryParam("fileHash"), Reason: c.QueryParam("reason")}
+	for param, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if s := c.QueryParam(param); s != "" {
+			unix, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return invalidRequest(c, param+" has to be unix time")
+			}
+			*t = time.Unix(unix, 0)
+		}
+	}
+	if s := c.QueryParam("limit"); s != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(s); err != nil || filter.Limit < 0 {
+			return invalidRequest(c, "limit has to be a positive number")
+		}
+	}
+	entries, err := ProxeusFS.AuditLog().Entries(filter)
+	if err != nil {
+		c.Logger().Error(err)
+		return errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+func AdminDeleteFile(c echo.Context) error {
+	operator, _ := c.Get(operatorKey).(string)
+	err := ProxeusFS.ForceDelete(c.Param("fileHash"), operator)
+	if err != nil {
+		c.Logger().Error(err)
+		return errorResponse(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func AdminMaintenance(c echo.Context) error {
+	return c.JSON(http.StatusOK, maintenanceMode{ReadOnly: ProxeusFS.ReadOnly()})
+}
+
+// Enables or disables the read-only maintenance mode
+func AdminSetMaintenance(c echo.Context) error {
+	mode := maintenanceMode{}
+	if err := c.Bind(&mode); err != nil {
+		return invalidRequest(c, "body has to be {\"readOnly\": bool}")
+	}
+	if err := ProxeusFS.SetReadOnly(mode.ReadOnly); err != nil {
+		c.Logger().Error(err)
+		return errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, maintenanceMode{ReadOnly: ProxeusFS.ReadOnly()})
+}
@@ -0,0 +1,140 @@
+package endpoint
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/ethereum"
+	"github.com/ProxeusApp/storage-app/lib/grant"
+	"github.com/ProxeusApp/storage-app/lib/ratelimit"
+	"github.com/ProxeusApp/storage-app/spp/client/models"
+	"github.com/ProxeusApp/storage-app/spp/fs"
+)
+
+/**
+Failed requests are answered with a models.Error body: a stable code, a message and a hint whether and when the
+request may be repeated. Clients shouldn't rely on the status code alone, several errors share one.
+*/
+
+type apiError struct {
+	status int
+	code   string
+	retry  string
+}
+
+var apiErrors = map[error]apiError{
+	fs.ErrInvalidSignature:          {http.StatusUnauthorized, models.CodeInvalidSignature, models.RetryNever},
+	grant.ErrInvalidGrant:           {http.StatusUnauthorized, models.CodeInvalidGrant, models.RetryNever},
+	grant.ErrGrantScope:             {http.StatusUnauthorized, models.CodeInvalidGrant, models.RetryNever},
+	grant.ErrGrantTooLong:           {http.StatusUnauthorized, models.CodeInvalidGrant, models.RetryNever},
+	grant.ErrGrantExpired:           {http.StatusUnauthorized, models.CodeGrantExpired, models.RetryLater},
+	grant.ErrGrantAlreadyUsed:       {http.StatusUnauthorized, models.CodeGrantUsed, models.RetryLater},
+	fs.ErrNoPermission:              {http.StatusForbidden, models.CodeNoPermission, models.RetryLater}, // Permissions follow the chain, which may lag behind
+	fs.ErrNotOperator:               {http.StatusForbidden, models.CodeNotOperator, models.RetryNever},
+	ratelimit.ErrRateLimited:        {http.StatusTooManyRequests, models.CodeRateLimited, models.RetryLater},
+	ratelimit.ErrTooManyUploads:     {http.StatusTooManyRequests, models.CodeTooManyUploads, models.RetryLater},
+	ethereum.ErrFileNotFound:        {http.StatusNotFound, models.CodeFileNotFound, models.RetryNever},
+	fs.ErrSppFileMetaNotFound:       {http.StatusNotFound, models.CodeFileNotFound, models.RetryNever},
+	fs.ErrFileNotReady:              {http.StatusAccepted, models.CodeFileNotReady, models.RetryLater},
+	fs.ErrFileRemoved:               {http.StatusGone, models.CodeFileRemoved, models.RetryNever},
+	fs.ErrNotSatisfiable:            {http.StatusRequestedRangeNotSatisfiable, models.CodeNotSatisfiable, models.RetryLater},
+	fs.ErrFilePaymentNotFound:       {http.StatusPaymentRequired, models.CodePaymentNotFound, models.RetryLater},
+	fs.ErrPaymentDoesNotMatch:       {http.StatusPaymentRequired, models.CodePaymentMismatch, models.RetryPayment},
+	fs.ErrRenewalPaymentNotFound:    {http.StatusPaymentRequired, models.CodeRenewalPaymentNotFound, models.RetryLater},
+	fs.ErrInvalidRenewalPayment:     {http.StatusBadRequest, models.CodeInvalidRenewalPayment, models.RetryNever},
+	fs.ErrRenewalAlreadyUsed:        {http.StatusConflict, models.CodeRenewalAlreadyUsed, models.RetryNever},
+	fs.ErrInvalidRenewalDuration:    {http.StatusBadRequest, models.CodeInvalidDuration, models.RetryNever},
+	fs.ErrReplacementFeeNotFound:    {http.StatusPaymentRequired, models.CodePaymentNotFound, models.RetryLater},
+	fs.ErrInvalidReplacementFee:     {http.StatusPaymentRequired, models.CodePaymentMismatch, models.RetryPayment},
+	fs.ErrReplacementFeeAlreadyUsed: {http.StatusConflict, models.CodePaymentMismatch, models.RetryPayment},
+	fs.ErrReplacingExistingFileSize: {http.StatusBadRequest, models.CodeSizeMismatch, models.RetryNever},
+	fs.ErrUploadTooLarge:            {http.StatusRequestEntityTooLarge, models.CodeUploadTooLarge, models.RetryNever},
+	fs.ErrUploadSessionNotFound:     {http.StatusNotFound, models.CodeUploadNotFound, models.RetryNever},
+	fs.ErrUploadIncomplete:          {http.StatusConflict, models.CodeUploadIncomplete, models.RetryLater},
+	fs.ErrUploadInProgress:          {http.StatusConflict, models.CodeUploadInProgress, models.RetryLater},
+	fs.ErrInsufficientCapacity:      {http.StatusInsufficientStorage, models.CodeInsufficientCapacity, models.RetryNever},
+	fs.ErrReadOnly:                  {http.StatusServiceUnavailable, models.CodeReadOnly, models.RetryLater},
+	fs.ErrReplicaDigestMismatch:     {http.StatusBadRequest, models.CodeInvalidReplica, models.RetryNever},
+	fs.ErrInvalidReplica:            {http.StatusBadRequest, models.CodeInvalidReplica, models.RetryNever},
+	fs.ErrInvalidProofChallenge:     {http.StatusBadRequest, models.CodeInvalidProofChallenge, models.RetryNever},
+}
+
+// Answers the request failed with err
+func errorResponse(c echo.Context, err error) error {
+	if v, ok := err.(*fs.ArchiveViolation); ok {
+		return c.JSON(http.StatusUnprocessableEntity, models.Error{
+			Version: models.ErrorVersion,
+			Code:    models.CodeArchiveRejected,
+			Message: v.Error(),
+			Retry:   models.RetryNever,
+			ArchiveRejection: &models.ArchiveRejection{
+				Reason: v.Reason,
+				Entry:  v.Entry,
+				Detail: v.Detail,
+			},
+		})
+	}
+	authFailed(c, err)
+	if e, ok := apiErrors[err]; ok {
+		return errorBody(c, e.status, e.code, err.Error(), e.retry, 0)
+	}
+	if os.IsNotExist(err) {
+		return errorBody(c, http.StatusNotFound, models.CodeFileNotFound, "file not found", models.RetryNever, 0)
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return errorBody(c, http.StatusServiceUnavailable, models.CodeUnavailable, "ethereum node unavailable", models.RetryLater, 0)
+	}
+	// Unexpected errors may reveal internals, they are only logged
+	log.Printf("[endpoint][errorResponse] %s %s: %v", c.Request().Method, c.Path(), err)
+	return errorBody(c, http.StatusInternalServerError, models.CodeInternal, http.StatusText(http.StatusInternalServerError), models.RetryLater, 0)
+}
+
+// Answers a request with missing or malformed params
+func invalidRequest(c echo.Context, message string) error {
+	return errorBody(c, http.StatusBadRequest, models.CodeInvalidRequest, message, models.RetryNever, 0)
+}
+
+// Answers requests over the limits of the guard, see ratelimit.Guard.SetResponder
+func RateLimited(c echo.Context, wait time.Duration) error {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+	return errorBody(c, http.StatusTooManyRequests, models.CodeRateLimited, ratelimit.ErrRateLimited.Error(), models.RetryLater, seconds)
+}
+
+func errorBody(c echo.Context, status int, code, message, retry string, retryAfter int) error {
+	return c.JSON(status, models.Error{
+		Version:    models.ErrorVersion,
+		Code:       code,
+		Message:    message,
+		Retry:      retry,
+		RetryAfter: retryAfter,
+	})
+}
+
+// Answers the errors echo handles itself, like unknown routes, with the same body
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	he, ok := err.(*echo.HTTPError)
+	if !ok {
+		_ = errorResponse(c, err)
+		return
+	}
+	code, retry := models.CodeInvalidRequest, models.RetryNever
+	if he.Code >= http.StatusInternalServerError {
+		code, retry = models.CodeInternal, models.RetryLater
+	}
+	if c.Request().Method == http.MethodHead {
+		_ = c.NoContent(he.Code)
+		return
+	}
+	_ = errorBody(c, he.Code, code, fmt.Sprint(he.Message), retry, 0)
+}
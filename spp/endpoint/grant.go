@@ -0,0 +1,46 @@
+package endpoint
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/ProxeusApp/storage-app/lib/grant"
+	"github.com/ProxeusApp/storage-app/spp/client/models"
+)
+
+// Returns the domain and provider address grants for this SPP are signed with
+func GrantInfo(c echo.Context) error {
+	domain := ProxeusFS.GrantDomain()
+	return c.JSON(http.StatusOK, models.GrantInfo{Domain: domain, Provider: ProxeusFS.GrantProvider()})
+}
+
+// Like CreateUpload, authorized by the write grant in the Storage-Grant header
+func CreateUploadWithGrant(c echo.Context) error {
+	duration, size, err := uploadParams(c)
+	if err != nil {
+		return invalidRequest(c, "duration and size have to be numbers")
+	}
+	sess, err := ProxeusFS.CreateUploadSessionWithGrant(c.Param("fileHash"), c.Request().Header.Get(grant.Header), duration, size,
+		c.QueryParam("feeTx"))
+	if err != nil {
+		c.Logger().Error(err)
+		return errorResponse(c, err)
+	}
+	return uploadSessionResponse(c, http.StatusOK, sess.ID, sess.Token, sess.Offset)
+}
+
+// Like PostFile, authorized by the write grant in the Storage-Grant header
+func PostFileWithGrant(c echo.Context) error {
+	return inputFile(c, func(body io.Reader, duration int) error {
+		_, err := ProxeusFS.InputWithGrant(c.Param("fileHash"), c.Request().Header.Get(grant.Header), body, duration)
+		return err
+	})
+}
+
+// Like GetFile, authorized by the read grant in the Storage-Grant header
+func GetFileWithGrant(c echo.Context) error {
+	blob, info, err := ProxeusFS.OutputWithGrant(c.Param("fileHash"), c.Request().Header.Get(grant.Header))
+	return outputFile(c, blob, info, err)
+}
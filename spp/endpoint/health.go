@@ -1,47 +1,142 @@
 package endpoint
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo"
+
+	"github.com/ProxeusApp/storage-app/lib/health"
+	"github.com/ProxeusApp/storage-app/spp/config"
+	"github.com/ProxeusApp/storage-app/spp/fs"
 )
 
 /**
-Health is used to check dependencies' statuses
+Health is used to check dependencies' statuses. The readiness goes down as soon as the SPP can't safely accept uploads:
+a database can't be read, the ethereum node is unreachable, payments lag behind the chain, the disk or the capacity
+is full or the SPP is in maintenance mode. The websocket subscription and the expiry sweep are only reported.
 */
 
-const (
-	up   string = "UP"
-	down string = "DOWN"
-)
+var HealthChecks *health.Checker
 
-type serviceStatus struct {
-	ServiceName string
-	Status      string
-	Info        string
-}
+const healthCheckTimeout = 5 * time.Second
 
 // Checks dependencies' health and returns ServiceStatuses
 func Health(c echo.Context) error {
-	serviceStatuses := []serviceStatus{
-		ethServiceStatus(),
-	}
-	return c.JSON(http.StatusOK, serviceStatuses)
+	return c.JSON(http.StatusOK, HealthChecks.Run().Checks)
 }
 
-// Tests Ethereum connection from this service and returns a serviceStatus
-func ethServiceStatus() serviceStatus {
-	ethStatus := serviceStatus{
-		ServiceName: "ethereum",
-		Status:      down,
-	}
+// Answers 200 as long as the SPP serves requests
+func Live(c echo.Context) error {
+	return HealthChecks.Live(c)
+}
+
+// Answers 503 if the SPP can't safely accept uploads
+func Ready(c echo.Context) error {
+	return HealthChecks.Ready(c)
+}
+
+// Returns the checks of the SPP, chainEvents is the pipeline applying the payments
+func NewHealthChecks(cfg *config.Configuration, chainEvents *fs.ChainEvents) *health.Checker {
+	checks := health.NewChecker(healthCheckTimeout)
+	checks.Add("ethereum", true, ethServiceStatus)
+	checks.Add("fileMetaDB", true, func() (string, error) {
+		return "", ProxeusFS.CheckFileMeta()
+	})
+	checks.Add("paymentDB", true, func() (string, error) {
+		return "", ProxeusFS.CheckPayments()
+	})
+	checks.Add("eventSubscription", false, func() (string, error) {
+		return eventSubscriptionStatus(chainEvents)
+	})
+	checks.Add("eventLag", true, func() (string, error) {
+		return eventLagStatus(chainEvents, uint64(cfg.HealthMaxBlockLag))
+	})
+	checks.Add("disk", true, func() (string, error) {
+		return diskStatus(cfg.StorageDir, cfg.HealthMinFreeDisk)
+	})
+	checks.Add("capacity", true, capacityStatus)
+	checks.Add("maintenance", true, func() (string, error) {
+		if ProxeusFS.ReadOnly() {
+			return "", fs.ErrReadOnly
+		}
+		return "Accepting uploads", nil
+	})
+	checks.Add("expirySweep", false, func() (string, error) {
+		return sweepStatus(time.Duration(cfg.HealthMaxSweepAge) * time.Second)
+	})
+	return checks
+}
+
+// Tests Ethereum connection from this service
+func ethServiceStatus() (string, error) {
 	header, err := EthClient.HeaderByNumber(nil)
 	if err != nil || header == nil {
-		ethStatus.Info = "Not connected"
-	} else {
-		ethStatus.Status = up
-		ethStatus.Info = fmt.Sprintf("Connected. Last block: %d", header.Number)
+		return "Not connected", errors.New("not connected")
+	}
+	return fmt.Sprintf("Connected. Last block: %d", header.Number), nil
+}
+
+// Without the subscription the contract events are still polled
+func eventSubscriptionStatus(chainEvents *fs.ChainEvents) (string, error) {
+	status, _ := chainEvents.Status()
+	if !status.Subscribed {
+		return "Not subscribed, polling eth_getLogs", errors.New("not subscribed")
+	}
+	return "Subscribed", nil
+}
+
+// Payments of blocks which aren't processed yet aren't known, uploads paid in them would be rejected
+func eventLagStatus(chainEvents *fs.ChainEvents, maxLag uint64) (string, error) {
+	status, err := chainEvents.Status()
+	if err != nil {
+		return "", err
+	}
+	info := fmt.Sprintf("Head: %d | processed: %d | lag: %d blocks", status.Head, status.Checkpoint, status.Lag)
+	if !status.LastSync.IsZero() {
+		info += fmt.Sprintf(" | last sync: %s ago", time.Since(status.LastSync).Truncate(time.Second))
+	}
+	if maxLag > 0 && status.Lag > maxLag {
+		return info, fmt.Errorf("events lag more than %d blocks behind", maxLag)
+	}
+	return info, nil
+}
+
+// Uploads are written to the storage dir first, even with an S3 blob store
+func diskStatus(dir string, minFree int64) (string, error) {
+	free, err := health.FreeDiskBytes(dir)
+	if err != nil {
+		return "", err
+	}
+	info := fmt.Sprintf("Free: %d bytes", free)
+	if minFree > 0 && free < uint64(minFree) {
+		return info, fmt.Errorf("less than %d bytes free", minFree)
+	}
+	return info, nil
+}
+
+func capacityStatus() (string, error) {
+	free, limited, err := ProxeusFS.FreeCapacity()
+	if err != nil {
+		return "", err
+	}
+	if !limited {
+		return "Not limited", nil
+	}
+	info := fmt.Sprintf("Free: %d bytes", free)
+	if free <= 0 {
+		return info, fs.ErrInsufficientCapacity
+	}
+	return info, nil
+}
+
+func sweepStatus(maxAge time.Duration) (string, error) {
+	age := Sweeper.SinceSuccess().Truncate(time.Second)
+	info := fmt.Sprintf("Last successful sweep: %s ago", age)
+	if maxAge > 0 && age > maxAge {
+		return info, fmt.Errorf("no successful sweep for more than %s", maxAge)
 	}
-	return ethStatus
+	return info, nil
 }
@@ -1,57 +1,74 @@
 package endpoint
 
 import (
+	"io"
 	"log"
-	"net"
 	"net/http"
 	"os"
 	"strconv"
 
-	"github.com/ProxeusApp/storage-app/spp/client/models"
-
 	"github.com/labstack/echo"
 
 	"github.com/ProxeusApp/storage-app/dapp/core/ethereum"
+	"github.com/ProxeusApp/storage-app/lib/challenge"
 	"github.com/ProxeusApp/storage-app/spp/fs"
+	"github.com/ProxeusApp/storage-app/spp/metrics"
+	"github.com/ProxeusApp/storage-app/spp/service"
 )
 
 var ProxeusFS *fs.ProxeusFS
+var Challenges *challenge.Authenticator
 var EthClient *ethereum.SppClient
-var ServiceProviderInfo models.StorageProviderInfo
+var ProviderInfoService service.ProviderInfoService
+var Sweeper *fs.Sweeper
 
 func GetChallenge(c echo.Context) error {
-	r, err := ProxeusFS.CreateSignInChallenge()
+	r, err := Challenges.CreateSignInChallenge()
 	if err != nil {
 		c.Logger().Error(err)
-		return c.NoContent(http.StatusBadRequest)
+		return errorResponse(c, err)
 	}
 	return c.JSON(http.StatusOK, r)
 }
 
 func PostFile(c echo.Context) error {
-	body := http.MaxBytesReader(c.Response().Writer, c.Request().Body, ServiceProviderInfo.MaxFileSizeByte) // TODO file validation
+	return inputFile(c, func(body io.Reader, duration int) error {
+		_, err := ProxeusFS.Input(
+			c.Param("fileHash"),
+			c.Param("token"),
+			c.Param("signature"),
+			body,
+			duration)
+		return err
+	})
+}
+
+// Stores the archive in the request body with input, which authorizes the upload
+func inputFile(c echo.Context, input func(body io.Reader, duration int) error) error {
+	body := http.MaxBytesReader(c.Response().Writer, c.Request().Body, ProviderInfoService.Get().MaxFileSizeByte) // TODO file validation
 	defer body.Close()
 
 	log.Println("spp: Requesting file upload for: ", c.Param("fileHash"))
 
+	// Refuse uploads which don't fit up front, the capacity is checked again while writing
+	if size := c.Request().ContentLength; size > 0 {
+		if err := ProxeusFS.CheckCapacity(size); err != nil {
+			c.Logger().Error(err)
+			return errorResponse(c, err)
+		}
+	}
+
 	duration, err := strconv.Atoi(c.QueryParam("duration"))
 	if err != nil {
-		return err
+		return invalidRequest(c, "duration has to be a number of days")
 	}
 
-	_, err = ProxeusFS.Input(
-		c.Param("fileHash"),
-		c.Param("token"),
-		c.Param("signature"),
-		body,
-		duration)
+	err = input(body, duration)
 
 	if err != nil {
 		c.Logger().Error(err)
-		if err == ethereum.ErrFilePaymentNotFound {
-			return c.NoContent(http.StatusPaymentRequired)
-		}
-		return c.NoContent(http.StatusBadRequest)
+		countPaymentError(err)
+		return errorResponse(c, err)
 	}
 
 	c.Logger().Info("spp: successfully uploaded file ", c.Param("fileHash"))
@@ -63,37 +80,58 @@ func GetFile(c echo.Context) error {
 	if _, ok := c.QueryParams()["force"]; ok {
 		force = true
 	}
-	p, err := ProxeusFS.Output(
+	blob, info, err := ProxeusFS.Output(
 		c.Param("fileHash"),
 		c.Param("token"),
 		c.Param("signature"),
 		force,
 	)
+	return outputFile(c, blob, info, err)
+}
+
+// Serves the archive returned by ProxeusFS.Output or the error it failed with
+func outputFile(c echo.Context, blob fs.Blob, info fs.BlobInfo, err error) error {
 	if err != nil {
 		c.Logger().Error(err)
-		if err == ethereum.ErrFileNotFound {
-			// The file hasn't been registered
-			return c.NoContent(http.StatusNotFound)
-		} else if os.IsNotExist(err) {
+		if os.IsNotExist(err) {
 			// The file has been registered on the blockchain but the file isn't arrived yet. Try again
-			return c.NoContent(http.StatusAccepted)
-		} else if err == fs.ErrNoPermission {
-			return c.NoContent(http.StatusForbidden)
-		} else if err == fs.ErrNotSatisfiable {
-			return c.String(http.StatusRequestedRangeNotSatisfiable, err.Error())
-		} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			return c.NoContent(http.StatusServiceUnavailable)
-		} else if err == fs.ErrFileRemoved {
-			return c.NoContent(http.StatusGone)
-		} else {
-			return c.NoContent(http.StatusBadRequest)
+			err = fs.ErrFileNotReady
 		}
+		return errorResponse(c, err)
+	}
+	defer blob.Close()
+
+	digest, err := ProxeusFS.ArchiveDigest(c.Param("fileHash"))
+	if err != nil {
+		c.Logger().Error(err)
+		return errorResponse(c, err)
 	}
-	return c.File(p)
+	// http.ServeContent evaluates Range, If-Range and If-None-Match against the ETag
+	c.Response().Header().Set("ETag", `"`+digest+`"`)
+	http.ServeContent(c.Response(), c.Request(), info.Name, info.ModTime, blob)
+	return nil
 }
 
+// Counts the payments which couldn't be verified
+func countPaymentError(err error) {
+	switch err {
+	case fs.ErrPaymentDoesNotMatch:
+		metrics.PaymentErrors.WithLabelValues(metrics.PaymentMismatch).Inc()
+	case fs.ErrFilePaymentNotFound, fs.ErrRenewalPaymentNotFound:
+		metrics.PaymentErrors.WithLabelValues(metrics.PaymentNotFound).Inc()
+	}
+}
+
+// Returns the provider info with the current free capacity
 func Info(c echo.Context) error {
-	return c.JSON(http.StatusOK, ServiceProviderInfo)
+	info := ProviderInfoService.Get()
+	free, limited, err := ProxeusFS.FreeCapacity()
+	if err != nil {
+		c.Logger().Error(err)
+	} else if limited {
+		info.FreeCapacityByte = &free
+	}
+	return c.JSON(http.StatusOK, info)
 }
 
 func Ping(c echo.Context) error {
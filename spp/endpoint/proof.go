@@ -0,0 +1,28 @@
+package endpoint
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/ProxeusApp/storage-app/spp/client/models"
+)
+
+// Answers a proof-of-storage challenge for the byte offsets given in the offset query params
+func GetStorageProof(c echo.Context) error {
+	var offsets []int64
+	for _, o := range c.QueryParams()[models.ProofOffsetParam] {
+		offset, err := strconv.ParseInt(o, 10, 64)
+		if err != nil {
+			return invalidRequest(c, "offsets have to be numbers")
+		}
+		offsets = append(offsets, offset)
+	}
+	proof, err := ProxeusFS.ProveStorage(c.Param("fileHash"), c.Param("token"), c.Param("signature"), offsets)
+	if err != nil {
+		c.Logger().Error(err)
+		return errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, proof)
+}
@@ -0,0 +1,34 @@
+package endpoint
+
+import (
+	"github.com/labstack/echo"
+
+	"github.com/ProxeusApp/storage-app/lib/grant"
+	"github.com/ProxeusApp/storage-app/lib/ratelimit"
+	"github.com/ProxeusApp/storage-app/spp/fs"
+)
+
+// Limits the requests of IPs and addresses, see lib/ratelimit
+var Guard *ratelimit.Guard
+
+// Rejects requests of banned IPs and requests over the limit of their IP, see ratelimit.Guard.Middleware
+func Limit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if Guard == nil {
+			return next(c)
+		}
+		return Guard.Middleware()(next)(c)
+	}
+}
+
+// Counts failed sign ins and grants of the client, repeated failures ban its IP for a while.
+// Denied file permissions don't count, they are answered with retry later as the permissions on the chain may lag behind.
+func authFailed(c echo.Context, err error) {
+	if Guard == nil {
+		return
+	}
+	switch err {
+	case fs.ErrInvalidSignature, fs.ErrNotOperator, grant.ErrInvalidGrant, grant.ErrGrantScope:
+		Guard.AuthFailed(Guard.ClientIP(c))
+	}
+}
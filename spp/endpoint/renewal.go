@@ -0,0 +1,26 @@
+package endpoint
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/ProxeusApp/storage-app/spp/client/models"
+)
+
+// Extends the storage duration of a file, paid with the XES transfer given in the tx query param
+func Renew(c echo.Context) error {
+	duration, err := strconv.Atoi(c.QueryParam("duration"))
+	if err != nil {
+		return invalidRequest(c, "duration has to be a number of days")
+	}
+	expiry, err := ProxeusFS.Renew(c.Param("fileHash"), c.Param("token"), c.Param("signature"), c.QueryParam("tx"), duration)
+	if err != nil {
+		c.Logger().Error(err)
+		countPaymentError(err)
+		return errorResponse(c, err)
+	}
+	c.Logger().Info("spp: renewed file ", c.Param("fileHash"))
+	return c.JSON(http.StatusOK, models.Renewal{FileHash: c.Param("fileHash"), Expiry: expiry.Int64()})
+}
@@ -0,0 +1,34 @@
+package endpoint
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/ProxeusApp/storage-app/spp/fs"
+)
+
+// Creates an upload session for a replica pushed by a peer provider.
+// Responds with 204 if the archive is stored already, the replica is uploaded through the upload endpoints otherwise.
+func CreateReplica(c echo.Context) error {
+	duration, err := strconv.Atoi(c.QueryParam("duration"))
+	if err != nil {
+		return invalidRequest(c, "duration has to be a number of days")
+	}
+	size, err := strconv.ParseInt(c.QueryParam("size"), 10, 64)
+	if err != nil {
+		return invalidRequest(c, "size has to be a number")
+	}
+
+	sess, err := ProxeusFS.CreateReplicaSession(c.Param("fileHash"), c.Param("token"), c.Param("signature"), duration, size,
+		c.QueryParam("digest"))
+	if err == fs.ErrReplicaAlreadyStored {
+		return c.NoContent(http.StatusNoContent)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return errorResponse(c, err)
+	}
+	return uploadSessionResponse(c, http.StatusOK, sess.ID, sess.Token, sess.Offset)
+}
@@ -0,0 +1,98 @@
+package endpoint
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/ProxeusApp/storage-app/spp/client/models"
+	"github.com/ProxeusApp/storage-app/spp/fs"
+)
+
+// Creates a resumable upload session or returns the existing one with its committed offset
+func CreateUpload(c echo.Context) error {
+	duration, size, err := uploadParams(c)
+	if err != nil {
+		return invalidRequest(c, "duration and size have to be numbers")
+	}
+
+	sess, err := ProxeusFS.CreateUploadSession(c.Param("fileHash"), c.Param("token"), c.Param("signature"), duration, size,
+		c.QueryParam("feeTx"))
+	if err != nil {
+		c.Logger().Error(err)
+		return errorResponse(c, err)
+	}
+	return uploadSessionResponse(c, http.StatusOK, sess.ID, sess.Token, sess.Offset)
+}
+
+// Returns the storage duration and the announced size, if any, of a new upload session
+func uploadParams(c echo.Context) (duration int, size int64, err error) {
+	if duration, err = strconv.Atoi(c.QueryParam("duration")); err != nil {
+		return
+	}
+	if s := c.QueryParam("size"); s != "" {
+		size, err = strconv.ParseInt(s, 10, 64)
+	}
+	return
+}
+
+func UploadOffset(c echo.Context) error {
+	sess, err := ProxeusFS.UploadSession(c.Param("uploadId"), uploadToken(c))
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return uploadSessionResponse(c, http.StatusOK, sess.ID, "", sess.Offset)
+}
+
+// Appends the body to the upload at the offset given by the Upload-Offset header
+func UploadChunk(c echo.Context) error {
+	offset, err := strconv.ParseInt(c.Request().Header.Get(models.UploadOffsetHeader), 10, 64)
+	if err != nil {
+		return invalidRequest(c, models.UploadOffsetHeader+" header has to be a number")
+	}
+	body := c.Request().Body
+	defer body.Close()
+
+	id := c.Param("uploadId")
+	committed, err := ProxeusFS.WriteUploadChunk(id, uploadToken(c), offset, body)
+	if err != nil {
+		c.Logger().Error(err)
+		if err == fs.ErrUploadOffsetMismatch {
+			return uploadSessionResponse(c, http.StatusConflict, id, "", committed)
+		}
+		c.Response().Header().Set(models.UploadOffsetHeader, strconv.FormatInt(committed, 10))
+		return errorResponse(c, err)
+	}
+	return uploadSessionResponse(c, http.StatusOK, id, "", committed)
+}
+
+// Validates the uploaded archive and the payment and stores the file
+func FinalizeUpload(c echo.Context) error {
+	written, err := ProxeusFS.FinalizeUpload(c.Param("uploadId"), uploadToken(c))
+	if err != nil {
+		c.Logger().Error(err)
+		countPaymentError(err)
+		return errorResponse(c, err)
+	}
+	c.Logger().Infof("spp: successfully uploaded file with %d bytes", written)
+	return c.NoContent(http.StatusOK)
+}
+
+func DeleteUpload(c echo.Context) error {
+	if err := ProxeusFS.AbortUpload(c.Param("uploadId"), uploadToken(c)); err != nil {
+		return errorResponse(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Returns the token of the upload session the request is sent to, see models.UploadTokenHeader
+func uploadToken(c echo.Context) string {
+	return c.Request().Header.Get(models.UploadTokenHeader)
+}
+
+// token is only returned when the session is created or resumed
+func uploadSessionResponse(c echo.Context, status int, id, token string, offset int64) error {
+	c.Response().Header().Set(models.UploadOffsetHeader, strconv.FormatInt(offset, 10))
+	return c.JSON(status, models.UploadSession{ID: id, Token: token, Offset: offset})
+}
@@ -0,0 +1,176 @@
+package fs
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/util"
+	"github.com/ProxeusApp/storage-app/spp/metrics"
+)
+
+/**
+Operator functions of the admin API. Only the storage provider's own address may use them.
+*/
+type (
+	StoredFile struct {
+		FileHash string `json:"fileHash"`
+		Stored   bool   `json:"stored"` // false if the meta information exists but the archive doesn't
+		Size     int64  `json:"size"`
+		Owner    string `json:"owner"`
+		Expiry   int64  `json:"expiry"`
+		Payment  string `json:"payment"` // In XESWei, empty if unknown
+	}
+
+	OwnerUsage struct {
+		Owner string `json:"owner"`
+		Files int    `json:"files"`
+		Size  int64  `json:"size"`
+	}
+)
+
+// The SPP is in maintenance mode as long as this file exists in the storage dir
+const maintenanceFilename = "maintenance"
+
+var (
+	ErrNotOperator = errors.New("only the storage provider may use the admin api")
+	ErrReadOnly    = errors.New("spp is in read-only maintenance mode")
+)
+
+// Returns the operator address if the challenge was signed by the storage provider
+func (me *ProxeusFS) ValidateOperator(token, signatureHex string) (addr string, err error) {
+	addr, err = me.Validate(token, signatureHex)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(addr, me.spAddress.String()) {
+		log.Printf("[proxeusFS][ValidateOperator] denied admin access to %s", addr)
+		return "", ErrNotOperator
+	}
+	return addr, nil
+}
+
+// Lists the files known to the SPP with their size, owner, expiry and payment
+func (me *ProxeusFS) Files() ([]StoredFile, error) {
+	fileMetas, err := me.fileMetaHandler.All()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]StoredFile, 0, len(fileMetas))
+	for _, fileMeta := range fileMetas {
+		f := StoredFile{
+			FileHash: fileMeta.FileHash.Hex(),
+			Owner:    me.fileOwner(fileMeta).String(),
+		}
+		if fileMeta.Expiry != nil {
+			f.Expiry = fileMeta.Expiry.Int64()
+		}
+		if info, err := me.blobs.Stat(f.FileHash); err == nil {
+			f.Stored = true
+			f.Size = info.Size
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if payment, err := me.FilePayment(fileMeta.FileHash); err == nil {
+			f.Payment = payment.String()
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// Sums up the stored files and bytes by owner, largest first
+func (me *ProxeusFS) UsageByOwner() ([]OwnerUsage, error) {
+	files, err := me.Files()
+	if err != nil {
+		return nil, err
+	}
+	byOwner := map[string]*OwnerUsage{}
+	for _, f := range files {
+		if !f.Stored {
+			continue
+		}
+		u, ok := byOwner[f.Owner]
+		if !ok {
+			u = &OwnerUsage{Owner: f.Owner}
+			byOwner[f.Owner] = u
+		}
+		u.Files++
+		u.Size += f.Size
+	}
+	usage := make([]OwnerUsage, 0, len(byOwner))
+	for _, u := range byOwner {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Size > usage[j].Size })
+	return usage, nil
+}
+
+// Removes the archive and the meta information of a file regardless of its expiry.
+// The removal is recorded in the audit log with the operator's address.
+func (me *ProxeusFS) ForceDelete(docHash, operator string) error {
+	fileHash := util.StrHexToBytes32(docHash)
+	fileMeta, metaErr := me.fileMetaHandler.Get(fileHash)
+	err := me.removeFileFromDisk(common.Hash(fileHash).Hex())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.IsNotExist(err) && metaErr == ErrSppFileMetaNotFound {
+		return err
+	}
+	me.fileMetaHandler.Remove(fileHash)
+	metrics.FilesRemoved.WithLabelValues(metrics.RemovedAdmin).Inc()
+	log.Println("[proxeusFS][ForceDelete] removed file ", docHash)
+
+	entry := AuditEntry{FileHash: common.Hash(fileHash).Hex(), Reason: AuditReasonAdmin, Operator: operator}
+	if metaErr == nil && fileMeta.Expiry != nil {
+		entry.Expiry = fileMeta.Expiry.Int64()
+	}
+	if err = me.audit.Record(entry); err != nil {
+		log.Println("[proxeusFS][ForceDelete] couldn't record removal in the audit log ", err)
+	}
+	return nil
+}
+
+// Rejects new uploads while enabled, downloads keep working. The mode is kept across restarts.
+func (me *ProxeusFS) SetReadOnly(readOnly bool) error {
+	if readOnly {
+		f, err := os.OpenFile(me.maintenancePath(), os.O_WRONLY|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	err := os.Remove(me.maintenancePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (me *ProxeusFS) ReadOnly() bool {
+	_, err := os.Stat(me.maintenancePath())
+	return err == nil
+}
+
+func (me *ProxeusFS) maintenancePath() string {
+	return filepath.Join(me.basePath, maintenanceFilename)
+}
+
+// Returns the saved owner, files saved before the owner was kept are looked up on the smart contract
+func (me *ProxeusFS) fileOwner(fileMeta *sppFileMeta) common.Address {
+	if fileMeta.Owner != (common.Address{}) || me.ethconn == nil {
+		return fileMeta.Owner
+	}
+	fileInfo, err := me.ethconn.FileInfo(fileMeta.FileHash, true)
+	if err != nil {
+		log.Println("[proxeusFS][fileOwner] couldn't get file info: ", err)
+		return fileMeta.Owner
+	}
+	return fileInfo.Ownr
+}
@@ -0,0 +1,67 @@
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/util"
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+func TestAdmin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileMetas := NewFileMetaClientMock(nil)
+	pfs, err := NewProxeusFS(&config.Configuration{StorageDir: dir}, nil, fileMetas, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner := common.HexToAddress("0x5C9eDfaaC887552D6b521E38dAA3BFf1f645fD36")
+	hashes := []string{
+		"0x822ac138637485893a49980082b5dfbb020c14f20017f4ae69c7f350c06fe8c1",
+		"0xcd9afd2b4c1c663b96a19c1405d437ee760ccb6eda35eb7d81ccf2b9faa05ae9",
+	}
+	for i, h := range hashes {
+		fileMetas.Save(FileInfo{Id: util.StrHexToBytes32(h), Ownr: owner})
+		content := bytes.Repeat([]byte{1}, 10*(i+1))
+		if err = pfs.BlobStore().Put(h, bytes.NewReader(content), int64(len(content))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	usage, err := pfs.UsageByOwner()
+	if assert.NoError(t, err) && assert.Len(t, usage, 1) {
+		assert.Equal(t, OwnerUsage{Owner: owner.String(), Files: 2, Size: 30}, usage[0])
+	}
+
+	operator := "0x4E8f2A3fCbC3B4e8D1e5B0e6a6C1f3d2E7b9A0c1"
+	assert.NoError(t, pfs.ForceDelete(hashes[0], operator))
+	assert.True(t, os.IsNotExist(pfs.ForceDelete(hashes[0], operator)))
+	entries, err := pfs.AuditLog().Entries(AuditFilter{Reason: AuditReasonAdmin})
+	if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+		assert.Equal(t, hashes[0], entries[0].FileHash)
+		assert.Equal(t, operator, entries[0].Operator)
+	}
+	files, err := pfs.Files()
+	if assert.NoError(t, err) && assert.Len(t, files, 1) {
+		assert.Equal(t, hashes[1], files[0].FileHash)
+		assert.True(t, files[0].Stored)
+	}
+
+	assert.NoError(t, pfs.SetReadOnly(true))
+	assert.True(t, pfs.ReadOnly())
+	_, err = pfs.CreateUploadSession(hashes[0], "token", "signature", 1, 0, "")
+	assert.Equal(t, ErrReadOnly, err)
+	assert.NoError(t, pfs.SetReadOnly(false))
+	assert.False(t, pfs.ReadOnly())
+}
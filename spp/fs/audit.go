@@ -0,0 +1,116 @@
+package fs
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+The audit log records every file removed by the SPP, one JSON object per line in <StorageDir>/deletion_audit.log.
+Entries are only ever appended, the log is never rewritten by the SPP.
+*/
+type (
+	AuditLog struct {
+		path string
+		lock sync.Mutex
+	}
+
+	AuditEntry struct {
+		Time         time.Time `json:"time"`
+		FileHash     string    `json:"fileHash"`
+		Reason       string    `json:"reason"`
+		Expiry       int64     `json:"expiry,omitempty"`       // Expiry saved by the SPP, 0 if unknown
+		GraceSeconds int64     `json:"graceSeconds,omitempty"` // Grace period the removal was subject to
+		ChainExpiry  int64     `json:"chainExpiry,omitempty"`  // Expiry confirmed with the smart contract before the removal
+		Operator     string    `json:"operator,omitempty"`     // Address removing the file through the admin api
+		TxHash       string    `json:"txHash,omitempty"`       // Transaction deleting the file in the smart contract
+		Block        uint64    `json:"block,omitempty"`
+	}
+
+	// Zero values match every entry
+	AuditFilter struct {
+		FileHash string
+		Reason   string
+		Since    time.Time
+		Until    time.Time
+		Limit    int // Returns the latest Limit entries
+	}
+)
+
+const (
+	AuditReasonExpired         = "expired"
+	AuditReasonContractDeleted = "contract-deleted"
+	AuditReasonAdmin           = "admin"
+
+	auditLogFilename = "deletion_audit.log"
+)
+
+func NewAuditLog(storageDir string) *AuditLog {
+	return &AuditLog{path: filepath.Join(storageDir, auditLogFilename)}
+}
+
+// Appends the entry and syncs it to disk. The time is set if missing.
+func (me *AuditLog) Record(entry AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	bts, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	f, err := os.OpenFile(me.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Write(append(bts, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Returns the entries matching filter, oldest first
+func (me *AuditLog) Entries(filter AuditFilter) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	f, err := os.Open(me.path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries, nil
+}
+
+func (me AuditFilter) matches(entry AuditEntry) bool {
+	return (me.FileHash == "" || strings.EqualFold(me.FileHash, entry.FileHash)) &&
+		(me.Reason == "" || me.Reason == entry.Reason) &&
+		(me.Since.IsZero() || !entry.Time.Before(me.Since)) &&
+		(me.Until.IsZero() || entry.Time.Before(me.Until))
+}
@@ -0,0 +1,153 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+/**
+BlobStore persists the archives of an SPP. Archives are addressed by their file hash.
+Missing blobs are reported with errors satisfying os.IsNotExist.
+*/
+type (
+	BlobStore interface {
+		Put(name string, src io.Reader, size int64) error
+		Get(name string) (Blob, BlobInfo, error)
+		Stat(name string) (BlobInfo, error)
+		Delete(name string) error
+		List() ([]BlobInfo, error)
+	}
+
+	// Blob is a readable and seekable stored archive, seeking allows serving byte ranges
+	Blob interface {
+		io.ReadSeeker
+		io.Closer
+	}
+
+	BlobInfo struct {
+		Name    string
+		Size    int64
+		ModTime time.Time
+	}
+
+	localBlobStore struct {
+		basePath string
+	}
+)
+
+const (
+	BlobStoreLocal = "local"
+	BlobStoreS3    = "s3"
+)
+
+var ErrUnknownBlobStore = errors.New("unknown blob store")
+
+// Returns the blob store configured by cfg.BlobStore, the local storage dir if not set
+func NewBlobStore(cfg *config.Configuration) (BlobStore, error) {
+	switch strings.ToLower(cfg.BlobStore) {
+	case "", BlobStoreLocal:
+		return NewLocalBlobStore(cfg.StorageDir)
+	case BlobStoreS3:
+		return NewS3BlobStore(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			Prefix:    cfg.S3Prefix,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	}
+	return nil, ErrUnknownBlobStore
+}
+
+// Stores blobs as files in a flat directory
+func NewLocalBlobStore(basePath string) (BlobStore, error) {
+	if basePath != "" {
+		if err := os.MkdirAll(basePath, 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &localBlobStore{basePath: basePath}, nil
+}
+
+func (me *localBlobStore) path(name string) string {
+	return filepath.Join(me.basePath, filepath.Base(name))
+}
+
+// Writes to a temporary file first, so a blob is either complete or not there at all
+func (me *localBlobStore) Put(name string, src io.Reader, size int64) error {
+	tmpPath := me.path(name) + downloadingSuffix
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(f, src)
+	if err == nil && size >= 0 && written != size {
+		err = io.ErrUnexpectedEOF
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, me.path(name))
+}
+
+func (me *localBlobStore) Get(name string) (Blob, BlobInfo, error) {
+	f, err := os.Open(me.path(name))
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, BlobInfo{}, err
+	}
+	return f, localBlobInfo(stat), nil
+}
+
+func (me *localBlobStore) Stat(name string) (BlobInfo, error) {
+	stat, err := os.Stat(me.path(name))
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return localBlobInfo(stat), nil
+}
+
+func (me *localBlobStore) Delete(name string) error {
+	return os.Remove(me.path(name))
+}
+
+// Lists the regular files of the directory, temporary files of ongoing writes are left out
+func (me *localBlobStore) List() ([]BlobInfo, error) {
+	dir := me.basePath
+	if dir == "" {
+		dir = "."
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var infos []BlobInfo
+	for _, f := range files {
+		// the storage dir holds the databases and logs of the SPP too, archives are named by their file hash
+		if !f.Mode().IsRegular() || !strings.HasPrefix(f.Name(), "0x") || strings.HasSuffix(f.Name(), downloadingSuffix) {
+			continue
+		}
+		infos = append(infos, localBlobInfo(f))
+	}
+	return infos, nil
+}
+
+func localBlobInfo(stat os.FileInfo) BlobInfo {
+	return BlobInfo{Name: stat.Name(), Size: stat.Size(), ModTime: stat.ModTime()}
+}
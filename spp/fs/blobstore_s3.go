@@ -0,0 +1,335 @@
+package fs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+s3BlobStore keeps the archives in a bucket of an S3 compatible object storage like AWS S3 or MinIO.
+Requests are signed with AWS Signature Version 4 and use path-style addressing (<endpoint>/<bucket>/<key>),
+which is supported by all common S3 compatible services.
+*/
+type (
+	S3Config struct {
+		Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000
+		Region    string
+		Bucket    string
+		Prefix    string // Optional key prefix, allows sharing a bucket
+		AccessKey string
+		SecretKey string
+	}
+
+	s3BlobStore struct {
+		cfg      S3Config
+		endpoint *url.URL
+		client   *http.Client
+	}
+
+	// Reads an object lazily with range requests, so seeking doesn't transfer skipped data
+	s3Blob struct {
+		store  *s3BlobStore
+		name   string
+		size   int64
+		offset int64
+		body   io.ReadCloser
+	}
+
+	s3ListBucketResult struct {
+		Contents []struct {
+			Key          string
+			Size         int64
+			LastModified time.Time
+		}
+		IsTruncated           bool
+		NextContinuationToken string
+	}
+)
+
+const (
+	s3Service         = "s3"
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+)
+
+var ErrS3Config = errors.New("s3 blob store requires endpoint, bucket and credentials")
+
+func NewS3BlobStore(cfg S3Config) (BlobStore, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, ErrS3Config
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	return &s3BlobStore{cfg: cfg, endpoint: endpoint, client: &http.Client{}}, nil
+}
+
+func (me *s3BlobStore) Put(name string, src io.Reader, size int64) error {
+	req, err := me.newRequest(http.MethodPut, me.key(name), nil, src)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := me.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (me *s3BlobStore) Get(name string) (Blob, BlobInfo, error) {
+	info, err := me.Stat(name)
+	if err != nil {
+		return nil, info, err
+	}
+	return &s3Blob{store: me, name: name, size: info.Size}, info, nil
+}
+
+func (me *s3BlobStore) Stat(name string) (BlobInfo, error) {
+	req, err := me.newRequest(http.MethodHead, me.key(name), nil, nil)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	resp, err := me.do(req)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	resp.Body.Close()
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return BlobInfo{Name: name, Size: resp.ContentLength, ModTime: modTime}, nil
+}
+
+func (me *s3BlobStore) Delete(name string) error {
+	// S3 doesn't report missing keys on delete, check first to behave like os.Remove
+	if _, err := me.Stat(name); err != nil {
+		return err
+	}
+	req, err := me.newRequest(http.MethodDelete, me.key(name), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := me.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (me *s3BlobStore) List() ([]BlobInfo, error) {
+	var infos []BlobInfo
+	continuationToken := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if me.cfg.Prefix != "" {
+			query.Set("prefix", me.cfg.Prefix)
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		req, err := me.newRequest(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := me.do(req)
+		if err != nil {
+			return nil, err
+		}
+		result := s3ListBucketResult{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range result.Contents {
+			infos = append(infos, BlobInfo{
+				Name:    strings.TrimPrefix(obj.Key, me.cfg.Prefix),
+				Size:    obj.Size,
+				ModTime: obj.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return infos, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+func (me *s3BlobStore) key(name string) string {
+	return me.cfg.Prefix + name
+}
+
+func (me *s3BlobStore) newRequest(method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := *me.endpoint
+	u.Path = u.Path + "/" + me.cfg.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	if query != nil {
+		u.RawQuery = strings.Replace(query.Encode(), "+", "%20", -1)
+	}
+	return http.NewRequest(method, u.String(), body)
+}
+
+func (me *s3BlobStore) do(req *http.Request) (*http.Response, error) {
+	me.sign(req, time.Now().UTC())
+	resp, err := me.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, os.ErrNotExist
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s %s", req.Method, req.URL.Path, resp.Status, string(msg))
+	}
+	return resp, nil
+}
+
+// Signs the request with AWS Signature Version 4, the payload is left unsigned to allow streaming
+func (me *s3BlobStore) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format(s3TimeFormat)
+	scope := strings.Join([]string{now.Format(s3DateFormat), me.cfg.Region, s3Service, "aws4_request"}, "/")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+
+	headerNames := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Range") != "" {
+		headerNames = append(headerNames, "range")
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for _, h := range headerNames {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+me.cfg.SecretKey), now.Format(s3DateFormat))
+	key = hmacSHA256(key, me.cfg.Region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, me.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3Escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func (me *s3Blob) Read(p []byte) (int, error) {
+	if me.offset >= me.size {
+		return 0, io.EOF
+	}
+	if me.body == nil {
+		req, err := me.store.newRequest(http.MethodGet, me.store.key(me.name), nil, nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(me.offset, 10)+"-")
+		resp, err := me.store.do(req)
+		if err != nil {
+			return 0, err
+		}
+		me.body = resp.Body
+	}
+	n, err := me.body.Read(p)
+	me.offset += int64(n)
+	return n, err
+}
+
+func (me *s3Blob) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = me.offset + offset
+	case io.SeekEnd:
+		abs = me.size + offset
+	default:
+		return 0, os.ErrInvalid
+	}
+	if abs < 0 {
+		return 0, os.ErrInvalid
+	}
+	if abs != me.offset && me.body != nil {
+		me.body.Close()
+		me.body = nil
+	}
+	me.offset = abs
+	return abs, nil
+}
+
+func (me *s3Blob) Close() error {
+	if me.body != nil {
+		return me.body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// In-memory stand-in for an S3 compatible service like MinIO, using path-style addressing
+type fakeS3 struct {
+	sync.Mutex
+	bucket  string
+	objects map[string][]byte
+}
+
+func (me *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	me.Lock()
+	defer me.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), s3Algorithm+" Credential=access/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.HasPrefix(path, me.bucket) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(path, me.bucket), "/")
+	if key == "" && r.Method == http.MethodGet {
+		type content struct {
+			Key          string
+			Size         int64
+			LastModified time.Time
+		}
+		result := struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []content
+		}{}
+		for k, v := range me.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				result.Contents = append(result.Contents, content{Key: k, Size: int64(len(v)), LastModified: time.Now()})
+			}
+		}
+		xml.NewEncoder(w).Encode(result)
+		return
+	}
+	obj, ok := me.objects[key]
+	switch r.Method {
+	case http.MethodPut:
+		me.objects[key], _ = ioutil.ReadAll(r.Body)
+	case http.MethodDelete:
+		delete(me.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet, http.MethodHead:
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, key, time.Now(), bytes.NewReader(obj))
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobstore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewLocalBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStore(t, store)
+}
+
+func TestS3BlobStore(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{bucket: "archives", objects: map[string][]byte{}})
+	defer server.Close()
+
+	store, err := NewS3BlobStore(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "archives",
+		Prefix:    "spp/",
+		AccessKey: "access",
+		SecretKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStore(t, store)
+}
+
+func testBlobStore(t *testing.T, store BlobStore) {
+	name := "0x822ac138637485893a49980082b5dfbb020c14f20017f4ae69c7f350c06fe8c1"
+	content := []byte("-----BEGIN PGP MESSAGE-----")
+
+	_, err := store.Stat(name)
+	assert.True(t, os.IsNotExist(err), "missing blob should be reported as not existing")
+
+	if err = store.Put(name, bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := store.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(len(content)), info.Size)
+
+	blob, _, err := store.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = blob.Seek(11, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := ioutil.ReadAll(blob)
+	blob.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(content[11:]), string(rest))
+
+	infos, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, infos, 1) {
+		assert.Equal(t, name, infos[0].Name)
+	}
+
+	assert.NoError(t, store.Delete(name))
+	assert.True(t, os.IsNotExist(store.Delete(name)), "deleting a missing blob should be reported as not existing")
+}
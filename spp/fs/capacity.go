@@ -0,0 +1,92 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+/**
+Capacity management. The used capacity is the size of all stored archives plus the partial data of ongoing uploads.
+It's computed from the blob store at most once per usageTTL and kept up to date with the uploaded chunks in between.
+*/
+type usage struct {
+	sync.Mutex
+	used    int64
+	updated time.Time
+}
+
+const usageTTL = 10 * time.Minute
+
+var ErrInsufficientCapacity = errors.New("spp has no capacity left for the upload")
+
+// Returns the capacity still accepting uploads, limited is false if no capacity is configured
+func (me *ProxeusFS) FreeCapacity() (free int64, limited bool, err error) {
+	info := me.providerInfoService.Get()
+	if info.CapacityByte <= 0 {
+		return 0, false, nil
+	}
+	used, err := me.UsedCapacity()
+	if err != nil {
+		return 0, true, err
+	}
+	free = info.CapacityByte - info.LowWaterMarkByte - used
+	if free < 0 {
+		free = 0
+	}
+	return free, true, nil
+}
+
+// Returns ErrInsufficientCapacity if sizeByte more can't be stored. A size of 0 checks if any capacity is left.
+func (me *ProxeusFS) CheckCapacity(sizeByte int64) error {
+	free, limited, err := me.FreeCapacity()
+	if err != nil || !limited {
+		return err
+	}
+	if free <= 0 || free < sizeByte {
+		return ErrInsufficientCapacity
+	}
+	return nil
+}
+
+// Returns the bytes used by stored archives and ongoing uploads
+func (me *ProxeusFS) UsedCapacity() (int64, error) {
+	me.usage.Lock()
+	defer me.usage.Unlock()
+	if !me.usage.updated.IsZero() && time.Since(me.usage.updated) < usageTTL {
+		return me.usage.used, nil
+	}
+	blobs, err := me.blobs.List()
+	if err != nil {
+		return 0, err
+	}
+	var used int64
+	for _, b := range blobs {
+		used += b.Size
+	}
+	sessions, err := me.allUploadSessions()
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	for _, sess := range sessions {
+		used += sess.Offset
+	}
+	me.usage.used = used
+	me.usage.updated = time.Now()
+	return used, nil
+}
+
+// Accounts for written bytes until the usage is computed again
+func (me *ProxeusFS) addUsedCapacity(n int64) {
+	me.usage.Lock()
+	me.usage.used += n
+	me.usage.Unlock()
+}
+
+// Lets the next capacity check compute the usage from the blob store, after archives were stored or removed
+func (me *ProxeusFS) resetUsedCapacity() {
+	me.usage.Lock()
+	me.usage.updated = time.Time{}
+	me.usage.Unlock()
+}
@@ -0,0 +1,70 @@
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/spp/client/models"
+	"github.com/ProxeusApp/storage-app/spp/config"
+	"github.com/ProxeusApp/storage-app/spp/service"
+)
+
+type providerInfoStub models.StorageProviderInfo
+
+func (me providerInfoStub) Get() models.StorageProviderInfo {
+	return models.StorageProviderInfo(me)
+}
+
+func (me providerInfoStub) PriceScheduleAt(t time.Time) (service.PriceSchedule, bool) {
+	return service.PriceSchedule{}, false
+}
+
+func TestCapacity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capacity-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	info := providerInfoStub{MaxFileSizeByte: 1000, CapacityByte: 100, LowWaterMarkByte: 10}
+	pfs, err := NewProxeusFS(&config.Configuration{StorageDir: dir}, nil, NewFileMetaClientMock(nil), info, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := bytes.Repeat([]byte{1}, 50)
+	if err = pfs.BlobStore().Put("0x01", bytes.NewReader(stored), int64(len(stored))); err != nil {
+		t.Fatal(err)
+	}
+	free, limited, err := pfs.FreeCapacity()
+	assert.NoError(t, err)
+	assert.True(t, limited)
+	assert.Equal(t, int64(40), free)
+	assert.NoError(t, pfs.CheckCapacity(40))
+	assert.Equal(t, ErrInsufficientCapacity, pfs.CheckCapacity(41))
+
+	// chunks are cut off at the free capacity
+	sess := &UploadSession{ID: "capacity", FileHash: "0x02", CreatedAt: time.Now()}
+	if err = os.MkdirAll(pfs.uploadsPath(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(pfs.uploadPartPath(sess.ID), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = pfs.putUploadSession(sess); err != nil {
+		t.Fatal(err)
+	}
+	committed, err := pfs.WriteUploadChunk(sess.ID, sess.Token, 0, bytes.NewReader(bytes.Repeat([]byte{1}, 60)))
+	assert.Equal(t, ErrInsufficientCapacity, err)
+	assert.Equal(t, int64(40), committed)
+	assert.Equal(t, ErrInsufficientCapacity, pfs.CheckCapacity(0))
+
+	// aborting the upload frees its capacity again
+	assert.NoError(t, pfs.AbortUpload(sess.ID, sess.Token))
+	assert.NoError(t, pfs.CheckCapacity(40))
+}
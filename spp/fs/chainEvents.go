@@ -0,0 +1,425 @@
+package fs
+
+import (
+	"errors"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/ethglue"
+	"github.com/ProxeusApp/storage-app/spp/eth"
+	"github.com/ProxeusApp/storage-app/spp/metrics"
+)
+
+/**
+The chain event pipeline applies the Deleted, PaymentReceived and UpdatedEvent logs of the ProxeusFS contract:
+a deleted file is removed with its meta information, a payment to this provider is saved for the upload it pays for
+and the meta information of an updated file is refreshed from the smart contract.
+
+Logs are always fetched with eth_getLogs from the block after the checkpoint, in order, and only once their block is
+confirmations blocks deep, so logs dropped by a reorg aren't applied. The websocket subscription only tracks new logs
+until they are confirmed and then triggers a fetch, without it the pipeline polls every pollInterval. A log reported
+as removed after it was applied is rolled back as far as possible. A log which can't be applied stops the pipeline at
+its block until the next try, so no log is skipped.
+The state is kept in the event store, see eventStore.go. Side effects outside of it, like removing a blob,
+are idempotent, so a log applied again after a crash changes nothing.
+*/
+type (
+	ChainLogSource interface {
+		LatestBlock() (uint64, error)
+		HeaderByNumber(number *big.Int) (*types.Header, error)
+		FilterLogs(query ethereum.FilterQuery) ([]types.Log, error)
+		// Fails if websockets are unavailable
+		SubscribeLogs(query ethereum.FilterQuery, logs chan<- types.Log) (ethereum.Subscription, error)
+	}
+
+	ChainEvents struct {
+		pfs           *ProxeusFS
+		source        ChainLogSource
+		startBlock    uint64
+		confirmations *ethglue.Confirmations
+		pollInterval  time.Duration
+		contract      *bind.BoundContract
+		topics        map[common.Hash]string
+		lock          sync.Mutex
+		stop          chan bool
+		stopped       chan bool
+
+		stateLock  sync.Mutex // lock is held for a whole sync, the state can be read meanwhile
+		subscribed bool
+		lastSync   time.Time
+	}
+
+	// State of the pipeline, reported by the health checks
+	ChainEventsStatus struct {
+		Subscribed bool      // The websocket subscription is up, otherwise logs are only polled
+		Head       uint64    // Latest block of the node
+		Checkpoint uint64    // Last block processed completely
+		Lag        uint64    // Confirmed blocks after the checkpoint which aren't processed yet
+		LastSync   time.Time // End of the last sync which processed every confirmed block
+	}
+)
+
+const (
+	eventDeleted         = "Deleted"
+	eventPaymentReceived = "PaymentReceived"
+	eventUpdated         = "UpdatedEvent"
+
+	eventsBlockChunk = 2000
+)
+
+var ErrFilePaymentNotFound = errors.New("file payment not found")
+
+// Logs are processed from startBlock on if there is no checkpoint yet, once they are confirmations blocks deep
+func NewChainEvents(pfs *ProxeusFS, source ChainLogSource, startBlock, confirmations uint64, pollInterval time.Duration) (*ChainEvents, error) {
+	contractABI, err := abi.JSON(strings.NewReader(eth.ProxeusFSContractABI))
+	if err != nil {
+		return nil, err
+	}
+	me := &ChainEvents{
+		pfs:           pfs,
+		source:        source,
+		startBlock:    startBlock,
+		confirmations: ethglue.NewConfirmations(confirmations),
+		pollInterval:  pollInterval,
+		contract:      bind.NewBoundContract(pfs.contractAddress, contractABI, nil, nil, nil),
+		topics:        map[common.Hash]string{},
+	}
+	for _, name := range []string{eventDeleted, eventPaymentReceived, eventUpdated} {
+		me.topics[contractABI.Events[name].ID()] = name
+	}
+	return me, nil
+}
+
+func (me *ChainEvents) Start() {
+	me.stop = make(chan bool)
+	me.stopped = make(chan bool)
+	go me.run()
+}
+
+func (me *ChainEvents) Stop() {
+	if me.stop == nil {
+		return
+	}
+	close(me.stop)
+	<-me.stopped
+}
+
+func (me *ChainEvents) run() {
+	defer close(me.stopped)
+	ticker := time.NewTicker(me.pollInterval)
+	defer ticker.Stop()
+
+	var sub ethereum.Subscription
+	subscribed := true
+	logs := make(chan types.Log, 200)
+	defer func() {
+		if sub != nil {
+			sub.Unsubscribe()
+		}
+	}()
+
+	syncNow := true
+	for {
+		if sub == nil {
+			var err error
+			sub, err = me.source.SubscribeLogs(me.query(nil, nil), logs)
+			if err != nil && subscribed {
+				log.Println("[ChainEvents][run] websocket subscription failed, polling eth_getLogs instead: ", err)
+			} else if err == nil && !subscribed {
+				log.Println("[ChainEvents][run] websocket subscription established")
+			}
+			subscribed = err == nil
+			me.setSubscribed(subscribed)
+		}
+		if syncNow {
+			if err := me.Sync(); err != nil {
+				log.Println("[ChainEvents][run] ", err)
+			}
+		}
+		syncNow = true
+
+		var subErr <-chan error
+		if sub != nil {
+			subErr = sub.Err()
+		}
+		select {
+		case <-ticker.C:
+		case lg := <-logs:
+			syncNow = me.track(lg)
+			for more := true; more; {
+				select {
+				case lg = <-logs:
+					syncNow = me.track(lg) || syncNow
+				default:
+					more = false
+				}
+			}
+		case err := <-subErr:
+			log.Println("[ChainEvents][run] websocket subscription ended, polling eth_getLogs until it is back: ", err)
+			sub.Unsubscribe()
+			sub = nil
+			subscribed = false
+			me.setSubscribed(false)
+		case <-me.stop:
+			return
+		}
+	}
+}
+
+// Tracks a log received on the subscription, confirmed is true once a tracked log is deep enough to be fetched.
+// A log removed after it was applied is rolled back.
+func (me *ChainEvents) track(lg types.Log) (confirmed bool) {
+	if !me.confirmations.Add(lg) {
+		if err := me.revert(&lg); err != nil {
+			log.Println("[ChainEvents][track] ", err)
+		}
+		return false
+	}
+	return len(me.confirmations.Release(me.confirmations.Latest())) > 0
+}
+
+// Rolls back a log removed by a reorg deeper than the confirmations
+func (me *ChainEvents) revert(lg *types.Log) error {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+
+	if len(lg.Topics) == 0 {
+		return nil
+	}
+	name, ok := me.topics[lg.Topics[0]]
+	if !ok {
+		return nil
+	}
+	checkpoint, _, err := me.pfs.events.checkpoint()
+	if err != nil {
+		return err
+	}
+	applied, err := me.pfs.events.applied(lg)
+	if err != nil || (lg.BlockNumber > checkpoint && !applied) {
+		return err
+	}
+	log.Printf("[ChainEvents][revert] %s log %d of tx %s in block %d was removed by a reorg", name, lg.Index, lg.TxHash.Hex(), lg.BlockNumber)
+
+	paidFile, err := me.pfs.events.revert(lg)
+	if err != nil {
+		return err
+	}
+	switch name {
+	case eventPaymentReceived:
+		if paidFile != nil {
+			log.Printf("[ChainEvents][revert] payment for file %s removed", paidFile.Hex())
+		}
+	case eventDeleted:
+		if len(lg.Topics) > 1 {
+			log.Printf("[ChainEvents][revert] file %s was removed for a deletion no longer on chain, it has to be uploaded again", lg.Topics[1].Hex())
+		}
+	case eventUpdated:
+		if len(lg.Topics) > 2 {
+			return me.pfs.refreshFileMeta(lg.Topics[2])
+		}
+	}
+	return nil
+}
+
+// Applies the logs of the blocks after the checkpoint up to the latest block
+func (me *ChainEvents) Sync() error {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+
+	checkpoint, ok, err := me.pfs.events.checkpoint()
+	if err != nil {
+		return err
+	}
+	from := me.startBlock
+	if ok {
+		from = checkpoint + 1
+	}
+	latest, err := me.source.LatestBlock()
+	if err != nil {
+		return err
+	}
+	// more recent blocks could still be dropped by a reorg
+	latest, ok = me.confirmations.ConfirmedBlock(latest)
+	if !ok {
+		return nil
+	}
+
+	for ; from <= latest; from += eventsBlockChunk {
+		to := from + eventsBlockChunk - 1
+		if to > latest {
+			to = latest
+		}
+		logs, err := me.source.FilterLogs(me.query(new(big.Int).SetUint64(from), new(big.Int).SetUint64(to)))
+		if err != nil {
+			return err
+		}
+		for i := range logs {
+			if err = me.apply(&logs[i]); err != nil {
+				return err
+			}
+		}
+		if err = me.pfs.events.complete(to); err != nil {
+			return err
+		}
+		metrics.LastProcessedBlock.Set(float64(to))
+	}
+	me.stateLock.Lock()
+	me.lastSync = time.Now()
+	me.stateLock.Unlock()
+	return nil
+}
+
+func (me *ChainEvents) setSubscribed(subscribed bool) {
+	me.stateLock.Lock()
+	me.subscribed = subscribed
+	me.stateLock.Unlock()
+}
+
+// Returns the state of the pipeline with the current head of the node
+func (me *ChainEvents) Status() (ChainEventsStatus, error) {
+	me.stateLock.Lock()
+	status := ChainEventsStatus{Subscribed: me.subscribed, LastSync: me.lastSync}
+	me.stateLock.Unlock()
+
+	checkpoint, ok, err := me.pfs.events.checkpoint()
+	if err != nil {
+		return status, err
+	}
+	status.Checkpoint = checkpoint
+	status.Head, err = me.source.LatestBlock()
+	if err != nil {
+		return status, err
+	}
+	confirmed, confirmedOk := me.confirmations.ConfirmedBlock(status.Head)
+	switch {
+	case !confirmedOk:
+	case ok && confirmed > checkpoint:
+		status.Lag = confirmed - checkpoint
+	case !ok && confirmed >= me.startBlock:
+		status.Lag = confirmed - me.startBlock + 1
+	}
+	return status, nil
+}
+
+func (me *ChainEvents) query(from, to *big.Int) ethereum.FilterQuery {
+	var topics []common.Hash
+	for topic := range me.topics {
+		topics = append(topics, topic)
+	}
+	return ethereum.FilterQuery{
+		FromBlock: from,
+		ToBlock:   to,
+		Addresses: []common.Address{me.pfs.contractAddress},
+		Topics:    [][]common.Hash{topics},
+	}
+}
+
+func (me *ChainEvents) apply(lg *types.Log) error {
+	if lg.Removed || len(lg.Topics) == 0 {
+		return nil
+	}
+	name, ok := me.topics[lg.Topics[0]]
+	if !ok {
+		return nil
+	}
+	applied, err := me.pfs.events.applied(lg)
+	if err != nil || applied {
+		return err
+	}
+
+	var (
+		fileHash common.Hash
+		payment  *big.Int
+		paidAt   time.Time
+	)
+	switch name {
+	case eventDeleted:
+		event := new(eth.ProxeusFSContractDeleted)
+		if err = me.contract.UnpackLog(event, name, *lg); err != nil {
+			return err
+		}
+		fileHash = event.Hash
+		err = me.pfs.removeDeletedFile(fileHash, lg)
+	case eventPaymentReceived:
+		event := new(eth.ProxeusFSContractPaymentReceived)
+		if err = me.contract.UnpackLog(event, name, *lg); err != nil {
+			return err
+		}
+		if event.StorageProvider == me.pfs.spAddress {
+			// the price schedule of the payment is the one effective when it was mined
+			var header *types.Header
+			if header, err = me.source.HeaderByNumber(new(big.Int).SetUint64(lg.BlockNumber)); err != nil {
+				return err
+			}
+			fileHash, payment, paidAt = event.Hash, event.XesAmount, time.Unix(int64(header.Time), 0)
+			log.Printf("[ChainEvents][apply] payment of %v received for file %s in tx %s", payment, fileHash.Hex(), lg.TxHash.Hex())
+		}
+	case eventUpdated:
+		event := new(eth.ProxeusFSContractUpdatedEvent)
+		if err = me.contract.UnpackLog(event, name, *lg); err != nil {
+			return err
+		}
+		fileHash = event.NewHash
+		err = me.pfs.refreshFileMeta(fileHash)
+	}
+	if err != nil {
+		return err
+	}
+	return me.pfs.events.commit(lg, fileHash, payment, paidAt)
+}
+
+// Removes the blob and the meta information of a file deleted in the smart contract
+func (me *ProxeusFS) removeDeletedFile(fileHash common.Hash, lg *types.Log) error {
+	fileMeta, metaErr := me.fileMetaHandler.Get(fileHash)
+	err := me.removeFileFromDisk(fileHash.Hex())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.IsNotExist(err) && metaErr == ErrSppFileMetaNotFound {
+		// not stored here or removed already
+		return nil
+	}
+	me.fileMetaHandler.Remove(fileHash)
+	me.removeReplicationJob(fileHash.Hex())
+	metrics.FilesRemoved.WithLabelValues(metrics.RemovedDeleted).Inc()
+
+	entry := AuditEntry{FileHash: fileHash.Hex(), Reason: AuditReasonContractDeleted, TxHash: lg.TxHash.Hex(), Block: lg.BlockNumber}
+	if metaErr == nil && fileMeta.Expiry != nil {
+		entry.Expiry = fileMeta.Expiry.Int64()
+	}
+	if err = me.audit.Record(entry); err != nil {
+		log.Println("[proxeusFS][removeDeletedFile] couldn't record removal in the audit log ", err)
+	}
+	return nil
+}
+
+// Updates the meta information of a stored file with the one of the smart contract
+func (me *ProxeusFS) refreshFileMeta(fileHash common.Hash) error {
+	if _, err := me.fileMetaHandler.Get(fileHash); err == ErrSppFileMetaNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	fileInfo, err := me.ethconn.FileInfo(fileHash, false)
+	if err != nil {
+		return err
+	}
+	me.fileMetaHandler.Save(fileInfo)
+	return nil
+}
+
+// Returns the XES paid to this provider for storing the file
+func (me *ProxeusFS) FilePayment(fileHash common.Hash) (*big.Int, error) {
+	payment, _, err := me.events.payment(fileHash)
+	return payment, err
+}
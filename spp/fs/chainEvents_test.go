@@ -0,0 +1,209 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/spp/config"
+	"github.com/ProxeusApp/storage-app/spp/eth"
+)
+
+// Serves logs with eth_getLogs only, like a node without websockets
+type logSourceStub struct {
+	latest uint64
+	logs   []types.Log
+}
+
+func (me *logSourceStub) LatestBlock() (uint64, error) { return me.latest, nil }
+func (me *logSourceStub) HeaderByNumber(number *big.Int) (*types.Header, error) {
+	// a block every 15 seconds
+	return &types.Header{Number: number, Time: 1500000000 + number.Uint64()*15}, nil
+}
+func (me *logSourceStub) FilterLogs(query ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	for _, lg := range me.logs {
+		if lg.BlockNumber >= query.FromBlock.Uint64() && lg.BlockNumber <= query.ToBlock.Uint64() {
+			logs = append(logs, lg)
+		}
+	}
+	return logs, nil
+}
+func (me *logSourceStub) SubscribeLogs(query ethereum.FilterQuery, logs chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, errors.New("websockets unavailable")
+}
+
+// Fails reading the file info until fail is unset
+type failingFileInfoStub struct {
+	fsClientStub
+	fail bool
+}
+
+func (me *failingFileInfoStub) FileInfo(fileHash [32]byte, readFromCache bool) (FileInfo, error) {
+	if me.fail {
+		return FileInfo{}, errors.New("node unavailable")
+	}
+	return FileInfo{Id: fileHash, Expiry: big.NewInt(2000000000)}, nil
+}
+
+func TestChainEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chain-events-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	contractABI, err := abi.JSON(strings.NewReader(eth.ProxeusFSContractABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spAddress := common.HexToAddress("0x5C9eDfaaC887552D6b521E38dAA3BFf1f645fD36")
+	deleted := common.HexToHash("0x822ac138637485893a49980082b5dfbb020c14f20017f4ae69c7f350c06fe8c1")
+	paid := common.HexToHash("0x01")
+	updated := common.HexToHash("0x02")
+	paymentData, err := contractABI.Events[eventPaymentReceived].Inputs.NonIndexed().Pack(paid, big.NewInt(42), spAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &logSourceStub{latest: 20, logs: []types.Log{
+		{BlockNumber: 11, TxHash: common.HexToHash("0xa1"), Index: 0, Data: paymentData,
+			Topics: []common.Hash{contractABI.Events[eventPaymentReceived].ID()}},
+		{BlockNumber: 12, TxHash: common.HexToHash("0xa2"), Index: 1,
+			Topics: []common.Hash{contractABI.Events[eventDeleted].ID(), deleted}},
+		{BlockNumber: 12, TxHash: common.HexToHash("0xa2"), Index: 2,
+			Topics: []common.Hash{contractABI.Events[eventUpdated].ID(), updated, updated}},
+	}}
+
+	ethConn := &failingFileInfoStub{fail: true}
+	fileMetas := NewFileMetaClientMock(nil)
+	fileMetas.Save(FileInfo{Id: deleted, Expiry: big.NewInt(1)})
+	fileMetas.Save(FileInfo{Id: updated, Expiry: big.NewInt(1)})
+	cfg := &config.Configuration{StorageDir: dir, StorageProviderAddress: spAddress.Hex()}
+	pfs, err := NewProxeusFS(cfg, ethConn, fileMetas, providerInfoStub{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := []byte("archive")
+	if err = pfs.BlobStore().Put(deleted.Hex(), bytes.NewReader(archive), int64(len(archive))); err != nil {
+		t.Fatal(err)
+	}
+	events, err := NewChainEvents(pfs, source, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the update can't be applied, the pipeline stops in the middle of block 12
+	assert.Error(t, events.Sync())
+	checkpoint, _, err := pfs.events.checkpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(11), checkpoint)
+	payment, paidAt, err := pfs.events.payment(paid)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(42), payment.Int64())
+		// time of block 11
+		assert.Equal(t, int64(1500000165), paidAt.Unix())
+	}
+	_, err = pfs.BlobStore().Stat(deleted.Hex())
+	assert.True(t, os.IsNotExist(err))
+	_, err = fileMetas.Get(deleted)
+	assert.Equal(t, ErrSppFileMetaNotFound, err)
+
+	// after a restart the remaining log is applied once, the deletion isn't applied again
+	assert.NoError(t, pfs.Close())
+	ethConn.fail = false
+	pfs, err = NewProxeusFS(cfg, ethConn, fileMetas, providerInfoStub{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pfs.Close()
+	events, err = NewChainEvents(pfs, source, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, events.Sync())
+	assert.NoError(t, events.Sync())
+	checkpoint, _, err = pfs.events.checkpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(20), checkpoint)
+	fileMeta, err := fileMetas.Get(updated)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2000000000), fileMeta.Expiry.Int64())
+	}
+	entries, err := pfs.AuditLog().Entries(AuditFilter{Reason: AuditReasonContractDeleted})
+	if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+		assert.Equal(t, uint64(12), entries[0].Block)
+	}
+	_, err = pfs.FilePayment(updated)
+	assert.Equal(t, ErrFilePaymentNotFound, err)
+}
+
+func TestChainEventsConfirmations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chain-events-confirmations-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	contractABI, err := abi.JSON(strings.NewReader(eth.ProxeusFSContractABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spAddress := common.HexToAddress("0x5C9eDfaaC887552D6b521E38dAA3BFf1f645fD36")
+	paid := common.HexToHash("0x01")
+	paymentData, err := contractABI.Events[eventPaymentReceived].Inputs.NonIndexed().Pack(paid, big.NewInt(42), spAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment := types.Log{BlockNumber: 11, TxHash: common.HexToHash("0xa1"), Data: paymentData,
+		Topics: []common.Hash{contractABI.Events[eventPaymentReceived].ID()}}
+	source := &logSourceStub{latest: 12, logs: []types.Log{payment}}
+
+	pfs, err := NewProxeusFS(&config.Configuration{StorageDir: dir, StorageProviderAddress: spAddress.Hex()},
+		&fsClientStub{}, NewFileMetaClientMock(nil), providerInfoStub{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pfs.Close()
+	events, err := NewChainEvents(pfs, source, 10, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the payment is tracked until it is 3 blocks deep
+	assert.False(t, events.track(payment))
+	assert.NoError(t, events.Sync())
+	_, err = pfs.FilePayment(paid)
+	assert.Equal(t, ErrFilePaymentNotFound, err)
+
+	source.latest = 14
+	assert.True(t, events.track(types.Log{BlockNumber: 14}))
+	assert.NoError(t, events.Sync())
+	_, err = pfs.FilePayment(paid)
+	assert.NoError(t, err)
+
+	// the lag counts the confirmed blocks after the checkpoint
+	source.latest = 20
+	status, err := events.Status()
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint64(20), status.Head)
+		assert.Equal(t, uint64(11), status.Checkpoint)
+		assert.Equal(t, uint64(6), status.Lag)
+		assert.False(t, status.LastSync.IsZero())
+	}
+
+	// a reorg deeper than the confirmations rolls the payment back
+	payment.Removed = true
+	assert.False(t, events.track(payment))
+	_, err = pfs.FilePayment(paid)
+	assert.Equal(t, ErrFilePaymentNotFound, err)
+}
@@ -0,0 +1,196 @@
+package fs
+
+import (
+	"encoding/binary"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+/**
+The event store keeps the state of the chain event pipeline in <StorageDir>/chain_events.db:
+the checkpoint, below which every block has been processed completely, the logs applied from the blocks after the
+checkpoint and the payments received with the time of their block. A log is marked as applied in the same transaction which saves its payment and
+advances the checkpoint, so a restart neither skips nor applies a log twice.
+*/
+type eventStore struct {
+	db *bolt.DB
+}
+
+const eventStoreFilename = "chain_events.db"
+
+var (
+	eventStateBucket    = []byte("state")
+	eventAppliedBucket  = []byte("applied")
+	eventPaymentsBucket = []byte("payments")
+	paymentTimesBucket  = []byte("payment_times") // Unix time of the block a payment was mined in
+	paymentLogsBucket   = []byte("payment_logs")  // File hash paid by a log, to roll the payment back after a reorg
+	checkpointKey       = []byte("checkpoint")
+)
+
+func openEventStore(storageDir string) (*eventStore, error) {
+	db, err := bolt.Open(filepath.Join(storageDir, eventStoreFilename), 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{eventStateBucket, eventAppliedBucket, eventPaymentsBucket, paymentTimesBucket, paymentLogsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &eventStore{db: db}, nil
+}
+
+// Returns the last block processed completely, ok is false before the first one
+func (me *eventStore) checkpoint() (block uint64, ok bool, err error) {
+	err = me.db.View(func(tx *bolt.Tx) error {
+		bts := tx.Bucket(eventStateBucket).Get(checkpointKey)
+		if len(bts) == 8 {
+			block, ok = binary.BigEndian.Uint64(bts), true
+		}
+		return nil
+	})
+	return
+}
+
+func (me *eventStore) applied(lg *types.Log) (applied bool, err error) {
+	err = me.db.View(func(tx *bolt.Tx) error {
+		applied = tx.Bucket(eventAppliedBucket).Get(logKey(lg)) != nil
+		return nil
+	})
+	return
+}
+
+// Marks lg as applied and saves its payment, if any, mined at paidAt. The blocks before the one of lg are complete.
+func (me *eventStore) commit(lg *types.Log, fileHash common.Hash, payment *big.Int, paidAt time.Time) error {
+	return me.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(eventAppliedBucket).Put(logKey(lg), []byte{1}); err != nil {
+			return err
+		}
+		if payment != nil {
+			if err := tx.Bucket(eventPaymentsBucket).Put(paymentKey(fileHash), payment.Bytes()); err != nil {
+				return err
+			}
+			bts := make([]byte, 8)
+			binary.BigEndian.PutUint64(bts, uint64(paidAt.Unix()))
+			if err := tx.Bucket(paymentTimesBucket).Put(paymentKey(fileHash), bts); err != nil {
+				return err
+			}
+			if err := tx.Bucket(paymentLogsBucket).Put(logKey(lg), fileHash.Bytes()); err != nil {
+				return err
+			}
+		}
+		if lg.BlockNumber > 0 {
+			return putCheckpoint(tx, lg.BlockNumber-1)
+		}
+		return nil
+	})
+}
+
+// Moves the checkpoint to block once every log up to it is applied, the applied marks aren't needed anymore
+func (me *eventStore) complete(block uint64) error {
+	return me.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(eventAppliedBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket(eventAppliedBucket); err != nil {
+			return err
+		}
+		return putCheckpoint(tx, block)
+	})
+}
+
+// Forgets that lg was applied and removes the payment it saved. Returns the file hash of the payment, if any.
+func (me *eventStore) revert(lg *types.Log) (paidFile *common.Hash, err error) {
+	err = me.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(eventAppliedBucket).Delete(logKey(lg)); err != nil {
+			return err
+		}
+		paymentLogs := tx.Bucket(paymentLogsBucket)
+		bts := paymentLogs.Get(logKey(lg))
+		if bts == nil {
+			return nil
+		}
+		fileHash := common.BytesToHash(bts)
+		paidFile = &fileHash
+		if err := tx.Bucket(eventPaymentsBucket).Delete(paymentKey(fileHash)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(paymentTimesBucket).Delete(paymentKey(fileHash)); err != nil {
+			return err
+		}
+		return paymentLogs.Delete(logKey(lg))
+	})
+	return
+}
+
+// Returns the payment for fileHash and the time of the block it was mined in.
+// paidAt is zero for payments saved before the time was kept.
+func (me *eventStore) payment(fileHash common.Hash) (payment *big.Int, paidAt time.Time, err error) {
+	err = me.db.View(func(tx *bolt.Tx) error {
+		if bts := tx.Bucket(eventPaymentsBucket).Get(paymentKey(fileHash)); len(bts) > 0 {
+			payment = new(big.Int).SetBytes(bts)
+		}
+		if bts := tx.Bucket(paymentTimesBucket).Get(paymentKey(fileHash)); len(bts) == 8 {
+			paidAt = time.Unix(int64(binary.BigEndian.Uint64(bts)), 0)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if payment == nil {
+		return nil, time.Time{}, ErrFilePaymentNotFound
+	}
+	return payment, paidAt, nil
+}
+
+// Returns an error if the buckets can't be read
+func (me *eventStore) check() error {
+	return me.db.View(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{eventStateBucket, eventPaymentsBucket} {
+			if tx.Bucket(b) == nil {
+				return bolt.ErrBucketNotFound
+			}
+		}
+		return nil
+	})
+}
+
+func (me *eventStore) close() error {
+	return me.db.Close()
+}
+
+// Never moves the checkpoint backwards
+func putCheckpoint(tx *bolt.Tx, block uint64) error {
+	b := tx.Bucket(eventStateBucket)
+	if bts := b.Get(checkpointKey); len(bts) == 8 && binary.BigEndian.Uint64(bts) > block {
+		return nil
+	}
+	bts := make([]byte, 8)
+	binary.BigEndian.PutUint64(bts, block)
+	return b.Put(checkpointKey, bts)
+}
+
+func logKey(lg *types.Log) []byte {
+	key := make([]byte, common.HashLength+4)
+	copy(key, lg.TxHash.Bytes())
+	binary.BigEndian.PutUint32(key[common.HashLength:], uint32(lg.Index))
+	return key
+}
+
+func paymentKey(fileHash common.Hash) []byte {
+	return []byte(strings.ToLower(fileHash.Hex()))
+}
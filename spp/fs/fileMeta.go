@@ -18,7 +18,13 @@ type (
 		All() ([]*sppFileMeta, error)
 		Remove(fileHash common.Hash)
 		Save(fileInfo FileInfo)
+		SaveDigest(fileHash common.Hash, digest string) error
+		SaveMerkleRoot(fileHash common.Hash, root string) error
+		Renew(fileHash common.Hash, renewal Renewal) error
+		Replace(fileHash common.Hash, replacement Replacement) error
 		Manipulate(manipulatedFileInfo FileInfoMock)
+		// Returns an error if the meta information can't be read
+		Check() error
 	}
 
 	fileMetaHandler struct {
@@ -26,8 +32,14 @@ type (
 	}
 
 	sppFileMeta struct {
-		FileHash common.Hash
-		Expiry   *big.Int
+		FileHash   common.Hash
+		Expiry     *big.Int
+		Digest     string `json:",omitempty"` // SHA-256 of the stored archive
+		MerkleRoot string `json:",omitempty"` // Root of the Merkle tree over the chunks of the stored archive, see proof.go
+		Owner      common.Address
+		Renewals   []Renewal `json:",omitempty"` // Paid extensions of the expiry registered in the smart contract
+		// Paid replacements of the archive, see replacement.go
+		Replacements []Replacement `json:",omitempty"`
 	}
 )
 
@@ -85,13 +97,18 @@ func (me *fileMetaHandler) delete(fileHash common.Hash) error {
 func (me *fileMetaHandler) Save(fileInfo FileInfo) {
 	fileMeta, err := me.Get(fileInfo.Id)
 	if err == ErrSppFileMetaNotFound {
-		fileMeta = &sppFileMeta{FileHash: fileInfo.Id, Expiry: fileInfo.Expiry}
+		fileMeta = &sppFileMeta{FileHash: fileInfo.Id, Expiry: fileInfo.Expiry, Owner: fileInfo.Ownr}
 	} else if err != nil {
 		log.Println("[fileMetaHandler][Save] couldn't get file meta information: ", err)
 		return
 	} else {
-		// Update existing file meta informations
-		fileMeta.Expiry = fileInfo.Expiry
+		// Update existing file meta informations, a renewed expiry is kept over the one of the smart contract
+		if updatesExpiry(fileMeta, fileInfo.Expiry) {
+			fileMeta.Expiry = fileInfo.Expiry
+		}
+		if fileInfo.Ownr != (common.Address{}) {
+			fileMeta.Owner = fileInfo.Ownr
+		}
 	}
 
 	err = me.put(*fileMeta)
@@ -101,6 +118,78 @@ func (me *fileMetaHandler) Save(fileInfo FileInfo) {
 	}
 }
 
+// Returns whether expiry, read from the smart contract, replaces the one of fileMeta.
+// An unknown expiry doesn't replace a known one and a renewed expiry is only replaced by a later one.
+func updatesExpiry(fileMeta *sppFileMeta, expiry *big.Int) bool {
+	if expiry == nil {
+		return false
+	}
+	return len(fileMeta.Renewals) == 0 || fileMeta.Expiry == nil || expiry.Cmp(fileMeta.Expiry) > 0
+}
+
+// Stores the digest of the archive currently held for fileHash
+func (me *fileMetaHandler) SaveDigest(fileHash common.Hash, digest string) error {
+	fileMeta, err := me.Get(fileHash)
+	if err == ErrSppFileMetaNotFound {
+		fileMeta = &sppFileMeta{FileHash: fileHash}
+	} else if err != nil {
+		return err
+	}
+	fileMeta.Digest = digest
+	return me.put(*fileMeta)
+}
+
+// Stores the Merkle root of the archive currently held for fileHash
+func (me *fileMetaHandler) SaveMerkleRoot(fileHash common.Hash, root string) error {
+	fileMeta, err := me.Get(fileHash)
+	if err == ErrSppFileMetaNotFound {
+		fileMeta = &sppFileMeta{FileHash: fileHash}
+	} else if err != nil {
+		return err
+	}
+	fileMeta.MerkleRoot = root
+	return me.put(*fileMeta)
+}
+
+// Extends the expiry of fileHash to renewal.Expiry. A transaction can only pay for one renewal.
+func (me *fileMetaHandler) Renew(fileHash common.Hash, renewal Renewal) error {
+	fileMetas, err := me.All()
+	if err != nil {
+		return err
+	}
+	if renewalUsed(fileMetas, renewal.TxHash) {
+		return ErrRenewalAlreadyUsed
+	}
+	fileMeta, err := me.Get(fileHash)
+	if err != nil {
+		return err
+	}
+	fileMeta.Expiry = renewal.Expiry
+	fileMeta.Renewals = append(fileMeta.Renewals, renewal)
+	return me.put(*fileMeta)
+}
+
+// Keeps the transfer paying the replacement of the archive of fileHash. A transaction can only pay for one archive.
+func (me *fileMetaHandler) Replace(fileHash common.Hash, replacement Replacement) error {
+	fileMetas, err := me.All()
+	if err != nil {
+		return err
+	}
+	used, paid := replacementUsed(fileMetas, replacement.TxHash, fileHash, replacement.Digest)
+	if used {
+		return ErrReplacementFeeAlreadyUsed
+	}
+	if paid {
+		return nil
+	}
+	fileMeta, err := me.Get(fileHash)
+	if err != nil {
+		return err
+	}
+	fileMeta.Replacements = append(fileMeta.Replacements, replacement)
+	return me.put(*fileMeta)
+}
+
 func (me *fileMetaHandler) Remove(fileHash common.Hash) {
 	fileMeta, err := me.Get(fileHash)
 	if err != nil {
@@ -136,6 +225,10 @@ func (me *fileMetaHandler) All() ([]*sppFileMeta, error) {
 	return fileMetas, nil
 }
 
+func (me *fileMetaHandler) Check() error {
+	return me.sppFileMetaDB.Check()
+}
+
 func (me *fileMetaHandler) close() {
 	me.sppFileMetaDB.Close()
 }
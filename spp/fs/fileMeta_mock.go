@@ -54,18 +54,74 @@ func (me *fileMetaHandlerMock) Get(fileHash common.Hash) (*sppFileMeta, error) {
 func (me *fileMetaHandlerMock) Save(FileInfo FileInfo) {
 	fileMeta, err := me.Get(FileInfo.Id)
 	if err == ErrSppFileMetaNotFound {
-		fileMeta = &sppFileMeta{FileHash: FileInfo.Id, Expiry: FileInfo.Expiry}
+		fileMeta = &sppFileMeta{FileHash: FileInfo.Id, Expiry: FileInfo.Expiry, Owner: FileInfo.Ownr}
 	} else if err != nil {
 		log.Println("client::Save(): couldn't get file meta information: ", err)
 		return
 	} else {
 		// Update existing file meta informations
-		fileMeta.Expiry = FileInfo.Expiry
+		if updatesExpiry(fileMeta, FileInfo.Expiry) {
+			fileMeta.Expiry = FileInfo.Expiry
+		}
+		if FileInfo.Ownr != (common.Address{}) {
+			fileMeta.Owner = FileInfo.Ownr
+		}
 	}
 
 	me.sppFileMetaDB[fileMeta.FileHash] = fileMeta
 }
 
+func (me *fileMetaHandlerMock) SaveDigest(fileHash common.Hash, digest string) error {
+	fileMeta, err := me.Get(fileHash)
+	if err == ErrSppFileMetaNotFound {
+		fileMeta = &sppFileMeta{FileHash: fileHash}
+		me.sppFileMetaDB[fileHash] = fileMeta
+	}
+	fileMeta.Digest = digest
+	return nil
+}
+
+func (me *fileMetaHandlerMock) SaveMerkleRoot(fileHash common.Hash, root string) error {
+	fileMeta, err := me.Get(fileHash)
+	if err == ErrSppFileMetaNotFound {
+		fileMeta = &sppFileMeta{FileHash: fileHash}
+		me.sppFileMetaDB[fileHash] = fileMeta
+	}
+	fileMeta.MerkleRoot = root
+	return nil
+}
+
+func (me *fileMetaHandlerMock) Renew(fileHash common.Hash, renewal Renewal) error {
+	fileMetas, _ := me.All()
+	if renewalUsed(fileMetas, renewal.TxHash) {
+		return ErrRenewalAlreadyUsed
+	}
+	fileMeta, err := me.Get(fileHash)
+	if err != nil {
+		return err
+	}
+	fileMeta.Expiry = renewal.Expiry
+	fileMeta.Renewals = append(fileMeta.Renewals, renewal)
+	return nil
+}
+
+func (me *fileMetaHandlerMock) Replace(fileHash common.Hash, replacement Replacement) error {
+	fileMetas, _ := me.All()
+	used, paid := replacementUsed(fileMetas, replacement.TxHash, fileHash, replacement.Digest)
+	if used {
+		return ErrReplacementFeeAlreadyUsed
+	}
+	if paid {
+		return nil
+	}
+	fileMeta, err := me.Get(fileHash)
+	if err != nil {
+		return err
+	}
+	fileMeta.Replacements = append(fileMeta.Replacements, replacement)
+	return nil
+}
+
 func (me *fileMetaHandlerMock) Remove(fileHash common.Hash) {
 	delete(me.sppFileMetaDB, fileHash)
 }
@@ -78,3 +134,7 @@ func (me *fileMetaHandlerMock) All() ([]*sppFileMeta, error) {
 
 	return allSppFileMeta, nil
 }
+
+func (me *fileMetaHandlerMock) Check() error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package fs
+
+import (
+	"io"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/ProxeusApp/storage-app/lib/grant"
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+/**
+Signed grants authorize a single upload or download of a file without a sign in, see lib/grant.
+The grant replaces the challenge token and its signature, the permissions of the granting address are checked the same way.
+*/
+
+// Used if the configuration doesn't limit the validity of grants
+const defaultGrantMaxValidity = 24 * time.Hour
+
+func newGrantVerifier(cfg *config.Configuration) *grant.Verifier {
+	maxValidity := time.Duration(cfg.GrantMaxValidity) * time.Second
+	if maxValidity <= 0 {
+		maxValidity = defaultGrantMaxValidity
+	}
+	domain := grant.NewDomain(config.GetChainId().Int64(), common.HexToAddress(cfg.ContractAddress).Hex())
+	return grant.NewVerifier(domain, common.HexToAddress(cfg.StorageProviderAddress), maxValidity)
+}
+
+// Returns the domain grants for this SPP have to be signed for
+func (me *ProxeusFS) GrantDomain() grant.Domain {
+	return me.grants.Domain()
+}
+
+// Returns the provider address grants for this SPP have to name
+func (me *ProxeusFS) GrantProvider() string {
+	return me.grants.Provider().Hex()
+}
+
+// Returns the address which signed the encoded grant of operation on docHash.
+// Like sign ins, grants count towards the request limit of the address.
+func (me *ProxeusFS) ValidateGrant(encoded, docHash, operation string) (addr string, err error) {
+	addr, err = me.grants.Verify(encoded, docHash, operation)
+	if err != nil || me.guard == nil {
+		return addr, err
+	}
+	if err = me.guard.AllowAddress(addr); err != nil {
+		return "", err
+	}
+	return addr, nil
+}
+
+// Like CreateUploadSession, authorized by a write grant
+func (me *ProxeusFS) CreateUploadSessionWithGrant(docHash, encodedGrant string, duration int, size int64, feeTx string) (*UploadSession, error) {
+	if me.ReadOnly() {
+		return nil, ErrReadOnly
+	}
+	addr, err := me.ValidateGrant(encodedGrant, docHash, grant.OperationWrite)
+	if err != nil {
+		return nil, err
+	}
+	return me.createUploadSessionOf(docHash, addr, duration, size, feeTx)
+}
+
+// Like Input, authorized by a write grant
+func (me *ProxeusFS) InputWithGrant(docHash, encodedGrant string, body io.Reader, duration int) (written int64, err error) {
+	sess, err := me.CreateUploadSessionWithGrant(docHash, encodedGrant, duration, 0, "")
+	if err != nil {
+		return 0, err
+	}
+	return me.input(sess, body)
+}
+
+// Like Output, authorized by a read grant
+func (me *ProxeusFS) OutputWithGrant(docHashString, encodedGrant string) (blob Blob, info BlobInfo, err error) {
+	// the grant covers a valid file hash only
+	addr, err := me.ValidateGrant(encodedGrant, docHashString, grant.OperationRead)
+	if err != nil {
+		return nil, info, err
+	}
+	docHash, err := strHashToBytes32(docHashString)
+	if err != nil {
+		return nil, info, err
+	}
+	return me.output(docHashString, docHash, addr)
+}
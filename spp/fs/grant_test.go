@@ -0,0 +1,73 @@
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/lib/grant"
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+func TestGrants(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grant-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Configuration{
+		StorageDir:             dir,
+		StorageProviderAddress: "0x5C9eDfaaC887552D6b521E38dAA3BFf1f645fD36",
+		ContractAddress:        "0xcbd8084f8c759be749340bd20aaed48ec64860e6",
+		GrantMaxValidity:       3600,
+	}
+	pfs, err := NewProxeusFS(cfg, &fsClientStub{}, NewFileMetaClientMock(nil), providerInfoStub{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pfs.Close()
+
+	docHash := "0x822ac138637485893a49980082b5dfbb020c14f20017f4ae69c7f350c06fe8c1"
+	if err = pfs.BlobStore().Put(docHash, bytes.NewReader([]byte("archive")), 7); err != nil {
+		t.Fatal(err)
+	}
+	signed := func(operation string) string {
+		g, err := grant.New(docHash, operation, pfs.GrantProvider(), time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = g.Sign(pfs.GrantDomain(), grant.KeySigner(key)); err != nil {
+			t.Fatal(err)
+		}
+		return g.Encode()
+	}
+
+	read := signed(grant.OperationRead)
+	blob, _, err := pfs.OutputWithGrant(docHash, read)
+	if assert.NoError(t, err) {
+		data, _ := ioutil.ReadAll(blob)
+		blob.Close()
+		assert.Equal(t, "archive", string(data))
+	}
+	_, _, err = pfs.OutputWithGrant(docHash, read)
+	assert.Equal(t, grant.ErrGrantAlreadyUsed, err)
+	_, _, err = pfs.OutputWithGrant(docHash, signed(grant.OperationWrite))
+	assert.Equal(t, grant.ErrGrantScope, err)
+
+	sess, err := pfs.CreateUploadSessionWithGrant(docHash, signed(grant.OperationWrite), 30, 0, "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, crypto.PubkeyToAddress(key.PublicKey).Hex(), sess.Address)
+	}
+	_, err = pfs.CreateUploadSessionWithGrant(docHash, read, 30, 0, "")
+	assert.Equal(t, grant.ErrGrantScope, err)
+}
@@ -0,0 +1,11 @@
+package fs
+
+// Returns an error if the meta information of the stored files can't be read
+func (me *ProxeusFS) CheckFileMeta() error {
+	return me.fileMetaHandler.Check()
+}
+
+// Returns an error if the event store holding the received payments can't be read
+func (me *ProxeusFS) CheckPayments() error {
+	return me.events.check()
+}
@@ -0,0 +1,65 @@
+package fs
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/spp/client/models"
+	"github.com/ProxeusApp/storage-app/spp/config"
+	"github.com/ProxeusApp/storage-app/spp/service"
+)
+
+// Current prices with the schedules they replaced
+type priceHistoryStub struct {
+	providerInfoStub
+	history []service.PriceSchedule
+}
+
+func (me priceHistoryStub) PriceScheduleAt(t time.Time) (service.PriceSchedule, bool) {
+	for _, s := range me.history {
+		if !t.Before(s.From) && (s.Until.IsZero() || t.Before(s.Until)) {
+			return s, true
+		}
+	}
+	return service.PriceSchedule{}, false
+}
+
+func TestVerifyAmountUsesScheduleAtPaymentTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "payment-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	changed := time.Now().Add(-time.Hour)
+	oldPrices := models.StorageProviderInfo{PriceByte: "0", PriceDay: "1", MaxStorageDays: 30}
+	newPrices := models.StorageProviderInfo{PriceByte: "0", PriceDay: "2", MaxStorageDays: 30}
+	old := service.PriceSchedule{PriceByte: "0", PriceDay: "1", From: changed.Add(-time.Hour), Until: changed}
+	current := service.PriceSchedule{PriceByte: "0", PriceDay: "2", From: changed}
+	info := priceHistoryStub{providerInfoStub(newPrices), []service.PriceSchedule{old, current}}
+	pfs, err := NewProxeusFS(&config.Configuration{StorageDir: dir}, nil, NewFileMetaClientMock(nil), info, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xes := func(info models.StorageProviderInfo) *big.Int {
+		breakdown, err := info.PriceBreakdown(10, big.NewInt(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return breakdown.Total
+	}
+	// an upload started before the change pays the old price, one started after it the new price only
+	assert.NoError(t, pfs.verifyAmount("0x01", xes(oldPrices), 0, 10, false, false, changed.Add(-time.Minute)))
+	assert.Equal(t, ErrPaymentDoesNotMatch, pfs.verifyAmount("0x01", xes(newPrices), 0, 10, false, false, changed.Add(-time.Minute)))
+	assert.NoError(t, pfs.verifyAmount("0x01", xes(newPrices), 0, 10, false, false, time.Now()))
+	assert.Equal(t, ErrPaymentDoesNotMatch, pfs.verifyAmount("0x01", xes(oldPrices), 0, 10, false, false, time.Now()))
+
+	// the current prices apply if the schedule isn't kept anymore
+	assert.NoError(t, pfs.verifyAmount("0x01", xes(newPrices), 0, 10, false, false, changed.Add(-3*time.Hour)))
+}
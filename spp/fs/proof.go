@@ -0,0 +1,161 @@
+package fs
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/util"
+	"github.com/ProxeusApp/storage-app/lib/merkle"
+	"github.com/ProxeusApp/storage-app/spp/client/models"
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+/**
+Proofs of storage let the owner of a file check that the SPP still holds the archive without downloading it.
+A Merkle tree is computed over the chunks of every archive when it is stored, the root is kept in the file meta and
+the chunk hashes in <StorageDir>/merkle. A challenge names random offsets of the archive and is answered with the
+chunks holding them and their Merkle proofs, which the client verifies against the root it computed before uploading.
+*/
+
+const (
+	merkleFolderName = "merkle"
+	merkleHashLength = 32
+
+	// Most offsets a single challenge may name
+	MaxProofOffsets = 16
+)
+
+var ErrInvalidProofChallenge = errors.New("proof challenge needs 1 to 16 offsets within the archive")
+
+// Answers a proof-of-storage challenge for the chunks holding offsets of the archive of docHash
+func (me *ProxeusFS) ProveStorage(docHash, token, signatureHex string, offsets []int64) (*models.StorageProof, error) {
+	addr, err := me.Validate(token, signatureHex)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Config.IsTestMode() {
+		access, err := me.hasPermission(docHash, addr, false)
+		if err != nil {
+			return nil, err
+		}
+		if !access {
+			return nil, ErrNoPermission
+		}
+	}
+	if len(offsets) == 0 || len(offsets) > MaxProofOffsets {
+		return nil, ErrInvalidProofChallenge
+	}
+
+	blob, info, err := me.blobs.Get(docHash)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	for _, offset := range offsets {
+		if offset < 0 || offset > 0 && offset >= info.Size {
+			return nil, ErrInvalidProofChallenge
+		}
+	}
+	leaves, err := me.merkleLeaves(docHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(leaves) != merkle.Chunks(info.Size) {
+		// the chunk hashes don't belong to the stored archive anymore
+		if leaves, err = me.computeMerkleLeaves(docHash); err != nil {
+			return nil, err
+		}
+	}
+
+	proof := &models.StorageProof{
+		FileHash: docHash,
+		Root:     hex.EncodeToString(merkle.Root(leaves)),
+		Size:     info.Size,
+	}
+	for _, offset := range offsets {
+		index := int(offset / merkle.ChunkSize)
+		if _, err = blob.Seek(int64(index)*merkle.ChunkSize, io.SeekStart); err != nil {
+			return nil, err
+		}
+		chunk := make([]byte, merkle.ChunkSize)
+		n, err := io.ReadFull(blob, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, err
+		}
+		chunkProof := models.ChunkProof{
+			Offset: offset,
+			Index:  index,
+			Data:   chunk[:n],
+			Hash:   hex.EncodeToString(merkle.LeafHash(chunk[:n])),
+		}
+		for _, sibling := range merkle.Proof(leaves, index) {
+			chunkProof.Proof = append(chunkProof.Proof, hex.EncodeToString(sibling))
+		}
+		proof.Chunks = append(proof.Chunks, chunkProof)
+	}
+	return proof, nil
+}
+
+// Returns the chunk hashes of the stored archive, they are computed for archives stored before proofs were supported
+func (me *ProxeusFS) merkleLeaves(docHash string) ([][]byte, error) {
+	bts, err := ioutil.ReadFile(me.merkleLeavesPath(docHash))
+	if os.IsNotExist(err) {
+		return me.computeMerkleLeaves(docHash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var leaves [][]byte
+	for i := 0; i+merkleHashLength <= len(bts); i += merkleHashLength {
+		leaves = append(leaves, bts[i:i+merkleHashLength])
+	}
+	return leaves, nil
+}
+
+func (me *ProxeusFS) computeMerkleLeaves(docHash string) ([][]byte, error) {
+	blob, _, err := me.blobs.Get(docHash)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	leaves, err := merkle.Leaves(blob)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[proxeusFS][computeMerkleLeaves] computed the Merkle tree of the stored archive %s", docHash)
+	return leaves, me.saveMerkleLeaves(docHash, leaves)
+}
+
+// Keeps the chunk hashes of the archive and its root in the file meta
+func (me *ProxeusFS) saveMerkleLeaves(docHash string, leaves [][]byte) error {
+	if err := os.MkdirAll(filepath.Join(me.basePath, merkleFolderName), 0700); err != nil {
+		return err
+	}
+	bts := make([]byte, 0, len(leaves)*merkleHashLength)
+	for _, leaf := range leaves {
+		bts = append(bts, leaf...)
+	}
+	tmp := me.merkleLeavesPath(docHash) + downloadingSuffix
+	if err := ioutil.WriteFile(tmp, bts, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, me.merkleLeavesPath(docHash)); err != nil {
+		return err
+	}
+	return me.fileMetaHandler.SaveMerkleRoot(util.StrHexToBytes32(docHash), hex.EncodeToString(merkle.Root(leaves)))
+}
+
+func (me *ProxeusFS) removeMerkleLeaves(docHash string) {
+	if err := os.Remove(me.merkleLeavesPath(docHash)); err != nil && !os.IsNotExist(err) {
+		log.Println("[proxeusFS][removeMerkleLeaves] ", err)
+	}
+}
+
+func (me *ProxeusFS) merkleLeavesPath(docHash string) string {
+	return filepath.Join(me.basePath, merkleFolderName, filepath.Base(docHash))
+}
@@ -0,0 +1,108 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/util"
+	"github.com/ProxeusApp/storage-app/lib/challenge"
+	"github.com/ProxeusApp/storage-app/lib/merkle"
+	"github.com/ProxeusApp/storage-app/spp/client/models"
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+func TestProveStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proof-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := challenge.NewAuthenticator(challenge.NewMemoryStore(), time.Minute)
+	fileMetas := NewFileMetaClientMock(nil)
+	pfs, err := NewProxeusFS(&config.Configuration{StorageDir: dir}, &fsClientStub{}, fileMetas, providerInfoStub{}, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pfs.Close()
+
+	docHash := "0x822ac138637485893a49980082b5dfbb020c14f20017f4ae69c7f350c06fe8c1"
+	archive := make([]byte, 3*merkle.ChunkSize+100)
+	for i := range archive {
+		archive[i] = byte(i * 13)
+	}
+	leaves, err := merkle.Leaves(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := merkle.Root(leaves)
+	if err = pfs.BlobStore().Put(docHash, bytes.NewReader(archive), int64(len(archive))); err != nil {
+		t.Fatal(err)
+	}
+
+	prove := func(offsets ...int64) (*models.StorageProof, error) {
+		msg, err := auth.CreateSignInChallenge()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pfs.ProveStorage(docHash, msg.Token, signChallenge(t, msg.Challenge, key), offsets)
+	}
+	verified := func(proof *models.StorageProof) bool {
+		for _, chunk := range proof.Chunks {
+			var siblings [][]byte
+			for _, s := range chunk.Proof {
+				sibling, _ := hex.DecodeString(s)
+				siblings = append(siblings, sibling)
+			}
+			if !merkle.Verify(root, merkle.LeafHash(chunk.Data), chunk.Index, merkle.Chunks(proof.Size), siblings) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// the tree of an archive stored before proofs were supported is computed on the first challenge
+	proof, err := prove(0, merkle.ChunkSize+1, int64(len(archive)-1))
+	if assert.NoError(t, err) {
+		assert.Equal(t, hex.EncodeToString(root), proof.Root)
+		assert.Len(t, proof.Chunks, 3)
+		assert.Equal(t, 3, proof.Chunks[2].Index)
+		assert.Len(t, proof.Chunks[2].Data, 100)
+		assert.True(t, verified(proof))
+	}
+	fileMeta, err := fileMetas.Get(util.StrHexToBytes32(docHash))
+	if assert.NoError(t, err) {
+		assert.Equal(t, hex.EncodeToString(root), fileMeta.MerkleRoot)
+	}
+
+	_, err = prove(int64(len(archive)))
+	assert.Equal(t, ErrInvalidProofChallenge, err)
+	_, err = prove()
+	assert.Equal(t, ErrInvalidProofChallenge, err)
+
+	// a corrupted archive can't be proven
+	archive[merkle.ChunkSize+5]++
+	if err = pfs.BlobStore().Put(docHash, bytes.NewReader(archive), int64(len(archive))); err != nil {
+		t.Fatal(err)
+	}
+	proof, err = prove(merkle.ChunkSize)
+	if assert.NoError(t, err) {
+		assert.False(t, verified(proof))
+	}
+
+	// removing the file removes its chunk hashes
+	assert.NoError(t, pfs.removeFileFromDisk(docHash))
+	_, err = os.Stat(pfs.merkleLeavesPath(docHash))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -1,6 +1,8 @@
 package fs
 
 import (
+	"crypto/ecdsa"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"io"
@@ -18,31 +20,42 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
-	cache "github.com/patrickmn/go-cache"
-	uuid "github.com/satori/go.uuid"
 
-	"github.com/ProxeusApp/storage-app/lib/wallet"
+	"github.com/ProxeusApp/storage-app/lib/challenge"
+	"github.com/ProxeusApp/storage-app/lib/grant"
+	"github.com/ProxeusApp/storage-app/lib/merkle"
+	"github.com/ProxeusApp/storage-app/lib/ratelimit"
+	"github.com/ProxeusApp/storage-app/spp/client/models"
 	"github.com/ProxeusApp/storage-app/spp/config"
 	"github.com/ProxeusApp/storage-app/spp/fs/db"
 )
 
 type ProxeusFS struct {
 	basePath            string
-	c                   *cache.Cache
+	blobs               BlobStore
+	auth                *challenge.Authenticator
+	grants              *grant.Verifier
 	contractAddress     common.Address
 	spAddress           common.Address
 	database            *db.KVStore
 	ethconn             FsClientInterface
 	providerInfoService service.ProviderInfoService
 	fileGblLock         sync.Mutex
+	uploadLocks         sync.Map
+	validators          sync.Map // Archive validator by upload session id, see validation.go
+	archivePolicy       ArchivePolicy
+	guard               *ratelimit.Guard // Caps the open uploads of an address, nil for no limit
+	renewLock           sync.Mutex
+	providerKey         *ecdsa.PrivateKey
+	replicating         int32
+	usage               usage
 	fileMetaHandler     FileMetaHandlerInterface
+	audit               *AuditLog
+	events              *eventStore
 	testMode            bool
 }
 
-type SignMsg struct {
-	Token     string `json:"token"`
-	Challenge string `json:"challenge"`
-}
+type SignMsg = challenge.SignMsg
 
 type SpAddress struct {
 	Address string `json:"address"`
@@ -66,7 +79,9 @@ type FileInfo struct {
 type FsClientInterface interface {
 	FileInfo(fileHash [32]byte, readFromCache bool) (FileInfo, error)
 	SpInfoForFile(fileHash string) (string, error)
-	GetFilePayment(fhash common.Hash) (*big.Int, error)
+	StorageProvidersForFile(fileHash string) ([]SpAddress, error)
+	// Returns the XES transfers of the transaction txHash once it is confirmed, ErrRenewalPaymentNotFound before
+	XesTransfers(txHash common.Hash) ([]XesTransfer, error)
 	HasWriteRights(fileHash [32]byte, addr common.Address, readFromCache bool) (bool, error)
 	HasReadRights(fileHash [32]byte, addr common.Address, readFromCache bool) (bool, error)
 	Close() error
@@ -79,151 +94,281 @@ const (
 
 var (
 	ErrNotSatisfiable      = errors.New("try again later")
-	ErrInvalidSignature    = errors.New("login.error.invalidSignature")
+	ErrInvalidSignature    = challenge.ErrInvalidSignature
 	ErrNoPermission        = errors.New("proxeusFS permission denied")
 	ErrFileRemoved         = errors.New("file has been removed")
 	ErrFileNotReady        = errors.New("file isn't ready yet")
 	ErrPaymentDoesNotMatch = errors.New("spp: received and calculated xes do not match")
 )
 
-func NewProxeusFS(cfg *config.Configuration, ethConn FsClientInterface, fileMetaHandler FileMetaHandlerInterface, providerInfoService service.ProviderInfoService) (*ProxeusFS, error) {
+func NewProxeusFS(cfg *config.Configuration, ethConn FsClientInterface, fileMetaHandler FileMetaHandlerInterface, providerInfoService service.ProviderInfoService,
+	auth *challenge.Authenticator) (*ProxeusFS, error) {
 	if cfg.StorageDir != "" {
 		err := os.MkdirAll(cfg.StorageDir, 0700)
 		if err != nil {
 			return nil, err
 		}
 	}
+	blobs, err := NewBlobStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	events, err := openEventStore(cfg.StorageDir)
+	if err != nil {
+		return nil, err
+	}
 	pfs := &ProxeusFS{
 		basePath:            cfg.StorageDir,
+		blobs:               blobs,
 		spAddress:           common.HexToAddress(cfg.StorageProviderAddress),
 		contractAddress:     common.HexToAddress(cfg.ContractAddress),
-		c:                   cache.New(5*time.Minute, 10*time.Minute),
+		auth:                auth,
+		grants:              newGrantVerifier(cfg),
 		ethconn:             ethConn,
 		providerInfoService: providerInfoService,
 		fileMetaHandler:     fileMetaHandler,
+		audit:               NewAuditLog(cfg.StorageDir),
+		events:              events,
+		archivePolicy:       NewArchivePolicy(cfg),
+	}
+	if auth != nil {
+		// used grants are kept with the challenges, a persistent challenge store keeps them used across restarts
+		pfs.grants.SetNonceStore(auth)
 	}
 	return pfs, nil
 }
 
-func (me *ProxeusFS) CreateSignInChallenge() (*SignMsg, error) {
-	msg := wallet.CreateSignInChallenge("Sign this message to login: ")
-	u, err := uuid.NewV4()
+// The payment has to match the price schedule which was effective when it was mined, so uploads paid before a
+// price change still verify but payments after it can't pay the old price.
+// With atLeast any higher payment is accepted too, see replication.go.
+func (me *ProxeusFS) verifyPayment(sess *UploadSession, fileSizeBytes int64, atLeast bool) error {
+	receivedXes, paidAt, err := me.events.payment(util.StrHexToBytes32(sess.FileHash))
 	if err != nil {
-		return nil, err
+		return err
 	}
-	tokenStr := u.String()
-	res := &SignMsg{Token: tokenStr, Challenge: msg}
-	me.c.Set(tokenStr, res, cache.DefaultExpiration)
-	return res, nil
+	if paidAt.IsZero() {
+		// saved before the block time was kept
+		paidAt = sess.CreatedAt
+	}
+	return me.verifyAmount(sess.FileHash, receivedXes, fileSizeBytes, sess.Duration, false, atLeast, paidAt)
 }
 
-func (me *ProxeusFS) verifyPayment(filehash string, fileSizeBytes int64, duration int) error {
-	receivedXes, err := me.ethconn.GetFilePayment(util.StrHexToBytes32(filehash))
+// Checks receivedXes against the price of the upload or, with renewal, of keeping the file duration days longer,
+// computed with the price schedule effective at paidAt. The current prices are used if that schedule isn't kept anymore.
+func (me *ProxeusFS) verifyAmount(filehash string, receivedXes *big.Int, fileSizeBytes int64, duration int, renewal, atLeast bool, paidAt time.Time) error {
+	info := me.providerInfoService.Get()
+	if schedule, ok := me.providerInfoService.PriceScheduleAt(paidAt); ok {
+		info = schedule.ProviderInfo()
+	}
+	totalXes, err := me.calcTotalXes(info, duration, big.NewInt(fileSizeBytes), renewal)
 	if err != nil {
 		return err
 	}
-
-	totalXes, err := me.calcTotalXes(duration, big.NewInt(int64(fileSizeBytes)))
-
-	if 0 != receivedXes.Cmp(totalXes) {
-		log.Printf("[proxeusFS][verifyPayment] file: %s | expectedXes: %d | receivedXes: %d", filehash, totalXes, receivedXes)
-		return ErrPaymentDoesNotMatch
+	cmp := receivedXes.Cmp(totalXes)
+	if cmp == 0 || (atLeast && cmp > 0) {
+		return nil
 	}
-	return err
+	log.Printf("[proxeusFS][verifyPayment] file: %s | expectedXes: %d | receivedXes: %d | renewal: %t | atLeast: %t | paidAt: %s",
+		filehash, totalXes, receivedXes, renewal, atLeast, paidAt)
+	return ErrPaymentDoesNotMatch
 }
 
 var ErrReplacingExistingFileSize = errors.New("cannot replace file. Size of new and existing file differ to much")
 
+// Input receives a whole archive in a single request. It's kept for clients not supporting resumable uploads
+// and goes through a fresh upload session.
 func (me *ProxeusFS) Input(docHash, token, signatureHex string, body io.Reader, duration int) (written int64, err error) {
-	addr, err := me.Validate(token, signatureHex)
+	sess, err := me.CreateUploadSession(docHash, token, signatureHex, duration, 0, "")
 	if err != nil {
 		return 0, err
 	}
-	ok, err := me.hasPermission(docHash, addr, true)
-	if err != nil {
-		return 0, err
+	return me.input(sess, body)
+}
+
+func (me *ProxeusFS) input(sess *UploadSession, body io.Reader) (written int64, err error) {
+	if sess.Offset > 0 {
+		// a single request upload can't resume, start over
+		if err = me.truncateUpload(sess.ID); err != nil {
+			return 0, err
+		}
 	}
-	if !ok {
-		return 0, ErrNoPermission
+
+	if _, err = me.writeUploadChunk(sess.ID, 0, body, 0); err != nil {
+		me.abortUpload(sess.ID)
+		return 0, err
 	}
+	return me.finalizeUpload(sess.ID)
+}
 
-	newFileSize, err := me.writeFileToDiskTmp(docHash, body)
+// Validates the archive at tmpPath uploaded by sess and moves it into place. keepSession reports whether the error can be
+// resolved without uploading the archive again, like a payment which hasn't been received yet.
+func (me *ProxeusFS) commitUpload(sess *UploadSession, tmpPath string) (err error, keepSession bool) {
+	docHash, newFileSize := sess.FileHash, sess.Offset
+	digest, leaves, err := archiveHashes(tmpPath)
 	if err != nil {
-		return
+		return err, false
+	}
+	if sess.Replica && digest != sess.Digest {
+		log.Printf("[proxeusFS][commitUpload] replica of file %s has digest %s instead of %s", docHash, digest, sess.Digest)
+		return ErrReplicaDigestMismatch, false
 	}
-	defer me.removeFileTmp(docHash) //remove tmp file if any
 
 	err, isNewFile := me.checkForExistingFile(docHash, newFileSize)
 	if err != nil {
-		return 0, err
+		return err, false
 	}
 
-	tmpPath := me.downloadingPath(docHash)
-	untarDst := filepath.Join(me.basePath, tempFolderName, "decompressed", docHash)
-	if err = verifyArchivePgpFiles(tmpPath, untarDst); err != nil {
-		log.Println("Unencrypted files in archive found", err)
-		return 0, err
+	if err = me.finishArchiveValidation(sess.ID, newFileSize); err != nil {
+		log.Printf("[proxeusFS][commitUpload] archive of file %s rejected: %v", docHash, err)
+		return err, false
+	}
+
+	var peers []SpAddress
+	if !config.Config.IsTestMode() {
+		if peers, err = me.replicationPeers(docHash); err != nil {
+			return err, true
+		}
 	}
 
-	//if file was on spp before do not check payment because filesize might change due to re-encryption with different amount of keys
+	//if file was on spp before do not check payment because filesize might change due to re-encryption with different amount of keys,
+	//the replacement is charged the replacement fee instead
+	if !isNewFile && !sess.Replica {
+		if config.Config.IsTestMode() {
+			log.Println("SPP running in TESTMODE. Replacement fee won't be verified")
+		} else if err = me.payReplacement(sess, digest); err != nil {
+			// a new payment is named by resuming the session
+			log.Printf("[proxeusFS][commitUpload] replacement of file %s not paid: %v", docHash, err)
+			return err, true
+		}
+	}
+	var fileInfo FileInfo
 	if isNewFile {
 		// Since we don't want to copy the stream's content in memory,
 		// we're only going to verify the payment once the file has been written to disk.
-		// If the payment doesn't match or an error occurs we remove the file
-		var fileInfo FileInfo
+		// If the payment doesn't match or an error occurs the upload is kept until the session expires
 		if config.Config.IsTestMode() {
 			log.Println("SPP running in TESTMODE. File payment won't be verified")
 			fileInfo = FileInfo{
 				Id:       util.StrHexToBytes32(docHash),
-				Ownr:     common.HexToAddress(addr),
+				Ownr:     common.HexToAddress(sess.Address),
 				FileType: big.NewInt(2),
 			}
 		} else {
-			err = me.verifyPayment(docHash, newFileSize, duration)
+			// Every provider of a file is paid the price of the most expensive one
+			err = me.verifyPayment(sess, newFileSize, len(peers) > 0)
 			if err != nil {
 				log.Println("Can't verify payment", err)
-				return 0, err
+				return err, true
 			}
 
 			fileHash := util.StrHexToBytes32(docHash)
 			fileInfo, err = me.ethconn.FileInfo(fileHash, false)
 			if err != nil {
-				return 0, err
+				return err, true
 			}
 		}
+	}
+
+	tmpFile, err := os.Open(tmpPath)
+	if err != nil {
+		return err, false
+	}
+	err = me.blobs.Put(docHash, tmpFile, newFileSize)
+	tmpFile.Close()
+	me.resetUsedCapacity()
+	if err != nil {
+		return err, false
+	}
+	if isNewFile {
+		// saved once the archive is in place, a meta without its archive would count as stored
 		me.fileMetaHandler.Save(fileInfo)
 	}
+	if err = me.fileMetaHandler.SaveDigest(util.StrHexToBytes32(docHash), digest); err != nil {
+		return err, false
+	}
+	if err = me.saveMerkleLeaves(docHash, leaves); err != nil {
+		return err, false
+	}
+	if !sess.Replica {
+		me.enqueueReplication(docHash, sess.Duration, peers)
+	}
+	return nil, false
+}
+
+// Returns the hex encoded SHA-256 of the stored archive.
+// The digest is computed and saved for archives stored before digests were kept.
+func (me *ProxeusFS) ArchiveDigest(docHashString string) (string, error) {
+	fileHash := util.StrHexToBytes32(docHashString)
+	fileMeta, err := me.fileMetaHandler.Get(fileHash)
+	if err == nil && fileMeta.Digest != "" {
+		return fileMeta.Digest, nil
+	}
+	blob, _, err := me.blobs.Get(docHashString)
+	if err != nil {
+		return "", err
+	}
+	defer blob.Close()
+	digest, err := readerDigest(blob)
+	if err != nil {
+		return "", err
+	}
+	return digest, me.fileMetaHandler.SaveDigest(fileHash, digest)
+}
 
-	return newFileSize, me.moveFileTmpToRealDir(docHash)
+// Returns the digest and the Merkle tree chunk hashes of the archive at path, reading it once
+func archiveHashes(path string) (digest string, leaves [][]byte, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if leaves, err = merkle.Leaves(io.TeeReader(f, h)); err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), leaves, nil
+}
+
+func readerDigest(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 //verify that the new uploaded file to replace the existing one (if any) is approx the same size as existing file
 func (me *ProxeusFS) checkForExistingFile(docHash string, newFileSize int64) (err error, isNew bool) {
-	existingFileInfo, err := os.Stat(filepath.Join(me.basePath, docHash))
+	existingFileInfo, err := me.blobs.Stat(docHash)
 	if err != nil {
 		return nil, true
 	}
 
-	sizeDiff := math.Abs(float64(newFileSize) - float64(existingFileInfo.Size()))
+	sizeDiff := math.Abs(float64(newFileSize) - float64(existingFileInfo.Size))
 
 	//1 sharee-key = ~1000 bytes, we'll allow a difference in size according to 100 sharees
 	if sizeDiff > (100 * 1000) {
-		log.Printf("[proxeusFS][Input] size existing file: %d | new file: %d", existingFileInfo.Size(), newFileSize)
+		log.Printf("[proxeusFS][Input] size existing file: %d | new file: %d", existingFileInfo.Size, newFileSize)
 		return ErrReplacingExistingFileSize, false
 	}
 	return nil, false
 }
 
-func (me *ProxeusFS) Output(docHashString, token, signatureHex string, force bool) (n string, err error) {
+// Returns the stored archive, the caller has to close it
+func (me *ProxeusFS) Output(docHashString, token, signatureHex string, force bool) (blob Blob, info BlobInfo, err error) {
 	docHash, err := strHashToBytes32(docHashString)
 	if err != nil {
-		return "", err
+		return nil, info, err
 	}
-	var addr string
-	addr, err = me.Validate(token, signatureHex)
+	addr, err := me.Validate(token, signatureHex)
 	if err != nil {
-		return "", err
+		return nil, info, err
 	}
+	return me.output(docHashString, docHash, addr)
+}
+
+// Returns the stored archive once addr is authenticated, by a challenge or a grant
+func (me *ProxeusFS) output(docHashString string, docHash [32]byte, addr string) (blob Blob, info BlobInfo, err error) {
 	// Retrieve file first
 
 	var fi FileInfo
@@ -237,30 +382,23 @@ func (me *ProxeusFS) Output(docHashString, token, signatureHex string, force boo
 	} else {
 		fi, err = me.ethconn.FileInfo(docHash, false)
 		if err != nil {
-			return "", err
+			return nil, info, err
 		}
 
 		if fi.Removed {
-			return "", ErrFileRemoved
+			return nil, info, ErrFileRemoved
 		}
 
 		// Then check its permissions
 		readRights, err := me.hasPermission(docHashString, addr, false)
 		if err != nil {
-			return "", err
+			return nil, info, err
 		}
 		if !readRights {
-			return "", ErrNoPermission
+			return nil, info, ErrNoPermission
 		}
 	}
 
-	oldPath := filepath.Join(me.basePath, docHashString+downloadingSuffix)
-	_, err = os.Stat(oldPath)
-	if !os.IsNotExist(err) {
-		err = ErrNotSatisfiable
-		return
-	}
-
 	// Check if file meta exists, add otherwise
 	_, err = me.fileMetaHandler.Get(docHash)
 	if err == ErrSppFileMetaNotFound {
@@ -269,69 +407,32 @@ func (me *ProxeusFS) Output(docHashString, token, signatureHex string, force boo
 		log.Println("proxeusFS::Output(): couldn't get file meta information: ", err)
 	}
 
-	return filepath.Join(me.basePath, docHashString), nil
+	return me.blobs.Get(docHashString)
 }
 
+// Returns the address which signed the challenge of token
 func (me *ProxeusFS) Validate(token, signatureHex string) (addr string, err error) {
-	if x, found := me.c.Get(token); found {
-		signMsg := x.(*SignMsg)
-		addr, err = wallet.VerifySignInChallenge(signMsg.Challenge, signatureHex)
-		if err != nil {
-			return
-		}
-		me.c.Delete(token)
-	}
-	return
-}
-
-func (me *ProxeusFS) writeFileToDisk(filename string, body io.Reader) (written int64, err error) {
-	if written, err = me.writeFileToDiskTmp(filename, body); err != nil {
-		return 0, err
-	}
-
-	return written, me.moveFileTmpToRealDir(filename)
-}
-
-func (me *ProxeusFS) moveFileTmpToRealDir(filename string) error {
-	newPath := filepath.Join(me.basePath, filename)
-	oldPath := me.downloadingPath(filename)
-	return os.Rename(oldPath, newPath)
-}
-
-func (me *ProxeusFS) removeFileTmp(filename string) error {
-	return os.Remove(me.downloadingPath(filename))
+	return me.auth.Validate(token, signatureHex)
 }
 
-func (me *ProxeusFS) writeFileToDiskTmp(filename string, body io.Reader) (written int64, err error) {
-	var f *os.File
-
-	downloadingPath := me.downloadingPath(filename)
-	//check if already
-	_, err = os.Stat(downloadingPath)
-	if !os.IsNotExist(err) {
-		err = os.ErrInvalid
-		return
-	}
-	f, err = os.OpenFile(downloadingPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
-	defer f.Close()
-	if err != nil {
-		return
+func (me *ProxeusFS) removeFileFromDisk(filename string) (err error) {
+	err = me.blobs.Delete(filepath.Base(filename))
+	if err == nil {
+		log.Println("Removed file: ", filename)
+		me.removeMerkleLeaves(filename)
+		me.resetUsedCapacity()
 	}
-	return io.Copy(f, body)
+	return
 }
 
-func (me *ProxeusFS) downloadingPath(filename string) string {
-	downloadingFilename := filename + downloadingSuffix
-	return filepath.Join(me.basePath, downloadingFilename)
+// Returns the blob store holding the archives
+func (me *ProxeusFS) BlobStore() BlobStore {
+	return me.blobs
 }
 
-func (me *ProxeusFS) removeFileFromDisk(filename string) (err error) {
-	absPath := filepath.Join(me.basePath, filepath.Base(filename))
-	err = os.Remove(absPath)
-	if err == nil {
-		log.Println("Removed file: ", absPath)
-	}
-	return
+// Returns the log of the removed files
+func (me *ProxeusFS) AuditLog() *AuditLog {
+	return me.audit
 }
 
 func strHashToBytes32(documentHashHex string) (documentHashBytesFixed [32]byte, err error) {
@@ -369,82 +470,28 @@ func (me *ProxeusFS) hasPermission(docHashStr, addr string, write bool) (access
 	return allow, err
 }
 
-func (me *ProxeusFS) calcTotalXes(durationInDays int, fileSizeByte *big.Int) (*big.Int, error) {
-	storageProviderInfo := me.providerInfoService.Get()
-	totalXes, err := storageProviderInfo.TotalPriceForFile(durationInDays, fileSizeByte)
+func (me *ProxeusFS) calcTotalXes(info models.StorageProviderInfo, durationInDays int, fileSizeByte *big.Int, renewal bool) (*big.Int, error) {
+	breakdown, err := priceBreakdown(info, durationInDays, fileSizeByte, renewal)
 	if err != nil {
-		return totalXes, err
+		return nil, err
 	}
 
-	priceDuration, _ := storageProviderInfo.PriceForDurationInXesWei(durationInDays)
-	priceSize, _ := storageProviderInfo.PriceForSizeInXesWei(fileSizeByte)
-	pricePerDayXesWei, _ := storageProviderInfo.PriceDayXESWei()
-	pricePerByteXesWei, _ := storageProviderInfo.PriceByteXESWei()
-
-	log.Printf("spp upload: pricing totalXes: %v | durationInDays: %v | fileSizeByte: %v",
-		totalXes, durationInDays, fileSizeByte)
-	log.Printf("spp upload: priceSize: %v | priceDuration: %v | pricePerByteXesWei: %v | pricePerDayXesWei: %v",
-		priceSize, priceDuration, pricePerByteXesWei, pricePerDayXesWei)
+	log.Printf("spp upload: pricing totalXes: %v | durationInDays: %v | fileSizeByte: %v | renewal: %v",
+		breakdown.Total, durationInDays, fileSizeByte, renewal)
+	log.Printf("spp upload: priceSize: %v | priceDuration: %v | durationDiscount: %v | minimumCharge: %v",
+		breakdown.Size, breakdown.Duration, breakdown.DurationDiscount, breakdown.MinimumCharge)
 
-	return totalXes, nil
+	return breakdown.Total, nil
 }
 
-func (me *ProxeusFS) CheckForExpiredFiles() {
-	start := time.Now()
-	log.Println("CheckForExpiredFiles...")
-
-	fileMetas, err := me.fileMetaHandler.All()
-	if err != nil {
-		return
+func priceBreakdown(info models.StorageProviderInfo, durationInDays int, fileSizeByte *big.Int, renewal bool) (models.PriceBreakdown, error) {
+	if renewal {
+		return info.RenewalPriceBreakdown(durationInDays)
 	}
-
-	now := time.Now().Unix()
-	gracePeriod := int64(me.providerInfoService.Get().GraceSeconds)
-
-	for _, fileMeta := range fileMetas {
-		expiryWithGrace := fileMeta.Expiry.Int64() + gracePeriod
-
-		if expiryWithGrace > now {
-			continue
-		}
-
-		log.Println("CheckForExpiredFiles: Expired, would remove, double check expiry from smart contract...", fileMeta.FileHash.Hex())
-		fileInfo, err := me.ethconn.FileInfo(fileMeta.FileHash, false)
-		if err != nil {
-			log.Println("CheckForExpiredFiles: error while double checking expiry date ", err)
-			continue
-		}
-
-		if fileMeta.Expiry.Int64() != fileInfo.Expiry.Int64() {
-			log.Printf("CheckForExpiredFiles: saved expiry date not identical with smart contract! Saved: %d, Smart contract: %d, FileHash: %s", fileMeta.Expiry.Int64(), fileInfo.Expiry.Int64(), fileMeta.FileHash.Hex())
-			expiryWithGrace = fileInfo.Expiry.Int64() + gracePeriod
-
-			// Check if expiry date from smart contract still is old enough to be removed, otherwise update file meta
-			if expiryWithGrace > now {
-				// Update spp file meta
-				me.fileMetaHandler.Save(fileInfo)
-				continue
-			}
-		}
-
-		log.Println("CheckForExpiredFiles: actually remove... ", fileMeta.FileHash.Hex())
-		err = me.removeFileFromDisk(fileMeta.FileHash.Hex())
-		if err != nil {
-			log.Println("CheckForExpiredFiles: error while remove file from disk ", err)
-			if !os.IsNotExist(err) {
-				continue
-			}
-		}
-		// If no error occurred during remove file from disk or file didn't exist, remove meta information
-		me.fileMetaHandler.Remove(fileMeta.FileHash)
-	}
-
-	elapsed := time.Since(start)
-
-	log.Println("...CheckForExpiredFiles took ", elapsed)
+	return info.PriceBreakdown(durationInDays, fileSizeByte)
 }
 
 func (me *ProxeusFS) Close() (err error) {
 	me.ethconn.Close()
-	return nil
+	return me.events.close()
 }
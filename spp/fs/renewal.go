@@ -0,0 +1,130 @@
+package fs
+
+import (
+	"errors"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/util"
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+/**
+Renewals extend the expiry of a stored file. The smart contract can't change the expiry of a registered file,
+so a renewal is paid with a plain XES transfer to the storage provider and the extended expiry is kept in the file meta.
+*/
+type (
+	// A XES transfer as read from the receipt of its transaction
+	XesTransfer struct {
+		From   common.Address
+		To     common.Address
+		Amount *big.Int
+		Time   time.Time // Time of the block the transfer was mined in
+	}
+
+	Renewal struct {
+		TxHash common.Hash // XES transfer paying the renewal
+		Days   int
+		Xes    *big.Int
+		Expiry *big.Int // Expiry after the renewal
+	}
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+var (
+	ErrRenewalPaymentNotFound = errors.New("renewal payment not found")
+	ErrInvalidRenewalPayment  = errors.New("renewal payment is no XES transfer from the signer to the storage provider")
+	ErrRenewalAlreadyUsed     = errors.New("renewal payment has been used already")
+	ErrInvalidRenewalDuration = errors.New("renewal has to be at least a day and within the max storage days")
+)
+
+// Extends the expiry of docHash by duration days. The renewal has to be paid by the signer with the XES transfer txHash.
+// The days are added to the current expiry or, if the file expired already, to now.
+func (me *ProxeusFS) Renew(docHash, token, signatureHex, txHash string, duration int) (*big.Int, error) {
+	addr, err := me.Validate(token, signatureHex)
+	if err != nil {
+		return nil, err
+	}
+	access, err := me.hasPermission(docHash, addr, true)
+	if err != nil {
+		return nil, err
+	}
+	if !access {
+		return nil, ErrNoPermission
+	}
+
+	// Serialize renewals so a transfer can't be used twice and concurrent renewals extend each other
+	me.renewLock.Lock()
+	defer me.renewLock.Unlock()
+
+	fileHash := util.StrHexToBytes32(docHash)
+	fileMeta, err := me.fileMetaHandler.Get(fileHash)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	from := now
+	if fileMeta.Expiry != nil && fileMeta.Expiry.Int64() > now {
+		from = fileMeta.Expiry.Int64()
+	}
+	expiry := from + int64(duration)*secondsPerDay
+	if duration < 1 || expiry-now > int64(me.providerInfoService.Get().MaxStorageDays)*secondsPerDay {
+		return nil, ErrInvalidRenewalDuration
+	}
+
+	renewal := Renewal{TxHash: common.HexToHash(txHash), Days: duration, Xes: new(big.Int), Expiry: big.NewInt(expiry)}
+	if config.Config.IsTestMode() {
+		log.Println("SPP running in TESTMODE. Renewal payment won't be verified")
+	} else {
+		transfers, err := me.ethconn.XesTransfers(renewal.TxHash)
+		if err != nil {
+			return nil, err
+		}
+		if renewal.Xes, err = me.renewalPayment(docHash, common.HexToAddress(addr), transfers, duration); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = me.fileMetaHandler.Renew(fileHash, renewal); err != nil {
+		return nil, err
+	}
+	log.Printf("[proxeusFS][Renew] file: %s renewed by %d days until %s, paid with %s",
+		docHash, duration, time.Unix(expiry, 0), renewal.TxHash.Hex())
+	return renewal.Expiry, nil
+}
+
+// Returns the amount of the transfer from the signer to this provider which pays duration days,
+// with the prices effective when the transfer was mined
+func (me *ProxeusFS) renewalPayment(docHash string, signer common.Address, transfers []XesTransfer, duration int) (*big.Int, error) {
+	err := ErrInvalidRenewalPayment
+	for _, transfer := range transfers {
+		if transfer.To != me.spAddress || transfer.From != signer {
+			continue
+		}
+		if err = me.verifyAmount(docHash, transfer.Amount, 0, duration, true, false, transfer.Time); err == nil {
+			return transfer.Amount, nil
+		}
+	}
+	return nil, err
+}
+
+// Returns true if txHash paid for a renewal or a replacement, see replacement.go
+func renewalUsed(fileMetas []*sppFileMeta, txHash common.Hash) bool {
+	for _, fileMeta := range fileMetas {
+		for _, r := range fileMeta.Renewals {
+			if r.TxHash == txHash {
+				return true
+			}
+		}
+		for _, r := range fileMeta.Replacements {
+			if r.TxHash == txHash {
+				return true
+			}
+		}
+	}
+	return false
+}
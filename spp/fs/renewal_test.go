@@ -0,0 +1,162 @@
+package fs
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/util"
+	"github.com/ProxeusApp/storage-app/lib/challenge"
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+// Grants every permission and returns the XES transfers by transaction hash and the given providers for every file
+type fsClientStub struct {
+	transfers map[common.Hash][]XesTransfer
+	providers []SpAddress
+}
+
+func (me *fsClientStub) FileInfo(fileHash [32]byte, readFromCache bool) (FileInfo, error) {
+	return FileInfo{Id: fileHash}, nil
+}
+func (me *fsClientStub) SpInfoForFile(fileHash string) (string, error) { return "http://spp", nil }
+func (me *fsClientStub) StorageProvidersForFile(fileHash string) ([]SpAddress, error) {
+	return me.providers, nil
+}
+func (me *fsClientStub) XesTransfers(txHash common.Hash) ([]XesTransfer, error) {
+	transfers, ok := me.transfers[txHash]
+	if !ok {
+		return nil, ErrRenewalPaymentNotFound
+	}
+	return transfers, nil
+}
+func (me *fsClientStub) HasWriteRights(fileHash [32]byte, addr common.Address, readFromCache bool) (bool, error) {
+	return true, nil
+}
+func (me *fsClientStub) HasReadRights(fileHash [32]byte, addr common.Address, readFromCache bool) (bool, error) {
+	return true, nil
+}
+func (me *fsClientStub) Close() error { return nil }
+
+func TestRenew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "renewal-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	spAddress := common.HexToAddress("0x5C9eDfaaC887552D6b521E38dAA3BFf1f645fD36")
+	paid := common.HexToHash("0x01")
+	underpaid := common.HexToHash("0x02")
+	otherProvider := common.HexToHash("0x04")
+	concurrent := []common.Hash{common.HexToHash("0x05"), common.HexToHash("0x06")}
+	xes20 := new(big.Int).Mul(big.NewInt(20), big.NewInt(1000000000000000000))
+	ethConn := &fsClientStub{transfers: map[common.Hash][]XesTransfer{
+		// the transfer paying the renewal is found among the other transfers of the transaction
+		paid: {
+			{From: owner, To: common.HexToAddress("0x01"), Amount: xes20, Time: time.Now()},
+			{From: owner, To: spAddress, Amount: xes20, Time: time.Now()},
+		},
+		underpaid:     {{From: owner, To: spAddress, Amount: big.NewInt(1), Time: time.Now()}},
+		otherProvider: {{From: owner, To: common.HexToAddress("0x01"), Amount: xes20, Time: time.Now()}},
+		concurrent[0]: {{From: owner, To: spAddress, Amount: new(big.Int).Div(xes20, big.NewInt(2)), Time: time.Now()}},
+		concurrent[1]: {{From: owner, To: spAddress, Amount: new(big.Int).Div(xes20, big.NewInt(2)), Time: time.Now()}},
+	}}
+	auth := challenge.NewAuthenticator(challenge.NewMemoryStore(), time.Minute)
+	info := providerInfoStub{PriceByte: "1", PriceDay: "2", MaxStorageDays: 30}
+	fileMetas := NewFileMetaClientMock(nil)
+	pfs, err := NewProxeusFS(&config.Configuration{StorageDir: dir, StorageProviderAddress: spAddress.String()},
+		ethConn, fileMetas, info, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docHash := "0x822ac138637485893a49980082b5dfbb020c14f20017f4ae69c7f350c06fe8c1"
+	expiry := time.Now().Add(24 * time.Hour).Unix()
+	fileMetas.Save(FileInfo{Id: util.StrHexToBytes32(docHash), Expiry: big.NewInt(expiry), Ownr: owner})
+
+	renew := func(txHash common.Hash, duration int) (*big.Int, error) {
+		msg, err := auth.CreateSignInChallenge()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pfs.Renew(docHash, msg.Token, signChallenge(t, msg.Challenge, key), txHash.Hex(), duration)
+	}
+
+	_, err = renew(common.HexToHash("0x03"), 10)
+	assert.Equal(t, ErrRenewalPaymentNotFound, err)
+	_, err = renew(underpaid, 10)
+	assert.Equal(t, ErrPaymentDoesNotMatch, err)
+	_, err = renew(otherProvider, 10)
+	assert.Equal(t, ErrInvalidRenewalPayment, err)
+	_, err = renew(paid, 30)
+	assert.Equal(t, ErrInvalidRenewalDuration, err)
+
+	// 10 days * 2 XES are added to the current expiry
+	newExpiry, err := renew(paid, 10)
+	if assert.NoError(t, err) {
+		assert.Equal(t, expiry+10*secondsPerDay, newExpiry.Int64())
+	}
+	_, err = renew(paid, 10)
+	assert.Equal(t, ErrRenewalAlreadyUsed, err)
+
+	// concurrent renewals of 5 days both extend the expiry
+	var wg sync.WaitGroup
+	for _, txHash := range concurrent {
+		wg.Add(1)
+		go func(txHash common.Hash) {
+			defer wg.Done()
+			_, err := renew(txHash, 5)
+			assert.NoError(t, err)
+		}(txHash)
+	}
+	wg.Wait()
+	fileMeta, err := fileMetas.Get(util.StrHexToBytes32(docHash))
+	if assert.NoError(t, err) {
+		assert.Equal(t, expiry+20*secondsPerDay, fileMeta.Expiry.Int64())
+		newExpiry = fileMeta.Expiry
+	}
+
+	// the renewed expiry is kept over the one registered in the smart contract
+	fileMetas.Save(FileInfo{Id: util.StrHexToBytes32(docHash), Expiry: big.NewInt(expiry)})
+	fileMeta, err = fileMetas.Get(util.StrHexToBytes32(docHash))
+	if assert.NoError(t, err) {
+		assert.Equal(t, newExpiry, fileMeta.Expiry)
+	}
+	// nor replaced by an unknown one
+	fileMetas.Save(FileInfo{Id: util.StrHexToBytes32(docHash)})
+	fileMeta, err = fileMetas.Get(util.StrHexToBytes32(docHash))
+	if assert.NoError(t, err) {
+		assert.Equal(t, newExpiry, fileMeta.Expiry)
+	}
+}
+
+// Signs the challenge like eth_sign does
+func signChallenge(t *testing.T, challengeHex string, key *ecdsa.PrivateKey) string {
+	challengeBytes, err := hex.DecodeString(challengeHex[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := crypto.Keccak256(append([]byte("\x19Ethereum Signed Message:\n"+strconv.Itoa(len(challengeBytes))), challengeBytes...))
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	return "0x" + hex.EncodeToString(sig)
+}
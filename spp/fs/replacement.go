@@ -0,0 +1,115 @@
+package fs
+
+import (
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/util"
+)
+
+/**
+Uploading the archive of a stored file again, like when it is re-encrypted for a new share, is charged the replacement
+fee of the provider. Like a renewal it is paid with a plain XES transfer to the storage provider, the upload session
+names the transaction. A transfer pays for one archive only, uploading the same archive again doesn't need a new one.
+*/
+type Replacement struct {
+	TxHash common.Hash // XES transfer paying the replacement fee
+	Xes    *big.Int
+	Digest string // SHA-256 of the archive paid for
+}
+
+var (
+	ErrReplacementFeeNotFound    = errors.New("replacement fee payment not found")
+	ErrInvalidReplacementFee     = errors.New("replacement fee is no XES transfer from the uploader to the storage provider")
+	ErrReplacementFeeAlreadyUsed = errors.New("replacement fee payment has been used already")
+)
+
+// Checks that sess paid the replacement fee for the archive with digest and marks its transfer as used
+func (me *ProxeusFS) payReplacement(sess *UploadSession, digest string) error {
+	replacement := Replacement{Xes: new(big.Int), Digest: digest}
+	if sess.FeeTx == "" {
+		fee, err := me.replacementFee(time.Now())
+		if err != nil || fee.Sign() == 0 {
+			return err
+		}
+		log.Printf("[proxeusFS][payReplacement] replacement of file %s by %s isn't paid", sess.FileHash, sess.Address)
+		return ErrInvalidReplacementFee
+	}
+	replacement.TxHash = common.HexToHash(sess.FeeTx)
+	transfers, err := me.ethconn.XesTransfers(replacement.TxHash)
+	if err == ErrRenewalPaymentNotFound {
+		// not confirmed yet
+		return ErrReplacementFeeNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	err = ErrInvalidReplacementFee
+	for _, transfer := range transfers {
+		if transfer.To != me.spAddress || !strings.EqualFold(transfer.From.Hex(), sess.Address) {
+			continue
+		}
+		var fee *big.Int
+		if fee, err = me.replacementFee(transfer.Time); err != nil {
+			return err
+		}
+		if transfer.Amount.Cmp(fee) == 0 {
+			replacement.Xes = transfer.Amount
+			err = nil
+			break
+		}
+		log.Printf("[proxeusFS][payReplacement] file: %s | expectedXes: %d | receivedXes: %d | paidAt: %s",
+			sess.FileHash, fee, transfer.Amount, transfer.Time)
+		err = ErrPaymentDoesNotMatch
+	}
+	if err != nil {
+		return err
+	}
+
+	// Serialized with renewals, a transfer can't pay for both
+	me.renewLock.Lock()
+	defer me.renewLock.Unlock()
+	return me.fileMetaHandler.Replace(util.StrHexToBytes32(sess.FileHash), replacement)
+}
+
+// Returns the replacement fee with the price schedule effective at paidAt, the current one if it isn't kept anymore
+func (me *ProxeusFS) replacementFee(paidAt time.Time) (*big.Int, error) {
+	info := me.providerInfoService.Get()
+	if schedule, ok := me.providerInfoService.PriceScheduleAt(paidAt); ok {
+		info = schedule.ProviderInfo()
+	}
+	breakdown, err := info.ReplacementPriceBreakdown()
+	if err != nil {
+		return nil, err
+	}
+	return breakdown.Total, nil
+}
+
+// Returns true if txHash paid for a renewal or for another archive than digest of fileHash,
+// paid is true if it paid for that archive already
+func replacementUsed(fileMetas []*sppFileMeta, txHash, fileHash common.Hash, digest string) (used, paid bool) {
+	for _, fileMeta := range fileMetas {
+		for _, r := range fileMeta.Replacements {
+			if r.TxHash != txHash {
+				continue
+			}
+			if fileMeta.FileHash == fileHash && r.Digest == digest {
+				paid = true
+			} else {
+				used = true
+			}
+		}
+		for _, r := range fileMeta.Renewals {
+			if r.TxHash == txHash {
+				used = true
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,77 @@
+package fs
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/util"
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+func TestPayReplacement(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replacement-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	owner := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	spAddress := common.HexToAddress("0x5C9eDfaaC887552D6b521E38dAA3BFf1f645fD36")
+	paid := common.HexToHash("0x01")
+	underpaid := common.HexToHash("0x02")
+	otherSender := common.HexToHash("0x03")
+	xes3 := new(big.Int).Mul(big.NewInt(3), big.NewInt(1000000000000000000))
+	ethConn := &fsClientStub{transfers: map[common.Hash][]XesTransfer{
+		paid:        {{From: owner, To: spAddress, Amount: xes3, Time: time.Now()}},
+		underpaid:   {{From: owner, To: spAddress, Amount: big.NewInt(1), Time: time.Now()}},
+		otherSender: {{From: common.HexToAddress("0x01"), To: spAddress, Amount: xes3, Time: time.Now()}},
+	}}
+	info := providerInfoStub{PriceByte: "1", PriceDay: "2", MaxStorageDays: 30, ReplacementFee: "3"}
+	fileMetas := NewFileMetaClientMock(nil)
+	pfs, err := NewProxeusFS(&config.Configuration{StorageDir: dir, StorageProviderAddress: spAddress.String()},
+		ethConn, fileMetas, info, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docHash := "0x822ac138637485893a49980082b5dfbb020c14f20017f4ae69c7f350c06fe8c1"
+	otherDocHash := "0x922ac138637485893a49980082b5dfbb020c14f20017f4ae69c7f350c06fe8c1"
+	for _, h := range []string{docHash, otherDocHash} {
+		fileMetas.Save(FileInfo{Id: util.StrHexToBytes32(h), Expiry: big.NewInt(2000000000), Ownr: owner})
+	}
+	replace := func(docHash string, feeTx common.Hash, digest string) error {
+		sess := &UploadSession{FileHash: docHash, Address: owner.Hex()}
+		if feeTx != (common.Hash{}) {
+			sess.FeeTx = feeTx.Hex()
+		}
+		return pfs.payReplacement(sess, digest)
+	}
+
+	assert.Equal(t, ErrInvalidReplacementFee, replace(docHash, common.Hash{}, "a"))
+	assert.Equal(t, ErrReplacementFeeNotFound, replace(docHash, common.HexToHash("0x04"), "a"))
+	assert.Equal(t, ErrPaymentDoesNotMatch, replace(docHash, underpaid, "a"))
+	assert.Equal(t, ErrInvalidReplacementFee, replace(docHash, otherSender, "a"))
+
+	assert.NoError(t, replace(docHash, paid, "a"))
+	// uploading the same archive again doesn't need a new payment, another archive or file does
+	assert.NoError(t, replace(docHash, paid, "a"))
+	assert.Equal(t, ErrReplacementFeeAlreadyUsed, replace(docHash, paid, "b"))
+	assert.Equal(t, ErrReplacementFeeAlreadyUsed, replace(otherDocHash, paid, "a"))
+	fileMeta, err := fileMetas.Get(util.StrHexToBytes32(docHash))
+	if assert.NoError(t, err) && assert.Len(t, fileMeta.Replacements, 1) {
+		assert.Equal(t, paid, fileMeta.Replacements[0].TxHash)
+		assert.Equal(t, xes3, fileMeta.Replacements[0].Xes)
+	}
+	// the transfer can't pay for a renewal either
+	assert.Equal(t, ErrRenewalAlreadyUsed, fileMetas.Renew(util.StrHexToBytes32(docHash), Renewal{TxHash: paid}))
+
+	// replacements are free without a replacement fee
+	pfs.providerInfoService = providerInfoStub{PriceByte: "1", PriceDay: "2", MaxStorageDays: 30}
+	assert.NoError(t, replace(docHash, common.Hash{}, "c"))
+}
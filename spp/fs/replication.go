@@ -0,0 +1,295 @@
+package fs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/ProxeusApp/storage-app/lib/wallet"
+	"github.com/ProxeusApp/storage-app/spp/client"
+	"github.com/ProxeusApp/storage-app/spp/metrics"
+)
+
+/**
+Files can be registered with several storage providers while the client uploads the archive to one of them only.
+The provider receiving the upload pushes the archive to its peers listed for the same file in the smart contract.
+
+A replica is pushed through the same upload sessions as a client upload, signed in with the key of the pushing provider.
+The peer accepts it if the pushing provider is listed for the file and the archive matches the digest it announced.
+Every provider of a file is paid the same amount by the smart contract, the price of the most expensive provider,
+so a payment above the own price is accepted for such files.
+
+Pending replications are kept in <StorageDir>/replications and retried with a backoff until all peers hold the archive.
+*/
+type ReplicationJob struct {
+	FileHash   string      `json:"fileHash"`
+	Duration   int         `json:"duration"`
+	Peers      []SpAddress `json:"peers"`
+	Replicated []string    `json:"replicated,omitempty"` // Addresses of the peers holding the archive
+	Tries      int         `json:"tries"`
+	NextTry    time.Time   `json:"nextTry"`
+	CreatedAt  time.Time   `json:"createdAt"`
+}
+
+const (
+	replicationsFolderName = "replications"
+	maxReplicationTries    = 10
+	replicationBackoff     = time.Minute
+	maxReplicationBackoff  = 6 * time.Hour
+	replicationTimeout     = time.Hour
+)
+
+var (
+	ErrReplicaDigestMismatch = errors.New("replica does not match the announced digest")
+	ErrReplicaAlreadyStored  = errors.New("replica is already stored")
+	ErrInvalidReplica        = errors.New("replica needs a size and a digest")
+	ErrInvalidProviderKey    = errors.New("provider key doesn't belong to the storage provider address")
+)
+
+// Sets the key of the storage provider address, archives are only replicated to peers with a key set
+func (me *ProxeusFS) SetProviderKey(key *ecdsa.PrivateKey) error {
+	if key != nil && crypto.PubkeyToAddress(key.PublicKey) != me.spAddress {
+		return ErrInvalidProviderKey
+	}
+	me.providerKey = key
+	return nil
+}
+
+// Creates an upload session for a replica pushed by a peer provider of the file.
+// ErrReplicaAlreadyStored is returned if the archive with digest is stored already.
+func (me *ProxeusFS) CreateReplicaSession(docHash, token, signatureHex string, duration int, size int64, digest string) (*UploadSession, error) {
+	if me.ReadOnly() {
+		return nil, ErrReadOnly
+	}
+	addr, err := me.Validate(token, signatureHex)
+	if err != nil {
+		return nil, err
+	}
+	if size <= 0 || digest == "" {
+		return nil, ErrInvalidReplica
+	}
+	if err = me.checkReplicaPeer(docHash, addr); err != nil {
+		return nil, err
+	}
+	if max := me.providerInfoService.Get().MaxFileSizeByte; max > 0 && size > max {
+		return nil, ErrUploadTooLarge
+	}
+	if _, err = me.blobs.Stat(docHash); err == nil {
+		if stored, err := me.ArchiveDigest(docHash); err == nil && strings.EqualFold(stored, digest) {
+			return nil, ErrReplicaAlreadyStored
+		}
+	}
+	return me.createUploadSession(docHash, addr, duration, size, true, strings.ToLower(digest), "")
+}
+
+// Replicas are only accepted from another provider of the file and only if this provider is listed too
+func (me *ProxeusFS) checkReplicaPeer(docHash, addr string) error {
+	providers, err := me.ethconn.StorageProvidersForFile(docHash)
+	if err != nil {
+		return err
+	}
+	var self, peer bool
+	for _, p := range providers {
+		switch common.HexToAddress(p.Address) {
+		case me.spAddress:
+			self = true
+		case common.HexToAddress(addr):
+			peer = true
+		}
+	}
+	if !self || !peer {
+		log.Printf("[proxeusFS][checkReplicaPeer] replica of file %s from %s denied, provider listed: %t, peer listed: %t", docHash, addr, self, peer)
+		return ErrNoPermission
+	}
+	return nil
+}
+
+// Returns the other providers the file is registered with
+func (me *ProxeusFS) replicationPeers(docHash string) ([]SpAddress, error) {
+	providers, err := me.ethconn.StorageProvidersForFile(docHash)
+	if err != nil {
+		return nil, err
+	}
+	var peers []SpAddress
+	for _, p := range providers {
+		if common.HexToAddress(p.Address) != me.spAddress {
+			peers = append(peers, p)
+		}
+	}
+	return peers, nil
+}
+
+func (me *ProxeusFS) enqueueReplication(docHash string, duration int, peers []SpAddress) {
+	if len(peers) == 0 {
+		return
+	}
+	if me.providerKey == nil {
+		log.Printf("[proxeusFS][enqueueReplication] no provider key set, file %s won't be replicated to %d peers", docHash, len(peers))
+		return
+	}
+	job := &ReplicationJob{FileHash: docHash, Duration: duration, Peers: peers, CreatedAt: time.Now()}
+	if err := me.putReplicationJob(job); err != nil {
+		log.Printf("[proxeusFS][enqueueReplication] couldn't enqueue replication of file %s: %v", docHash, err)
+	}
+}
+
+// Pushes the archives of the due replication jobs to the peers not holding them yet.
+// Only one run is active at a time, further calls return right away.
+func (me *ProxeusFS) ReplicatePending() {
+	if me.providerKey == nil || !atomic.CompareAndSwapInt32(&me.replicating, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&me.replicating, 0)
+
+	jobs, err := me.replicationJobs()
+	if err != nil {
+		log.Println("[proxeusFS][ReplicatePending] couldn't list replication jobs: ", err)
+		return
+	}
+	for _, job := range jobs {
+		if time.Now().Before(job.NextTry) {
+			continue
+		}
+		me.runReplication(job)
+	}
+}
+
+func (me *ProxeusFS) runReplication(job *ReplicationJob) {
+	pending := 0
+	for _, peer := range job.Peers {
+		if job.replicatedTo(peer.Address) {
+			continue
+		}
+		if err := me.replicate(job, peer); err != nil {
+			log.Printf("[proxeusFS][runReplication] try %d: replication of file %s to %s failed: %v", job.Tries+1, job.FileHash, peer.Url, err)
+			pending++
+			continue
+		}
+		log.Printf("[proxeusFS][runReplication] replicated file %s to %s", job.FileHash, peer.Url)
+		metrics.Replications.WithLabelValues(metrics.ReplicationSucceeded).Inc()
+		job.Replicated = append(job.Replicated, peer.Address)
+	}
+
+	job.Tries++
+	if pending == 0 || job.Tries >= maxReplicationTries {
+		if pending > 0 {
+			log.Printf("[proxeusFS][runReplication] giving up replication of file %s to %d peers after %d tries", job.FileHash, pending, job.Tries)
+			metrics.Replications.WithLabelValues(metrics.ReplicationFailed).Add(float64(pending))
+		}
+		me.removeReplicationJob(job.FileHash)
+		return
+	}
+	backoff := replicationBackoff << uint(job.Tries-1)
+	if backoff > maxReplicationBackoff {
+		backoff = maxReplicationBackoff
+	}
+	job.NextTry = time.Now().Add(backoff)
+	if err := me.putReplicationJob(job); err != nil {
+		log.Printf("[proxeusFS][runReplication] couldn't save replication of file %s: %v", job.FileHash, err)
+	}
+}
+
+func (me *ProxeusFS) replicate(job *ReplicationJob, peer SpAddress) error {
+	r, err := client.Challenge(peer.Url)
+	if err != nil {
+		return err
+	}
+	bts, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return err
+	}
+	msg := SignMsg{}
+	if err = json.Unmarshal(bts, &msg); err != nil {
+		return err
+	}
+	signature, err := wallet.SignInChallenge(msg.Challenge, me.providerKey)
+	if err != nil {
+		return err
+	}
+
+	digest, err := me.ArchiveDigest(job.FileHash)
+	if err != nil {
+		return err
+	}
+	blob, info, err := me.blobs.Get(job.FileHash)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), replicationTimeout)
+	defer cancel()
+	return client.Replicate(ctx, peer.Url, job.FileHash, msg.Token, signature, digest, blob, info.Size, job.Duration)
+}
+
+func (me *ReplicationJob) replicatedTo(address string) bool {
+	for _, a := range me.Replicated {
+		if strings.EqualFold(a, address) {
+			return true
+		}
+	}
+	return false
+}
+
+func (me *ProxeusFS) replicationsPath() string {
+	return filepath.Join(me.basePath, replicationsFolderName)
+}
+
+func (me *ProxeusFS) replicationJobPath(docHash string) string {
+	return filepath.Join(me.replicationsPath(), filepath.Base(docHash)+".json")
+}
+
+func (me *ProxeusFS) putReplicationJob(job *ReplicationJob) error {
+	if err := os.MkdirAll(me.replicationsPath(), 0700); err != nil {
+		return err
+	}
+	bts, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	tmp := me.replicationJobPath(job.FileHash) + downloadingSuffix
+	if err = ioutil.WriteFile(tmp, bts, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, me.replicationJobPath(job.FileHash))
+}
+
+func (me *ProxeusFS) replicationJobs() ([]*ReplicationJob, error) {
+	matches, err := filepath.Glob(filepath.Join(me.replicationsPath(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*ReplicationJob
+	for _, m := range matches {
+		bts, err := ioutil.ReadFile(m)
+		if err != nil {
+			log.Println("[proxeusFS][replicationJobs] skipping replication job ", m, err)
+			continue
+		}
+		job := &ReplicationJob{}
+		if err = json.Unmarshal(bts, job); err != nil {
+			log.Println("[proxeusFS][replicationJobs] skipping replication job ", m, err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (me *ProxeusFS) removeReplicationJob(docHash string) {
+	if err := os.Remove(me.replicationJobPath(docHash)); err != nil && !os.IsNotExist(err) {
+		log.Println("[proxeusFS][removeReplicationJob] ", err)
+	}
+}
@@ -0,0 +1,100 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/lib/challenge"
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+func TestReplication(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replication-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	selfKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	strangerKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := crypto.PubkeyToAddress(selfKey.PublicKey)
+	peer := crypto.PubkeyToAddress(peerKey.PublicKey)
+	ethConn := &fsClientStub{providers: []SpAddress{
+		{Address: self.Hex(), Url: "http://127.0.0.1:1"},
+		{Address: peer.Hex(), Url: "http://127.0.0.1:1"},
+	}}
+	auth := challenge.NewAuthenticator(challenge.NewMemoryStore(), time.Minute)
+	pfs, err := NewProxeusFS(&config.Configuration{StorageDir: dir, StorageProviderAddress: self.Hex()},
+		ethConn, NewFileMetaClientMock(nil), providerInfoStub{}, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docHash := "0x822ac138637485893a49980082b5dfbb020c14f20017f4ae69c7f350c06fe8c1"
+	archive := []byte("archive")
+	digest, err := readerDigest(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	createReplica := func(key *ecdsa.PrivateKey, size int64, digest string) (*UploadSession, error) {
+		msg, err := auth.CreateSignInChallenge()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pfs.CreateReplicaSession(docHash, msg.Token, signChallenge(t, msg.Challenge, key), 10, size, digest)
+	}
+
+	_, err = createReplica(strangerKey, int64(len(archive)), digest)
+	assert.Equal(t, ErrNoPermission, err)
+	_, err = createReplica(peerKey, 0, digest)
+	assert.Equal(t, ErrInvalidReplica, err)
+
+	// an archive not matching the announced digest is rejected
+	sess, err := createReplica(peerKey, int64(len(archive)), digest)
+	if assert.NoError(t, err) {
+		assert.True(t, sess.Replica)
+		_, err = pfs.WriteUploadChunk(sess.ID, sess.Token, 0, bytes.NewReader([]byte("archivX")))
+		assert.NoError(t, err)
+		_, err = pfs.FinalizeUpload(sess.ID, sess.Token)
+		assert.Equal(t, ErrReplicaDigestMismatch, err)
+	}
+
+	if err = pfs.BlobStore().Put(docHash, bytes.NewReader(archive), int64(len(archive))); err != nil {
+		t.Fatal(err)
+	}
+	_, err = createReplica(peerKey, int64(len(archive)), digest)
+	assert.Equal(t, ErrReplicaAlreadyStored, err)
+
+	// pushing to an unreachable peer is retried later
+	assert.Equal(t, ErrInvalidProviderKey, pfs.SetProviderKey(peerKey))
+	assert.NoError(t, pfs.SetProviderKey(selfKey))
+	peers, err := pfs.replicationPeers(docHash)
+	if assert.NoError(t, err) && assert.Len(t, peers, 1) {
+		assert.Equal(t, peer.Hex(), peers[0].Address)
+	}
+	pfs.enqueueReplication(docHash, 10, peers)
+	pfs.ReplicatePending()
+	jobs, err := pfs.replicationJobs()
+	if assert.NoError(t, err) && assert.Len(t, jobs, 1) {
+		assert.Equal(t, 1, jobs[0].Tries)
+		assert.Empty(t, jobs[0].Replicated)
+		assert.True(t, jobs[0].NextTry.After(time.Now()))
+	}
+}
@@ -0,0 +1,284 @@
+package fs
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProxeusApp/storage-app/spp/metrics"
+)
+
+/**
+The sweeper removes the files expired longer than the grace period ago on a schedule, either daily at a time of day
+or at a fixed interval. A sweep removes at most batchSize files, the remaining ones are removed by follow-up sweeps a
+minute apart. In dry-run mode the sweeper only reports what it would remove.
+
+Every removal is recorded in the audit log.
+*/
+type (
+	Sweeper struct {
+		pfs       *ProxeusFS
+		schedule  SweepSchedule
+		batchSize int
+		dryRun    bool
+		stop      chan bool
+		lock      sync.Mutex
+		next      time.Time
+		last      *SweepReport
+		started   time.Time
+		succeeded time.Time // End of the last sweep which didn't fail
+	}
+
+	// Runs daily at Hour:Minute local time or, if Interval is set, every Interval
+	SweepSchedule struct {
+		Interval time.Duration
+		Hour     int
+		Minute   int
+	}
+
+	SweepReport struct {
+		DryRun    bool         `json:"dryRun"`
+		Started   time.Time    `json:"started"`
+		Finished  time.Time    `json:"finished"`
+		Files     []string     `json:"files"`     // Removed files, or the ones which would be removed in a dry run
+		Entries   []AuditEntry `json:"entries"`   // Details of Files
+		Remaining bool         `json:"remaining"` // The batch size was reached before all expired files were removed
+	}
+
+	SweeperStatus struct {
+		Schedule  string       `json:"schedule"`
+		BatchSize int          `json:"batchSize"`
+		DryRun    bool         `json:"dryRun"`
+		Next      time.Time    `json:"next"`
+		Last      *SweepReport `json:"last"`
+	}
+)
+
+// Pause between sweeps removing what was left over by the batch size
+const sweepBatchPause = time.Minute
+
+var ErrInvalidSweepSchedule = errors.New("sweep schedule has to be a time of day (HH:MM) or an interval (e.g. 6h)")
+
+// Parses a daily time of day like "02:00" or an interval like "6h"
+func ParseSweepSchedule(s string) (SweepSchedule, error) {
+	if strings.Contains(s, ":") {
+		t, err := time.Parse("15:04", s)
+		if err != nil {
+			return SweepSchedule{}, ErrInvalidSweepSchedule
+		}
+		return SweepSchedule{Hour: t.Hour(), Minute: t.Minute()}, nil
+	}
+	interval, err := time.ParseDuration(s)
+	if err != nil || interval < time.Minute {
+		return SweepSchedule{}, ErrInvalidSweepSchedule
+	}
+	return SweepSchedule{Interval: interval}, nil
+}
+
+// Returns the first run after t
+func (me SweepSchedule) Next(t time.Time) time.Time {
+	if me.Interval > 0 {
+		return t.Add(me.Interval)
+	}
+	next := time.Date(t.Year(), t.Month(), t.Day(), me.Hour, me.Minute, 0, 0, t.Location())
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (me SweepSchedule) String() string {
+	if me.Interval > 0 {
+		return me.Interval.String()
+	}
+	return time.Date(0, 1, 1, me.Hour, me.Minute, 0, 0, time.Local).Format("15:04")
+}
+
+// batchSize 0 removes all expired files in one sweep
+func NewSweeper(pfs *ProxeusFS, schedule SweepSchedule, batchSize int, dryRun bool) *Sweeper {
+	return &Sweeper{pfs: pfs, schedule: schedule, batchSize: batchSize, dryRun: dryRun}
+}
+
+func (me *Sweeper) Start() {
+	me.lock.Lock()
+	me.stop = make(chan bool)
+	me.started = time.Now()
+	me.next = me.schedule.Next(me.started)
+	me.lock.Unlock()
+	log.Printf("[Sweeper][Start] schedule: %s | batch size: %d | dry run: %t | next sweep: %s", me.schedule, me.batchSize, me.dryRun, me.next)
+
+	go func() {
+		for {
+			me.lock.Lock()
+			wait := time.Until(me.next)
+			me.lock.Unlock()
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+				me.Sweep()
+			case <-me.stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (me *Sweeper) Stop() {
+	if me.stop != nil {
+		close(me.stop)
+	}
+}
+
+// Runs a sweep with the configured batch size and dry-run mode and schedules the next one
+func (me *Sweeper) Sweep() {
+	report, err := me.pfs.RemoveExpiredFiles(me.dryRun, me.batchSize)
+
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	now := time.Now()
+	me.next = me.schedule.Next(now)
+	if err != nil {
+		log.Println("[Sweeper][Sweep] sweep failed: ", err)
+		return
+	}
+	me.last = report
+	me.succeeded = now
+	if report.DryRun {
+		log.Printf("[Sweeper][Sweep] dry run, %d expired files would be removed: %v", len(report.Files), report.Files)
+	}
+	if report.Remaining && !report.DryRun && now.Add(sweepBatchPause).Before(me.next) {
+		me.next = now.Add(sweepBatchPause)
+	}
+}
+
+func (me *Sweeper) Status() SweeperStatus {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	return SweeperStatus{
+		Schedule:  me.schedule.String(),
+		BatchSize: me.batchSize,
+		DryRun:    me.dryRun,
+		Next:      me.next,
+		Last:      me.last,
+	}
+}
+
+// Returns the time since the last successful sweep, or since the start before the first one
+func (me *Sweeper) SinceSuccess() time.Duration {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	if me.succeeded.IsZero() {
+		return time.Since(me.started)
+	}
+	return time.Since(me.succeeded)
+}
+
+func (me *ProxeusFS) CheckForExpiredFiles() {
+	me.RemoveExpiredFiles(false, 0)
+}
+
+// Removes up to batchSize of the files expired longer than the grace period ago, 0 removes all of them.
+// The expiry is double checked with the smart contract before a file is removed. With dryRun the files are only reported.
+func (me *ProxeusFS) RemoveExpiredFiles(dryRun bool, batchSize int) (*SweepReport, error) {
+	report := &SweepReport{DryRun: dryRun, Started: time.Now(), Files: []string{}, Entries: []AuditEntry{}}
+	log.Println("CheckForExpiredFiles...")
+
+	fileMetas, err := me.fileMetaHandler.All()
+	if err != nil {
+		return nil, err
+	}
+
+	now := report.Started.Unix()
+	gracePeriod := int64(me.providerInfoService.Get().GraceSeconds)
+
+	for _, fileMeta := range fileMetas {
+		if fileMeta.Expiry == nil {
+			// the digest or Merkle root of an archive can be saved before its expiry is known
+			fileInfo, err := me.ethconn.FileInfo(fileMeta.FileHash, false)
+			if err != nil || fileInfo.Expiry == nil {
+				log.Println("CheckForExpiredFiles: no expiry saved and none read from the smart contract, skipping ", fileMeta.FileHash.Hex(), err)
+				continue
+			}
+			if !dryRun {
+				me.fileMetaHandler.Save(fileInfo)
+			}
+			withExpiry := *fileMeta
+			withExpiry.Expiry = fileInfo.Expiry
+			fileMeta = &withExpiry
+		}
+		expiryWithGrace := fileMeta.Expiry.Int64() + gracePeriod
+
+		if expiryWithGrace > now {
+			continue
+		}
+		if !dryRun && batchSize > 0 && len(report.Files) >= batchSize {
+			report.Remaining = true
+			break
+		}
+
+		log.Println("CheckForExpiredFiles: Expired, would remove, double check expiry from smart contract...", fileMeta.FileHash.Hex())
+		fileInfo, err := me.ethconn.FileInfo(fileMeta.FileHash, false)
+		if err != nil {
+			log.Println("CheckForExpiredFiles: error while double checking expiry date ", err)
+			continue
+		}
+
+		if fileMeta.Expiry.Int64() != fileInfo.Expiry.Int64() {
+			log.Printf("CheckForExpiredFiles: saved expiry date not identical with smart contract! Saved: %d, Smart contract: %d, FileHash: %s", fileMeta.Expiry.Int64(), fileInfo.Expiry.Int64(), fileMeta.FileHash.Hex())
+			expiryWithGrace = fileInfo.Expiry.Int64() + gracePeriod
+
+			// Check if expiry date from smart contract still is old enough to be removed, otherwise update file meta
+			if expiryWithGrace > now {
+				// Update spp file meta
+				if !dryRun {
+					me.fileMetaHandler.Save(fileInfo)
+				}
+				continue
+			}
+		}
+
+		entry := AuditEntry{
+			FileHash:     fileMeta.FileHash.Hex(),
+			Reason:       AuditReasonExpired,
+			Expiry:       fileMeta.Expiry.Int64(),
+			GraceSeconds: gracePeriod,
+			ChainExpiry:  fileInfo.Expiry.Int64(),
+		}
+		if dryRun {
+			report.Files = append(report.Files, entry.FileHash)
+			report.Entries = append(report.Entries, entry)
+			continue
+		}
+
+		log.Println("CheckForExpiredFiles: actually remove... ", fileMeta.FileHash.Hex())
+		err = me.removeFileFromDisk(fileMeta.FileHash.Hex())
+		if err != nil {
+			log.Println("CheckForExpiredFiles: error while remove file from disk ", err)
+			if !os.IsNotExist(err) {
+				continue
+			}
+		}
+		// If no error occurred during remove file from disk or file didn't exist, remove meta information
+		me.fileMetaHandler.Remove(fileMeta.FileHash)
+		metrics.FilesRemoved.WithLabelValues(metrics.RemovedExpired).Inc()
+		entry.Time = time.Now()
+		if err = me.audit.Record(entry); err != nil {
+			log.Println("CheckForExpiredFiles: couldn't record removal in the audit log ", err)
+		}
+		report.Files = append(report.Files, entry.FileHash)
+		report.Entries = append(report.Entries, entry)
+	}
+
+	if !dryRun {
+		me.removeStaleUploadSessions()
+	}
+
+	report.Finished = time.Now()
+	log.Println("...CheckForExpiredFiles took ", report.Finished.Sub(report.Started))
+	return report, nil
+}
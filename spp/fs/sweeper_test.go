@@ -0,0 +1,151 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/dapp/core/util"
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+func TestSweepSchedule(t *testing.T) {
+	now := time.Date(2020, 3, 1, 10, 30, 0, 0, time.Local)
+
+	daily, err := ParseSweepSchedule("02:00")
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Date(2020, 3, 2, 2, 0, 0, 0, time.Local), daily.Next(now))
+		assert.Equal(t, "02:00", daily.String())
+	}
+	later, err := ParseSweepSchedule("23:15")
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Date(2020, 3, 1, 23, 15, 0, 0, time.Local), later.Next(now))
+	}
+	interval, err := ParseSweepSchedule("6h")
+	if assert.NoError(t, err) {
+		assert.Equal(t, now.Add(6*time.Hour), interval.Next(now))
+	}
+
+	for _, invalid := range []string{"25:00", "1s", "daily", ""} {
+		_, err = ParseSweepSchedule(invalid)
+		assert.Equal(t, ErrInvalidSweepSchedule, err, invalid)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	audit := NewAuditLog(dir)
+	entries, err := audit.Entries(AuditFilter{})
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	start := time.Now().Add(-time.Hour)
+	assert.NoError(t, audit.Record(AuditEntry{Time: start, FileHash: "0x01", Reason: AuditReasonExpired, Expiry: 1, GraceSeconds: 2, ChainExpiry: 1}))
+	assert.NoError(t, audit.Record(AuditEntry{FileHash: "0x02", Reason: AuditReasonAdmin, Operator: "0xop"}))
+	assert.NoError(t, audit.Record(AuditEntry{FileHash: "0x03", Reason: AuditReasonContractDeleted, Block: 7}))
+
+	entries, err = audit.Entries(AuditFilter{})
+	if assert.NoError(t, err) && assert.Len(t, entries, 3) {
+		assert.Equal(t, int64(2), entries[0].GraceSeconds)
+		assert.False(t, entries[1].Time.IsZero())
+	}
+	entries, err = audit.Entries(AuditFilter{Reason: AuditReasonAdmin})
+	if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+		assert.Equal(t, "0xop", entries[0].Operator)
+	}
+	entries, err = audit.Entries(AuditFilter{Since: start.Add(time.Minute), Limit: 1})
+	if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+		assert.Equal(t, "0x03", entries[0].FileHash)
+	}
+	entries, err = audit.Entries(AuditFilter{Until: start.Add(time.Minute)})
+	if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+		assert.Equal(t, "0x01", entries[0].FileHash)
+	}
+}
+
+// Returns the expiry for every file, fails while it is nil
+type expiryStub struct {
+	fsClientStub
+	expiry *big.Int
+}
+
+func (me *expiryStub) FileInfo(fileHash [32]byte, readFromCache bool) (FileInfo, error) {
+	if me.expiry == nil {
+		return FileInfo{}, errors.New("node unavailable")
+	}
+	return FileInfo{Id: fileHash, Expiry: me.expiry}, nil
+}
+
+func TestSweepReadsUnknownExpiry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sweep-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ethConn := &expiryStub{}
+	fileMetas := NewFileMetaClientMock(nil)
+	pfs, err := NewProxeusFS(&config.Configuration{StorageDir: dir}, ethConn, fileMetas, providerInfoStub{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the digest and Merkle root create a file meta without expiry
+	hash := "0x822ac138637485893a49980082b5dfbb020c14f20017f4ae69c7f350c06fe8c1"
+	assert.NoError(t, fileMetas.SaveDigest(util.StrHexToBytes32(hash), "digest"))
+	assert.NoError(t, fileMetas.SaveMerkleRoot(util.StrHexToBytes32(hash), "root"))
+	if err = pfs.BlobStore().Put(hash, bytes.NewReader([]byte{1}), 1); err != nil {
+		t.Fatal(err)
+	}
+	expiry := func() *big.Int {
+		fileMeta, err := fileMetas.Get(util.StrHexToBytes32(hash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fileMeta.Expiry
+	}
+
+	// the file is kept while the expiry can't be read from the smart contract
+	report, err := pfs.RemoveExpiredFiles(false, 0)
+	if assert.NoError(t, err) {
+		assert.Empty(t, report.Files)
+	}
+	assert.Nil(t, expiry())
+
+	// the expiry read is saved, a dry run only reports
+	ethConn.expiry = big.NewInt(time.Now().Add(time.Hour).Unix())
+	report, err = pfs.RemoveExpiredFiles(true, 0)
+	if assert.NoError(t, err) {
+		assert.Empty(t, report.Files)
+	}
+	assert.Nil(t, expiry())
+	report, err = pfs.RemoveExpiredFiles(false, 0)
+	if assert.NoError(t, err) {
+		assert.Empty(t, report.Files)
+	}
+	assert.Equal(t, ethConn.expiry, expiry())
+
+	// once it expired the file is removed
+	fileMetas.Remove(util.StrHexToBytes32(hash))
+	assert.NoError(t, fileMetas.SaveDigest(util.StrHexToBytes32(hash), "digest"))
+	ethConn.expiry = big.NewInt(time.Now().Add(-time.Hour).Unix())
+	report, err = pfs.RemoveExpiredFiles(false, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{hash}, report.Files)
+	}
+	files, err := pfs.Files()
+	if assert.NoError(t, err) {
+		assert.Empty(t, files)
+	}
+}
@@ -0,0 +1,564 @@
+package fs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/ProxeusApp/storage-app/lib/ratelimit"
+	"github.com/ProxeusApp/storage-app/spp/metrics"
+)
+
+/**
+Resumable uploads are handled through upload sessions.
+A session is created once per file hash and address, chunks are appended at the committed offset
+and the archive is only validated and moved into place when the session is finalized.
+
+Session state is kept next to the partial data in <StorageDir>/tmp/uploads so it survives a restart of the SPP.
+A session is bound to the address creating it: creating or resuming it returns a random token, which the chunk,
+offset, finalize and abort requests have to carry. Only its hash is kept, resuming the session issues a new token.
+Every session counts towards the open uploads of its address, see ratelimit.Guard.OpenUpload, from its creation until
+it is finalized, aborted or expired.
+*/
+type UploadSession struct {
+	ID        string    `json:"uploadId"`
+	FileHash  string    `json:"fileHash"`
+	Address   string    `json:"address"`
+	Duration  int       `json:"duration"`
+	Size      int64     `json:"size,omitempty"`    // Announced size of the archive, 0 if unknown
+	Offset    int64     `json:"offset"`            // Committed offset, derived from the partial file
+	Replica   bool      `json:"replica,omitempty"` // Pushed by a peer provider, see replication.go
+	Digest    string    `json:"digest,omitempty"`  // SHA-256 the archive of a replica has to match
+	FeeTx     string    `json:"feeTx,omitempty"`   // XES transfer paying the replacement of a stored file, see replacement.go
+	TokenHash string    `json:"tokenHash,omitempty"`
+	Token     string    `json:"-"` // Only set when the session is created or resumed
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+const (
+	uploadsFolderName = "uploads"
+	uploadSessionTTL  = 24 * time.Hour
+
+	// Largest chunk the SPP accepts in a single request
+	MaxUploadChunkByte = 32 * 1024 * 1024
+)
+
+var (
+	ErrUploadSessionNotFound = errors.New("upload session not found")
+	ErrUploadOffsetMismatch  = errors.New("upload offset does not match committed offset")
+	ErrUploadIncomplete      = errors.New("upload incomplete")
+	ErrUploadTooLarge        = errors.New("upload exceeds max file size")
+	ErrUploadInProgress      = errors.New("file is being uploaded by another address")
+)
+
+// Creates a new upload session or returns the existing one of the same address for the file hash.
+// The file can't be uploaded by another address while the session of an address is open, see ErrUploadInProgress.
+// feeTx is the XES transfer paying the replacement fee if the file is stored already, it may be empty otherwise.
+func (me *ProxeusFS) CreateUploadSession(docHash, token, signatureHex string, duration int, size int64, feeTx string) (*UploadSession, error) {
+	if me.ReadOnly() {
+		return nil, ErrReadOnly
+	}
+	addr, err := me.Validate(token, signatureHex)
+	if err != nil {
+		return nil, err
+	}
+	return me.createUploadSessionOf(docHash, addr, duration, size, feeTx)
+}
+
+// Creates the upload session once addr is authenticated, by a challenge or a grant
+func (me *ProxeusFS) createUploadSessionOf(docHash, addr string, duration int, size int64, feeTx string) (*UploadSession, error) {
+	ok, err := me.hasPermission(docHash, addr, true)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNoPermission
+	}
+	if max := me.providerInfoService.Get().MaxFileSizeByte; max > 0 && size > max {
+		return nil, ErrUploadTooLarge
+	}
+
+	return me.createUploadSession(docHash, addr, duration, size, false, "", feeTx)
+}
+
+func (me *ProxeusFS) createUploadSession(docHash, addr string, duration int, size int64, replica bool, digest, feeTx string) (*UploadSession, error) {
+	me.fileGblLock.Lock()
+	defer me.fileGblLock.Unlock()
+
+	sess, err := me.uploadSessionByFileHash(docHash)
+	if err == nil {
+		sameAddress := strings.EqualFold(sess.Address, addr)
+		if !sameAddress && time.Since(sess.CreatedAt) <= uploadSessionTTL {
+			// Only its creator may replace a session until it expires
+			log.Printf("[proxeusFS][CreateUploadSession] file %s is being uploaded by %s", docHash, sess.Address)
+			return nil, ErrUploadInProgress
+		}
+		if sameAddress && sess.Duration == duration && (size == 0 || sess.Size == size) &&
+			sess.Replica == replica && sess.Digest == digest {
+			// The uploaded part is already accounted for
+			if err = me.CheckCapacity(sess.Size - sess.Offset); err != nil {
+				return nil, err
+			}
+			if feeTx != "" {
+				// paid again after the previous payment was rejected
+				sess.FeeTx = feeTx
+			}
+			if err = me.issueUploadToken(sess); err != nil {
+				return nil, err
+			}
+			if err = me.putUploadSession(sess); err != nil {
+				return nil, err
+			}
+			log.Printf("[proxeusFS][CreateUploadSession] resuming upload %s of file %s at offset %d", sess.ID, docHash, sess.Offset)
+			return sess, nil
+		}
+		// A different upload of the same file by the same address replaces the previous one
+		me.removeUploadSession(sess.ID)
+	} else if err != ErrUploadSessionNotFound {
+		return nil, err
+	}
+	if err = me.CheckCapacity(size); err != nil {
+		return nil, err
+	}
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	if me.guard != nil {
+		if err = me.guard.OpenUpload(addr, u.String()); err != nil {
+			return nil, err
+		}
+	}
+	sess = &UploadSession{
+		ID:        u.String(),
+		FileHash:  docHash,
+		Address:   addr,
+		Duration:  duration,
+		Size:      size,
+		Replica:   replica,
+		Digest:    digest,
+		FeeTx:     feeTx,
+		CreatedAt: time.Now(),
+	}
+	if err = me.issueUploadToken(sess); err != nil {
+		me.removeUploadSession(sess.ID)
+		return nil, err
+	}
+	if err = me.storeUploadSession(sess); err != nil {
+		me.removeUploadSession(sess.ID)
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (me *ProxeusFS) storeUploadSession(sess *UploadSession) error {
+	if err := os.MkdirAll(me.uploadsPath(), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(me.uploadPartPath(sess.ID), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return me.putUploadSession(sess)
+}
+
+// Caps the upload sessions an address keeps open at the same time with the limit of guard.
+// The sessions kept from before a restart are counted as well.
+func (me *ProxeusFS) SetGuard(guard *ratelimit.Guard) {
+	me.guard = guard
+	sessions, err := me.allUploadSessions()
+	if err != nil {
+		log.Println("[proxeusFS][SetGuard] couldn't list upload sessions: ", err)
+		return
+	}
+	for _, sess := range sessions {
+		if err = guard.OpenUpload(sess.Address, sess.ID); err != nil {
+			log.Printf("[proxeusFS][SetGuard] upload %s exceeds the open uploads of %s: %v", sess.ID, sess.Address, err)
+		}
+	}
+}
+
+// Sets a new random token of sess, replacing the previous one
+func (me *ProxeusFS) issueUploadToken(sess *UploadSession) error {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	sess.Token = hex.EncodeToString(token)
+	sess.TokenHash = uploadTokenHash(sess.Token)
+	return nil
+}
+
+func uploadTokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// Returns the session id if token is its token. A wrong token is answered like an unknown session.
+// Sessions kept from before tokens were issued don't have one.
+func (me *ProxeusFS) authorizedUploadSession(id, token string) (*UploadSession, error) {
+	sess, err := me.getUploadSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if sess.TokenHash != "" && subtle.ConstantTimeCompare([]byte(uploadTokenHash(token)), []byte(sess.TokenHash)) != 1 {
+		log.Printf("[proxeusFS][authorizedUploadSession] wrong token for upload %s", id)
+		return nil, ErrUploadSessionNotFound
+	}
+	return sess, nil
+}
+
+// Returns the session with its currently committed offset
+func (me *ProxeusFS) UploadSession(id, token string) (*UploadSession, error) {
+	return me.authorizedUploadSession(id, token)
+}
+
+// Appends body to the partial file of the session. offset has to match the committed offset.
+// Everything written until an error occurs stays committed, so the client can resume from there.
+func (me *ProxeusFS) WriteUploadChunk(id, token string, offset int64, body io.Reader) (committed int64, err error) {
+	if _, err = me.authorizedUploadSession(id, token); err != nil {
+		return 0, err
+	}
+	return me.writeUploadChunk(id, offset, body, MaxUploadChunkByte)
+}
+
+// chunkLimit 0 only limits the chunk by the max file size of the provider
+func (me *ProxeusFS) writeUploadChunk(id string, offset int64, body io.Reader, chunkLimit int64) (committed int64, err error) {
+	if me.ReadOnly() {
+		return offset, ErrReadOnly
+	}
+	lock := me.uploadLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	sess, err := me.getUploadSession(id)
+	if err != nil {
+		return 0, err
+	}
+	if offset != sess.Offset {
+		return sess.Offset, ErrUploadOffsetMismatch
+	}
+
+	f, err := os.OpenFile(me.uploadPartPath(id), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return sess.Offset, err
+	}
+	defer f.Close()
+
+	limit := int64(math.MaxInt64 - 1)
+	if chunkLimit > 0 {
+		limit = chunkLimit
+	}
+	if max := me.providerInfoService.Get().MaxFileSizeByte; max > 0 && max-offset < limit {
+		limit = max - offset
+	}
+	errLimit := ErrUploadTooLarge
+	free, limited, err := me.FreeCapacity()
+	if err != nil {
+		return offset, err
+	}
+	if limited && free < limit {
+		limit = free
+		errLimit = ErrInsufficientCapacity
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	validator, err := me.uploadValidator(id, offset)
+	if err != nil {
+		return offset, me.rejectUpload(id, err)
+	}
+	dst := &validatedWriter{w: f, validator: validator, remaining: limit}
+	written, err := io.Copy(dst, io.LimitReader(body, limit+1))
+	if dst.err != nil {
+		return offset, me.rejectUpload(id, dst.err)
+	}
+	if written > limit {
+		// Drop the bytes exceeding the limit, they are not committed
+		written = limit
+		if terr := f.Truncate(offset + written); terr != nil {
+			return offset, terr
+		}
+		err = errLimit
+	}
+	me.addUsedCapacity(written)
+	if serr := f.Sync(); serr != nil && err == nil {
+		err = serr
+	}
+	return offset + written, err
+}
+
+// Validates the uploaded archive and moves it into place.
+// The session is kept if the payment hasn't arrived yet, so the client can finalize again later without uploading again.
+func (me *ProxeusFS) FinalizeUpload(id, token string) (written int64, err error) {
+	if _, err = me.authorizedUploadSession(id, token); err != nil {
+		return 0, err
+	}
+	return me.finalizeUpload(id)
+}
+
+func (me *ProxeusFS) finalizeUpload(id string) (written int64, err error) {
+	if me.ReadOnly() {
+		return 0, ErrReadOnly
+	}
+	lock := me.uploadLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	sess, err := me.getUploadSession(id)
+	if err != nil {
+		return 0, err
+	}
+	if sess.Size > 0 && sess.Offset != sess.Size {
+		return sess.Offset, ErrUploadIncomplete
+	}
+
+	err, keepSession := me.commitUpload(sess, me.uploadPartPath(id))
+	if keepSession {
+		return 0, err
+	}
+	me.removeUploadSession(id)
+	if err != nil {
+		return 0, err
+	}
+	return sess.Offset, nil
+}
+
+// Removes the session and its partial data
+func (me *ProxeusFS) AbortUpload(id, token string) error {
+	if _, err := me.authorizedUploadSession(id, token); err != nil {
+		return err
+	}
+	return me.abortUpload(id)
+}
+
+func (me *ProxeusFS) abortUpload(id string) error {
+	lock := me.uploadLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, err := me.getUploadSession(id); err != nil {
+		return err
+	}
+	me.removeUploadSession(id)
+	return nil
+}
+
+func (me *ProxeusFS) truncateUpload(id string) error {
+	lock := me.uploadLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	me.dropUploadValidator(id)
+	return os.Truncate(me.uploadPartPath(id), 0)
+}
+
+// Returns the archive validator of the session, fed with the committed data up to offset.
+// A session resumed after a restart gets a new validator, which catches up by reading the partial file.
+func (me *ProxeusFS) uploadValidator(id string, offset int64) (*archiveValidator, error) {
+	if v, ok := me.validators.Load(id); ok {
+		validator := v.(*archiveValidator)
+		if validator.fed == offset {
+			return validator, nil
+		}
+		validator.abort()
+	}
+	validator := me.archivePolicy.newValidator()
+	me.validators.Store(id, validator)
+	if offset == 0 {
+		return validator, nil
+	}
+	f, err := os.Open(me.uploadPartPath(id))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err = io.CopyN(validator, f, offset); err != nil {
+		return nil, err
+	}
+	return validator, nil
+}
+
+// Completes the validation of the archive uploaded to the session
+func (me *ProxeusFS) finishArchiveValidation(id string, size int64) error {
+	validator, err := me.uploadValidator(id, size)
+	if err == nil {
+		err = validator.close()
+	}
+	if v, ok := err.(*ArchiveViolation); ok {
+		metrics.ArchiveValidationFailures.WithLabelValues(v.Reason).Inc()
+	}
+	return err
+}
+
+// Removes a session whose archive violates the validation policy, it can't become valid anymore
+func (me *ProxeusFS) rejectUpload(id string, err error) error {
+	v, ok := err.(*ArchiveViolation)
+	if !ok {
+		me.dropUploadValidator(id)
+		return err
+	}
+	log.Printf("[proxeusFS][rejectUpload] upload %s rejected: %v", id, v)
+	metrics.ArchiveValidationFailures.WithLabelValues(v.Reason).Inc()
+	me.removeUploadSession(id)
+	return v
+}
+
+func (me *ProxeusFS) dropUploadValidator(id string) {
+	if v, ok := me.validators.Load(id); ok {
+		v.(*archiveValidator).abort()
+		me.validators.Delete(id)
+	}
+}
+
+// Writes to w and feeds the first remaining bytes written to the validator
+type validatedWriter struct {
+	w         io.Writer
+	validator *archiveValidator
+	remaining int64
+	err       error // Returned by the validator
+}
+
+func (me *validatedWriter) Write(p []byte) (int, error) {
+	n, err := me.w.Write(p)
+	fed := int64(n)
+	if fed > me.remaining {
+		fed = me.remaining
+	}
+	if fed > 0 {
+		if _, verr := me.validator.Write(p[:fed]); verr != nil {
+			me.err = verr
+			return n, verr
+		}
+		me.remaining -= fed
+	}
+	return n, err
+}
+
+// Removes upload sessions that haven't been finalized within uploadSessionTTL
+func (me *ProxeusFS) removeStaleUploadSessions() {
+	sessions, err := me.allUploadSessions()
+	if err != nil {
+		log.Println("[proxeusFS][removeStaleUploadSessions] couldn't list upload sessions: ", err)
+		return
+	}
+	for _, sess := range sessions {
+		if time.Since(sess.CreatedAt) > uploadSessionTTL {
+			log.Printf("[proxeusFS][removeStaleUploadSessions] removing stale upload %s of file %s", sess.ID, sess.FileHash)
+			me.removeUploadSession(sess.ID)
+		}
+	}
+}
+
+func (me *ProxeusFS) uploadLock(id string) *sync.Mutex {
+	l, _ := me.uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	return l.(*sync.Mutex)
+}
+
+func (me *ProxeusFS) uploadsPath() string {
+	return filepath.Join(me.basePath, tempFolderName, uploadsFolderName)
+}
+
+func (me *ProxeusFS) uploadPartPath(id string) string {
+	return filepath.Join(me.uploadsPath(), filepath.Base(id)+".part")
+}
+
+func (me *ProxeusFS) uploadSessionPath(id string) string {
+	return filepath.Join(me.uploadsPath(), filepath.Base(id)+".json")
+}
+
+func (me *ProxeusFS) putUploadSession(sess *UploadSession) error {
+	bts, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	tmp := me.uploadSessionPath(sess.ID) + downloadingSuffix
+	if err = ioutil.WriteFile(tmp, bts, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, me.uploadSessionPath(sess.ID))
+}
+
+func (me *ProxeusFS) getUploadSession(id string) (*UploadSession, error) {
+	bts, err := ioutil.ReadFile(me.uploadSessionPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrUploadSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	sess := &UploadSession{}
+	if err = json.Unmarshal(bts, sess); err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(me.uploadPartPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrUploadSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	sess.Offset = stat.Size()
+	return sess, nil
+}
+
+func (me *ProxeusFS) uploadSessionByFileHash(docHash string) (*UploadSession, error) {
+	sessions, err := me.allUploadSessions()
+	if err != nil {
+		return nil, err
+	}
+	for _, sess := range sessions {
+		if strings.EqualFold(sess.FileHash, docHash) {
+			return sess, nil
+		}
+	}
+	return nil, ErrUploadSessionNotFound
+}
+
+func (me *ProxeusFS) allUploadSessions() ([]*UploadSession, error) {
+	matches, err := filepath.Glob(filepath.Join(me.uploadsPath(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*UploadSession
+	for _, m := range matches {
+		sess, err := me.getUploadSession(strings.TrimSuffix(filepath.Base(m), ".json"))
+		if err != nil {
+			log.Println("[proxeusFS][allUploadSessions] skipping upload session ", m, err)
+			continue
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, nil
+}
+
+func (me *ProxeusFS) removeUploadSession(id string) {
+	if err := os.Remove(me.uploadSessionPath(id)); err != nil && !os.IsNotExist(err) {
+		log.Println("[proxeusFS][removeUploadSession] ", err)
+	}
+	if err := os.Remove(me.uploadPartPath(id)); err != nil && !os.IsNotExist(err) {
+		log.Println("[proxeusFS][removeUploadSession] ", err)
+	}
+	me.dropUploadValidator(id)
+	me.uploadLocks.Delete(id)
+	if me.guard != nil {
+		me.guard.CloseUpload(id)
+	}
+	me.resetUsedCapacity()
+}
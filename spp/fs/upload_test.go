@@ -0,0 +1,114 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/lib/ratelimit"
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+func TestOpenUploadsPerAddress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newFS := func() *ProxeusFS {
+		pfs, err := NewProxeusFS(&config.Configuration{StorageDir: dir}, &fsClientStub{}, NewFileMetaClientMock(nil), providerInfoStub{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pfs.SetGuard(ratelimit.NewGuard(ratelimit.Config{MaxUploads: 2}))
+		return pfs
+	}
+	pfs := newFS()
+	hash := func(i int) string {
+		return fmt.Sprintf("0x%064x", i)
+	}
+	alice, bob := "0x1111111111111111111111111111111111111111", "0x2222222222222222222222222222222222222222"
+
+	first, err := pfs.createUploadSessionOf(hash(1), alice, 30, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pfs.createUploadSessionOf(hash(2), alice, 30, 0, "")
+	assert.NoError(t, err)
+	// resuming an open session doesn't count it again
+	first, err = pfs.createUploadSessionOf(hash(1), alice, 30, 0, "")
+	assert.NoError(t, err)
+	_, err = pfs.createUploadSessionOf(hash(3), alice, 30, 0, "")
+	assert.Equal(t, ratelimit.ErrTooManyUploads, err)
+	_, err = pfs.createUploadSessionOf(hash(3), bob, 30, 0, "")
+	assert.NoError(t, err)
+
+	// chunks are written to open sessions without counting
+	_, err = pfs.WriteUploadChunk(first.ID, first.Token, 0, bytes.NewReader([]byte{1, 2, 3}))
+	assert.NoError(t, err)
+
+	// the open sessions are counted again after a restart
+	pfs.Close()
+	pfs = newFS()
+	defer pfs.Close()
+	_, err = pfs.createUploadSessionOf(hash(4), alice, 30, 0, "")
+	assert.Equal(t, ratelimit.ErrTooManyUploads, err)
+
+	// an aborted session doesn't count anymore
+	assert.NoError(t, pfs.AbortUpload(first.ID, first.Token))
+	_, err = pfs.createUploadSessionOf(hash(4), alice, 30, 0, "")
+	assert.NoError(t, err)
+}
+
+func TestUploadSessionBoundToCreator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pfs, err := NewProxeusFS(&config.Configuration{StorageDir: dir}, &fsClientStub{}, NewFileMetaClientMock(nil), providerInfoStub{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pfs.Close()
+	hash := "0x822ac138637485893a49980082b5dfbb020c14f20017f4ae69c7f350c06fe8c1"
+	alice, bob := "0x1111111111111111111111111111111111111111", "0x2222222222222222222222222222222222222222"
+
+	sess, err := pfs.createUploadSessionOf(hash, alice, 30, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another address can't replace the session
+	_, err = pfs.createUploadSessionOf(hash, bob, 30, 0, "")
+	assert.Equal(t, ErrUploadInProgress, err)
+
+	// requests without the token of the session don't find it
+	_, err = pfs.WriteUploadChunk(sess.ID, "", 0, bytes.NewReader([]byte{1, 2, 3}))
+	assert.Equal(t, ErrUploadSessionNotFound, err)
+	_, err = pfs.FinalizeUpload(sess.ID, "wrong")
+	assert.Equal(t, ErrUploadSessionNotFound, err)
+	assert.Equal(t, ErrUploadSessionNotFound, pfs.AbortUpload(sess.ID, "wrong"))
+	committed, err := pfs.WriteUploadChunk(sess.ID, sess.Token, 0, bytes.NewReader([]byte{1, 2, 3}))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), committed)
+
+	// resuming the session issues a new token
+	resumed, err := pfs.createUploadSessionOf(hash, alice, 30, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, sess.ID, resumed.ID)
+	_, err = pfs.UploadSession(sess.ID, sess.Token)
+	assert.Equal(t, ErrUploadSessionNotFound, err)
+	current, err := pfs.UploadSession(resumed.ID, resumed.Token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(3), current.Offset)
+	}
+	assert.NoError(t, pfs.AbortUpload(resumed.ID, resumed.Token))
+}
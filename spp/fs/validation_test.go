@@ -0,0 +1,164 @@
+package fs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ProxeusApp/pgp"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProxeusApp/storage-app/spp/config"
+)
+
+type testEntry struct {
+	name     string
+	typeflag byte
+	data     []byte
+}
+
+func testArchive(t *testing.T, entries ...testEntry) []byte {
+	buf := &bytes.Buffer{}
+	gzw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gzw)
+	for _, e := range entries {
+		typeflag := e.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		header := &tar.Header{Name: e.name, Mode: 0600, Size: int64(len(e.data)), Typeflag: typeflag}
+		if typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(e.data); err != nil && typeflag == tar.TypeReg {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testEncrypted(t *testing.T, pubKey []byte, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	if _, err := pgp.EncryptStream(bytes.NewReader(data), buf, [][]byte{pubKey}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func random(t *testing.T, size int) []byte {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestArchivePolicy(t *testing.T) {
+	keys, err := pgp.Create("test", "test@proxeus.com", 1024, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := testEncrypted(t, keys["public"], []byte("document"))
+	policy := NewArchivePolicy(&config.Configuration{ArchiveMaxEntries: 3, ArchiveMaxExpanded: 1 << 22, ArchiveMaxRatio: 20, ArchiveMaxPathDepth: 1})
+
+	reason := func(err error) string {
+		if v, ok := err.(*ArchiveViolation); ok {
+			return v.Reason
+		}
+		return ""
+	}
+	assert.NoError(t, policy.Validate(bytes.NewReader(testArchive(t,
+		testEntry{name: "meta", data: encrypted},
+		testEntry{name: "document.pdf", data: encrypted},
+	))))
+
+	for _, tc := range []struct {
+		name    string
+		archive []byte
+		reason  string
+	}{
+		{"not gzip", []byte("archive"), ViolationInvalidArchive},
+		{"plain entry", testArchive(t, testEntry{name: "meta", data: encrypted}, testEntry{name: "document.pdf", data: []byte("document")}), ViolationNotEncrypted},
+		{"parent path", testArchive(t, testEntry{name: "../meta", data: encrypted}), ViolationUnsafePath},
+		{"absolute path", testArchive(t, testEntry{name: "/meta", data: encrypted}), ViolationUnsafePath},
+		{"nested path", testArchive(t, testEntry{name: "dir/meta", data: encrypted}), ViolationPathDepth},
+		{"duplicate", testArchive(t, testEntry{name: "meta", data: encrypted}, testEntry{name: "./meta", data: encrypted}), ViolationDuplicateEntry},
+		{"symlink", testArchive(t, testEntry{name: "meta", typeflag: tar.TypeSymlink}), ViolationEntryType},
+		{"too many entries", testArchive(t,
+			testEntry{name: "a", data: encrypted}, testEntry{name: "b", data: encrypted},
+			testEntry{name: "c", data: encrypted}, testEntry{name: "d", data: encrypted}), ViolationTooManyEntries},
+		{"expanded size", testArchive(t, testEntry{name: "meta", data: random(t, 5<<20)}), ViolationExpandedSize},
+	} {
+		assert.Equal(t, tc.reason, reason(policy.Validate(bytes.NewReader(tc.archive))), tc.name)
+	}
+
+	// a small archive expanding to a lot of data is rejected before it is read completely
+	bomb := testArchive(t, testEntry{name: "meta", data: make([]byte, 1<<21)})
+	assert.Equal(t, ViolationCompressionRatio, reason(policy.Validate(bytes.NewReader(bomb))))
+
+	policy.AllowUnencrypted = true
+	assert.NoError(t, policy.Validate(bytes.NewReader(testArchive(t, testEntry{name: "meta", data: []byte("document")}))))
+}
+
+func TestUploadArchiveValidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validation-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pfs, err := NewProxeusFS(&config.Configuration{StorageDir: dir}, nil, NewFileMetaClientMock(nil), providerInfoStub{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pfs.archivePolicy = ArchivePolicy{MaxEntries: 1, AllowUnencrypted: true}
+
+	entry := func(name string) testEntry {
+		return testEntry{name: name, data: random(t, 64*1024)}
+	}
+	archive := testArchive(t, entry("a"), entry("b"), entry("c"), entry("d"))
+	sess := &UploadSession{ID: "validation", FileHash: "0x01", CreatedAt: time.Now()}
+	if err = os.MkdirAll(pfs.uploadsPath(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(pfs.uploadPartPath(sess.ID), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = pfs.putUploadSession(sess); err != nil {
+		t.Fatal(err)
+	}
+
+	// the upload is rejected while the chunks are written, before the archive is complete
+	var offset int64
+	for offset < int64(len(archive)) && err == nil {
+		end := offset + 4096
+		if end > int64(len(archive)) {
+			end = int64(len(archive))
+		}
+		offset, err = pfs.WriteUploadChunk(sess.ID, sess.Token, offset, bytes.NewReader(archive[offset:end]))
+	}
+	if assert.IsType(t, &ArchiveViolation{}, err) {
+		assert.Equal(t, ViolationTooManyEntries, err.(*ArchiveViolation).Reason)
+		assert.Equal(t, "b", err.(*ArchiveViolation).Entry)
+	}
+	assert.True(t, offset < int64(len(archive)))
+
+	_, err = pfs.UploadSession(sess.ID, sess.Token)
+	assert.Equal(t, ErrUploadSessionNotFound, err)
+	_, err = os.Stat(pfs.uploadPartPath(sess.ID))
+	assert.True(t, os.IsNotExist(err))
+}
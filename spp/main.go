@@ -5,23 +5,29 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 
 	"github.com/ProxeusApp/storage-app/dapp/core/ethereum"
 	"github.com/ProxeusApp/storage-app/spp/service"
 
 	"github.com/labstack/echo"
 
+	"github.com/ProxeusApp/storage-app/lib/challenge"
 	"github.com/ProxeusApp/storage-app/lib/default_server"
+	"github.com/ProxeusApp/storage-app/lib/ratelimit"
 	"github.com/ProxeusApp/storage-app/spp/config"
 	"github.com/ProxeusApp/storage-app/spp/endpoint"
 	"github.com/ProxeusApp/storage-app/spp/fs"
+	"github.com/ProxeusApp/storage-app/spp/metrics"
 )
 
-const settingsFilename = "settings.json"
+const (
+	settingsFilename     = "settings.json"
+	priceHistoryFilename = "price_history.json"
+)
 
 var cfg *config.Configuration
 var sppWorkerRunning chan bool
@@ -47,18 +53,26 @@ func main() {
 		log.Println("#######################################################")
 	}
 
+	if err = providerInfoService.LoadPriceHistory(filepath.Join(cfg.StorageDir, priceHistoryFilename)); err != nil {
+		log.Panic(err)
+	}
+	if err = providerInfoService.Watch(); err != nil {
+		log.Panic(err)
+	}
+	defer providerInfoService.Close()
+
 	c, _ := json.MarshalIndent(providerInfoService.Get(), "", "  ")
 	log.Println("providerInfoService defined configuration:")
 	log.Println(string(c))
 
-	log.Printf("Starting new spp with config: EthClientURL: %s, StorageProviderAddress: %s, EthWebSocketURL: %s, StorageDir: %s, ContractAddress: %s",
-		cfg.EthClientURL, cfg.StorageProviderAddress, cfg.EthWebSocketURL, cfg.StorageDir, cfg.ContractAddress)
-	ethClient, err := ethereum.NewSppClient(cfg.EthClientURL, cfg.EthWebSocketURL, cfg.StorageDir, cfg.ContractAddress)
+	log.Printf("Starting new spp with config: EthClientURL: %s, StorageProviderAddress: %s, EthWebSocketURL: %s, StorageDir: %s, BlobStore: %s, ContractAddress: %s",
+		cfg.EthClientURL, cfg.StorageProviderAddress, cfg.EthWebSocketURL, cfg.StorageDir, cfg.BlobStore, cfg.ContractAddress)
+	ethClient, err := ethereum.NewSppClient(cfg.EthClientURL, cfg.EthWebSocketURL, cfg.StorageDir, cfg.ContractAddress, cfg.XESContractAddress)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	if err = ethClient.InitListeners(cfg.StorageDir, cfg.StorageProviderAddress, eventsHandler); err != nil {
+	if err = ethClient.Connect(cfg.StorageDir); err != nil {
 		log.Panic(err)
 	}
 
@@ -67,52 +81,115 @@ func main() {
 		log.Panic(err)
 	}
 
+	challengeStore, err := challenge.NewStore(cfg.ChallengeStore, cfg.StorageDir)
+	if err != nil {
+		log.Panic(err)
+	}
+
 	// Pass dependencies to `endpoint`
 	endpoint.EthClient = ethClient
-	endpoint.ProxeusFS, err = fs.NewProxeusFS(cfg, ethClient, fileMetaHandler, providerInfoService)
-	endpoint.ServiceProviderInfo = providerInfoService.Get()
+	endpoint.Challenges = challenge.NewAuthenticator(challengeStore, time.Duration(cfg.ChallengeTTL)*time.Second)
+	endpoint.ProxeusFS, err = fs.NewProxeusFS(cfg, ethClient, fileMetaHandler, providerInfoService, endpoint.Challenges)
+	endpoint.ProviderInfoService = providerInfoService
 	if err != nil {
 		log.Panic(err)
 	}
+	setProviderKey()
+	setGuard()
 
 	e := newEcho()
 
-	proxeusFSDeleteEvent, err := fs.NewProxeusFSDeleteEvent(&config.Config)
+	chainEvents, err := fs.NewChainEvents(endpoint.ProxeusFS, ethClient, cfg.EventsStartBlock, cfg.EventsConfirmationDepth(), time.Duration(cfg.EventsPollInterval)*time.Second)
 	if err != nil {
 		log.Panic(err)
 	}
+	chainEvents.Start()
 
-	proxeusFSDeleteEvent.StartSubscribeDeleteHandler()
+	sweepSchedule, err := fs.ParseSweepSchedule(cfg.SweepSchedule)
+	if err != nil {
+		log.Panic(err)
+	}
+	endpoint.Sweeper = fs.NewSweeper(endpoint.ProxeusFS, sweepSchedule, cfg.SweepBatchSize, cfg.SweepDryRun)
+	endpoint.Sweeper.Start()
+	defer endpoint.Sweeper.Stop()
+
+	endpoint.HealthChecks = endpoint.NewHealthChecks(cfg, chainEvents)
 
 	defer stopWorker()
 	startWorker()
 
 	default_server.StartServer(e, config.Config.ServiceAddress, config.Config.AutoTLS)
-	proxeusFSDeleteEvent.Close()
+	chainEvents.Stop()
+	endpoint.ProxeusFS.Close()
+	endpoint.Challenges.Close()
 }
 
-func eventsHandler(lg *types.Log, _ bool) error {
-	payRecv := endpoint.EthClient.LogAsPaymentReceived(lg)
-	if payRecv != nil && eventInterestingForMe(payRecv.StorageProvider) {
-		log.Printf("Event[PaymentReceived] %v %v incoming... tx %s fileHash %s, xesAmount: %v\n", lg.BlockNumber, lg.TxIndex, lg.TxHash.Hex(), common.Hash(payRecv.Hash).Hex(), payRecv.XesAmount)
-		endpoint.EthClient.HandlePaymentReceivedEvent(payRecv.Hash, payRecv.XesAmount)
+// Archives are only replicated to peer providers when the key of the storage provider address is configured
+func setProviderKey() {
+	if cfg.ProviderKey == "" {
+		log.Println("No provider key set, archives won't be replicated to peer providers")
+		return
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(cfg.ProviderKey, "0x"))
+	if err != nil {
+		log.Panic("invalid provider key: ", err)
+	}
+	if err = endpoint.ProxeusFS.SetProviderKey(key); err != nil {
+		log.Panic(err)
 	}
-	return nil
 }
 
-func eventInterestingForMe(provAddress common.Address) bool {
-	return cfg.StorageProviderAddress == provAddress.String()
+// Rate limits the public endpoints, the sign ins and the concurrent uploads of an address
+func setGuard() {
+	rateLimits, err := cfg.RateLimits()
+	if err != nil {
+		log.Panic(err)
+	}
+	endpoint.Guard = ratelimit.NewGuard(rateLimits)
+	endpoint.Guard.SetResponder(endpoint.RateLimited)
+	endpoint.Challenges.SetAddressLimiter(endpoint.Guard)
+	endpoint.ProxeusFS.SetGuard(endpoint.Guard)
+	metrics.RegisterGuard(endpoint.Guard)
 }
 
 func newEcho() *echo.Echo {
 	e := default_server.Setup("/var/log/spp.log")
-
-	e.GET("/challenge", endpoint.GetChallenge)
-	e.POST("/:fileHash/:token/:signature", endpoint.PostFile)
-	e.GET("/:fileHash/:token/:signature", endpoint.GetFile)
+	e.HTTPErrorHandler = endpoint.HTTPErrorHandler
+
+	uploadMetrics := metrics.Transfer(metrics.DirectionUpload)
+	downloadMetrics := metrics.Transfer(metrics.DirectionDownload)
+
+	e.GET("/challenge", endpoint.GetChallenge, endpoint.Limit)
+	e.POST("/upload/:fileHash/:token/:signature", endpoint.CreateUpload, endpoint.Limit)
+	e.GET("/upload/:uploadId", endpoint.UploadOffset, endpoint.Limit)
+	e.PUT("/upload/:uploadId", endpoint.UploadChunk, endpoint.Limit, uploadMetrics)
+	e.POST("/upload/:uploadId/finalize", endpoint.FinalizeUpload, endpoint.Limit, uploadMetrics)
+	e.DELETE("/upload/:uploadId", endpoint.DeleteUpload, endpoint.Limit)
+	e.POST("/renew/:fileHash/:token/:signature", endpoint.Renew, endpoint.Limit)
+	e.POST("/replicate/:fileHash/:token/:signature", endpoint.CreateReplica, endpoint.Limit)
+	e.GET("/proof/:fileHash/:token/:signature", endpoint.GetStorageProof, endpoint.Limit)
+	e.GET("/grant", endpoint.GrantInfo, endpoint.Limit)
+	e.POST("/grant/:fileHash/upload", endpoint.CreateUploadWithGrant, endpoint.Limit)
+	e.POST("/grant/:fileHash", endpoint.PostFileWithGrant, endpoint.Limit, uploadMetrics)
+	e.GET("/grant/:fileHash", endpoint.GetFileWithGrant, endpoint.Limit, downloadMetrics)
+	e.POST("/:fileHash/:token/:signature", endpoint.PostFile, endpoint.Limit, uploadMetrics)
+	e.GET("/:fileHash/:token/:signature", endpoint.GetFile, endpoint.Limit, downloadMetrics)
 	e.GET("/info", endpoint.Info)
 	e.GET("/ping", endpoint.Ping)
 	e.GET("/health", endpoint.Health)
+	e.GET("/health/live", endpoint.Live)
+	e.GET("/health/ready", endpoint.Ready)
+	e.GET("/metrics", metrics.Handler())
+
+	admin := e.Group("/admin/:token/:signature", endpoint.Limit, endpoint.RequireOperator)
+	admin.GET("/files", endpoint.AdminFiles)
+	admin.DELETE("/files/:fileHash", endpoint.AdminDeleteFile)
+	admin.GET("/usage", endpoint.AdminUsage)
+	admin.POST("/expired", endpoint.AdminRemoveExpired)
+	admin.GET("/sweeper", endpoint.AdminSweeper)
+	admin.GET("/deletions", endpoint.AdminDeletions)
+	admin.GET("/maintenance", endpoint.AdminMaintenance)
+	admin.PUT("/maintenance", endpoint.AdminSetMaintenance)
 
 	return e
 }
@@ -123,18 +200,15 @@ func startWorker() {
 	go func() {
 		sppWorkerRunning = make(chan bool, 1)
 		ticker := time.NewTicker(60 * time.Second)
-		var lastExecutedDate string
 
 		defer ticker.Stop()
 
+		updateStorageDirMetrics()
 		for {
 			select {
-			case t := <-ticker.C:
-				tickDateStr := t.Format("20060102")
-				if lastExecutedDate != tickDateStr && t.Hour() == 2 && t.Minute() == 0 {
-					lastExecutedDate = tickDateStr
-					go endpoint.ProxeusFS.CheckForExpiredFiles()
-				}
+			case <-ticker.C:
+				updateStorageDirMetrics()
+				go endpoint.ProxeusFS.ReplicatePending()
 			case <-sppWorkerRunning:
 				return
 			}
@@ -142,6 +216,12 @@ func startWorker() {
 	}()
 }
 
+func updateStorageDirMetrics() {
+	if err := metrics.UpdateStorageDirBytes(cfg.StorageDir); err != nil {
+		log.Println("[spp][updateStorageDirMetrics] ", err)
+	}
+}
+
 func stopWorker() {
 	log.Println("Stopping SPP worker...")
 	close(sppWorkerRunning)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"io/ioutil"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
@@ -16,6 +17,7 @@ import (
 	"gopkg.in/gavv/httpexpect.v2"
 
 	"github.com/ProxeusApp/storage-app/dapp/core/ethereum"
+	"github.com/ProxeusApp/storage-app/lib/challenge"
 	"github.com/ProxeusApp/storage-app/spp/config"
 	"github.com/ProxeusApp/storage-app/spp/fs"
 	"github.com/ProxeusApp/storage-app/spp/service"
@@ -30,15 +32,15 @@ func serverURL() string {
 	return server.URL
 }
 
-var challenge *httpexpect.String
+var signInChallenge *httpexpect.String
 var token *httpexpect.String
 
 func TestChallenge(t *testing.T) {
 	//e := httpexpect.New(t, serverURL())
 	//j := e.GET("/challenge").Expect().Status(http.StatusOK).JSON()
-	//challenge = j.Object().Value("challenge").String()
+	//signInChallenge = j.Object().Value("challenge").String()
 	//token = j.Object().Value("token").String()
-	//challenge.Match("^0x[0-9a-f]{188}$")
+	//signInChallenge.Match("^0x[0-9a-f]{188}$")
 	//token.Match("^[0-9a-f\\-]{36}$")
 
 	eventSignature := []byte("Deleted(bytes32)")
@@ -63,6 +65,12 @@ func BenchmarkChallenge(b *testing.B) {
 func TestCheckForExpiredFiles(t *testing.T) {
 	config.Setup()
 	cfg := &config.Config
+	dir, err := ioutil.TempDir("", "expired-files-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg.StorageDir = dir
 
 	providerInfoService, err := service.NewProviderInfoService("./settings.json")
 	if err != nil {
@@ -113,7 +121,8 @@ func TestCheckForExpiredFiles(t *testing.T) {
 	fsFileMocks := fs.NewFileMetaClientMock(proxeusFSFileMocks)
 	ethClientMock := ethereum.NewClientMock(fsFileMocks)
 
-	proxeusFS, err := fs.NewProxeusFS(cfg, ethClientMock, fsFileMocks, providerInfoService)
+	proxeusFS, err := fs.NewProxeusFS(cfg, ethClientMock, fsFileMocks, providerInfoService,
+		challenge.NewAuthenticator(challenge.NewMemoryStore(), challenge.DefaultTTL))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -130,6 +139,10 @@ func TestCheckForExpiredFiles(t *testing.T) {
 	if err != fs.ErrSppFileMetaNotFound {
 		t.Error("0x822ac138637485893a49980082b5dfbb020c14f20017f4ae69c7f350c06fe8c1 was expired, but not deleted. -", err)
 	}
+	removals, err := proxeusFS.AuditLog().Entries(fs.AuditFilter{Reason: fs.AuditReasonExpired})
+	if err != nil || len(removals) != 1 || removals[0].FileHash != "0x822ac138637485893a49980082b5dfbb020c14f20017f4ae69c7f350c06fe8c1" {
+		t.Error("removal of the expired file wasn't recorded in the audit log -", removals, err)
+	}
 
 	fileInGracePeriod, err := fsFileMocks.Get(util.StrHexToBytes32("0x7df17c9bc5c29772556b178c5df73bdd8d3991943196ea8e0e331ecc1c43a908"))
 	if fileInGracePeriod == nil || err != nil {
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ProxeusApp/storage-app/lib/ratelimit"
+)
+
+/**
+Prometheus metrics of the SPP, exposed on /metrics.
+*/
+
+const (
+	namespace = "spp"
+
+	DirectionUpload   = "upload"
+	DirectionDownload = "download"
+
+	PaymentMismatch = "mismatch"
+	PaymentNotFound = "not_found"
+
+	RemovedExpired = "expired"
+	RemovedDeleted = "deleted"
+	RemovedAdmin   = "admin"
+
+	ReplicationSucceeded = "succeeded"
+	ReplicationFailed    = "failed"
+)
+
+var (
+	Transfers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfers_total",
+		Help:      "Upload and download requests by direction and status code.",
+	}, []string{"direction", "code"})
+
+	TransferredBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transferred_bytes_total",
+		Help:      "Bytes received by uploads and sent by downloads.",
+	}, []string{"direction"})
+
+	TransferDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "transfer_duration_seconds",
+		Help:      "Duration of upload and download requests.",
+		Buckets:   []float64{.05, .1, .5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"direction"})
+
+	PaymentErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payment_errors_total",
+		Help:      "Payments which couldn't be verified, by reason (mismatch or not_found).",
+	}, []string{"reason"})
+
+	ArchiveValidationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "archive_validation_failures_total",
+		Help:      "Uploaded archives rejected by the archive validation policy, by reason.",
+	}, []string{"reason"})
+
+	FilesRemoved = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "files_removed_total",
+		Help:      "Files removed, by reason (expired, deleted or admin).",
+	}, []string{"reason"})
+
+	Replications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "replications_total",
+		Help:      "Archives pushed to peer providers, by result (succeeded or failed after the last try).",
+	}, []string{"result"})
+
+	LastProcessedBlock = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_processed_block",
+		Help:      "Number of the last block an event was processed from.",
+	})
+
+	StorageDirBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "storage_dir_bytes",
+		Help:      "Disk usage of the storage dir.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		Transfers,
+		TransferredBytes,
+		TransferDuration,
+		PaymentErrors,
+		ArchiveValidationFailures,
+		FilesRemoved,
+		Replications,
+		LastProcessedBlock,
+		StorageDirBytes,
+	)
+}
+
+// Exposes the limits and bans of the guard of the public endpoints
+func RegisterGuard(guard *ratelimit.Guard) {
+	prometheus.MustRegister(guard.Collector(namespace))
+}
+
+// Serves the registered metrics in the prometheus text format
+func Handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.Handler())
+}
+
+// Middleware counting requests, status codes and bytes of the routes it is applied to
+func Transfer(direction string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			var body *countingReader
+			if direction == DirectionUpload && c.Request().Body != nil {
+				body = &countingReader{ReadCloser: c.Request().Body}
+				c.Request().Body = body
+			}
+
+			err := next(c)
+			if err != nil {
+				// Let the error handler write the response, so the status code is known
+				c.Error(err)
+			}
+
+			TransferDuration.WithLabelValues(direction).Observe(time.Since(start).Seconds())
+			Transfers.WithLabelValues(direction, strconv.Itoa(c.Response().Status)).Inc()
+			if body != nil {
+				TransferredBytes.WithLabelValues(direction).Add(float64(body.n))
+			} else {
+				TransferredBytes.WithLabelValues(direction).Add(float64(c.Response().Size))
+			}
+			return nil
+		}
+	}
+}
+
+// Sums up the size of all files in dir
+func UpdateStorageDirBytes(dir string) error {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files might be removed while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	StorageDirBytes.Set(float64(size))
+	return nil
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (me *countingReader) Read(p []byte) (int, error) {
+	n, err := me.ReadCloser.Read(p)
+	me.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransfer(t *testing.T) {
+	e := echo.New()
+	e.PUT("/upload", func(c echo.Context) error {
+		ioutil.ReadAll(c.Request().Body)
+		return c.NoContent(http.StatusOK)
+	}, Transfer(DirectionUpload))
+	e.GET("/download", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusForbidden)
+	}, Transfer(DirectionDownload))
+	e.GET("/metrics", Handler())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/upload", strings.NewReader("0123456789")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, float64(1), testutil.ToFloat64(Transfers.WithLabelValues(DirectionUpload, "200")))
+	assert.Equal(t, float64(10), testutil.ToFloat64(TransferredBytes.WithLabelValues(DirectionUpload)))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/download", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, float64(1), testutil.ToFloat64(Transfers.WithLabelValues(DirectionDownload, "403")))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `spp_transfers_total{code="403",direction="download"} 1`)
+}
@@ -2,11 +2,19 @@ package service
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
 
 	"errors"
 
+	"github.com/fsnotify/fsnotify"
+
 	"github.com/ProxeusApp/storage-app/spp/client/models"
 )
 
@@ -17,6 +25,49 @@ An instance should be reused over the application
 */
 type ProviderInfoService interface {
 	Get() models.StorageProviderInfo
+	// PriceScheduleAt returns the price schedule which was effective at t, ok is false if it isn't kept
+	PriceScheduleAt(t time.Time) (schedule PriceSchedule, ok bool)
+}
+
+// PriceSchedule is a price which was effective from From until Until, Until is zero for the current price
+type PriceSchedule struct {
+	PriceByte         string                    `json:"priceByte"`
+	PriceDay          string                    `json:"priceDay"`
+	SizeTiers         []models.SizeTier         `json:"sizeTiers,omitempty"`
+	DurationDiscounts []models.DurationDiscount `json:"durationDiscounts,omitempty"`
+	MinimumCharge     string                    `json:"minimumCharge,omitempty"`
+	ReplacementFee    string                    `json:"replacementFee,omitempty"`
+	From              time.Time                 `json:"from"`
+	Until             time.Time                 `json:"until,omitempty"`
+}
+
+func newPriceSchedule(info models.StorageProviderInfo, from time.Time) PriceSchedule {
+	return PriceSchedule{
+		PriceByte:         info.PriceByte,
+		PriceDay:          info.PriceDay,
+		SizeTiers:         info.SizeTiers,
+		DurationDiscounts: info.DurationDiscounts,
+		MinimumCharge:     info.MinimumCharge,
+		ReplacementFee:    info.ReplacementFee,
+		From:              from,
+	}
+}
+
+// Returns the provider info holding the prices of the schedule, to compute prices with
+func (me PriceSchedule) ProviderInfo() models.StorageProviderInfo {
+	return models.StorageProviderInfo{
+		PriceByte:         me.PriceByte,
+		PriceDay:          me.PriceDay,
+		SizeTiers:         me.SizeTiers,
+		DurationDiscounts: me.DurationDiscounts,
+		MinimumCharge:     me.MinimumCharge,
+		ReplacementFee:    me.ReplacementFee,
+	}
+}
+
+func (me PriceSchedule) samePrices(other PriceSchedule) bool {
+	other.From, other.Until = me.From, me.Until
+	return reflect.DeepEqual(me, other)
 }
 
 /*
@@ -25,28 +76,228 @@ type ProviderInfoService interface {
 
 		pis := NewProviderInfoService("settings.json")
 		pis.Get()
+
+	Settings failing validation are rejected. With Watch the file is reloaded on changes, settings failing validation
+	are ignored then and the previous ones are kept.
+	The price schedules are kept in memory, LoadPriceHistory keeps them in a file across restarts.
 */
 type FileProviderInfoService struct {
 	filename            string                      // JSON file where to read the settings from
+	filePath            string                      // Full path of the settings file
+	historyPath         string                      // JSON file with the price schedule history
+	lock                sync.RWMutex                // Guards the settings and the price history
 	serviceProviderInfo *models.StorageProviderInfo // Cached settings
+	priceHistory        []PriceSchedule
+	watcher             *fsnotify.Watcher
 }
 
-func NewProviderInfoService(filePath string) (ProviderInfoService, error) {
+const (
+	// How long replaced price schedules are kept, uploads started under them are verified with them during this time
+	PriceHistoryRetention = 7 * 24 * time.Hour
+
+	maxStorageDaysLimit = 100 * 365
+	maxGraceSeconds     = 365 * 24 * 60 * 60
+	reloadDelay         = 500 * time.Millisecond
+)
+
+var (
+	ErrInvalidMaxStorageDays = fmt.Errorf("maxStorageDays has to be between 1 and %d", maxStorageDaysLimit)
+	ErrInvalidGraceSeconds   = fmt.Errorf("graceSeconds has to be between 0 and %d", maxGraceSeconds)
+	ErrInvalidMaxFileSize    = errors.New("maxFileSizeByte can't be negative")
+	ErrInvalidCapacity       = errors.New("capacityByte and lowWaterMarkByte can't be negative and lowWaterMarkByte has to be below capacityByte")
+)
+
+func NewProviderInfoService(filePath string) (*FileProviderInfoService, error) {
 	providerInfoService := &FileProviderInfoService{
 		filename: filepath.Base(filePath),
+		filePath: filePath,
 	}
 
+	info, err := readProviderInfo(filePath)
+	providerInfoService.serviceProviderInfo = info
+	if err != nil {
+		return providerInfoService, err
+	}
+	if err = ValidateProviderInfo(*info); err != nil {
+		return providerInfoService, fmt.Errorf("invalid settings in %s: %v", filePath, err)
+	}
+	providerInfoService.updatePriceHistory(*info, time.Now())
+	return providerInfoService, nil
+}
+
+func readProviderInfo(filePath string) (*models.StorageProviderInfo, error) {
 	configFile, err := os.Open(filePath)
 	defer configFile.Close()
 	if err != nil {
-		return providerInfoService, errors.New("Can't open " + filePath + ". " + err.Error())
+		return nil, errors.New("Can't open " + filePath + ". " + err.Error())
 	}
+	var info *models.StorageProviderInfo
 	jsonParser := json.NewDecoder(configFile)
-	err = jsonParser.Decode(&providerInfoService.serviceProviderInfo)
-	return providerInfoService, err
+	err = jsonParser.Decode(&info)
+	if err == nil && info == nil {
+		err = errors.New("empty settings in " + filePath)
+	}
+	return info, err
+}
+
+// Checks that the prices convert to XESWei, tiers and discounts are ordered and the limits are sane
+func ValidateProviderInfo(info models.StorageProviderInfo) error {
+	if err := info.ValidatePricing(); err != nil {
+		return err
+	}
+	if info.MaxStorageDays < 1 || info.MaxStorageDays > maxStorageDaysLimit {
+		return ErrInvalidMaxStorageDays
+	}
+	if info.GraceSeconds < 0 || info.GraceSeconds > maxGraceSeconds {
+		return ErrInvalidGraceSeconds
+	}
+	if info.MaxFileSizeByte < 0 {
+		return ErrInvalidMaxFileSize
+	}
+	if info.CapacityByte < 0 || info.LowWaterMarkByte < 0 || (info.CapacityByte > 0 && info.LowWaterMarkByte >= info.CapacityByte) {
+		return ErrInvalidCapacity
+	}
+	return nil
 }
 
 // Returns Settings by value
 func (me *FileProviderInfoService) Get() models.StorageProviderInfo {
+	me.lock.RLock()
+	defer me.lock.RUnlock()
 	return *me.serviceProviderInfo
 }
+
+func (me *FileProviderInfoService) PriceScheduleAt(t time.Time) (PriceSchedule, bool) {
+	me.lock.RLock()
+	defer me.lock.RUnlock()
+	for _, s := range me.priceHistory {
+		if !t.Before(s.From) && (s.Until.IsZero() || t.Before(s.Until)) {
+			return s, true
+		}
+	}
+	return PriceSchedule{}, false
+}
+
+// Watches the directory of the settings file, editors often replace the file instead of writing to it
+func (me *FileProviderInfoService) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err = watcher.Add(filepath.Dir(me.filePath)); err != nil {
+		watcher.Close()
+		return err
+	}
+	me.watcher = watcher
+
+	go func() {
+		var reload <-chan time.Time
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Base(event.Name) == me.filename && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					// Wait for the writes to settle
+					reload = time.After(reloadDelay)
+				}
+			case <-reload:
+				reload = nil
+				if err := me.Reload(); err != nil {
+					log.Println("[providerInfoService][Watch] keeping previous settings: ", err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Println("[providerInfoService][Watch] ", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Reads and validates the settings file and replaces the current settings
+func (me *FileProviderInfoService) Reload() error {
+	info, err := readProviderInfo(me.filePath)
+	if err != nil {
+		return err
+	}
+	if err = ValidateProviderInfo(*info); err != nil {
+		return err
+	}
+	me.lock.Lock()
+	me.serviceProviderInfo = info
+	me.lock.Unlock()
+	me.updatePriceHistory(*info, time.Now())
+	log.Printf("[providerInfoService][Reload] settings reloaded, priceByte: %s | priceDay: %s | maxFileSizeByte: %d",
+		info.PriceByte, info.PriceDay, info.MaxFileSizeByte)
+	return nil
+}
+
+func (me *FileProviderInfoService) Close() error {
+	if me.watcher == nil {
+		return nil
+	}
+	return me.watcher.Close()
+}
+
+// Loads the price schedules of previous runs from path and keeps them there from now on
+func (me *FileProviderInfoService) LoadPriceHistory(path string) error {
+	bts, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var history []PriceSchedule
+	if len(bts) > 0 {
+		if err = json.Unmarshal(bts, &history); err != nil {
+			return err
+		}
+	}
+
+	me.lock.Lock()
+	current := me.priceHistory
+	me.historyPath = path
+	me.priceHistory = history
+	me.lock.Unlock()
+
+	// Continue with the current prices, a change since the last run starts a new schedule
+	if n := len(current); n > 0 {
+		me.updatePriceHistory(current[n-1].ProviderInfo(), time.Now())
+	}
+	return nil
+}
+
+// Starts a new price schedule if the prices changed and drops the ones past PriceHistoryRetention
+func (me *FileProviderInfoService) updatePriceHistory(info models.StorageProviderInfo, now time.Time) {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+
+	schedule := newPriceSchedule(info, now)
+	n := len(me.priceHistory)
+	if n > 0 && me.priceHistory[n-1].samePrices(schedule) {
+		return
+	}
+	if n > 0 {
+		me.priceHistory[n-1].Until = now
+	}
+	history := []PriceSchedule{}
+	for _, s := range me.priceHistory {
+		if now.Sub(s.Until) <= PriceHistoryRetention {
+			history = append(history, s)
+		}
+	}
+	me.priceHistory = append(history, schedule)
+
+	if me.historyPath == "" {
+		return
+	}
+	bts, err := json.MarshalIndent(me.priceHistory, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(me.historyPath, bts, 0600)
+	}
+	if err != nil {
+		log.Println("[providerInfoService][updatePriceHistory] couldn't save price history: ", err)
+	}
+}
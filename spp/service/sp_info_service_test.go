@@ -4,7 +4,11 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 
 	"github.com/ProxeusApp/storage-app/spp/client/models"
 )
@@ -25,7 +29,10 @@ func TestFileIsReadCorrectly(t *testing.T) {
 		t.Error(err)
 	}
 	jsonSettings := models.StorageProviderInfo{
-		Name: "Test settings",
+		Name:           "Test settings",
+		MaxStorageDays: 100,
+		PriceByte:      "0.001",
+		PriceDay:       "0.5",
 	}
 	b, _ := json.Marshal(jsonSettings)
 	file.Write(b)
@@ -46,3 +53,79 @@ func TestFileNonExistingReturnsAppropriateError(t *testing.T) {
 		t.Error("An error should be returned")
 	}
 }
+
+func TestInvalidSettingsAreRejected(t *testing.T) {
+	file, err := ioutil.TempFile(tmpPath, "settings-test-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(models.StorageProviderInfo{MaxStorageDays: 0})
+	file.Write(b)
+
+	_, err = NewProviderInfoService(file.Name())
+	assert.Error(t, err)
+}
+
+func TestReloadKeepsPriceHistory(t *testing.T) {
+	file, err := ioutil.TempFile(tmpPath, "settings-test-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSettings := func(info models.StorageProviderInfo) {
+		b, _ := json.Marshal(info)
+		if err := ioutil.WriteFile(file.Name(), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	valid := models.StorageProviderInfo{MaxStorageDays: 100, GraceSeconds: 60, PriceByte: "0.001", PriceDay: "0.5"}
+	writeSettings(valid)
+
+	settingsService, err := NewProviderInfoService(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	historyPath := filepath.Join(tmpPath, "price_history.json")
+	if err = settingsService.LoadPriceHistory(historyPath); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+
+	// invalid settings are rejected and the previous ones kept
+	invalid := valid
+	invalid.PriceByte = "0.0000000000000000001"
+	writeSettings(invalid)
+	assert.Error(t, settingsService.Reload())
+	assert.Equal(t, "0.001", settingsService.Get().PriceByte)
+
+	changed := valid
+	changed.PriceByte = "0.002"
+	writeSettings(changed)
+	assert.NoError(t, settingsService.Reload())
+	assert.Equal(t, "0.002", settingsService.Get().PriceByte)
+
+	// the schedule effective at a time is the only one returned for it
+	old, ok := settingsService.PriceScheduleAt(before)
+	if assert.True(t, ok) {
+		assert.Equal(t, "0.001", old.PriceByte)
+		assert.False(t, old.Until.IsZero())
+	}
+	current, ok := settingsService.PriceScheduleAt(time.Now())
+	if assert.True(t, ok) {
+		assert.Equal(t, "0.002", current.PriceByte)
+		assert.True(t, current.Until.IsZero())
+	}
+	_, ok = settingsService.PriceScheduleAt(before.Add(-time.Hour))
+	assert.False(t, ok)
+
+	// the history survives a restart
+	restarted, err := NewProviderInfoService(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = restarted.LoadPriceHistory(historyPath); err != nil {
+		t.Fatal(err)
+	}
+	old, ok = restarted.PriceScheduleAt(before)
+	assert.True(t, ok)
+	assert.Equal(t, "0.001", old.PriceByte)
+}
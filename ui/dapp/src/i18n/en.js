@@ -90,6 +90,7 @@ const translationEN = {
   'filebrowser.notify.fileRegistered': 'File already registered.',
   'filebrowser.notify.generic_error': 'An unexpected error occurred. Please try again.',
   'filebrowser.notify.noPgpAttached': 'Could not upload file because one of the selected signatories does not have a PGP key attached. This contact is not using the Proxeus DApp yet.',
+  'filebrowser.notify.pgpRevoked': 'Could not upload file because the PGP key of one of the selected signatories has been revoked. Ask the contact for the new key.',
   'filebrowser.notify.storageProviderNotFound': 'Please select a storage provider and try again.',
   'filebrowser.notify.tryAgain': 'Could not upload file. Please try again.',
   'filebrowser.notify.thumbnailRegistered': 'Thumbnail already registered.',
@@ -324,9 +325,11 @@ const translationEN = {
   'forgetwallet.modal.password': 'Please enter your password to export your keystore or forget your wallet.',
   'fileJS.transaction_queue.share.permissionDenied': 'There is no active account to share {filename} with {addresses}. Please logout and log in to your account',
   'fileJS.transaction_queue.share.pgpPublicKeyMissing': 'Could not share file. {addresses} has not created an account in the Proxeus Encrypted Storage DApp.',
+  'fileJS.transaction_queue.share.pgpPublicKeyRevoked': 'Could not share file. The PGP key of {addresses} has been revoked.',
   'fileJS.transaction_queue.share.noAddresses': 'No address provided. Please select an address',
   'fileJS.transaction_queue.unshare.permissionDenied': 'There is no active account to unshare {filename} with {addresses}. Please logout and log in to your account.',
   'fileJS.transaction_queue.unshare.pgpPublicKeyMissing': 'Could not unshare file. {addresses} has not created an account in the Proxeus Encrypted Storage DApp.',
+  'fileJS.transaction_queue.unshare.pgpPublicKeyRevoked': 'Could not unshare file. The PGP key of {addresses} has been revoked.',
   'password.hide.tooltip': 'Hide password',
   'password.show.tooltip': 'Show password',
   'password.please.use.a.strong.password.of.7.characters.or.more': 'Please use a strong password of 7 characters or more',
@@ -411,6 +414,8 @@ const translationEN = {
   'filebrowser.notifications.notification_file_grace_period_desc': 'File {fileName} has expired and is going to be deleted from the Storage Provider on {gracePeriodEndDate}.',
   'filebrowser.notifications.notification_file_expired': 'File has expired',
   'filebrowser.notifications.notification_file_expired_desc': 'File {fileName} has expired and was deleted from the Storage Provider.',
+  'filebrowser.notifications.notification_storage_proof_failed': 'Storage check failed',
+  'filebrowser.notifications.notification_storage_proof_failed_desc': 'The Storage Provider couldn\'t prove that it still stores file {fileName}.',
   'filebrowser.sidebar.expired_files': 'Expired files',
   'filegridview.dropdown.removeLocal': 'Locally remove file',
   'filebrowser.warning.removeFileLocal': 'Do you want to locally remove the file {filename}? This action can not be undone.',
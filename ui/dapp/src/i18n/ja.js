@@ -188,6 +188,7 @@ const translationJA = {
   'filebrowser.fileupload.sign_files': '通知',
   'filebrowser.fileupload.sign_files.no_sign_requests': '署名できるファイルがありません',
   'filebrowser.notify.noPgpAttached': '選択された署名者の一つにPGP鍵が添付されていないため、ファイルをアップロードできませんでした。この連絡先はまだ分散型アプリ「Proxeus」を使用していません。',
+  'filebrowser.notify.pgpRevoked': '選択された署名者の一つのPGP鍵が失効しているため、ファイルをアップロードできませんでした。連絡先に新しい鍵を確認してください。',
   'filebrowser.sidebar.all_files': '全ファイル',
   'filebrowser.sidebar.my_files': '自分のファイル',
   'filebrowser.sidebar.signed_by_me': '自分で署名',
@@ -298,9 +299,11 @@ const translationJA = {
   'forgetwallet.modal.password': 'キーストアをエクスポートする、またはウォレットを忘れたときのためにパスワードを入力してください。',
   'fileJS.transaction_queue.share.permissionDenied': '{filename} を {addresses} と共有するアクティブなアカウントはありません。自分のアカウントからログアウトして、ログインし直してください',
   'fileJS.transaction_queue.share.pgpPublicKeyMissing': 'ファイルを共有できませんでした。{addresses} は「Proxeus Encrypted Storage DApp」のアカウントを作成していません。',
+  'fileJS.transaction_queue.share.pgpPublicKeyRevoked': 'ファイルを共有できませんでした。{addresses} のPGP鍵は失効しています。',
   'fileJS.transaction_queue.share.noAddresses': 'アドレスが提供されていません。アドレスを選択してください',
   'fileJS.transaction_queue.unshare.permissionDenied': '{filename} の {addresses} との共有を解除できるアクティブなアカウントがありません。自分のアカウントからログアウトして、ログインし直してください。',
   'fileJS.transaction_queue.unshare.pgpPublicKeyMissing': 'ファイルの共有を解除できませんでした。{addresses} は「Proxeus Encrypted Storage DApp」のアカウントを作成していません。',
+  'fileJS.transaction_queue.unshare.pgpPublicKeyRevoked': 'ファイルの共有を解除できませんでした。{addresses} のPGP鍵は失効しています。',
   'password.hide.tooltip': 'パスワードを隠す',
   'password.show.tooltip': 'パスワードを表示',
   'password.please.use.a.strong.password.of.7.characters.or.more': '7文字以上の強固なパスワードを使用してください',
@@ -71,6 +71,10 @@ const getDefaultState = () => {
         'name': 'filebrowser.notifications.notification_file_expired',
         'desc': 'filebrowser.notifications.notification_file_expired_desc'
       },
+      'storage_proof_failed': {
+        'name': 'filebrowser.notifications.notification_storage_proof_failed',
+        'desc': 'filebrowser.notifications.notification_storage_proof_failed_desc'
+      },
       'tx_xes_send': {
         'name': 'filebrowser.notifications.notification_tx_xes_send',
         'desc': 'filebrowser.notifications.notification_tx_xes_send_desc'